@@ -17,8 +17,6 @@ var (
 const versionString = "N/A"
 
 func main() {
-	printBuildInfo()
-
 	code := run()
 	if code != 0 {
 		if err := os.Setenv("EXIT_CODE", fmt.Sprintf("%d", code)); err != nil {
@@ -43,6 +41,21 @@ func defaultIfEmpty(value, defaultValue string) string {
 
 func run() int {
 	opt := flags.ParseFlags()
+	// Режимы проверки и вывода настроек: ParseFlags уже завершил процесс,
+	// если настройки некорректны
+	if opt.PrintConfig {
+		if err := opt.WriteConfig(os.Stdout); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			return 1
+		}
+		return 0
+	}
+	if opt.CheckConfig {
+		fmt.Println("configuration is valid")
+		return 0
+	}
+	printBuildInfo()
+
 	if err := app.New(opt).Run(); err != nil {
 		fmt.Fprintf(os.Stderr, "error: %v\n", err)
 		return 1
@@ -1,44 +1,139 @@
-// Package main предоставляет утилиту для генерации ключей шифрования
+// Package main предоставляет утилиту для генерации ключей шифрования.
+//
+// Генерация пары ключей:
+//
+//	keygen [-type rsa|x25519] [-bits 2048] [-private private.pem] [-public public.pem]
+//	       [-passphrase-file file] [-force]
+//
+// Отпечаток ключа (значение заголовка X-Key-ID):
+//
+//	keygen fingerprint [-passphrase-file file] key.pem
+//
+// Пароль для шифрования приватного ключа также можно передать
+// через переменную окружения CRYPTO_KEY_PASSPHRASE.
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"os"
+	"strings"
 
 	"github.com/sanek1/metrics-collector/internal/crypto"
 )
 
 func main() {
-	var privateKeyPath string
-	var publicKeyPath string
+	if err := run(os.Args[1:], os.Stdout); err != nil {
+		fmt.Fprintf(os.Stderr, "keygen: %v\n", err)
+		exit(1)
+	}
+}
+
+func exit(code int) {
+	os.Exit(code)
+}
+
+func run(args []string, out io.Writer) error {
+	if len(args) > 0 && args[0] == "fingerprint" {
+		return runFingerprint(args[1:], out)
+	}
+	return runGenerate(args, out)
+}
+
+func runGenerate(args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("keygen", flag.ContinueOnError)
+	keyType := fs.String("type", crypto.KeyTypeRSA, "key type: rsa or x25519")
+	bits := fs.Int("bits", crypto.DefaultRSABits, "RSA key size in bits")
+	privateKeyPath := fs.String("private", "private.pem", "path to save private key")
+	publicKeyPath := fs.String("public", "public.pem", "path to save public key")
+	passphraseFile := fs.String("passphrase-file", "", "file with passphrase to encrypt private key")
+	force := fs.Bool("force", false, "overwrite existing key files")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
 
-	flag.StringVar(&privateKeyPath, "private", "private.pem", "path to save private key")
-	flag.StringVar(&publicKeyPath, "public", "public.pem", "path to save public key")
-	flag.Parse()
+	passphrase, err := readPassphrase(*passphraseFile)
+	if err != nil {
+		return err
+	}
 
-	fmt.Printf("generation RSA keys:\n")
-	fmt.Printf("private key: %s\n", privateKeyPath)
-	fmt.Printf("public key: %s\n", publicKeyPath)
+	fmt.Fprintf(out, "generation %s keys:\n", strings.ToUpper(*keyType))
+	fmt.Fprintf(out, "private key: %s\n", *privateKeyPath)
+	fmt.Fprintf(out, "public key: %s\n", *publicKeyPath)
 
-	if _, err := os.Stat(privateKeyPath); err == nil {
-		fmt.Printf("file %s already exists, will be overwritten\n", privateKeyPath)
+	privateKey, err := crypto.GenerateKey(*keyType, *bits)
+	if err != nil {
+		return err
 	}
-	if _, err := os.Stat(publicKeyPath); err == nil {
-		fmt.Printf("file %s already exists, will be overwritten\n", publicKeyPath)
+	if err := crypto.WriteKeyPair(privateKey, passphrase, *privateKeyPath, *publicKeyPath, *force); err != nil {
+		if errors.Is(err, crypto.ErrKeyExists) {
+			return fmt.Errorf("%w (use -force to overwrite)", err)
+		}
+		return err
 	}
 
-	if err := crypto.GenerateKeyPair(privateKeyPath, publicKeyPath); err != nil {
-		fmt.Printf("error generating keys: %v\n", err)
-		os.Exit(1)
+	id, err := crypto.Fingerprint(privateKey.Public().(crypto.PublicKey))
+	if err != nil {
+		return err
 	}
 
-	fmt.Printf("keys generated successfully!\n")
-	fmt.Printf("\nusage on server:\n")
-	fmt.Printf("  run server with flag: -crypto-key=%s\n", privateKeyPath)
-	fmt.Printf("  or set environment variable: CRYPTO_KEY=%s\n", privateKeyPath)
+	fmt.Fprintf(out, "keys generated successfully!\n")
+	fmt.Fprintf(out, "fingerprint: %s\n", id)
+	if len(passphrase) > 0 {
+		fmt.Fprintf(out, "private key is encrypted, pass the passphrase to the server via CRYPTO_KEY_PASSPHRASE\n")
+	}
+	fmt.Fprintf(out, "\nusage on server:\n")
+	fmt.Fprintf(out, "  run server with flag: -crypto-key=%s\n", *privateKeyPath)
+	fmt.Fprintf(out, "  or set environment variable: CRYPTO_KEY=%s\n", *privateKeyPath)
 
-	fmt.Printf("\nusage on agent:\n")
-	fmt.Printf("  run agent with flag: -crypto-key=%s\n", publicKeyPath)
-	fmt.Printf("  or set environment variable: CRYPTO_KEY=%s\n", publicKeyPath)
+	fmt.Fprintf(out, "\nusage on agent:\n")
+	fmt.Fprintf(out, "  run agent with flag: -crypto-key=%s\n", *publicKeyPath)
+	fmt.Fprintf(out, "  or set environment variable: CRYPTO_KEY=%s\n", *publicKeyPath)
+	return nil
+}
+
+func runFingerprint(args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("keygen fingerprint", flag.ContinueOnError)
+	passphraseFile := fs.String("passphrase-file", "", "file with passphrase of encrypted private key")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: keygen fingerprint [-passphrase-file file] key.pem")
+	}
+
+	path := fs.Arg(0)
+	publicKey, err := crypto.LoadPublicKey(path)
+	if err != nil {
+		passphrase, perr := readPassphrase(*passphraseFile)
+		if perr != nil {
+			return perr
+		}
+		privateKey, perr := crypto.LoadPrivateKey(path, passphrase)
+		if perr != nil {
+			return fmt.Errorf("%s is neither a public nor a private key: %w", path, perr)
+		}
+		publicKey = privateKey.Public().(crypto.PublicKey)
+	}
+
+	id, err := crypto.Fingerprint(publicKey)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "%s  %s  %s\n", id, crypto.KeyType(publicKey), path)
+	return nil
+}
+
+// readPassphrase читает пароль из файла или переменной окружения CRYPTO_KEY_PASSPHRASE.
+func readPassphrase(path string) ([]byte, error) {
+	if path == "" {
+		return []byte(os.Getenv("CRYPTO_KEY_PASSPHRASE")), nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading passphrase: %w", err)
+	}
+	return []byte(strings.TrimRight(string(data), "\r\n")), nil
 }
@@ -1,11 +1,15 @@
 package main
 
 import (
+	"bytes"
+	"io"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/sanek1/metrics-collector/internal/crypto"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
@@ -26,3 +30,48 @@ func TestGenerateKeyPair(t *testing.T) {
 	err = crypto.GenerateKeyPair(privateKeyPath, publicKeyPath)
 	require.NoError(t, err, "error rewriting key pair")
 }
+
+func TestRunGenerate(t *testing.T) {
+	dir := t.TempDir()
+	privateKeyPath := filepath.Join(dir, "private.pem")
+	publicKeyPath := filepath.Join(dir, "public.pem")
+	args := []string{"-type", "x25519", "-private", privateKeyPath, "-public", publicKeyPath}
+
+	var out bytes.Buffer
+	require.NoError(t, run(args, &out))
+	assert.Contains(t, out.String(), "fingerprint: ")
+
+	info, err := os.Stat(privateKeyPath)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	err = run(args, &out)
+	require.ErrorIs(t, err, crypto.ErrKeyExists, "existing keys must not be overwritten without -force")
+
+	require.NoError(t, run(append(args, "-force"), &out))
+
+	err = run([]string{"-bits", "1024", "-private", filepath.Join(dir, "weak.pem"), "-public", filepath.Join(dir, "weak.pub")}, &out)
+	assert.Error(t, err)
+}
+
+func TestRunFingerprint(t *testing.T) {
+	dir := t.TempDir()
+	privateKeyPath := filepath.Join(dir, "private.pem")
+	publicKeyPath := filepath.Join(dir, "public.pem")
+	passphraseFile := filepath.Join(dir, "passphrase")
+	require.NoError(t, os.WriteFile(passphraseFile, []byte("secret\n"), 0600))
+
+	require.NoError(t, run([]string{"-bits", "3072", "-passphrase-file", passphraseFile,
+		"-private", privateKeyPath, "-public", publicKeyPath}, io.Discard))
+
+	var pubOut bytes.Buffer
+	require.NoError(t, run([]string{"fingerprint", publicKeyPath}, &pubOut))
+	assert.Contains(t, pubOut.String(), " rsa ")
+
+	err := run([]string{"fingerprint", privateKeyPath}, io.Discard)
+	require.ErrorIs(t, err, crypto.ErrPassphraseRequired)
+
+	var privOut bytes.Buffer
+	require.NoError(t, run([]string{"fingerprint", "-passphrase-file", passphraseFile, privateKeyPath}, &privOut))
+	assert.Equal(t, strings.Fields(pubOut.String())[0], strings.Fields(privOut.String())[0])
+}
@@ -0,0 +1,246 @@
+// Package main предоставляет утилиту для переноса метрик между хранилищами сервера.
+//
+// Использование:
+//
+//	migrate-store -from SOURCE -to DESTINATION [-tenant id] [-merge] [-dry-run] [-verify=false]
+//
+// Хранилище задается путем к файлу резервной копии (можно с префиксом file:)
+// или строкой подключения к PostgreSQL (postgres://... или host=... dbname=...).
+// Поддерживаются переносы файл -> PostgreSQL, PostgreSQL -> файл
+// и PostgreSQL -> PostgreSQL.
+//
+// Файл источника читается так же, как при запуске сервера: из резервной копии
+// и журнала упреждающей записи. Файл назначения дополняется и сохраняется
+// атомарно, прежняя копия остается в файле с суффиксом .1. Сервер, использующий
+// файл назначения, на время переноса должен быть остановлен.
+//
+// По умолчанию у переносимых арендаторов в назначении не должно быть метрик,
+// иначе перенос не начинается: повторный запуск после частичного сбоя
+// удвоил бы значения счетчиков. В этом случае очистите назначение
+// и запустите перенос снова. С -merge метрики добавляются к существующим:
+// значения счетчиков в назначении увеличиваются на значения из источника,
+// значения gauge заменяются, что позволяет объединить несколько серверов.
+// После переноса число метрик и контрольная сумма назначения сравниваются
+// с ожидаемыми; -dry-run только выводит их.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"github.com/sanek1/metrics-collector/internal/flags/config"
+	flags "github.com/sanek1/metrics-collector/internal/flags/server"
+	storage "github.com/sanek1/metrics-collector/internal/storage/server"
+	"github.com/sanek1/metrics-collector/internal/storage/transfer"
+	"github.com/sanek1/metrics-collector/internal/tenant"
+	"github.com/sanek1/metrics-collector/pkg/logging"
+)
+
+func main() {
+	if err := run(context.Background(), os.Args[1:], os.Stdout); err != nil {
+		fmt.Fprintf(os.Stderr, "migrate-store: %v\n", err)
+		exit(1)
+	}
+}
+
+func exit(code int) {
+	os.Exit(code)
+}
+
+func run(ctx context.Context, args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("migrate-store", flag.ContinueOnError)
+	from := fs.String("from", "", "source: backup file path or PostgreSQL connection string")
+	to := fs.String("to", "", "destination: backup file path or PostgreSQL connection string")
+	tenantID := fs.String("tenant", "", "copy only this tenant, by default all tenants are copied")
+	dryRun := fs.Bool("dry-run", false, "read the source and print counts and checksums without writing")
+	verify := fs.Bool("verify", true, "compare destination counts and checksums after copying")
+	merge := fs.Bool("merge", false, "add to metrics already in the destination: counters are summed, gauges replaced")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("unknown arguments: %v", fs.Args())
+	}
+	if *from == "" || *to == "" {
+		return fmt.Errorf("both -from and -to must be set")
+	}
+
+	src, err := parseBackend(*from)
+	if err != nil {
+		return fmt.Errorf("-from: %w", err)
+	}
+	dst, err := parseBackend(*to)
+	if err != nil {
+		return fmt.Errorf("-to: %w", err)
+	}
+	if src == dst {
+		return fmt.Errorf("source and destination are the same")
+	}
+	if src.kind == kindFile {
+		if _, err := os.Stat(src.target); err != nil {
+			return fmt.Errorf("open source: %w", err)
+		}
+	}
+
+	logger, err := logging.NewZapLogger(zap.WarnLevel)
+	if err != nil {
+		return err
+	}
+
+	source, closeSource, err := src.open(ctx, logger, false)
+	if err != nil {
+		return fmt.Errorf("open source: %w", err)
+	}
+	defer closeSource()
+	destination, closeDestination, err := dst.open(ctx, logger, !*dryRun)
+	if err != nil {
+		return fmt.Errorf("open destination: %w", err)
+	}
+	defer closeDestination()
+
+	opt := transfer.Options{DryRun: *dryRun, Verify: *verify, Merge: *merge}
+	if *tenantID != "" {
+		opt.Tenants = []string{*tenantID}
+	}
+	reports, copyErr := transfer.Copy(ctx, source, destination, opt)
+	printReports(out, src, dst, reports, opt)
+	if copyErr != nil {
+		return copyErr
+	}
+
+	if *dryRun {
+		fmt.Fprintln(out, "dry run: nothing was written")
+		return nil
+	}
+	if err := dst.save(destination); err != nil {
+		return fmt.Errorf("save destination: %w", err)
+	}
+	if opt.Verify && dst.kind == kindFile {
+		return verifyFile(ctx, logger, dst, reports)
+	}
+	return nil
+}
+
+func printReports(out io.Writer, src, dst backend, reports []transfer.TenantReport, opt transfer.Options) {
+	fmt.Fprintf(out, "%s -> %s\n", src, dst)
+	for _, r := range reports {
+		status := "copied"
+		switch {
+		case opt.DryRun:
+			status = "dry run"
+		case r.Verified:
+			status = "verified"
+		}
+		fmt.Fprintf(out, "tenant %s: source %d metrics %s, destination expected %d metrics %s: %s\n",
+			r.Tenant, r.Source, r.Checksum, r.Expected, r.ExpectedChecksum, status)
+	}
+}
+
+// verifyFile перечитывает сохраненный файл назначения и сравнивает его
+// с ожидаемыми метриками, чтобы проверка охватывала и запись на диск.
+func verifyFile(ctx context.Context, logger *logging.ZapLogger, dst backend, reports []transfer.TenantReport) error {
+	saved, closeSaved, err := dst.open(ctx, logger, false)
+	if err != nil {
+		return fmt.Errorf("verify destination: %w", err)
+	}
+	defer closeSaved()
+
+	for _, r := range reports {
+		count, checksum, err := transfer.Summarize(tenant.WithTenant(ctx, r.Tenant), saved)
+		if err != nil {
+			return fmt.Errorf("verify destination: %w", err)
+		}
+		if count != r.Expected || checksum != r.ExpectedChecksum {
+			return fmt.Errorf("verify destination file: tenant %s: %w", r.Tenant, transfer.ErrVerification)
+		}
+	}
+	return nil
+}
+
+type backendKind int
+
+const (
+	kindFile backendKind = iota
+	kindPostgres
+)
+
+// backend - хранилище, заданное в командной строке
+type backend struct {
+	kind backendKind
+	// target - путь к файлу или строка подключения
+	target string
+}
+
+// parseBackend определяет вид хранилища по строке из командной строки.
+func parseBackend(spec string) (backend, error) {
+	switch {
+	case strings.HasPrefix(spec, "file:"):
+		path := strings.TrimPrefix(spec, "file:")
+		if path == "" {
+			return backend{}, fmt.Errorf("empty file path")
+		}
+		return backend{kind: kindFile, target: path}, nil
+	case strings.HasPrefix(spec, "postgres://"), strings.HasPrefix(spec, "postgresql://"), strings.Contains(spec, "="):
+		return backend{kind: kindPostgres, target: spec}, nil
+	default:
+		return backend{kind: kindFile, target: spec}, nil
+	}
+}
+
+// String описывает хранилище для вывода, скрывая пароль в строке подключения.
+func (b backend) String() string {
+	if b.kind == kindFile {
+		return "file " + b.target
+	}
+	return "postgres " + config.RedactDSN(b.target)
+}
+
+// open открывает хранилище. Файл загружается в память вместе с журналом;
+// в базе данных назначения при prepare применяются миграции схемы.
+func (b backend) open(ctx context.Context, logger *logging.ZapLogger, prepare bool) (storage.Storage, func(), error) {
+	if b.kind == kindFile {
+		ms := storage.NewMetricsStorage(logger)
+		if err := ms.RestoreFromFile(b.target); err != nil {
+			return nil, nil, err
+		}
+		return ms, func() {}, nil
+	}
+
+	db := storage.NewDBStorage(&flags.ServerOptions{DBPath: b.target, UseDatabase: true}, logger)
+	if !db.PingIsOk() {
+		_ = db.Close()
+		return nil, nil, fmt.Errorf("cannot connect to %s", config.RedactDSN(b.target))
+	}
+	if prepare {
+		if err := db.EnsureMetricsTableExists(ctx); err != nil {
+			_ = db.Close()
+			return nil, nil, fmt.Errorf("apply migrations: %w", err)
+		}
+	}
+	return db, func() { _ = db.Close() }, nil
+}
+
+// save сохраняет файл назначения. В базу данных метрики записываются сразу.
+func (b backend) save(s storage.Storage) error {
+	if b.kind != kindFile {
+		return nil
+	}
+	ms := s.(*storage.MetricsStorage)
+	// прежнее содержимое файла остается в копии .1, а предыдущие
+	// копии сервера сдвигаются, но не удаляются
+	keep := 1
+	for {
+		if _, err := os.Stat(fmt.Sprintf("%s.%d", b.target, keep)); err != nil {
+			break
+		}
+		keep++
+	}
+	ms.SetBackupRetention(keep)
+	return ms.SaveToFile(b.target)
+}
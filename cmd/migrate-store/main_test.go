@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	m "github.com/sanek1/metrics-collector/internal/models"
+	storage "github.com/sanek1/metrics-collector/internal/storage/server"
+	"github.com/sanek1/metrics-collector/internal/storage/transfer"
+	"github.com/sanek1/metrics-collector/internal/tenant"
+)
+
+func writeBackup(t *testing.T, path string, metrics map[string][]m.Metrics) {
+	t.Helper()
+	ms := storage.NewMetricsStorage(nil)
+	for id, list := range metrics {
+		for _, metric := range list {
+			ms.Metrics[storage.Key(id, metric.MType, metric.ID)] = metric
+		}
+	}
+	require.NoError(t, ms.SaveToFile(path))
+}
+
+func counter(id string, delta int64) m.Metrics {
+	return m.Metrics{ID: id, MType: m.TypeCounter, Delta: &delta}
+}
+
+func gauge(id string, value float64) m.Metrics {
+	return m.Metrics{ID: id, MType: m.TypeGauge, Value: &value}
+}
+
+func TestRun_FileToFile(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "server1.json")
+	dst := filepath.Join(dir, "shared.json")
+	writeBackup(t, src, map[string][]m.Metrics{
+		tenant.Default: {counter("billing", 5), gauge("load", 1.5)},
+		"acme":         {counter("billing", 7)},
+	})
+	writeBackup(t, dst, map[string][]m.Metrics{
+		tenant.Default: {counter("billing", 10), gauge("load", 9)},
+	})
+
+	var out bytes.Buffer
+	err := run(context.Background(), []string{"-from", src, "-to", "file:" + dst}, &out)
+	require.ErrorIs(t, err, transfer.ErrDestinationNotEmpty, "existing destination requires -merge")
+
+	out.Reset()
+	require.NoError(t, run(context.Background(), []string{"-from", src, "-to", "file:" + dst, "-merge"}, &out))
+	assert.Contains(t, out.String(), "tenant acme: source 1 metrics")
+	assert.Contains(t, out.String(), "verified")
+
+	restored := storage.NewMetricsStorage(nil)
+	require.NoError(t, restored.LoadFromFile(dst))
+	got, ok := restored.GetMetrics(context.Background(), m.TypeCounter, "billing")
+	require.True(t, ok)
+	assert.Equal(t, int64(15), *got.Delta, "counters of several servers are summed")
+	got, ok = restored.GetMetrics(context.Background(), m.TypeGauge, "load")
+	require.True(t, ok)
+	assert.Equal(t, 1.5, *got.Value)
+	got, ok = restored.GetMetrics(tenant.WithTenant(context.Background(), "acme"), m.TypeCounter, "billing")
+	require.True(t, ok)
+	assert.Equal(t, int64(7), *got.Delta)
+
+	_, err = os.Stat(dst + ".1")
+	assert.NoError(t, err, "previous destination file is kept")
+}
+
+func TestRun_DryRunAndTenant(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "server1.json")
+	dst := filepath.Join(dir, "shared.json")
+	writeBackup(t, src, map[string][]m.Metrics{
+		tenant.Default: {counter("billing", 5)},
+		"acme":         {counter("billing", 7)},
+	})
+
+	var out bytes.Buffer
+	require.NoError(t, run(context.Background(), []string{"-from", src, "-to", dst, "-dry-run"}, &out))
+	assert.Contains(t, out.String(), "dry run: nothing was written")
+	_, err := os.Stat(dst)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	out.Reset()
+	require.NoError(t, run(context.Background(), []string{"-from", src, "-to", dst, "-tenant", "acme"}, &out))
+	assert.NotContains(t, out.String(), "tenant default")
+
+	tenants, err := func() ([]string, error) {
+		restored := storage.NewMetricsStorage(nil)
+		require.NoError(t, restored.LoadFromFile(dst))
+		return restored.Tenants(context.Background())
+	}()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"acme"}, tenants)
+}
+
+func TestRun_Errors(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "server1.json")
+	writeBackup(t, src, nil)
+
+	testCases := []struct {
+		name string
+		args []string
+		err  string
+	}{
+		{name: "missing flags", args: []string{"-from", src}, err: "both -from and -to must be set"},
+		{name: "same backend", args: []string{"-from", src, "-to", "file:" + src}, err: "same"},
+		{name: "missing source", args: []string{"-from", filepath.Join(dir, "none.json"), "-to", src}, err: "open source"},
+		{name: "empty file path", args: []string{"-from", "file:", "-to", src}, err: "empty file path"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.ErrorContains(t, run(context.Background(), tc.args, io.Discard), tc.err)
+		})
+	}
+}
+
+func TestParseBackend(t *testing.T) {
+	testCases := []struct {
+		spec     string
+		expected backend
+	}{
+		{spec: "metrics.json", expected: backend{kind: kindFile, target: "metrics.json"}},
+		{spec: "file:/var/lib/metrics.json", expected: backend{kind: kindFile, target: "/var/lib/metrics.json"}},
+		{spec: "postgres://user:secret@db/metrics", expected: backend{kind: kindPostgres, target: "postgres://user:secret@db/metrics"}},
+		{spec: "host=db dbname=metrics", expected: backend{kind: kindPostgres, target: "host=db dbname=metrics"}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.spec, func(t *testing.T) {
+			b, err := parseBackend(tc.spec)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, b)
+		})
+	}
+
+	b, _ := parseBackend("postgres://user:secret@db/metrics")
+	assert.NotContains(t, b.String(), "secret")
+}
@@ -25,14 +25,7 @@ const (
 	versionString = "N/A"
 )
 
-// @title Metrics Collector API
-// @version 1.0
-// @description API для сбора и обработки метрик
-// @host localhost:8080
-// @BasePath /
 func main() {
-	printBuildInfo()
-
 	code := run()
 	if code != 0 {
 		if err := os.Setenv("EXIT_CODE", fmt.Sprintf("%d", code)); err != nil {
@@ -56,6 +49,22 @@ func defaultIfEmpty(value, versionString string) string {
 }
 
 func run() int {
+	opt := flags.ParseServerFlags()
+	// Режимы проверки и вывода настроек: ParseServerFlags уже завершил процесс,
+	// если настройки некорректны
+	if opt.PrintConfig {
+		if err := opt.WriteConfig(os.Stdout); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			return 1
+		}
+		return 0
+	}
+	if opt.CheckConfig {
+		fmt.Println("configuration is valid")
+		return 0
+	}
+	printBuildInfo()
+
 	errCh := make(chan error, 2)
 
 	go func() {
@@ -72,14 +81,21 @@ func run() int {
 		}
 	}()
 
-	opt := flags.ParseServerFlags()
+	// Run возвращает nil после штатной остановки по сигналу
+	done := make(chan error, 1)
 	go func() {
-		if err := app.New(opt, opt.UseDatabase).Run(); err != nil {
-			errCh <- fmt.Errorf("error running server: %w", err)
-		}
+		done <- app.New(opt, opt.UseDatabase).Run()
 	}()
 
-	err := <-errCh
-	fmt.Fprintf(os.Stderr, "critical error: %v\n", err)
-	return 1
+	select {
+	case err := <-errCh:
+		fmt.Fprintf(os.Stderr, "critical error: %v\n", err)
+		return 1
+	case err := <-done:
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "critical error: error running server: %v\n", err)
+			return 1
+		}
+		return 0
+	}
 }
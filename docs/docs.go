@@ -1,120 +0,0 @@
-// Package docs Code generated by swaggo/swag. DO NOT EDIT
-package docs
-
-import "github.com/swaggo/swag"
-
-const docTemplate = `{
-    "schemes": {{ marshal .Schemes }},
-    "swagger": "2.0",
-    "info": {
-        "description": "{{escape .Description}}",
-        "title": "{{.Title}}",
-        "contact": {},
-        "version": "{{.Version}}"
-    },
-    "host": "{{.Host}}",
-    "basePath": "{{.BasePath}}",
-    "paths": {
-        "/metrics": {
-            "get": {
-                "responses": {
-                    "200": {
-                        "description": "OK",
-                        "schema": {
-                            "$ref": "#/definitions/github_com_sanek1_metrics-collector_internal_models.Metrics"
-                        }
-                    },
-                    "400": {
-                        "description": "Bad Request",
-                        "schema": {
-                            "$ref": "#/definitions/github_com_sanek1_metrics-collector_internal_models.Metrics"
-                        }
-                    },
-                    "500": {
-                        "description": "Internal Server Error",
-                        "schema": {
-                            "$ref": "#/definitions/github_com_sanek1_metrics-collector_internal_models.Metrics"
-                        }
-                    }
-                }
-            }
-        },
-        "/value/{metricType}/{metricName}": {
-            "get": {
-                "description": "Возвращает значение метрики по имени и типу",
-                "produces": [
-                    "application/json"
-                ],
-                "tags": [
-                    "Metrics"
-                ],
-                "summary": "Получить значение метрики",
-                "parameters": [
-                    {
-                        "type": "string",
-                        "description": "Тип метрики",
-                        "name": "metricType",
-                        "in": "path",
-                        "required": true
-                    },
-                    {
-                        "type": "string",
-                        "description": "Имя метрики",
-                        "name": "metricName",
-                        "in": "path",
-                        "required": true
-                    }
-                ],
-                "responses": {
-                    "200": {
-                        "description": "OK",
-                        "schema": {
-                            "$ref": "#/definitions/github_com_sanek1_metrics-collector_internal_models.Metrics"
-                        }
-                    }
-                }
-            }
-        }
-    },
-    "definitions": {
-        "github_com_sanek1_metrics-collector_internal_models.Metrics": {
-            "type": "object",
-            "properties": {
-                "delta": {
-                    "description": "Count of the metric",
-                    "type": "integer"
-                },
-                "id": {
-                    "description": "Name of the metric",
-                    "type": "string"
-                },
-                "type": {
-                    "description": "Type of the metric",
-                    "type": "string"
-                },
-                "value": {
-                    "description": "Gauge value",
-                    "type": "number"
-                }
-            }
-        }
-    }
-}`
-
-// SwaggerInfo holds exported Swagger Info so clients can modify it
-var SwaggerInfo = &swag.Spec{
-	Version:          "1.0",
-	Host:             "localhost:8080",
-	BasePath:         "/",
-	Schemes:          []string{"http", "https"},
-	Title:            "Metrics Collector API",
-	Description:      "Сервис для сбора и мониторинга метрик",
-	InfoInstanceName: "swagger",
-	SwaggerTemplate:  docTemplate,
-	LeftDelim:        "{{",
-	RightDelim:       "}}",
-}
-
-func init() {
-	swag.Register(SwaggerInfo.InstanceName(), SwaggerInfo)
-}
@@ -0,0 +1,59 @@
+// Package apierror формирует ответы с ошибками HTTP API в едином формате
+// models.ErrorResponse с полями code, message и details.
+package apierror
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	m "github.com/sanek1/metrics-collector/internal/models"
+)
+
+// Коды ошибок
+const (
+	CodeBadRequest           = "bad_request"
+	CodeInvalidMetric        = "invalid_metric"
+	CodeInvalidHash          = "invalid_hash"
+	CodeNotFound             = "not_found"
+	CodeUnauthorized         = "unauthorized"
+	CodeForbidden            = "forbidden"
+	CodePayloadTooLarge      = "payload_too_large"
+	CodeUnsupportedMediaType = "unsupported_media_type"
+	CodeStorageUnavailable   = "storage_unavailable"
+	CodeInternal             = "internal_error"
+)
+
+// New создает тело ответа с ошибкой. Непустые детали объединяются через "; ".
+func New(code, message string, details ...string) m.ErrorResponse {
+	return m.ErrorResponse{
+		Code:    code,
+		Message: message,
+		Details: joinDetails(details),
+	}
+}
+
+// Abort прерывает обработку запроса gin и отвечает ошибкой с указанным статусом.
+func Abort(c *gin.Context, status int, code, message string, details ...string) {
+	c.AbortWithStatusJSON(status, New(code, message, details...))
+}
+
+// Write отвечает ошибкой через http.ResponseWriter для обработчиков net/http.
+func Write(rw http.ResponseWriter, status int, code, message string, details ...string) {
+	rw.Header().Set("Content-Type", "application/json; charset=utf-8")
+	rw.Header().Set("X-Content-Type-Options", "nosniff")
+	rw.WriteHeader(status)
+	_ = json.NewEncoder(rw).Encode(New(code, message, details...))
+}
+
+func joinDetails(details []string) string {
+	parts := details[:0:0]
+	for _, d := range details {
+		if d != "" {
+			parts = append(parts, d)
+		}
+	}
+	return strings.Join(parts, "; ")
+}
@@ -0,0 +1,43 @@
+package apierror
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	m "github.com/sanek1/metrics-collector/internal/models"
+)
+
+func TestNew(t *testing.T) {
+	assert.Equal(t, m.ErrorResponse{Code: CodeNotFound, Message: "missing"}, New(CodeNotFound, "missing"))
+	assert.Equal(t, "a; b", New(CodeBadRequest, "bad", "a", "", "b").Details)
+}
+
+func TestAbort(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+
+	Abort(c, http.StatusBadRequest, CodeInvalidMetric, "Invalid gauge value", "strconv.ParseFloat: invalid syntax")
+
+	assert.True(t, c.IsAborted())
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.JSONEq(t, `{"code":"invalid_metric","message":"Invalid gauge value","details":"strconv.ParseFloat: invalid syntax"}`, w.Body.String())
+}
+
+func TestWrite(t *testing.T) {
+	w := httptest.NewRecorder()
+
+	Write(w, http.StatusNotFound, CodeNotFound, "Not Implemented")
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Contains(t, w.Header().Get("Content-Type"), "application/json")
+	var body m.ErrorResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	assert.Equal(t, m.ErrorResponse{Code: CodeNotFound, Message: "Not Implemented"}, body)
+}
@@ -14,13 +14,17 @@ import (
 	"go.uber.org/zap"
 
 	ac "github.com/sanek1/metrics-collector/internal/controller/agent"
+	"github.com/sanek1/metrics-collector/internal/crypto"
 	af "github.com/sanek1/metrics-collector/internal/flags/agent"
 	as "github.com/sanek1/metrics-collector/internal/storage/agent"
+	"github.com/sanek1/metrics-collector/internal/tracing"
 	l "github.com/sanek1/metrics-collector/pkg/logging"
 )
 
 const (
 	countMetrics = 30
+	// flushTimeout - время на отправку накопленных метрик при остановке
+	flushTimeout = 10 * time.Second
 )
 
 type App struct {
@@ -35,28 +39,51 @@ func New(opt *af.Options) *App {
 	return &App{
 		controller: ctrl,
 		opt:        opt,
+		logger:     logger,
 	}
 }
 func (a *App) Run() error {
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
 	defer stop()
 
-	if err := a.startAgent(ctx); err != nil {
+	shutdownTracing, err := tracing.Setup(ctx, tracing.Options{
+		ServiceName: "metrics-agent",
+		Endpoint:    a.opt.TraceEndpoint,
+		File:        a.opt.TraceFile,
+	})
+	if err != nil {
+		a.logger.ErrorCtx(ctx, "Failed to set up tracing, continuing without exporting spans", zap.Error(err))
+	} else {
+		defer a.flushTraces(shutdownTracing)
+	}
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	if err := a.startAgent(ctx, hup); err != nil {
 		a.logger.ErrorCtx(ctx, "Error starting agent", zap.Error(err))
 		return err
 	}
 	return nil
 }
 
-func (a *App) startAgent(ctx context.Context) error {
+// flushTraces отправляет накопленные спаны перед завершением работы.
+func (a *App) flushTraces(shutdown tracing.ShutdownFunc) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := shutdown(ctx); err != nil {
+		a.logger.ErrorCtx(ctx, "Failed to flush traces", zap.Error(err))
+	}
+}
+
+func (a *App) startAgent(ctx context.Context, reloadCh <-chan os.Signal) error {
 	pollTick, reportTick, metrics, gpMetrics := initDataAgent(a.opt)
-	client := &http.Client{
-		Transport: &http.Transport{
-			MaxIdleConnsPerHost: 100,
-			IdleConnTimeout:     90 * time.Second,
-		},
-		Timeout: 10 * time.Second,
+	client, err := newHTTPClient(a.opt)
+	if err != nil {
+		return err
 	}
+	// pollCount - количество опросов, еще не принятых сервером
 	var pollCount int64 = 0
 
 	defer func() {
@@ -72,22 +99,102 @@ func (a *App) startAgent(ctx context.Context) error {
 			as.GetGopsuiteMetrics(gpMetrics)
 		case <-reportTick.C:
 			_, _ = fmt.Fprintf(os.Stdout, "--------- start response ---------\n\n")
-			a.controller.SendingCounterMetrics(ctx, &pollCount, client)
-			a.controller.SendingGaugeMetrics(ctx, metrics, client)
-			a.controller.SendingGaugeMetrics(ctx, gpMetrics, client)
+			a.report(ctx, client, &pollCount, metrics, gpMetrics)
 			_, _ = fmt.Fprintf(os.Stdout, "--------- end response ---------\n\n")
 			_, _ = fmt.Fprintf(os.Stdout, "--------- NEW ITERATION %d ---------> \n\n", pollCount)
 
+		case <-reloadCh:
+			a.reload(ctx, pollTick, reportTick)
+
 		case <-ctx.Done():
-			//a.logger.InfoCtx(ctx, "Agent stopped.", zap.String("signal", ctx.Err().Error()))
-			if a.controller != nil && gpMetrics != nil {
-				a.controller.SendingGaugeMetrics(ctx, gpMetrics, client)
-			}
+			a.flush(ctx, client, &pollCount, metrics, gpMetrics)
 			return nil
 		}
 	}
 }
 
+// reload перечитывает файл конфигурации и применяет адрес сервера, интервалы
+// и ограничение числа запросов. Вызывается в цикле агента между отправками,
+// поэтому настройки не меняются во время отправки метрик.
+// Изменения остальных параметров отклоняются с записью в журнал.
+func (a *App) reload(ctx context.Context, pollTick, reportTick *time.Ticker) {
+	next, err := af.Reload(a.opt)
+	if err != nil {
+		a.logger.ErrorCtx(ctx, "Failed to reload configuration, keeping current settings", zap.Error(err))
+		return
+	}
+
+	live, restart := a.opt.Changes(next)
+	if len(restart) > 0 {
+		a.logger.WarnCtx(ctx, "Configuration changes require restart and were not applied", zap.Strings("options", restart))
+	}
+	if len(live) == 0 {
+		a.logger.InfoCtx(ctx, "Configuration reloaded, no changes to apply")
+		return
+	}
+
+	a.opt.ApplyLive(next)
+	pollTick.Reset(time.Duration(a.opt.PollInterval) * time.Second)
+	reportTick.Reset(time.Duration(a.opt.ReportInterval) * time.Second)
+	a.logger.InfoCtx(ctx, "Configuration reloaded", zap.Strings("applied", live),
+		zap.String("address", a.opt.FlagRunAddr),
+		zap.Int64("poll_interval", a.opt.PollInterval),
+		zap.Int64("report_interval", a.opt.ReportInterval),
+		zap.Int64("rate_limit", a.opt.RateLimit))
+}
+
+// report отправляет накопленные метрики. Счетчик опросов уменьшается
+// только на значение, принятое сервером, поэтому при ошибке отправки
+// опросы учитываются в следующем отчете.
+func (a *App) report(ctx context.Context, client *http.Client, pollCount *int64, metrics, gpMetrics map[string]float64) {
+	if *pollCount > 0 {
+		sent := *pollCount
+		if err := a.controller.SendingCounterMetrics(ctx, &sent, client); err == nil {
+			*pollCount -= sent
+		}
+	}
+	if len(metrics) > 0 {
+		a.controller.SendingGaugeMetrics(ctx, metrics, client)
+	}
+	if len(gpMetrics) > 0 {
+		a.controller.SendingGaugeMetrics(ctx, gpMetrics, client)
+	}
+}
+
+// flush отправляет при остановке все метрики, собранные после последнего
+// отчета. Контекст остановки уже отменен, поэтому запросы выполняются
+// с отдельным ограничением flushTimeout.
+func (a *App) flush(ctx context.Context, client *http.Client, pollCount *int64, metrics, gpMetrics map[string]float64) {
+	flushCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), flushTimeout)
+	defer cancel()
+
+	a.logger.InfoCtx(flushCtx, "Agent stopping, flushing pending metrics", zap.Int64("poll_count", *pollCount))
+	a.report(flushCtx, client, pollCount, metrics, gpMetrics)
+	if *pollCount > 0 {
+		a.logger.ErrorCtx(flushCtx, "Failed to flush pending counters", zap.Int64("poll_count", *pollCount))
+		return
+	}
+	a.logger.InfoCtx(flushCtx, "Agent stopped")
+}
+
+func newHTTPClient(opt *af.Options) (*http.Client, error) {
+	transport := &http.Transport{
+		MaxIdleConnsPerHost: 100,
+		IdleConnTimeout:     90 * time.Second,
+	}
+	if opt.UseTLS() {
+		tlsConfig, err := crypto.ClientTLSConfig(opt.TLSCA, opt.TLSCert, opt.TLSKey)
+		if err != nil {
+			return nil, fmt.Errorf("tls configuration: %w", err)
+		}
+		transport.TLSClientConfig = tlsConfig
+	}
+	return &http.Client{
+		Transport: transport,
+		Timeout:   10 * time.Second,
+	}, nil
+}
+
 func startLogger() *l.ZapLogger {
 	ctx := context.Background()
 	logger, err := l.NewZapLogger(zap.DebugLevel)
@@ -3,11 +3,21 @@ package app
 import (
 	"context"
 	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 	"go.uber.org/zap"
 
 	af "github.com/sanek1/metrics-collector/internal/flags/agent"
@@ -316,3 +326,158 @@ func TestNewWithCustomLogger(t *testing.T) {
 	// Проверяем, что поле opt было установлено
 	assert.Equal(t, opt, app.opt)
 }
+
+func TestNewHTTPClient(t *testing.T) {
+	t.Run("plain http", func(t *testing.T) {
+		client, err := newHTTPClient(&af.Options{})
+		assert.NoError(t, err)
+		transport, ok := client.Transport.(*http.Transport)
+		assert.True(t, ok)
+		assert.Nil(t, transport.TLSClientConfig)
+	})
+
+	t.Run("https with system CA", func(t *testing.T) {
+		client, err := newHTTPClient(&af.Options{TLS: true})
+		assert.NoError(t, err)
+		transport, ok := client.Transport.(*http.Transport)
+		assert.True(t, ok)
+		assert.NotNil(t, transport.TLSClientConfig)
+	})
+
+	t.Run("missing CA file", func(t *testing.T) {
+		_, err := newHTTPClient(&af.Options{TLSCA: "missing-ca.pem"})
+		assert.Error(t, err)
+	})
+}
+
+// TestRun_FlushesPendingMetricsOnSignal проверяет, что по сигналу остановки
+// агент отправляет все метрики, собранные после последнего отчета, включая счетчик.
+func TestRun_FlushesPendingMetricsOnSignal(t *testing.T) {
+	var (
+		mu        sync.Mutex
+		pollCount int64
+		gauges    int
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if strings.HasPrefix(r.URL.Path, "/update/counter/PollCount/") {
+			delta, err := strconv.ParseInt(path.Base(r.URL.Path), 10, 64)
+			assert.NoError(t, err)
+			pollCount += delta
+			return
+		}
+		gauges++
+	}))
+	defer server.Close()
+
+	app := New(&af.Options{
+		FlagRunAddr:    strings.TrimPrefix(server.URL, "http://"),
+		PollInterval:   1,
+		ReportInterval: 60,
+	})
+	done := make(chan error, 1)
+	go func() {
+		done <- app.Run()
+	}()
+
+	// отчет не успевает отправиться, поэтому метрики уходят только при остановке
+	time.Sleep(1500 * time.Millisecond)
+	require.NoError(t, syscall.Kill(os.Getpid(), syscall.SIGTERM))
+
+	select {
+	case err := <-done:
+		require.NoError(t, err)
+	case <-time.After(15 * time.Second):
+		t.Fatal("agent did not stop after SIGTERM")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	// число опросов зависит от планировщика, важно лишь, что счетчик отправлен
+	assert.Positive(t, pollCount)
+	assert.Positive(t, gauges)
+}
+
+// TestReport_KeepsPollCountOnServerError проверяет, что опросы, не принятые
+// сервером, учитываются в следующем отчете.
+func TestReport_KeepsPollCountOnServerError(t *testing.T) {
+	var (
+		mu        sync.Mutex
+		fail      = true
+		pollCount int64
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if fail {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		delta, err := strconv.ParseInt(path.Base(r.URL.Path), 10, 64)
+		assert.NoError(t, err)
+		pollCount += delta
+	}))
+	defer server.Close()
+
+	app := New(&af.Options{FlagRunAddr: strings.TrimPrefix(server.URL, "http://")})
+	pending := int64(3)
+	app.report(context.Background(), server.Client(), &pending, nil, nil)
+	assert.EqualValues(t, 3, pending, "server error must not lose polls")
+
+	mu.Lock()
+	fail = false
+	mu.Unlock()
+	pending++
+	app.report(context.Background(), server.Client(), &pending, nil, nil)
+	assert.Zero(t, pending)
+	mu.Lock()
+	defer mu.Unlock()
+	assert.EqualValues(t, 4, pollCount)
+}
+
+// TestRun_ReloadOnSIGHUP проверяет, что по SIGHUP агент без перезапуска
+// переключается на новый адрес сервера и интервал отправки.
+func TestRun_ReloadOnSIGHUP(t *testing.T) {
+	for _, env := range []string{"ADDRESS", "REPORT_INTERVAL", "POLL_INTERVAL", "RATE_LIMIT", "TENANT", "AGENT_ID", "CONFIG"} {
+		t.Setenv(env, "")
+	}
+	var received atomic.Int64
+	oldServer := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	defer oldServer.Close()
+	newServer := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		received.Add(1)
+	}))
+	defer newServer.Close()
+
+	config := filepath.Join(t.TempDir(), "config.json")
+	app := New(&af.Options{
+		FlagRunAddr:    strings.TrimPrefix(oldServer.URL, "http://"),
+		PollInterval:   1,
+		ReportInterval: 60,
+		AgentID:        "test-agent",
+		ConfigPath:     config,
+	})
+	done := make(chan error, 1)
+	go func() {
+		done <- app.Run()
+	}()
+
+	require.NoError(t, os.WriteFile(config, []byte(`{
+		"address": "`+strings.TrimPrefix(newServer.URL, "http://")+`",
+		"report_interval": "1s",
+		"tenant": "team-b"
+	}`), 0600))
+	time.Sleep(100 * time.Millisecond)
+	require.NoError(t, syscall.Kill(os.Getpid(), syscall.SIGHUP))
+	assert.Eventually(t, func() bool { return received.Load() > 0 }, 5*time.Second, 20*time.Millisecond)
+
+	require.NoError(t, syscall.Kill(os.Getpid(), syscall.SIGTERM))
+	select {
+	case err := <-done:
+		require.NoError(t, err)
+	case <-time.After(15 * time.Second):
+		t.Fatal("agent did not stop after SIGTERM")
+	}
+	assert.Empty(t, app.opt.Tenant, "tenant requires restart and must not change")
+}
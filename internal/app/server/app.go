@@ -3,20 +3,30 @@ package app
 
 import (
 	"context"
+	"io"
 	"net/http"
+	"os"
 	"os/signal"
+	"sync"
 	"syscall"
 	"time"
 
 	_ "github.com/jackc/pgx/v5/stdlib"
 	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
 
 	sc "github.com/sanek1/metrics-collector/internal/controller/server"
+	"github.com/sanek1/metrics-collector/internal/crypto"
 	sf "github.com/sanek1/metrics-collector/internal/flags/server"
+	"github.com/sanek1/metrics-collector/internal/health"
 	ss "github.com/sanek1/metrics-collector/internal/storage/server"
+	"github.com/sanek1/metrics-collector/internal/tracing"
 	"github.com/sanek1/metrics-collector/pkg/logging"
 )
 
+// shutdownTimeout - время на завершение обрабатываемых запросов при остановке
+const shutdownTimeout = 10 * time.Second
+
 type App struct {
 	options     *sf.ServerOptions
 	useDatabase bool
@@ -32,11 +42,30 @@ func New(opt *sf.ServerOptions, useDatabase bool) *App {
 func (a *App) Run() error {
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
 	defer stop()
-	l, err := logging.NewZapLogger(zap.InfoLevel)
+	level, levelErr := zapcore.ParseLevel(a.options.LogLevel)
+	l, err := logging.NewZapLogger(level)
 	if err != nil {
 		panic(err)
 	}
 	ctx = l.WithContextFields(ctx, zap.String("app", "Server"))
+	if levelErr != nil {
+		l.ErrorCtx(ctx, "Wrong log level, using info", zap.Error(levelErr))
+	}
+	if err = a.options.ValidateTLS(); err != nil {
+		l.ErrorCtx(ctx, "Invalid TLS configuration", zap.Error(err))
+		return err
+	}
+
+	shutdownTracing, err := tracing.Setup(ctx, tracing.Options{
+		ServiceName: "metrics-server",
+		Endpoint:    a.options.TraceEndpoint,
+		File:        a.options.TraceFile,
+	})
+	if err != nil {
+		l.ErrorCtx(ctx, "Failed to set up tracing, continuing without exporting spans", zap.Error(err))
+	} else {
+		defer flushTraces(ctx, l, shutdownTracing)
+	}
 
 	storage := ss.GetStorage(a.useDatabase, a.options, l)
 	if a.useDatabase {
@@ -47,16 +76,45 @@ func (a *App) Run() error {
 
 	fs := ss.NewMetricsStorage(l)
 	ctrl := sc.NewController(fs, storage, a.options, l)
+	readiness := ctrl.Health()
+
+	// Фоновые задачи останавливаются только после завершения обрабатываемых
+	// запросов, чтобы последнее сохранение включало все принятые метрики.
+	bgCtx, stopBackground := context.WithCancel(context.WithoutCancel(ctx))
+	defer stopBackground()
+	var background sync.WaitGroup
 
-	if fs, ok := storage.(ss.FileStorage); ok {
-		go fs.PeriodicallySaveBackUp(ctx, a.options.Path, a.options.Restore, time.Duration(a.options.StoreInterval)*time.Second)
+	backup, hasBackup := storage.(ss.FileStorage)
+	if hasBackup {
+		if bc, ok := storage.(ss.BackupChecker); ok {
+			readiness.Register("backup", bc.CheckBackup)
+		}
+		if br, ok := storage.(ss.BackupRotator); ok {
+			br.SetBackupRetention(int(a.options.BackupKeep))
+		}
+		background.Add(1)
+		go func() {
+			defer background.Done()
+			backup.PeriodicallySaveBackUp(bgCtx, a.options.Path, a.options.Restore, time.Duration(a.options.StoreInterval)*time.Second)
+		}()
 	}
+	background.Add(1)
+	go func() {
+		defer background.Done()
+		a.watchReload(bgCtx, l, ctrl, storage)
+	}()
+
 	if dbs, ok := storage.(ss.DatabaseStorage); ok {
+		if hc, ok := storage.(ss.HealthChecker); ok {
+			readiness.Register("database", hc.CheckHealth)
+		}
 		if err = dbs.EnsureMetricsTableExists(ctx); err != nil {
 			l.ErrorCtx(ctx, "failed to ensure Metrics table exists", zap.Error(err))
+			readiness.Register("migrations", health.Failed(err))
 		}
 	}
 
+	// потоковый импорт снимает ограничения времени для своих запросов (validation.NoDeadlines)
 	server := &http.Server{
 		Addr:              a.options.FlagRunAddr,
 		Handler:           ctrl.Router(),
@@ -66,23 +124,143 @@ func (a *App) Run() error {
 		ReadHeaderTimeout: 5 * time.Second,
 	}
 
-	l.InfoCtx(ctx, "Running server"+a.options.FlagRunAddr, zap.String("address%s", a.options.FlagRunAddr))
-
-	err = server.ListenAndServe()
-	if err != nil {
-		l.FatalCtx(ctx, "Failed to start server", zap.Error(err))
+	if a.options.UseTLS() {
+		server.TLSConfig, err = crypto.ServerTLSConfig(a.options.TLSCert, a.options.TLSKey, a.options.TLSClientCA)
+		if err != nil {
+			l.ErrorCtx(ctx, "Failed to load TLS configuration", zap.Error(err))
+			stopBackground()
+			background.Wait()
+			a.release(ctx, l, storage)
+			return err
+		}
 	}
 
-	<-ctx.Done()
-	l.InfoCtx(ctx, "get signal to stop server")
+	l.InfoCtx(ctx, "Running server"+a.options.FlagRunAddr,
+		zap.String("address", a.options.FlagRunAddr),
+		zap.Bool("tls", a.options.UseTLS()),
+		zap.Bool("mtls", a.options.TLSClientCA != ""))
 
-	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	serveErr := make(chan error, 1)
+	go func() {
+		if a.options.UseTLS() {
+			serveErr <- server.ListenAndServeTLS("", "")
+		} else {
+			serveErr <- server.ListenAndServe()
+		}
+	}()
+	readiness.MarkReady()
+
+	select {
+	case err = <-serveErr:
+		l.ErrorCtx(ctx, "Failed to start server", zap.Error(err))
+	case <-ctx.Done():
+		l.InfoCtx(ctx, "get signal to stop server")
+		err = nil
+	}
+
+	// Готовность снимается до остановки, чтобы балансировщик перестал
+	// направлять запросы. Shutdown закрывает слушатель и ждет завершения
+	// обрабатываемых запросов, но не дольше shutdownTimeout.
+	readiness.MarkStopping()
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
 	defer cancel()
-	if err := server.Shutdown(shutdownCtx); err != nil {
-		l.FatalCtx(ctx, "Failed to shutdown server", zap.Error(err))
+	if shutdownErr := server.Shutdown(shutdownCtx); shutdownErr != nil {
+		l.ErrorCtx(ctx, "Failed to drain in-flight requests, closing connections", zap.Error(shutdownErr))
+		_ = server.Close()
 	}
 
+	stopBackground()
+	background.Wait()
+	if hasBackup {
+		a.saveFinalBackup(ctx, l, backup)
+	}
+	a.release(ctx, l, storage)
+
 	l.InfoCtx(ctx, "Server gracefully stopped")
+	return err
+}
 
-	return nil
+// watchReload перечитывает конфигурацию по сигналу SIGHUP до отмены ctx.
+func (a *App) watchReload(ctx context.Context, l *logging.ZapLogger, ctrl *sc.Controller, storage ss.Storage) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	current := a.options
+	for {
+		select {
+		case <-hup:
+			current = reload(ctx, l, current, ctrl, storage)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// reload перечитывает файл конфигурации и применяет параметры, которые меняются
+// без перезапуска: ключи, уровень журнала, интервал сохранения, число хранимых
+// резервных копий и ограничения размера тела. Изменения остальных параметров отклоняются с записью в журнал.
+// Возвращает настройки, действующие после перечитывания.
+func reload(ctx context.Context, l *logging.ZapLogger, current *sf.ServerOptions, ctrl *sc.Controller, storage ss.Storage) *sf.ServerOptions {
+	next, err := sf.Reload(current)
+	if err != nil {
+		l.ErrorCtx(ctx, "Failed to reload configuration, keeping current settings", zap.Error(err))
+		return current
+	}
+
+	live, restart := current.Changes(next)
+	if len(restart) > 0 {
+		l.WarnCtx(ctx, "Configuration changes require restart and were not applied", zap.Strings("options", restart))
+	}
+	if len(live) == 0 {
+		l.InfoCtx(ctx, "Configuration reloaded, no changes to apply")
+		return current
+	}
+
+	applied := current.WithLive(next)
+	if level, err := zapcore.ParseLevel(applied.LogLevel); err == nil {
+		l.SetLevel(level)
+	}
+	if bs, ok := storage.(ss.BackupScheduler); ok {
+		bs.SetBackupInterval(time.Duration(applied.StoreInterval) * time.Second)
+	}
+	if br, ok := storage.(ss.BackupRotator); ok {
+		br.SetBackupRetention(int(applied.BackupKeep))
+	}
+	if err := ctrl.Reload(applied); err != nil {
+		l.WarnCtx(ctx, "Failed to load private keys, keeping current keys", zap.Error(err))
+	}
+	l.InfoCtx(ctx, "Configuration reloaded", zap.Strings("applied", live))
+	return applied
+}
+
+// saveFinalBackup сохраняет метрики в файл после завершения всех запросов,
+// чтобы после перезапуска восстановились метрики, принятые после
+// последнего периодического сохранения.
+func (a *App) saveFinalBackup(ctx context.Context, l *logging.ZapLogger, backup ss.FileStorage) {
+	if err := backup.SaveToFile(a.options.Path); err != nil {
+		l.ErrorCtx(ctx, "Failed to save final backup", zap.String("path", a.options.Path), zap.Error(err))
+		return
+	}
+	l.InfoCtx(ctx, "Final backup saved", zap.String("path", a.options.Path))
+}
+
+// release закрывает соединения хранилища, например пул соединений с базой данных.
+func (a *App) release(ctx context.Context, l *logging.ZapLogger, storage ss.Storage) {
+	closer, ok := storage.(io.Closer)
+	if !ok {
+		return
+	}
+	if err := closer.Close(); err != nil {
+		l.ErrorCtx(ctx, "Failed to close storage", zap.Error(err))
+	}
+}
+
+// flushTraces отправляет накопленные спаны перед завершением работы.
+func flushTraces(ctx context.Context, l *logging.ZapLogger, shutdown tracing.ShutdownFunc) {
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := shutdown(shutdownCtx); err != nil {
+		l.ErrorCtx(ctx, "Failed to flush traces", zap.Error(err))
+	}
 }
@@ -2,11 +2,20 @@ package app
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"syscall"
 	"testing"
 	"time"
 
 	sf "github.com/sanek1/metrics-collector/internal/flags/server"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 type mockServer struct {
@@ -53,3 +62,121 @@ func TestApp_Run_MemoryStorage(t *testing.T) {
 	case <-ctx.Done():
 	}
 }
+
+func TestApp_Run_ClientCAWithoutCert(t *testing.T) {
+	options := &sf.ServerOptions{
+		FlagRunAddr: "127.0.0.1:0",
+		LogLevel:    "info",
+		TLSClientCA: "ca.crt",
+	}
+	err := New(options, false).Run()
+	assert.ErrorContains(t, err, "tls_client_ca")
+}
+
+// TestApp_Run_LosslessRestart проверяет, что по сигналу остановки сервер
+// сохраняет метрики в файл, а после перезапуска восстанавливает их.
+func TestApp_Run_LosslessRestart(t *testing.T) {
+	options := &sf.ServerOptions{
+		FlagRunAddr:   freeAddr(t),
+		Path:          filepath.Join(t.TempDir(), "metrics.json"),
+		StoreInterval: 300,
+		Restore:       true,
+	}
+	base := "http://" + options.FlagRunAddr
+
+	done := startApp(t, options)
+	resp, err := http.Post(base+"/update/counter/hits/5", "text/plain", nil)
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	stopApp(t, done)
+
+	data, err := os.ReadFile(options.Path)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"hits"`)
+
+	done = startApp(t, options)
+	resp, err = http.Get(base + "/value/counter/hits")
+	require.NoError(t, err)
+	body, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "5", string(body))
+	stopApp(t, done)
+}
+
+func freeAddr(t *testing.T) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+	return ln.Addr().String()
+}
+
+// startApp запускает сервер и ждет его готовности.
+func startApp(t *testing.T, options *sf.ServerOptions) <-chan error {
+	done := make(chan error, 1)
+	go func() {
+		done <- New(options, false).Run()
+	}()
+	require.Eventually(t, func() bool {
+		resp, err := http.Get("http://" + options.FlagRunAddr + "/readyz")
+		if err != nil {
+			return false
+		}
+		_ = resp.Body.Close()
+		return resp.StatusCode == http.StatusOK
+	}, 5*time.Second, 20*time.Millisecond)
+	return done
+}
+
+// stopApp отправляет процессу SIGTERM и ждет остановки сервера.
+func stopApp(t *testing.T, done <-chan error) {
+	require.NoError(t, syscall.Kill(os.Getpid(), syscall.SIGTERM))
+	select {
+	case err := <-done:
+		require.NoError(t, err)
+	case <-time.After(15 * time.Second):
+		t.Fatal("server did not stop after SIGTERM")
+	}
+}
+
+// TestApp_Run_ReloadOnSIGHUP проверяет, что по SIGHUP сервер применяет новый
+// ключ подписи без перезапуска, а изменение адреса отклоняет.
+func TestApp_Run_ReloadOnSIGHUP(t *testing.T) {
+	for _, env := range []string{"ADDRESS", "KEY", "CRYPTO_KEY", "STORE_INTERVAL", "RESTORE", "LOG_LEVEL"} {
+		t.Setenv(env, "")
+	}
+	dir := t.TempDir()
+	config := filepath.Join(dir, "config.json")
+	require.NoError(t, os.WriteFile(config, []byte(`{"crypto_key": "k1"}`), 0600))
+
+	options := &sf.ServerOptions{
+		FlagRunAddr:   freeAddr(t),
+		Path:          filepath.Join(dir, "metrics.json"),
+		StoreInterval: 300,
+		CryptoKey:     "k1",
+		ConfigPath:    config,
+	}
+	signature := func() string {
+		resp, err := http.Get("http://" + options.FlagRunAddr + "/api/v1/ping")
+		if err != nil {
+			return ""
+		}
+		_ = resp.Body.Close()
+		return resp.Header.Get("HashSHA256")
+	}
+	expected := func(key string) string {
+		sum := sha256.Sum256([]byte(key))
+		return hex.EncodeToString(sum[:])
+	}
+
+	done := startApp(t, options)
+	assert.Equal(t, expected("k1"), signature())
+
+	require.NoError(t, os.WriteFile(config, []byte(`{"crypto_key": "k2", "address": "127.0.0.1:1"}`), 0600))
+	require.NoError(t, syscall.Kill(os.Getpid(), syscall.SIGHUP))
+	assert.Eventually(t, func() bool { return signature() == expected("k2") }, 5*time.Second, 20*time.Millisecond,
+		"server should keep listening on the old address and sign with the new key")
+
+	stopApp(t, done)
+}
@@ -0,0 +1,233 @@
+// Package compression предоставляет кодеки сжатия тел HTTP-запросов и ответов
+// (gzip, zstd, snappy) и выбор кодировки по заголовку Accept-Encoding.
+package compression
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/klauspost/compress/s2"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Поддерживаемые кодировки
+const (
+	Gzip     = "gzip"
+	Zstd     = "zstd"
+	Snappy   = "snappy"
+	Identity = "identity"
+)
+
+// zstdMaxMemory ограничивает память декодера zstd, заявленную в заголовке кадра
+const zstdMaxMemory = 64 << 20
+
+// ErrUnsupported возвращается для неизвестной кодировки.
+var ErrUnsupported = errors.New("unsupported content encoding")
+
+// Codec сжимает и распаковывает потоки данных в одной кодировке.
+type Codec interface {
+	// Name возвращает название кодировки для заголовка Content-Encoding
+	Name() string
+	// NewWriter возвращает поток сжатия, Close обязательно вызывать
+	NewWriter(w io.Writer) io.WriteCloser
+	// NewReader возвращает поток распаковки
+	NewReader(r io.Reader) (io.ReadCloser, error)
+}
+
+// preference - кодировки в порядке предпочтения при равном весе в Accept-Encoding
+var preference = []string{Zstd, Snappy, Gzip}
+
+var codecs = map[string]Codec{
+	Gzip:   gzipCodec{},
+	Zstd:   zstdCodec{},
+	Snappy: snappyCodec{},
+}
+
+// Get возвращает кодек по названию кодировки.
+func Get(name string) (Codec, bool) {
+	c, ok := codecs[strings.ToLower(strings.TrimSpace(name))]
+	return c, ok
+}
+
+// Supported возвращает поддерживаемые кодировки в порядке предпочтения.
+func Supported() []string {
+	return append([]string(nil), preference...)
+}
+
+// AcceptEncoding возвращает значение заголовка Accept-Encoding
+// со всеми поддерживаемыми кодировками.
+func AcceptEncoding() string {
+	return strings.Join(preference, ", ")
+}
+
+// Compress сжимает данные в указанной кодировке.
+// Для пустой кодировки и identity данные возвращаются без изменений.
+func Compress(name string, data []byte) ([]byte, error) {
+	if name == "" || name == Identity {
+		return data, nil
+	}
+	c, ok := Get(name)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupported, name)
+	}
+	var buf bytes.Buffer
+	w := c.NewWriter(&buf)
+	if _, err := w.Write(data); err != nil {
+		_ = w.Close()
+		return nil, fmt.Errorf("%s compression: %w", name, err)
+	}
+	if err := w.Close(); err != nil {
+		return nil, fmt.Errorf("%s compression: %w", name, err)
+	}
+	return buf.Bytes(), nil
+}
+
+// NewReader возвращает поток распаковки для значения заголовка Content-Encoding.
+// Для пустой кодировки и identity поток возвращается без изменений.
+func NewReader(name string, r io.Reader) (io.ReadCloser, error) {
+	if name == "" || name == Identity {
+		return io.NopCloser(r), nil
+	}
+	c, ok := Get(name)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupported, name)
+	}
+	rc, err := c.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("%s decompression: %w", name, err)
+	}
+	return rc, nil
+}
+
+// Negotiate выбирает кодировку из заголовка Accept-Encoding с учетом весов (q).
+// При равном весе предпочтение отдается порядку Supported.
+// Возвращает пустую строку, если подходящей кодировки нет.
+func Negotiate(acceptEncoding string) string {
+	weights := make(map[string]float64)
+	wildcard := -1.0
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		name, q := parseEncoding(part)
+		switch {
+		case name == "":
+		case name == "*":
+			wildcard = q
+		default:
+			weights[name] = q
+		}
+	}
+
+	candidates := make([]string, 0, len(preference))
+	for _, name := range preference {
+		q, ok := weights[name]
+		if !ok {
+			q = wildcard
+		}
+		if q > 0 {
+			weights[name] = q
+			candidates = append(candidates, name)
+		}
+	}
+	if len(candidates) == 0 {
+		return ""
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return weights[candidates[i]] > weights[candidates[j]]
+	})
+	return candidates[0]
+}
+
+func parseEncoding(part string) (string, float64) {
+	name, params, _ := strings.Cut(part, ";")
+	name = strings.ToLower(strings.TrimSpace(name))
+	q := 1.0
+	for _, p := range strings.Split(params, ";") {
+		k, v, ok := strings.Cut(strings.TrimSpace(p), "=")
+		if ok && strings.EqualFold(k, "q") {
+			if parsed, err := strconv.ParseFloat(v, 64); err == nil {
+				q = parsed
+			}
+		}
+	}
+	return name, q
+}
+
+type gzipCodec struct{}
+
+var gzipWriters = sync.Pool{New: func() any { return gzip.NewWriter(io.Discard) }}
+
+func (gzipCodec) Name() string { return Gzip }
+
+func (gzipCodec) NewWriter(w io.Writer) io.WriteCloser {
+	zw := gzipWriters.Get().(*gzip.Writer)
+	zw.Reset(w)
+	return &pooledWriter{WriteCloser: zw, release: func() {
+		zw.Reset(io.Discard)
+		gzipWriters.Put(zw)
+	}}
+}
+
+func (gzipCodec) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return gzip.NewReader(r)
+}
+
+type zstdCodec struct{}
+
+var zstdWriters = sync.Pool{New: func() any {
+	// ошибка возможна только при некорректных опциях
+	zw, _ := zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1), zstd.WithEncoderLevel(zstd.SpeedFastest))
+	return zw
+}}
+
+func (zstdCodec) Name() string { return Zstd }
+
+func (zstdCodec) NewWriter(w io.Writer) io.WriteCloser {
+	zw := zstdWriters.Get().(*zstd.Encoder)
+	zw.Reset(w)
+	return &pooledWriter{WriteCloser: zw, release: func() {
+		zw.Reset(nil)
+		zstdWriters.Put(zw)
+	}}
+}
+
+func (zstdCodec) NewReader(r io.Reader) (io.ReadCloser, error) {
+	zr, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1), zstd.WithDecoderMaxMemory(zstdMaxMemory))
+	if err != nil {
+		return nil, err
+	}
+	return zr.IOReadCloser(), nil
+}
+
+type snappyCodec struct{}
+
+func (snappyCodec) Name() string { return Snappy }
+
+// NewWriter создает поток в формате snappy framing, совместимый с другими реализациями snappy.
+func (snappyCodec) NewWriter(w io.Writer) io.WriteCloser {
+	return s2.NewWriter(w, s2.WriterSnappyCompat(), s2.WriterConcurrency(1))
+}
+
+func (snappyCodec) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return io.NopCloser(s2.NewReader(r)), nil
+}
+
+// pooledWriter возвращает поток сжатия в пул после закрытия.
+type pooledWriter struct {
+	io.WriteCloser
+	release func()
+}
+
+func (w *pooledWriter) Close() error {
+	err := w.WriteCloser.Close()
+	if w.release != nil {
+		w.release()
+		w.release = nil
+	}
+	return err
+}
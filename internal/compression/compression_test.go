@@ -0,0 +1,86 @@
+package compression
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompressRoundTrip(t *testing.T) {
+	data := []byte(strings.Repeat(`{"id":"Alloc","type":"gauge","value":1.5}`, 100))
+
+	for _, name := range append(Supported(), Identity, "") {
+		t.Run(name, func(t *testing.T) {
+			compressed, err := Compress(name, data)
+			require.NoError(t, err)
+			if name != Identity && name != "" {
+				assert.Less(t, len(compressed), len(data))
+			}
+
+			r, err := NewReader(name, bytes.NewReader(compressed))
+			require.NoError(t, err)
+			defer r.Close()
+
+			got, err := io.ReadAll(r)
+			require.NoError(t, err)
+			assert.Equal(t, data, got)
+		})
+	}
+}
+
+func TestPooledWritersReuse(t *testing.T) {
+	for _, name := range []string{Gzip, Zstd} {
+		for i := 0; i < 3; i++ {
+			data := []byte(strings.Repeat("x", i+1))
+			compressed, err := Compress(name, data)
+			require.NoError(t, err)
+
+			r, err := NewReader(name, bytes.NewReader(compressed))
+			require.NoError(t, err)
+			got, err := io.ReadAll(r)
+			require.NoError(t, err)
+			assert.Equal(t, data, got, name)
+		}
+	}
+}
+
+func TestUnsupported(t *testing.T) {
+	_, err := Compress("br", []byte("data"))
+	assert.True(t, errors.Is(err, ErrUnsupported))
+
+	_, err = NewReader("br", bytes.NewReader(nil))
+	assert.True(t, errors.Is(err, ErrUnsupported))
+}
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		accept string
+		want   string
+	}{
+		{"", ""},
+		{"br", ""},
+		{"gzip", Gzip},
+		{"gzip, deflate, br", Gzip},
+		{"gzip, zstd", Zstd},
+		{"GZIP, Snappy", Snappy},
+		{"zstd;q=0.5, gzip", Gzip},
+		{"zstd;q=0, gzip;q=0.1", Gzip},
+		{"*", Zstd},
+		{"*;q=0.1, gzip;q=0.5", Gzip},
+		{"*, zstd;q=0", Snappy},
+	}
+	for _, tt := range tests {
+		t.Run(tt.accept, func(t *testing.T) {
+			assert.Equal(t, tt.want, Negotiate(tt.accept))
+		})
+	}
+}
+
+func TestAcceptEncoding(t *testing.T) {
+	assert.Equal(t, "zstd, snappy, gzip", AcceptEncoding())
+}
@@ -30,21 +30,24 @@ func NewController(options *flags.Options, logger *l.ZapLogger) *Controller {
 	}
 }
 
-func (c *Controller) SendingCounterMetrics(ctx context.Context, pollCount *int64, client *http.Client) {
+// SendingCounterMetrics отправляет счетчик опросов PollCount и возвращает ошибку отправки.
+func (c *Controller) SendingCounterMetrics(ctx context.Context, pollCount *int64, client *http.Client) error {
 	metricCounter := m.NewMetricCounter("PollCount", pollCount)
 	pollMetricsURL := &url.URL{
-		Scheme: "http",
+		Scheme: c.opt.Scheme(),
 		Host:   c.opt.FlagRunAddr,
 		Path:   "/update/counter/PollCount/" + fmt.Sprintf("%d", *pollCount),
 	}
 	if err := c.s.SendToServerMetric(ctx, client, pollMetricsURL.String(), *metricCounter); err != nil {
 		c.l.ErrorCtx(ctx, "message"+err.Error(), zap.String("sendingCounterMetrics", fmt.Sprintf("Error reporting metrics%v", err)))
+		return err
 	}
+	return nil
 }
 
 func (c *Controller) SendingGaugeMetrics(ctx context.Context, metrics map[string]float64, client *http.Client) {
 	updatesURL := &url.URL{
-		Scheme: "http",
+		Scheme: c.opt.Scheme(),
 		Host:   c.opt.FlagRunAddr,
 		Path:   "/updates/",
 	}
@@ -72,7 +75,7 @@ func (c *Controller) SendingGaugeMetrics(ctx context.Context, metrics map[string
 			}()
 
 			metricURL := &url.URL{
-				Scheme: "http",
+				Scheme: c.opt.Scheme(),
 				Host:   c.opt.FlagRunAddr,
 				Path:   fmt.Sprintf("/update/gauge/%s/%f", gauge.ID, *gauge.Value),
 			}
@@ -6,6 +6,7 @@ import (
 	"net/http"
 
 	sf "github.com/sanek1/metrics-collector/internal/flags/server"
+	"github.com/sanek1/metrics-collector/internal/health"
 	"github.com/sanek1/metrics-collector/internal/routing"
 	ss "github.com/sanek1/metrics-collector/internal/storage/server"
 	l "github.com/sanek1/metrics-collector/pkg/logging"
@@ -15,6 +16,8 @@ type Controller struct {
 	storage    ss.Storage
 	fieStorage ss.FileStorage
 	router     http.Handler
+	routing    *routing.Router
+	health     *health.Registry
 	logger     *l.ZapLogger
 }
 
@@ -24,6 +27,8 @@ func NewController(fs ss.FileStorage, s ss.Storage, opt *sf.ServerOptions, logge
 		storage:    s,
 		fieStorage: fs,
 		router:     r.InitRouting(),
+		routing:    r,
+		health:     r.Health(),
 		logger:     logger,
 	}
 }
@@ -32,3 +37,13 @@ func (c *Controller) Router() http.Handler {
 	c.logger.InfoCtx(context.Background(), "init router")
 	return c.router
 }
+
+// Health возвращает реестр проверок живости и готовности сервера.
+func (c *Controller) Health() *health.Registry {
+	return c.health
+}
+
+// Reload применяет настройки маршрутизации, которые меняются без перезапуска.
+func (c *Controller) Reload(opt *sf.ServerOptions) error {
+	return c.routing.Reload(opt)
+}
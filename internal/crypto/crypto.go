@@ -2,24 +2,54 @@
 package crypto
 
 import (
+	"crypto"
+	"crypto/ecdh"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/sha256"
 	"crypto/x509"
 	"encoding/pem"
+	"errors"
 	"fmt"
 	"os"
+
+	"github.com/youmark/pkcs8"
+)
+
+// PrivateKey - приватный ключ RSA (*rsa.PrivateKey) или X25519 (*ecdh.PrivateKey)
+type PrivateKey interface {
+	Public() crypto.PublicKey
+}
+
+// PublicKey - публичный ключ RSA (*rsa.PublicKey) или X25519 (*ecdh.PublicKey)
+type PublicKey interface {
+	Equal(x crypto.PublicKey) bool
+}
+
+const (
+	pemPrivateKey          = "PRIVATE KEY"
+	pemEncryptedPrivateKey = "ENCRYPTED PRIVATE KEY"
+	pemPublicKey           = "PUBLIC KEY"
 )
 
-// LoadPublicKey загружает публичный ключ RSA из файла
-func LoadPublicKey(filePath string) (*rsa.PublicKey, error) {
+var (
+	// errNotPrivateKey возвращается, если файл не содержит приватный ключ в формате PEM.
+	errNotPrivateKey = errors.New("invalid PEM block with private key")
+	// ErrPassphraseRequired возвращается при загрузке зашифрованного ключа без пароля.
+	ErrPassphraseRequired = errors.New("private key is encrypted, passphrase required")
+	// ErrUnsupportedKey возвращается для ключей, отличных от RSA и X25519.
+	ErrUnsupportedKey = errors.New("unsupported key type")
+)
+
+// LoadPublicKey загружает публичный ключ RSA или X25519 из файла
+func LoadPublicKey(filePath string) (PublicKey, error) {
 	pemData, err := os.ReadFile(filePath)
 	if err != nil {
 		return nil, fmt.Errorf("error loading public key: %w", err)
 	}
 
 	block, _ := pem.Decode(pemData)
-	if block == nil || block.Type != "PUBLIC KEY" {
+	if block == nil || block.Type != pemPublicKey {
 		return nil, fmt.Errorf("invalid PEM block with public key")
 	}
 
@@ -28,57 +58,129 @@ func LoadPublicKey(filePath string) (*rsa.PublicKey, error) {
 		return nil, fmt.Errorf("error parsing public key: %w", err)
 	}
 
-	pub, ok := pubInterface.(*rsa.PublicKey)
-	if !ok {
-		return nil, fmt.Errorf("error converting key to RSA public key")
-	}
-
-	return pub, nil
+	return checkPublicKey(pubInterface)
 }
 
-// LoadPrivateKey загружает приватный ключ RSA из файла
-func LoadPrivateKey(filePath string) (*rsa.PrivateKey, error) {
+// LoadPrivateKey загружает приватный ключ RSA или X25519 из файла PKCS#8.
+// Ключ, зашифрованный паролем (ENCRYPTED PRIVATE KEY), расшифровывается passphrase.
+func LoadPrivateKey(filePath string, passphrase []byte) (PrivateKey, error) {
 	pemData, err := os.ReadFile(filePath)
 	if err != nil {
 		return nil, fmt.Errorf("error reading private key: %w", err)
 	}
+	return ParsePrivateKeyPEM(pemData, passphrase)
+}
 
+// ParsePrivateKeyPEM разбирает приватный ключ PKCS#8 в формате PEM.
+func ParsePrivateKeyPEM(pemData []byte, passphrase []byte) (PrivateKey, error) {
 	block, _ := pem.Decode(pemData)
-	if block == nil || block.Type != "PRIVATE KEY" {
-		return nil, fmt.Errorf("invalid PEM block with private key")
+	if block == nil {
+		return nil, errNotPrivateKey
+	}
+
+	var priv any
+	var err error
+	switch block.Type {
+	case pemPrivateKey:
+		priv, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case pemEncryptedPrivateKey:
+		if len(passphrase) == 0 {
+			return nil, ErrPassphraseRequired
+		}
+		priv, err = pkcs8.ParsePKCS8PrivateKey(block.Bytes, passphrase)
+	default:
+		return nil, errNotPrivateKey
 	}
-
-	priv, err := x509.ParsePKCS8PrivateKey(block.Bytes)
 	if err != nil {
 		return nil, fmt.Errorf("error parsing private key: %w", err)
 	}
 
-	privateKey, ok := priv.(*rsa.PrivateKey)
-	if !ok {
-		return nil, fmt.Errorf("error converting key to RSA private key")
+	switch key := priv.(type) {
+	case *rsa.PrivateKey:
+		return key, nil
+	case *ecdh.PrivateKey:
+		if key.Curve() != ecdh.X25519() {
+			return nil, ErrUnsupportedKey
+		}
+		return key, nil
+	default:
+		return nil, ErrUnsupportedKey
 	}
+}
 
-	return privateKey, nil
+func checkPublicKey(pub any) (PublicKey, error) {
+	switch key := pub.(type) {
+	case *rsa.PublicKey:
+		return key, nil
+	case *ecdh.PublicKey:
+		if key.Curve() != ecdh.X25519() {
+			return nil, ErrUnsupportedKey
+		}
+		return key, nil
+	default:
+		return nil, ErrUnsupportedKey
+	}
 }
 
-// EncryptData шифрует данные с помощью публичного ключа RSA
-func EncryptData(publicKey *rsa.PublicKey, data []byte) ([]byte, error) {
-	// Используем OAEP шифрование с SHA-256
-	encrypted, err := rsa.EncryptOAEP(
-		sha256.New(),
-		rand.Reader,
-		publicKey,
-		data,
-		nil,
-	)
+// EncryptData шифрует данные для владельца приватного ключа RSA или X25519.
+// Данные шифруются случайным ключом AES-256-GCM, который для RSA шифруется
+// публичным ключом RSA-OAEP, а для X25519 выводится из общего секрета ECDH.
+// Размер данных не ограничен размером ключа.
+func EncryptData(publicKey PublicKey, data []byte) ([]byte, error) {
+	var encrypted []byte
+	var err error
+	switch key := publicKey.(type) {
+	case *rsa.PublicKey:
+		encrypted, err = sealEnvelope(key, data)
+	case *ecdh.PublicKey:
+		encrypted, err = sealEnvelopeX25519(key, data)
+	default:
+		err = ErrUnsupportedKey
+	}
 	if err != nil {
 		return nil, fmt.Errorf("error encrypting data: %w", err)
 	}
 	return encrypted, nil
 }
 
-// DecryptData расшифровывает данные с помощью приватного ключа RSA
-func DecryptData(privateKey *rsa.PrivateKey, data []byte) ([]byte, error) {
+// DecryptData расшифровывает данные с помощью приватного ключа RSA или X25519.
+// Для RSA поддерживается также прежний формат,
+// в котором все данные зашифрованы напрямую RSA-OAEP с SHA-256.
+func DecryptData(privateKey PrivateKey, data []byte) ([]byte, error) {
+	switch key := privateKey.(type) {
+	case *rsa.PrivateKey:
+		return decryptRSA(key, data)
+	case *ecdh.PrivateKey:
+		if !isEnvelope(data) {
+			return nil, fmt.Errorf("error decrypting data: %w", ErrUnknownFormat)
+		}
+		decrypted, err := openEnvelopeX25519(key, data)
+		if err != nil {
+			return nil, fmt.Errorf("error decrypting data: %w", err)
+		}
+		return decrypted, nil
+	default:
+		return nil, fmt.Errorf("error decrypting data: %w", ErrUnsupportedKey)
+	}
+}
+
+func decryptRSA(privateKey *rsa.PrivateKey, data []byte) ([]byte, error) {
+	legacy := len(data) == privateKey.Size()
+
+	if isEnvelope(data) {
+		decrypted, err := openEnvelope(privateKey, data)
+		if err == nil || !legacy {
+			if err != nil {
+				return nil, fmt.Errorf("error decrypting data: %w", err)
+			}
+			return decrypted, nil
+		}
+	}
+
+	if !legacy {
+		return nil, fmt.Errorf("error decrypting data: %w", ErrUnknownFormat)
+	}
+
 	// Используем OAEP расшифровку с SHA-256
 	decrypted, err := rsa.DecryptOAEP(
 		sha256.New(),
@@ -90,58 +192,16 @@ func DecryptData(privateKey *rsa.PrivateKey, data []byte) ([]byte, error) {
 	if err != nil {
 		return nil, fmt.Errorf("error decrypting data: %w", err)
 	}
+
 	return decrypted, nil
 }
 
-// GenerateKeyPair создает новую пару ключей RSA и сохраняет их в файлы
+// GenerateKeyPair создает новую пару ключей RSA 2048 и сохраняет их в файлы.
+// Существующие файлы перезаписываются, приватный ключ доступен только владельцу.
 func GenerateKeyPair(privateKeyPath, publicKeyPath string) error {
-	// Генерируем приватный ключ
-	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
-	if err != nil {
-		return fmt.Errorf("error generating keys: %w", err)
-	}
-
-	// Создаем PEM блок для приватного ключа
-	privateKeyBytes, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	privateKey, err := GenerateKey(KeyTypeRSA, DefaultRSABits)
 	if err != nil {
-		return fmt.Errorf("error marshalling private key: %w", err)
+		return err
 	}
-
-	privatePEM := pem.Block{
-		Type:  "PRIVATE KEY",
-		Bytes: privateKeyBytes,
-	}
-
-	privateFile, err := os.Create(privateKeyPath)
-	if err != nil {
-		return fmt.Errorf("error creating private key file: %w", err)
-	}
-	defer privateFile.Close()
-
-	if err := pem.Encode(privateFile, &privatePEM); err != nil {
-		return fmt.Errorf("error saving private key: %w", err)
-	}
-
-	// Создаем PEM блок для публичного ключа
-	publicKeyBytes, err := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
-	if err != nil {
-		return fmt.Errorf("error marshalling public key: %w", err)
-	}
-
-	publicPEM := pem.Block{
-		Type:  "PUBLIC KEY",
-		Bytes: publicKeyBytes,
-	}
-
-	publicFile, err := os.Create(publicKeyPath)
-	if err != nil {
-		return fmt.Errorf("error creating public key file: %w", err)
-	}
-	defer publicFile.Close()
-
-	if err := pem.Encode(publicFile, &publicPEM); err != nil {
-		return fmt.Errorf("error saving public key: %w", err)
-	}
-
-	return nil
+	return WriteKeyPair(privateKey, nil, privateKeyPath, publicKeyPath, true)
 }
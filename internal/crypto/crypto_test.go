@@ -29,7 +29,7 @@ func TestGenerateAndLoadKeys(t *testing.T) {
 		t.Fatalf("public key file not created: %v", err)
 	}
 
-	privateKey, err := LoadPrivateKey(privateKeyPath)
+	privateKey, err := LoadPrivateKey(privateKeyPath, nil)
 	if err != nil {
 		t.Fatalf("error loading private key: %v", err)
 	}
@@ -73,7 +73,7 @@ func TestEncryptionAndDecryption(t *testing.T) {
 }
 
 func TestLoadKeys_FileNotExist(t *testing.T) {
-	_, err := LoadPrivateKey("non_existent_private.pem")
+	_, err := LoadPrivateKey("non_existent_private.pem", nil)
 	if err == nil {
 		t.Fatal("expected error when loading non-existent private key")
 	}
@@ -0,0 +1,223 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// Формат конверта (envelope) версии 1:
+//
+//	magic "MCE" | версия (1 байт) | длина ключа (uint16, big endian) |
+//	ключ AES-256, зашифрованный RSA-OAEP | nonce (12 байт) | шифротекст AES-256-GCM
+//
+// Версия 2 предназначена для ключей X25519:
+//
+//	magic "MCE" | версия (1 байт) | эфемерный публичный ключ X25519 (32 байта) |
+//	nonce (12 байт) | шифротекст AES-256-GCM
+//
+// Ключ AES выводится через HKDF-SHA256 из общего секрета ECDH.
+//
+// Заголовок до nonce включительно передается в GCM как дополнительные данные,
+// поэтому его подмена обнаруживается при расшифровке.
+const (
+	envelopeVersion1 = 1
+	envelopeVersion2 = 2
+	envelopeKeySize  = 32
+)
+
+var (
+	envelopeMagic   = []byte("MCE")
+	envelopeKDFInfo = []byte("metrics-collector envelope v2")
+)
+
+// ErrUnknownFormat возвращается, если данные не являются ни конвертом,
+// ни шифротекстом RSA-OAEP прежнего формата.
+var ErrUnknownFormat = errors.New("unknown encrypted data format")
+
+// sealEnvelope шифрует данные случайным ключом AES-256-GCM
+// и упаковывает ключ, зашифрованный публичным ключом RSA.
+func sealEnvelope(publicKey *rsa.PublicKey, data []byte) ([]byte, error) {
+	key := make([]byte, envelopeKeySize)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return nil, fmt.Errorf("error generating data key: %w", err)
+	}
+
+	wrappedKey, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, publicKey, key, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error wrapping data key: %w", err)
+	}
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, fmt.Errorf("error generating nonce: %w", err)
+	}
+
+	header := make([]byte, 0, len(envelopeMagic)+3+len(wrappedKey)+len(nonce))
+	header = append(header, envelopeMagic...)
+	header = append(header, envelopeVersion1)
+	header = binary.BigEndian.AppendUint16(header, uint16(len(wrappedKey)))
+	header = append(header, wrappedKey...)
+	header = append(header, nonce...)
+
+	return gcm.Seal(header, nonce, data, header), nil
+}
+
+// openEnvelope расшифровывает конверт, созданный sealEnvelope.
+func openEnvelope(privateKey *rsa.PrivateKey, data []byte) ([]byte, error) {
+	rest := data[len(envelopeMagic):]
+	if len(rest) < 3 {
+		return nil, fmt.Errorf("envelope is truncated")
+	}
+	if rest[0] == envelopeVersion2 {
+		return nil, fmt.Errorf("envelope is encrypted for an X25519 key")
+	}
+	if rest[0] != envelopeVersion1 {
+		return nil, fmt.Errorf("unsupported envelope version %d", rest[0])
+	}
+	keyLen := int(binary.BigEndian.Uint16(rest[1:3]))
+	rest = rest[3:]
+	if len(rest) < keyLen {
+		return nil, fmt.Errorf("envelope is truncated")
+	}
+	wrappedKey := rest[:keyLen]
+	rest = rest[keyLen:]
+
+	key, err := rsa.DecryptOAEP(sha256.New(), rand.Reader, privateKey, wrappedKey, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error unwrapping data key: %w", err)
+	}
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) < gcm.NonceSize()+gcm.Overhead() {
+		return nil, fmt.Errorf("envelope is truncated")
+	}
+	nonce := rest[:gcm.NonceSize()]
+	header := data[:len(data)-len(rest)+gcm.NonceSize()]
+
+	plain, err := gcm.Open(nil, nonce, rest[gcm.NonceSize():], header)
+	if err != nil {
+		return nil, fmt.Errorf("error decrypting payload: %w", err)
+	}
+	return plain, nil
+}
+
+// sealEnvelopeX25519 шифрует данные ключом AES-256-GCM,
+// выведенным из общего секрета эфемерного ключа и ключа получателя.
+func sealEnvelopeX25519(publicKey *ecdh.PublicKey, data []byte) ([]byte, error) {
+	ephemeral, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("error generating ephemeral key: %w", err)
+	}
+	shared, err := ephemeral.ECDH(publicKey)
+	if err != nil {
+		return nil, fmt.Errorf("error computing shared secret: %w", err)
+	}
+
+	ephemeralPublic := ephemeral.PublicKey().Bytes()
+	gcm, err := x25519GCM(shared, ephemeralPublic, publicKey.Bytes())
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, fmt.Errorf("error generating nonce: %w", err)
+	}
+
+	header := make([]byte, 0, len(envelopeMagic)+1+len(ephemeralPublic)+len(nonce))
+	header = append(header, envelopeMagic...)
+	header = append(header, envelopeVersion2)
+	header = append(header, ephemeralPublic...)
+	header = append(header, nonce...)
+
+	return gcm.Seal(header, nonce, data, header), nil
+}
+
+// openEnvelopeX25519 расшифровывает конверт, созданный sealEnvelopeX25519.
+func openEnvelopeX25519(privateKey *ecdh.PrivateKey, data []byte) ([]byte, error) {
+	rest := data[len(envelopeMagic):]
+	if rest[0] != envelopeVersion2 {
+		return nil, fmt.Errorf("unsupported envelope version %d for X25519 key", rest[0])
+	}
+	rest = rest[1:]
+
+	const publicKeySize = 32
+	if len(rest) < publicKeySize {
+		return nil, fmt.Errorf("envelope is truncated")
+	}
+	ephemeralPublic := rest[:publicKeySize]
+	rest = rest[publicKeySize:]
+
+	ephemeral, err := ecdh.X25519().NewPublicKey(ephemeralPublic)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ephemeral key: %w", err)
+	}
+	shared, err := privateKey.ECDH(ephemeral)
+	if err != nil {
+		return nil, fmt.Errorf("error computing shared secret: %w", err)
+	}
+
+	gcm, err := x25519GCM(shared, ephemeralPublic, privateKey.PublicKey().Bytes())
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) < gcm.NonceSize()+gcm.Overhead() {
+		return nil, fmt.Errorf("envelope is truncated")
+	}
+	nonce := rest[:gcm.NonceSize()]
+	header := data[:len(data)-len(rest)+gcm.NonceSize()]
+
+	plain, err := gcm.Open(nil, nonce, rest[gcm.NonceSize():], header)
+	if err != nil {
+		return nil, fmt.Errorf("error decrypting payload: %w", err)
+	}
+	return plain, nil
+}
+
+func x25519GCM(shared, ephemeralPublic, recipientPublic []byte) (cipher.AEAD, error) {
+	salt := make([]byte, 0, len(ephemeralPublic)+len(recipientPublic))
+	salt = append(salt, ephemeralPublic...)
+	salt = append(salt, recipientPublic...)
+
+	key := make([]byte, envelopeKeySize)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, shared, salt, envelopeKDFInfo), key); err != nil {
+		return nil, fmt.Errorf("error deriving data key: %w", err)
+	}
+	return newGCM(key)
+}
+
+// isEnvelope сообщает, начинаются ли данные с сигнатуры конверта.
+func isEnvelope(data []byte) bool {
+	return bytes.HasPrefix(data, envelopeMagic) && len(data) > len(envelopeMagic)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("error creating cipher: %w", err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("error creating GCM: %w", err)
+	}
+	return gcm, nil
+}
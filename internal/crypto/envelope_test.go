@@ -0,0 +1,88 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEnvelope_LargePayload(t *testing.T) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	// значительно больше предела RSA-OAEP для ключа 2048 бит (~190 байт)
+	payload := bytes.Repeat([]byte(`{"id":"Alloc","type":"gauge","value":123456.789},`), 2000)
+
+	encrypted, err := EncryptData(&privateKey.PublicKey, payload)
+	require.NoError(t, err)
+	assert.True(t, bytes.HasPrefix(encrypted, envelopeMagic))
+	assert.Equal(t, byte(envelopeVersion1), encrypted[len(envelopeMagic)])
+
+	decrypted, err := DecryptData(privateKey, encrypted)
+	require.NoError(t, err)
+	assert.Equal(t, payload, decrypted)
+}
+
+func TestEnvelope_LegacyPayload(t *testing.T) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	payload := []byte(`{"id":"PollCount","type":"counter","delta":5}`)
+	legacy, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, &privateKey.PublicKey, payload, nil)
+	require.NoError(t, err)
+
+	decrypted, err := DecryptData(privateKey, legacy)
+	require.NoError(t, err)
+	assert.Equal(t, payload, decrypted)
+}
+
+func TestEnvelope_Errors(t *testing.T) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	encrypted, err := EncryptData(&privateKey.PublicKey, []byte("payload"))
+	require.NoError(t, err)
+
+	t.Run("tampered ciphertext", func(t *testing.T) {
+		tampered := append([]byte(nil), encrypted...)
+		tampered[len(tampered)-1] ^= 0xff
+		_, err := DecryptData(privateKey, tampered)
+		assert.Error(t, err)
+	})
+
+	t.Run("tampered header", func(t *testing.T) {
+		tampered := append([]byte(nil), encrypted...)
+		tampered[len(tampered)-30] ^= 0xff
+		_, err := DecryptData(privateKey, tampered)
+		assert.Error(t, err)
+	})
+
+	t.Run("wrong key", func(t *testing.T) {
+		_, err := DecryptData(otherKey, encrypted)
+		assert.Error(t, err)
+	})
+
+	t.Run("truncated", func(t *testing.T) {
+		_, err := DecryptData(privateKey, encrypted[:10])
+		assert.Error(t, err)
+	})
+
+	t.Run("unsupported version", func(t *testing.T) {
+		tampered := append([]byte(nil), encrypted...)
+		tampered[len(envelopeMagic)] = 99
+		_, err := DecryptData(privateKey, tampered)
+		assert.Error(t, err)
+	})
+
+	t.Run("unknown format", func(t *testing.T) {
+		_, err := DecryptData(privateKey, []byte("plain text"))
+		assert.ErrorIs(t, err, ErrUnknownFormat)
+	})
+}
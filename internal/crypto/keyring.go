@@ -0,0 +1,219 @@
+package crypto
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// KeyIDHeader - заголовок запроса с отпечатком ключа, которым зашифрованы данные
+const KeyIDHeader = "X-Key-ID"
+
+const (
+	// keyRingRefresh - период, после которого набор ключей перечитывается при обращении
+	keyRingRefresh = time.Minute
+	// keyRingRetry - минимальный интервал между перечитываниями из-за неизвестного ключа
+	keyRingRetry = 5 * time.Second
+)
+
+// ErrUnknownKeyID возвращается, если ключ с указанным отпечатком не найден.
+var ErrUnknownKeyID = errors.New("unknown key id")
+
+// Fingerprint возвращает отпечаток публичного ключа:
+// SHA-256 от его DER-представления PKIX в шестнадцатеричном виде.
+func Fingerprint(publicKey PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		return "", fmt.Errorf("error marshalling public key: %w", err)
+	}
+	sum := sha256.Sum256(der)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// KeyRing хранит набор приватных ключей, идентифицируемых отпечатком.
+// Ключи загружаются из файлов и каталогов и перечитываются без перезапуска:
+// периодически при обращении, при запросе неизвестного ключа и по вызову Reload.
+type KeyRing struct {
+	mu         sync.RWMutex
+	sources    []string
+	passphrase []byte
+	keys       map[string]PrivateKey
+	ids        []string
+	loadedAt   time.Time
+	reloadedAt time.Time
+	now        func() time.Time
+}
+
+// NewKeyRing создает набор ключей из списка источников, разделенных запятой.
+// Источником может быть файл с приватным ключом или каталог с файлами *.pem и *.key.
+// passphrase используется для зашифрованных ключей.
+func NewKeyRing(sources string, passphrase []byte) *KeyRing {
+	k := &KeyRing{
+		passphrase: passphrase,
+		keys:       make(map[string]PrivateKey),
+		now:        time.Now,
+	}
+	for _, src := range strings.Split(sources, ",") {
+		if src = strings.TrimSpace(src); src != "" {
+			k.sources = append(k.sources, src)
+		}
+	}
+	return k
+}
+
+// Reload перечитывает ключи из источников.
+// При ошибке текущий набор ключей сохраняется.
+func (k *KeyRing) Reload() error {
+	keys := make(map[string]PrivateKey)
+	for _, src := range k.sources {
+		if err := loadKeySource(src, k.passphrase, keys); err != nil {
+			k.mu.Lock()
+			k.reloadedAt = k.now()
+			k.mu.Unlock()
+			return err
+		}
+	}
+
+	ids := make([]string, 0, len(keys))
+	for id := range keys {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.keys = keys
+	k.ids = ids
+	k.loadedAt = k.now()
+	k.reloadedAt = k.loadedAt
+	return nil
+}
+
+// Len возвращает количество загруженных ключей.
+func (k *KeyRing) Len() int {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return len(k.keys)
+}
+
+// IDs возвращает отпечатки загруженных ключей.
+func (k *KeyRing) IDs() []string {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return append([]string(nil), k.ids...)
+}
+
+// Get возвращает ключ по отпечатку. Если ключ не найден,
+// набор ключей перечитывается (не чаще одного раза в несколько секунд).
+func (k *KeyRing) Get(id string) (PrivateKey, bool) {
+	k.refreshIfStale()
+
+	k.mu.RLock()
+	key, ok := k.keys[id]
+	retry := k.now().Sub(k.reloadedAt) >= keyRingRetry
+	k.mu.RUnlock()
+
+	if ok || !retry {
+		return key, ok
+	}
+	if err := k.Reload(); err != nil {
+		return nil, false
+	}
+
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	key, ok = k.keys[id]
+	return key, ok
+}
+
+// Decrypt расшифровывает данные ключом с отпечатком id.
+// Если отпечаток не указан, поочередно пробуются все ключи набора.
+func (k *KeyRing) Decrypt(id string, data []byte) ([]byte, error) {
+	if id != "" {
+		key, ok := k.Get(id)
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownKeyID, id)
+		}
+		return DecryptData(key, data)
+	}
+
+	k.refreshIfStale()
+	k.mu.RLock()
+	keys := make([]PrivateKey, 0, len(k.ids))
+	for _, id := range k.ids {
+		keys = append(keys, k.keys[id])
+	}
+	k.mu.RUnlock()
+
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no private keys loaded")
+	}
+	var err error
+	for _, key := range keys {
+		var decrypted []byte
+		if decrypted, err = DecryptData(key, data); err == nil {
+			return decrypted, nil
+		}
+	}
+	return nil, err
+}
+
+func (k *KeyRing) refreshIfStale() {
+	k.mu.RLock()
+	stale := k.now().Sub(k.loadedAt) >= keyRingRefresh && k.now().Sub(k.reloadedAt) >= keyRingRetry
+	k.mu.RUnlock()
+	if stale {
+		_ = k.Reload()
+	}
+}
+
+func loadKeySource(src string, passphrase []byte, keys map[string]PrivateKey) error {
+	info, err := os.Stat(src)
+	if err != nil {
+		return fmt.Errorf("error reading key source: %w", err)
+	}
+	if !info.IsDir() {
+		return addKeyFile(src, passphrase, keys)
+	}
+
+	entries, err := os.ReadDir(src)
+	if err != nil {
+		return fmt.Errorf("error reading key directory: %w", err)
+	}
+	for _, e := range entries {
+		ext := filepath.Ext(e.Name())
+		if e.IsDir() || (ext != ".pem" && ext != ".key") {
+			continue
+		}
+		// в каталоге рядом с приватными ключами могут лежать публичные - их пропускаем
+		if err := addKeyFile(filepath.Join(src, e.Name()), passphrase, keys); err != nil && !errors.Is(err, errNotPrivateKey) {
+			return err
+		}
+	}
+	return nil
+}
+
+func addKeyFile(path string, passphrase []byte, keys map[string]PrivateKey) error {
+	key, err := LoadPrivateKey(path, passphrase)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	publicKey, ok := key.Public().(PublicKey)
+	if !ok {
+		return fmt.Errorf("%s: %w", path, ErrUnsupportedKey)
+	}
+	id, err := Fingerprint(publicKey)
+	if err != nil {
+		return err
+	}
+	keys[id] = key
+	return nil
+}
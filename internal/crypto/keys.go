@@ -0,0 +1,150 @@
+package crypto
+
+import (
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/youmark/pkcs8"
+)
+
+// Поддерживаемые типы ключей
+const (
+	KeyTypeRSA    = "rsa"
+	KeyTypeX25519 = "x25519"
+)
+
+const (
+	// DefaultRSABits - размер ключа RSA по умолчанию
+	DefaultRSABits = 2048
+	// MinRSABits - минимально допустимый размер ключа RSA
+	MinRSABits = 2048
+
+	privateKeyPerm = 0600
+	publicKeyPerm  = 0644
+)
+
+// ErrKeyExists возвращается, если файл ключа уже существует, а перезапись не разрешена.
+var ErrKeyExists = errors.New("key file already exists")
+
+// GenerateKey создает приватный ключ указанного типа.
+// bits учитывается только для RSA.
+func GenerateKey(keyType string, bits int) (PrivateKey, error) {
+	switch keyType {
+	case KeyTypeRSA:
+		if bits < MinRSABits {
+			return nil, fmt.Errorf("RSA key size must be at least %d bits", MinRSABits)
+		}
+		key, err := rsa.GenerateKey(rand.Reader, bits)
+		if err != nil {
+			return nil, fmt.Errorf("error generating keys: %w", err)
+		}
+		return key, nil
+	case KeyTypeX25519:
+		key, err := ecdh.X25519().GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, fmt.Errorf("error generating keys: %w", err)
+		}
+		return key, nil
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnsupportedKey, keyType)
+	}
+}
+
+// KeyType возвращает тип ключа: rsa или x25519.
+func KeyType(publicKey PublicKey) string {
+	switch publicKey.(type) {
+	case *rsa.PublicKey:
+		return KeyTypeRSA
+	case *ecdh.PublicKey:
+		return KeyTypeX25519
+	default:
+		return ""
+	}
+}
+
+// MarshalPrivateKeyPEM кодирует приватный ключ в PEM PKCS#8.
+// Если задан passphrase, ключ шифруется (PBES2, AES-256-CBC).
+func MarshalPrivateKeyPEM(privateKey PrivateKey, passphrase []byte) ([]byte, error) {
+	der, err := pkcs8.MarshalPrivateKey(privateKey, passphrase, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error marshalling private key: %w", err)
+	}
+	blockType := pemPrivateKey
+	if len(passphrase) > 0 {
+		blockType = pemEncryptedPrivateKey
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), nil
+}
+
+// MarshalPublicKeyPEM кодирует публичный ключ в PEM PKIX.
+func MarshalPublicKeyPEM(publicKey PublicKey) ([]byte, error) {
+	der, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		return nil, fmt.Errorf("error marshalling public key: %w", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: pemPublicKey, Bytes: der}), nil
+}
+
+// WriteKeyPair сохраняет приватный ключ с правами 0600 и публичный с правами 0644.
+// Если force не задан, а хотя бы один из файлов существует, возвращается ErrKeyExists.
+func WriteKeyPair(privateKey PrivateKey, passphrase []byte, privateKeyPath, publicKeyPath string, force bool) error {
+	if !force {
+		for _, path := range []string{privateKeyPath, publicKeyPath} {
+			if _, err := os.Stat(path); err == nil {
+				return fmt.Errorf("%w: %s", ErrKeyExists, path)
+			}
+		}
+	}
+
+	privatePEM, err := MarshalPrivateKeyPEM(privateKey, passphrase)
+	if err != nil {
+		return err
+	}
+	publicKey, ok := privateKey.Public().(PublicKey)
+	if !ok {
+		return ErrUnsupportedKey
+	}
+	publicPEM, err := MarshalPublicKeyPEM(publicKey)
+	if err != nil {
+		return err
+	}
+
+	if err := writeKeyFile(privateKeyPath, privatePEM, privateKeyPerm, force); err != nil {
+		return fmt.Errorf("error saving private key: %w", err)
+	}
+	if err := writeKeyFile(publicKeyPath, publicPEM, publicKeyPerm, force); err != nil {
+		return fmt.Errorf("error saving public key: %w", err)
+	}
+	return nil
+}
+
+// writeKeyFile записывает файл с заданными правами.
+// Права выставляются явно, так как при перезаписи OpenFile их не меняет.
+func writeKeyFile(path string, data []byte, perm os.FileMode, force bool) error {
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if !force {
+		flags |= os.O_EXCL
+	}
+	f, err := os.OpenFile(path, flags, perm)
+	if err != nil {
+		if errors.Is(err, os.ErrExist) {
+			return fmt.Errorf("%w: %s", ErrKeyExists, path)
+		}
+		return err
+	}
+	if err := f.Chmod(perm); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
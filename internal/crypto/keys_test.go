@@ -0,0 +1,114 @@
+package crypto
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerateKey_Types(t *testing.T) {
+	for _, tc := range []struct {
+		keyType string
+		bits    int
+	}{
+		{KeyTypeRSA, 2048},
+		{KeyTypeRSA, 3072},
+		{KeyTypeX25519, 0},
+	} {
+		t.Run(tc.keyType, func(t *testing.T) {
+			privateKey, err := GenerateKey(tc.keyType, tc.bits)
+			require.NoError(t, err)
+			publicKey := privateKey.Public().(PublicKey)
+			assert.Equal(t, tc.keyType, KeyType(publicKey))
+
+			payload := []byte(`[{"id":"Alloc","type":"gauge","value":1}]`)
+			encrypted, err := EncryptData(publicKey, payload)
+			require.NoError(t, err)
+			decrypted, err := DecryptData(privateKey, encrypted)
+			require.NoError(t, err)
+			assert.Equal(t, payload, decrypted)
+		})
+	}
+
+	_, err := GenerateKey(KeyTypeRSA, 1024)
+	assert.Error(t, err)
+	_, err = GenerateKey("dsa", 0)
+	assert.ErrorIs(t, err, ErrUnsupportedKey)
+}
+
+func TestX25519Envelope_Errors(t *testing.T) {
+	privateKey, err := GenerateKey(KeyTypeX25519, 0)
+	require.NoError(t, err)
+	otherKey, err := GenerateKey(KeyTypeX25519, 0)
+	require.NoError(t, err)
+	rsaKey, err := GenerateKey(KeyTypeRSA, DefaultRSABits)
+	require.NoError(t, err)
+
+	encrypted, err := EncryptData(privateKey.Public().(PublicKey), []byte("payload"))
+	require.NoError(t, err)
+
+	_, err = DecryptData(otherKey, encrypted)
+	assert.Error(t, err, "wrong key")
+	_, err = DecryptData(rsaKey, encrypted)
+	assert.Error(t, err, "RSA key for X25519 envelope")
+
+	tampered := append([]byte(nil), encrypted...)
+	tampered[len(envelopeMagic)+5] ^= 0xff
+	_, err = DecryptData(privateKey, tampered)
+	assert.Error(t, err, "tampered ephemeral key")
+
+	_, err = DecryptData(privateKey, encrypted[:20])
+	assert.Error(t, err, "truncated")
+}
+
+func TestWriteKeyPair_Passphrase(t *testing.T) {
+	dir := t.TempDir()
+	privateKeyPath := filepath.Join(dir, "private.pem")
+	publicKeyPath := filepath.Join(dir, "public.pem")
+
+	privateKey, err := GenerateKey(KeyTypeRSA, DefaultRSABits)
+	require.NoError(t, err)
+	require.NoError(t, WriteKeyPair(privateKey, []byte("secret"), privateKeyPath, publicKeyPath, false))
+
+	info, err := os.Stat(privateKeyPath)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	_, err = LoadPrivateKey(privateKeyPath, nil)
+	assert.ErrorIs(t, err, ErrPassphraseRequired)
+	_, err = LoadPrivateKey(privateKeyPath, []byte("wrong"))
+	assert.Error(t, err)
+
+	loaded, err := LoadPrivateKey(privateKeyPath, []byte("secret"))
+	require.NoError(t, err)
+	assert.True(t, privateKey.Public().(PublicKey).Equal(loaded.Public()))
+
+	err = WriteKeyPair(privateKey, nil, privateKeyPath, publicKeyPath, false)
+	assert.ErrorIs(t, err, ErrKeyExists)
+
+	// при перезаписи файла с широкими правами права сужаются до 0600
+	require.NoError(t, os.Chmod(privateKeyPath, 0644))
+	require.NoError(t, WriteKeyPair(privateKey, nil, privateKeyPath, publicKeyPath, true))
+	info, err = os.Stat(privateKeyPath)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+}
+
+func TestKeyRing_EncryptedKeys(t *testing.T) {
+	dir := t.TempDir()
+	privateKey, err := GenerateKey(KeyTypeX25519, 0)
+	require.NoError(t, err)
+	require.NoError(t, WriteKeyPair(privateKey, []byte("secret"),
+		filepath.Join(dir, "x25519.key"), filepath.Join(dir, "x25519.pem"), false))
+
+	assert.Error(t, NewKeyRing(dir, nil).Reload())
+
+	ring := NewKeyRing(dir, []byte("secret"))
+	require.NoError(t, ring.Reload())
+	id, err := Fingerprint(privateKey.Public().(PublicKey))
+	require.NoError(t, err)
+	assert.Equal(t, []string{id}, ring.IDs())
+}
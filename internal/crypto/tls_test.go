@@ -0,0 +1,125 @@
+package crypto
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newTestCert(t *testing.T, cn string, parent *testCert, isCA bool, usage x509.ExtKeyUsage) *testCert {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: cn},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{usage},
+		BasicConstraintsValid: true,
+		IsCA:                  isCA,
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+	}
+
+	signer, signerKey := tmpl, key
+	if parent != nil {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, signer, &key.PublicKey, signerKey)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return &testCert{cert: cert, key: key}
+}
+
+func (c *testCert) write(t *testing.T, dir, name string) (certFile, keyFile string) {
+	t.Helper()
+	certFile = filepath.Join(dir, name+".crt")
+	keyFile = filepath.Join(dir, name+".key")
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.cert.Raw})
+	require.NoError(t, os.WriteFile(certFile, certPEM, 0600))
+
+	keyDER, err := x509.MarshalPKCS8PrivateKey(c.key)
+	require.NoError(t, err)
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})
+	require.NoError(t, os.WriteFile(keyFile, keyPEM, 0600))
+	return certFile, keyFile
+}
+
+func TestMutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCert(t, "test-ca", nil, true, x509.ExtKeyUsageAny)
+	caFile, _ := ca.write(t, dir, "ca")
+	serverCertFile, serverKeyFile := newTestCert(t, "server", ca, false, x509.ExtKeyUsageServerAuth).write(t, dir, "server")
+	clientCertFile, clientKeyFile := newTestCert(t, "agent", ca, false, x509.ExtKeyUsageClientAuth).write(t, dir, "client")
+
+	serverCfg, err := ServerTLSConfig(serverCertFile, serverKeyFile, caFile)
+	require.NoError(t, err)
+	assert.Equal(t, tls.RequireAndVerifyClientCert, serverCfg.ClientAuth)
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	srv.TLS = serverCfg
+	srv.StartTLS()
+	defer srv.Close()
+
+	t.Run("client with certificate", func(t *testing.T) {
+		clientCfg, err := ClientTLSConfig(caFile, clientCertFile, clientKeyFile)
+		require.NoError(t, err)
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: clientCfg}}
+
+		resp, err := client.Get(srv.URL)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	})
+
+	t.Run("client without certificate", func(t *testing.T) {
+		clientCfg, err := ClientTLSConfig(caFile, "", "")
+		require.NoError(t, err)
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: clientCfg}}
+
+		resp, err := client.Get(srv.URL)
+		if err == nil {
+			resp.Body.Close()
+		}
+		assert.Error(t, err)
+	})
+}
+
+func TestTLSConfigErrors(t *testing.T) {
+	_, err := ServerTLSConfig("missing.crt", "missing.key", "")
+	assert.Error(t, err)
+
+	_, err = ClientTLSConfig("missing-ca.crt", "", "")
+	assert.Error(t, err)
+
+	invalidCA := filepath.Join(t.TempDir(), "ca.crt")
+	require.NoError(t, os.WriteFile(invalidCA, []byte("not a certificate"), 0600))
+	_, err = ClientTLSConfig(invalidCA, "", "")
+	assert.Error(t, err)
+}
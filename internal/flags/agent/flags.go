@@ -2,12 +2,18 @@
 package flags
 
 import (
-	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"os"
 	"strconv"
-	"time"
+	"strings"
+
+	"github.com/sanek1/metrics-collector/internal/compression"
+	"github.com/sanek1/metrics-collector/internal/flags/config"
+	"github.com/sanek1/metrics-collector/internal/payload"
+	"github.com/sanek1/metrics-collector/internal/requestid"
 )
 
 type Options struct {
@@ -17,44 +23,80 @@ type Options struct {
 	PollInterval   int64
 	RateLimit      int64
 	ConfigPath     string
+	Tenant         string
+	APIToken       string
+	// TLS включает HTTPS при отправке метрик
+	TLS bool
+	// TLSCA - удостоверяющий центр для проверки сертификата сервера
+	TLSCA string
+	// TLSCert и TLSKey - клиентский сертификат и ключ агента (mTLS)
+	TLSCert string
+	TLSKey  string
+	// Compression - кодировка тела запросов: auto, gzip, zstd, snappy или none.
+	// В режиме auto агент выбирает лучшую из кодировок, объявленных сервером.
+	Compression string
+	// Format - формат тела пакетов метрик: json, protobuf или msgpack
+	Format string
+	// TraceEndpoint - адрес OTLP/HTTP коллектора спанов
+	TraceEndpoint string
+	// TraceFile - файл, в который записываются спаны
+	TraceFile string
+	// AgentID - идентификатор агента в заголовке X-Agent-ID, по умолчанию имя хоста
+	AgentID string
+	// PrintConfig - вывести итоговые настройки и завершить работу
+	PrintConfig bool
+	// CheckConfig - проверить настройки и завершить работу
+	CheckConfig bool
+
+	// args - аргументы командной строки, которые сохраняют приоритет
+	// над файлом конфигурации при его перечитывании
+	args []string
 }
 
-// AgentFileConfig представляет конфигурацию агента из файла
+// AgentFileConfig представляет конфигурацию агента из файла JSON или YAML.
+// Интервалы задаются длительностью ("10s", "1m") или числом секунд, в кавычках или без.
 type AgentFileConfig struct {
-	Address        string `json:"address"`
-	ReportInterval string `json:"report_interval"`
-	PollInterval   string `json:"poll_interval"`
-	CryptoKey      string `json:"crypto_key"`
+	Address        string          `json:"address"`
+	ReportInterval config.Duration `json:"report_interval"`
+	PollInterval   config.Duration `json:"poll_interval"`
+	RateLimit      int64           `json:"rate_limit"`
+	// Key - ключ агента, синоним crypto_key (переменная окружения KEY)
+	Key           string `json:"key,omitempty"`
+	CryptoKey     string `json:"crypto_key"`
+	Tenant        string `json:"tenant"`
+	APIToken      string `json:"api_token"`
+	TLS           bool   `json:"tls"`
+	TLSCA         string `json:"tls_ca"`
+	TLSCert       string `json:"tls_cert"`
+	TLSKey        string `json:"tls_key"`
+	Compression   string `json:"compression"`
+	Format        string `json:"format"`
+	TraceEndpoint string `json:"trace_endpoint"`
+	TraceFile     string `json:"trace_file"`
+	AgentID       string `json:"agent_id"`
 }
 
 const (
+	defaultAddress        = ":8080"
 	defaultReportInterval = 10
 	defaultPollInterval   = 2
 	defaultRateLimit      = 2
+	defaultCompression    = "auto"
+	defaultFormat         = "json"
 )
 
-// ParseDuration преобразует строку длительности в секунды
+// ParseDuration преобразует длительность ("10s" или число секунд) в секунды
 func ParseDuration(duration string) (int64, error) {
-	d, err := time.ParseDuration(duration)
-	if err != nil {
-		return 0, err
-	}
-	return int64(d.Seconds()), nil
+	return config.Seconds(duration)
 }
 
-// LoadConfig загружает конфигурацию из JSON-файла
+// LoadConfig загружает конфигурацию из файла JSON или YAML
 func LoadConfig(filePath string) (*AgentFileConfig, error) {
-	data, err := os.ReadFile(filePath)
-	if err != nil {
-		return nil, fmt.Errorf("error reading config file: %w", err)
+	var cfg AgentFileConfig
+	if err := config.Load(filePath, &cfg); err != nil {
+		return nil, err
 	}
-
-	var config AgentFileConfig
-	if err := json.Unmarshal(data, &config); err != nil {
-		return nil, fmt.Errorf("error parsing JSON: %w", err)
-	}
-
-	return &config, nil
+	return &cfg, nil
 }
 
 // ApplyFileConfig применяет настройки из конфигурационного файла
@@ -64,7 +106,7 @@ func ApplyFileConfig(opt *Options, config *AgentFileConfig) error {
 	}
 
 	if config.ReportInterval != "" {
-		reportInterval, err := ParseDuration(config.ReportInterval)
+		reportInterval, err := ParseDuration(string(config.ReportInterval))
 		if err != nil {
 			return fmt.Errorf("wrong report_interval: %w", err)
 		}
@@ -72,74 +114,301 @@ func ApplyFileConfig(opt *Options, config *AgentFileConfig) error {
 	}
 
 	if config.PollInterval != "" {
-		pollInterval, err := ParseDuration(config.PollInterval)
+		pollInterval, err := ParseDuration(string(config.PollInterval))
 		if err != nil {
 			return fmt.Errorf("wrong poll_interval: %w", err)
 		}
 		opt.PollInterval = pollInterval
 	}
 
+	if config.RateLimit != 0 {
+		opt.RateLimit = config.RateLimit
+	}
+
+	if config.Key != "" {
+		opt.CryptoKey = config.Key
+	}
+
 	if config.CryptoKey != "" {
 		opt.CryptoKey = config.CryptoKey
 	}
 
+	if config.Tenant != "" {
+		opt.Tenant = config.Tenant
+	}
+
+	if config.APIToken != "" {
+		opt.APIToken = config.APIToken
+	}
+
+	if config.TLS {
+		opt.TLS = true
+	}
+
+	if config.TLSCA != "" {
+		opt.TLSCA = config.TLSCA
+	}
+
+	if config.TLSCert != "" {
+		opt.TLSCert = config.TLSCert
+	}
+
+	if config.TLSKey != "" {
+		opt.TLSKey = config.TLSKey
+	}
+
+	if config.Compression != "" {
+		opt.Compression = config.Compression
+	}
+
+	if config.Format != "" {
+		opt.Format = config.Format
+	}
+
+	if config.TraceEndpoint != "" {
+		opt.TraceEndpoint = config.TraceEndpoint
+	}
+
+	if config.TraceFile != "" {
+		opt.TraceFile = config.TraceFile
+	}
+
+	if config.AgentID != "" {
+		opt.AgentID = config.AgentID
+	}
+
 	return nil
 }
 
+// ParseFlags собирает настройки агента из аргументов командной строки,
+// переменных окружения и файла конфигурации. При ошибке в настройках
+// выводит все найденные ошибки и завершает процесс.
 func ParseFlags() *Options {
-	opt := &Options{}
-
-	flag.StringVar(&opt.FlagRunAddr, "a", ":8080", "address and port to run server")
-	flag.StringVar(&opt.CryptoKey, "k", "", "key to encrypt/decrypt metrics")
-	flag.Int64Var(&opt.ReportInterval, "r", defaultReportInterval, "report interval in seconds")
-	flag.Int64Var(&opt.PollInterval, "p", defaultPollInterval, "poll interval in seconds")
-	flag.Int64Var(&opt.RateLimit, "l", defaultRateLimit, "outgoing requests to the server ")
-	flag.StringVar(&opt.CryptoKey, "crypto-key", "", "path to public key file for encryption")
-	flag.StringVar(&opt.ConfigPath, "c", "", "path to config file")
-	flag.StringVar(&opt.ConfigPath, "config", "", "path to config file")
-	flag.Parse()
-
-	if len(flag.Args()) > 0 {
-		fmt.Fprintln(os.Stderr, "Unknown flags:", flag.Args())
-		os.Exit(1)
-	}
-
-	configPath := opt.ConfigPath
-	if configPath == "" {
-		configPath = os.Getenv("CONFIG")
-	}
-	if configPath != "" {
-		if cfg, err := LoadConfig(configPath); err == nil {
-			if err := ApplyFileConfig(opt, cfg); err != nil {
-				fmt.Fprintf(os.Stderr, "Error applying configuration: %v\n", err)
-			}
-		} else {
-			fmt.Fprintf(os.Stderr, "Error loading configuration: %v\n", err)
+	opt, err := Load(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid configuration:\n%v\n", err)
+		os.Exit(2)
+	}
+	return opt
+}
+
+// Load собирает и проверяет настройки агента. Приоритет источников:
+// флаги командной строки args > переменные окружения > файл конфигурации > значения по умолчанию.
+func Load(args []string) (*Options, error) {
+	opt := defaultOptions()
+	if err := opt.load(args); err != nil {
+		return nil, err
+	}
+	return opt, nil
+}
+
+func defaultOptions() *Options {
+	return &Options{
+		FlagRunAddr:    defaultAddress,
+		ReportInterval: defaultReportInterval,
+		PollInterval:   defaultPollInterval,
+		RateLimit:      defaultRateLimit,
+		Compression:    defaultCompression,
+		Format:         defaultFormat,
+	}
+}
+
+// newFlagSet связывает флаги с полями opt. Значениями по умолчанию
+// становятся текущие значения полей, поэтому повторный разбор args
+// меняет только явно переданные флаги.
+func newFlagSet(opt *Options) *flag.FlagSet {
+	fs := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+	fs.StringVar(&opt.FlagRunAddr, "a", opt.FlagRunAddr, "address and port to run server")
+	fs.StringVar(&opt.CryptoKey, "k", opt.CryptoKey, "key to encrypt/decrypt metrics")
+	fs.Var(secondsValue{&opt.ReportInterval}, "r", "report interval: seconds or duration (10s)")
+	fs.Var(secondsValue{&opt.PollInterval}, "p", "poll interval: seconds or duration (2s)")
+	fs.Int64Var(&opt.RateLimit, "l", opt.RateLimit, "outgoing requests to the server ")
+	fs.StringVar(&opt.CryptoKey, "crypto-key", opt.CryptoKey, "path to public key file for encryption")
+	fs.StringVar(&opt.ConfigPath, "c", opt.ConfigPath, "path to config file (JSON or YAML)")
+	fs.StringVar(&opt.ConfigPath, "config", opt.ConfigPath, "path to config file (JSON or YAML)")
+	fs.StringVar(&opt.Tenant, "tenant", opt.Tenant, "tenant id sent in X-Scope-OrgID header")
+	fs.StringVar(&opt.APIToken, "token", opt.APIToken, "bearer token for server API")
+	fs.BoolVar(&opt.TLS, "tls", opt.TLS, "send metrics over HTTPS")
+	fs.StringVar(&opt.TLSCA, "tls-ca", opt.TLSCA, "path to CA certificate used to verify the server")
+	fs.StringVar(&opt.TLSCert, "tls-cert", opt.TLSCert, "path to agent TLS client certificate")
+	fs.StringVar(&opt.TLSKey, "tls-key", opt.TLSKey, "path to agent TLS client private key")
+	fs.StringVar(&opt.Compression, "compression", opt.Compression, "request body encoding: auto, gzip, zstd, snappy or none")
+	fs.StringVar(&opt.Format, "format", opt.Format, "metrics batch format: json, protobuf or msgpack")
+	fs.StringVar(&opt.TraceEndpoint, "trace-endpoint", opt.TraceEndpoint, "OTLP/HTTP collector address for trace spans")
+	fs.StringVar(&opt.TraceFile, "trace-file", opt.TraceFile, "file to write trace spans to")
+	fs.StringVar(&opt.AgentID, "agent-id", opt.AgentID, "agent id sent in X-Agent-ID header, defaults to hostname")
+	fs.BoolVar(&opt.PrintConfig, "print-config", opt.PrintConfig, "print effective configuration and exit")
+	fs.BoolVar(&opt.CheckConfig, "check-config", opt.CheckConfig, "validate configuration and exit")
+	return fs
+}
+
+// load применяет к opt файл конфигурации, переменные окружения и флаги args
+// и проверяет результат. Флаги разбираются дважды: сначала чтобы узнать путь
+// к файлу конфигурации, затем поверх файла и окружения, чтобы иметь наивысший приоритет.
+func (o *Options) load(args []string) error {
+	fs := newFlagSet(o)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("unknown arguments: %v", fs.Args())
+	}
+
+	if path := o.configPath(); path != "" {
+		cfg, err := LoadConfig(path)
+		if err != nil {
+			return err
+		}
+		if err := ApplyFileConfig(o, cfg); err != nil {
+			return err
 		}
 	}
-	if addr := os.Getenv("ADDRESS"); addr != "" {
-		opt.FlagRunAddr = addr
+
+	// ошибки окружения выводятся вместе с ошибками проверки
+	envErr := applyEnv(o)
+
+	if err := newFlagSet(o).Parse(args); err != nil {
+		return err
+	}
+	if o.AgentID == "" {
+		o.AgentID, _ = os.Hostname()
 	}
+	o.args = args
+	return errors.Join(envErr, o.Validate())
+}
 
-	if interval := os.Getenv("REPORT_INTERVAL"); interval != "" {
-		opt.ReportInterval, _ = strconv.ParseInt(interval, 10, 64)
+// configPath возвращает путь к файлу конфигурации из флага или переменной CONFIG.
+func (o *Options) configPath() string {
+	if o.ConfigPath != "" {
+		return o.ConfigPath
 	}
+	return os.Getenv("CONFIG")
+}
 
-	if interval := os.Getenv("POLL_INTERVAL"); interval != "" {
-		opt.PollInterval, _ = strconv.ParseInt(interval, 10, 64)
+// applyEnv применяет переменные окружения поверх файла конфигурации.
+// Возвращает ошибки разбора всех некорректных переменных.
+func applyEnv(opt *Options) error {
+	env := config.NewEnv(os.Getenv)
+	env.String("ADDRESS", &opt.FlagRunAddr)
+	env.Seconds("REPORT_INTERVAL", &opt.ReportInterval)
+	env.Seconds("POLL_INTERVAL", &opt.PollInterval)
+	env.String("KEY", &opt.CryptoKey)
+	env.String("CRYPTO_KEY", &opt.CryptoKey)
+	env.Int64("RATE_LIMIT", &opt.RateLimit)
+	env.String("TENANT", &opt.Tenant)
+	env.String("API_TOKEN", &opt.APIToken)
+	env.Bool("TLS", &opt.TLS)
+	env.String("TLS_CA", &opt.TLSCA)
+	env.String("TLS_CERT", &opt.TLSCert)
+	env.String("TLS_KEY", &opt.TLSKey)
+	env.String("COMPRESSION", &opt.Compression)
+	env.String("FORMAT", &opt.Format)
+	env.String("OTEL_EXPORTER_OTLP_ENDPOINT", &opt.TraceEndpoint)
+	env.String("TRACE_FILE", &opt.TraceFile)
+	env.String("AGENT_ID", &opt.AgentID)
+	return env.Err()
+}
+
+// Validate проверяет настройки и возвращает все найденные ошибки.
+// Имена параметров в ошибках совпадают с ключами файла конфигурации.
+func (o *Options) Validate() error {
+	var errs config.Errors
+	if o.FlagRunAddr == "" {
+		errs.Addf("address", "must not be empty")
+	}
+	if o.ReportInterval <= 0 {
+		errs.Addf("report_interval", "must be positive, got %ds", o.ReportInterval)
+	}
+	if o.PollInterval <= 0 {
+		errs.Addf("poll_interval", "must be positive, got %ds", o.PollInterval)
+	}
+	if o.RateLimit < 0 {
+		errs.Addf("rate_limit", "must not be negative, got %d", o.RateLimit)
 	}
+	switch mode := strings.ToLower(strings.TrimSpace(o.Compression)); mode {
+	case "", defaultCompression, "none", compression.Identity:
+	default:
+		if _, ok := compression.Get(mode); !ok {
+			errs.Addf("compression", "unsupported encoding %q, use auto, none or one of %s",
+				o.Compression, strings.Join(compression.Supported(), ", "))
+		}
+	}
+	if _, err := payload.ContentType(o.Format); err != nil {
+		errs.Addf("format", "unsupported format %q, use json, protobuf or msgpack", o.Format)
+	}
+	if (o.TLSCert == "") != (o.TLSKey == "") {
+		errs.Addf("tls_cert", "tls_cert and tls_key must be set together")
+	}
+	if o.AgentID != "" {
+		if err := requestid.Validate(o.AgentID); err != nil {
+			errs.Addf("agent_id", "%v", err)
+		}
+	}
+	return errs.Err()
+}
 
-	if key := os.Getenv("KEY"); key != "" {
-		opt.CryptoKey = key
+// FileConfig возвращает настройки в виде файла конфигурации.
+// Секреты заменяются маской, поэтому результат пригоден для вывода в журнал.
+func (o *Options) FileConfig() *AgentFileConfig {
+	return &AgentFileConfig{
+		Address:        o.FlagRunAddr,
+		ReportInterval: config.Duration(config.FormatSeconds(o.ReportInterval)),
+		PollInterval:   config.Duration(config.FormatSeconds(o.PollInterval)),
+		RateLimit:      o.RateLimit,
+		CryptoKey:      config.SecretOrPath(o.CryptoKey),
+		Tenant:         o.Tenant,
+		APIToken:       config.Secret(o.APIToken),
+		TLS:            o.TLS,
+		TLSCA:          o.TLSCA,
+		TLSCert:        o.TLSCert,
+		TLSKey:         o.TLSKey,
+		Compression:    o.Compression,
+		Format:         o.Format,
+		TraceEndpoint:  o.TraceEndpoint,
+		TraceFile:      o.TraceFile,
+		AgentID:        o.AgentID,
 	}
+}
+
+// WriteConfig выводит итоговые настройки в формате файла конфигурации.
+func (o *Options) WriteConfig(w io.Writer) error {
+	return config.Print(w, o.FileConfig())
+}
 
-	if path := os.Getenv("CRYPTO_KEY"); path != "" {
-		opt.CryptoKey = path
+// secondsValue - флаг длительности в секундах: число секунд или длительность Go.
+type secondsValue struct {
+	seconds *int64
+}
+
+func (v secondsValue) String() string {
+	if v.seconds == nil {
+		return ""
 	}
+	return strconv.FormatInt(*v.seconds, 10)
+}
 
-	if limit := os.Getenv("RATE_LIMIT"); limit != "" {
-		opt.RateLimit, _ = strconv.ParseInt(limit, 10, 64)
+func (v secondsValue) Set(s string) error {
+	n, err := config.Seconds(s)
+	if err != nil {
+		return err
 	}
+	*v.seconds = n
+	return nil
+}
 
-	return opt
+// UseTLS сообщает, должен ли агент отправлять метрики по HTTPS.
+// HTTPS включается явно флагом или неявно при указании сертификатов.
+func (o *Options) UseTLS() bool {
+	return o.TLS || o.TLSCA != "" || o.TLSCert != ""
+}
+
+// Scheme возвращает схему URL сервера метрик.
+func (o *Options) Scheme() string {
+	if o.UseTLS() {
+		return "https"
+	}
+	return "http"
 }
@@ -1,6 +1,7 @@
 package flags
 
 import (
+	"bytes"
 	"flag"
 	"os"
 	"path/filepath"
@@ -79,9 +80,9 @@ func TestParseFlags(t *testing.T) {
 		assert.Equal(t, int64(5), opt.RateLimit)
 	})
 
-	t.Run("env overrides flags", func(t *testing.T) {
+	t.Run("flags override env", func(t *testing.T) {
 		flag.CommandLine = flag.NewFlagSet("test", flag.ExitOnError)
-		os.Args = []string{"test", "-a", ":9090", "-k", "testkey", "-r", "20", "-p", "5", "-l", "10"}
+		os.Args = []string{"test", "-a", ":9090", "-k", "testkey", "-r", "20", "-l", "10"}
 		_ = os.Setenv("ADDRESS", ":7070")
 		_ = os.Setenv("REPORT_INTERVAL", "30")
 		_ = os.Setenv("POLL_INTERVAL", "7")
@@ -89,11 +90,11 @@ func TestParseFlags(t *testing.T) {
 		_ = os.Setenv("RATE_LIMIT", "5")
 
 		opt := ParseFlags()
-		assert.Equal(t, ":7070", opt.FlagRunAddr)
-		assert.Equal(t, "envkey", opt.CryptoKey)
-		assert.Equal(t, int64(30), opt.ReportInterval)
-		assert.Equal(t, int64(7), opt.PollInterval)
-		assert.Equal(t, int64(5), opt.RateLimit)
+		assert.Equal(t, ":9090", opt.FlagRunAddr)
+		assert.Equal(t, "testkey", opt.CryptoKey)
+		assert.Equal(t, int64(20), opt.ReportInterval)
+		assert.Equal(t, int64(7), opt.PollInterval, "env applies to flags that were not passed")
+		assert.Equal(t, int64(10), opt.RateLimit)
 	})
 }
 
@@ -172,8 +173,8 @@ func TestLoadConfig(t *testing.T) {
 
 	// Проверяем загруженные значения
 	assert.Equal(t, "localhost:9090", config.Address)
-	assert.Equal(t, "5s", config.ReportInterval)
-	assert.Equal(t, "2s", config.PollInterval)
+	assert.EqualValues(t, "5s", config.ReportInterval)
+	assert.EqualValues(t, "2s", config.PollInterval)
 	assert.Equal(t, "/path/to/key.pem", config.CryptoKey)
 
 	// Проверяем ошибку при отсутствующем файле
@@ -307,3 +308,125 @@ func TestParseFlags_WithConfigFile(t *testing.T) {
 		assert.Equal(t, "/other/key.pem", opt.CryptoKey)
 	})
 }
+
+func TestOptions_Scheme(t *testing.T) {
+	assert.Equal(t, "http", (&Options{}).Scheme())
+	assert.Equal(t, "https", (&Options{TLS: true}).Scheme())
+	assert.Equal(t, "https", (&Options{TLSCA: "ca.pem"}).Scheme())
+	assert.Equal(t, "https", (&Options{TLSCert: "agent.pem", TLSKey: "agent.key"}).Scheme())
+}
+
+// clearEnv сбрасывает переменные окружения агента, оставленные другими тестами.
+func clearEnv(t *testing.T) {
+	for _, env := range []string{"ADDRESS", "REPORT_INTERVAL", "POLL_INTERVAL", "RATE_LIMIT", "KEY", "CRYPTO_KEY",
+		"TENANT", "API_TOKEN", "TLS", "COMPRESSION", "FORMAT", "AGENT_ID", "CONFIG"} {
+		t.Setenv(env, "")
+	}
+}
+
+func TestLoad_Precedence(t *testing.T) {
+	clearEnv(t)
+	path := filepath.Join(t.TempDir(), "agent.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+address: file:8080
+report_interval: 30s
+poll_interval: 1m
+rate_limit: 4
+key: file.pem
+tenant: file-tenant
+`), 0600))
+	t.Setenv("CONFIG", path)
+	t.Setenv("POLL_INTERVAL", "5s")
+	t.Setenv("TENANT", "env-tenant")
+	t.Setenv("RATE_LIMIT", "6")
+
+	opt, err := Load([]string{"-l", "8"})
+	require.NoError(t, err)
+
+	assert.Equal(t, "file:8080", opt.FlagRunAddr, "file overrides defaults")
+	assert.Equal(t, int64(30), opt.ReportInterval)
+	assert.Equal(t, "file.pem", opt.CryptoKey)
+	assert.Equal(t, int64(5), opt.PollInterval, "env overrides file")
+	assert.Equal(t, "env-tenant", opt.Tenant)
+	assert.Equal(t, int64(8), opt.RateLimit, "flags override env")
+	assert.Equal(t, defaultFormat, opt.Format, "defaults apply to unset options")
+
+	t.Run("flags survive reload", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(path, []byte("rate_limit: 3\nreport_interval: 20s\n"), 0600))
+		next, err := Reload(opt)
+		require.NoError(t, err)
+		assert.Equal(t, int64(8), next.RateLimit)
+		assert.Equal(t, int64(20), next.ReportInterval)
+	})
+}
+
+func TestLoad_Errors(t *testing.T) {
+	clearEnv(t)
+
+	t.Run("env parse errors", func(t *testing.T) {
+		t.Setenv("REPORT_INTERVAL", "soon")
+		t.Setenv("RATE_LIMIT", "many")
+		t.Setenv("TLS", "maybe")
+		_, err := Load(nil)
+		require.Error(t, err)
+		assert.ErrorContains(t, err, "REPORT_INTERVAL")
+		assert.ErrorContains(t, err, "RATE_LIMIT")
+		assert.ErrorContains(t, err, "TLS")
+	})
+
+	t.Run("fractional interval", func(t *testing.T) {
+		t.Setenv("POLL_INTERVAL", "1500ms")
+		_, err := Load(nil)
+		assert.ErrorContains(t, err, "not a whole number of seconds")
+	})
+
+	t.Run("validation", func(t *testing.T) {
+		_, err := Load([]string{"-r", "0", "-l", "-1", "-compression", "brotli", "-format", "xml", "-tls-cert", "agent.pem"})
+		require.Error(t, err)
+		for _, name := range []string{"report_interval", "rate_limit", "compression", "format", "tls_cert"} {
+			assert.ErrorContains(t, err, name+":")
+		}
+	})
+
+	t.Run("unknown key in file", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "agent.json")
+		require.NoError(t, os.WriteFile(path, []byte(`{"report_intreval": "5s"}`), 0600))
+		_, err := Load([]string{"-config", path})
+		assert.ErrorContains(t, err, "report_intreval")
+	})
+
+	t.Run("unknown flag", func(t *testing.T) {
+		_, err := Load([]string{"-unknown"})
+		assert.Error(t, err)
+	})
+}
+
+func TestWriteConfig(t *testing.T) {
+	clearEnv(t)
+	opt, err := Load([]string{"-token", "secret-token", "-r", "90", "-agent-id", "host-1", "-check-config"})
+	require.NoError(t, err)
+	assert.True(t, opt.CheckConfig)
+
+	var buf bytes.Buffer
+	require.NoError(t, opt.WriteConfig(&buf))
+	assert.NotContains(t, buf.String(), "secret-token")
+
+	path := filepath.Join(t.TempDir(), "printed.json")
+	require.NoError(t, os.WriteFile(path, buf.Bytes(), 0600))
+	cfg, err := LoadConfig(path)
+	require.NoError(t, err, "printed configuration must be a valid config file")
+	assert.EqualValues(t, "1m30s", cfg.ReportInterval)
+	assert.Equal(t, "host-1", cfg.AgentID)
+}
+
+func TestLoad_NumericIntervals(t *testing.T) {
+	clearEnv(t)
+	path := filepath.Join(t.TempDir(), "agent.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("report_interval: 10\npoll_interval: 3\n"), 0600))
+	t.Setenv("CONFIG", path)
+
+	opt, err := Load(nil)
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), opt.ReportInterval)
+	assert.Equal(t, int64(3), opt.PollInterval)
+}
@@ -0,0 +1,76 @@
+package flags
+
+import "errors"
+
+// ErrNoConfigFile - путь к файлу конфигурации не задан, перечитывать нечего
+var ErrNoConfigFile = errors.New("config file is not set")
+
+// option описывает параметр конфигурации для сравнения при перечитывании.
+// name совпадает с ключом в файле конфигурации.
+type option struct {
+	name string
+	// live - параметр применяется без перезапуска агента
+	live  bool
+	equal func(a, b *Options) bool
+}
+
+var reloadOptions = []option{
+	{name: "address", live: true, equal: func(a, b *Options) bool { return a.FlagRunAddr == b.FlagRunAddr }},
+	{name: "report_interval", live: true, equal: func(a, b *Options) bool { return a.ReportInterval == b.ReportInterval }},
+	{name: "poll_interval", live: true, equal: func(a, b *Options) bool { return a.PollInterval == b.PollInterval }},
+	{name: "rate_limit", live: true, equal: func(a, b *Options) bool { return a.RateLimit == b.RateLimit }},
+	{name: "crypto_key", equal: func(a, b *Options) bool { return a.CryptoKey == b.CryptoKey }},
+	{name: "tenant", equal: func(a, b *Options) bool { return a.Tenant == b.Tenant }},
+	{name: "api_token", equal: func(a, b *Options) bool { return a.APIToken == b.APIToken }},
+	{name: "tls", equal: func(a, b *Options) bool { return a.TLS == b.TLS }},
+	{name: "tls_ca", equal: func(a, b *Options) bool { return a.TLSCA == b.TLSCA }},
+	{name: "tls_cert", equal: func(a, b *Options) bool { return a.TLSCert == b.TLSCert }},
+	{name: "tls_key", equal: func(a, b *Options) bool { return a.TLSKey == b.TLSKey }},
+	{name: "compression", equal: func(a, b *Options) bool { return a.Compression == b.Compression }},
+	{name: "format", equal: func(a, b *Options) bool { return a.Format == b.Format }},
+	{name: "trace_endpoint", equal: func(a, b *Options) bool { return a.TraceEndpoint == b.TraceEndpoint }},
+	{name: "trace_file", equal: func(a, b *Options) bool { return a.TraceFile == b.TraceFile }},
+	{name: "agent_id", equal: func(a, b *Options) bool { return a.AgentID == b.AgentID }},
+}
+
+// Reload перечитывает файл конфигурации и возвращает новые настройки на основе current.
+// Приоритеты те же, что при запуске: значения из файла заменяют текущие,
+// переменные окружения - значения из файла, а флаги командной строки - все остальное.
+// Параметры, которых нет в файле, не меняются.
+func Reload(current *Options) (*Options, error) {
+	if current.configPath() == "" {
+		return nil, ErrNoConfigFile
+	}
+	next := *current
+	if err := next.load(current.args); err != nil {
+		return nil, err
+	}
+	return &next, nil
+}
+
+// Changes возвращает имена параметров, которые в next отличаются от текущих:
+// live применяются без перезапуска, restart - только после перезапуска агента.
+func (o *Options) Changes(next *Options) (live, restart []string) {
+	for _, opt := range reloadOptions {
+		if opt.equal(o, next) {
+			continue
+		}
+		if opt.live {
+			live = append(live, opt.name)
+		} else {
+			restart = append(restart, opt.name)
+		}
+	}
+	return live, restart
+}
+
+// ApplyLive переносит из next параметры, применяемые без перезапуска:
+// адрес сервера, интервалы опроса и отправки и ограничение числа запросов.
+// Изменяет текущие настройки, поэтому вызывается в цикле агента
+// между отправками метрик.
+func (o *Options) ApplyLive(next *Options) {
+	o.FlagRunAddr = next.FlagRunAddr
+	o.ReportInterval = next.ReportInterval
+	o.PollInterval = next.PollInterval
+	o.RateLimit = next.RateLimit
+}
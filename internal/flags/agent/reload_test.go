@@ -0,0 +1,63 @@
+package flags
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReload(t *testing.T) {
+	for _, env := range []string{"ADDRESS", "REPORT_INTERVAL", "POLL_INTERVAL", "RATE_LIMIT", "KEY", "CRYPTO_KEY", "TENANT", "AGENT_ID"} {
+		t.Setenv(env, "")
+	}
+	path := filepath.Join(t.TempDir(), "config.json")
+	current := &Options{
+		FlagRunAddr:    "localhost:8080",
+		ReportInterval: 10,
+		PollInterval:   2,
+		RateLimit:      2,
+		Tenant:         "team-a",
+		AgentID:        "host-1",
+		ConfigPath:     path,
+	}
+
+	t.Run("live and restart changes", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(path, []byte(`{
+			"address": "collector:8080",
+			"poll_interval": "1s",
+			"report_interval": "30s",
+			"rate_limit": 5,
+			"tenant": "team-b"
+		}`), 0600))
+
+		next, err := Reload(current)
+		require.NoError(t, err)
+
+		live, restart := current.Changes(next)
+		assert.Equal(t, []string{"address", "report_interval", "poll_interval", "rate_limit"}, live)
+		assert.Equal(t, []string{"tenant"}, restart)
+
+		opt := *current
+		opt.ApplyLive(next)
+		assert.Equal(t, "collector:8080", opt.FlagRunAddr)
+		assert.Equal(t, int64(30), opt.ReportInterval)
+		assert.Equal(t, int64(1), opt.PollInterval)
+		assert.Equal(t, int64(5), opt.RateLimit)
+		assert.Equal(t, "team-a", opt.Tenant)
+	})
+
+	t.Run("wrong interval", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(path, []byte(`{"poll_interval": "100ms"}`), 0600))
+		_, err := Reload(current)
+		assert.ErrorContains(t, err, "poll_interval")
+	})
+
+	t.Run("no config file", func(t *testing.T) {
+		t.Setenv("CONFIG", "")
+		_, err := Reload(&Options{})
+		assert.ErrorIs(t, err, ErrNoConfigFile)
+	})
+}
@@ -2,12 +2,20 @@
 package flags
 
 import (
-	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
+	"maps"
 	"os"
+	"slices"
 	"strconv"
-	"time"
+	"strings"
+
+	"go.uber.org/zap/zapcore"
+
+	"github.com/sanek1/metrics-collector/internal/flags/config"
+	"github.com/sanek1/metrics-collector/internal/limits"
 )
 
 type ServerOptions struct {
@@ -18,17 +26,78 @@ type ServerOptions struct {
 	DBPath        string
 	UseDatabase   bool
 	CryptoKey     string
-	ConfigPath    string
+	// BackupKeep - число хранимых предыдущих резервных копий Path.1 ... Path.N
+	BackupKeep int64
+	// CryptoKeyPassphrase - пароль зашифрованных приватных ключей
+	CryptoKeyPassphrase string
+	ConfigPath          string
+	// TenantTokens сопоставляет bearer-токены арендаторам
+	TenantTokens map[string]string
+	// APITokens - токены доступа к API с их правами
+	APITokens []APIToken
+	// TLSCert и TLSKey - сертификат и ключ сервера для HTTPS
+	TLSCert string
+	TLSKey  string
+	// TLSClientCA - удостоверяющий центр клиентских сертификатов (mTLS)
+	TLSClientCA string
+	// MaxBodySize и MaxDecompressedSize - ограничения размера тела запроса
+	// до и после распаковки в байтах, 0 - значение по умолчанию, < 0 - без ограничения
+	MaxBodySize         int64
+	MaxDecompressedSize int64
+	// TraceEndpoint - адрес OTLP/HTTP коллектора спанов
+	TraceEndpoint string
+	// TraceFile - файл, в который записываются спаны
+	TraceFile string
+	// LogLevel - уровень журнала: debug, info, warn или error
+	LogLevel string
+	// PrintConfig - вывести итоговые настройки и завершить работу
+	PrintConfig bool
+	// CheckConfig - проверить настройки и завершить работу
+	CheckConfig bool
+
+	// args - аргументы командной строки, которые сохраняют приоритет
+	// над файлом конфигурации при его перечитывании
+	args []string
 }
 
-// ServerFileConfig представляет конфигурацию сервера из файла
+// APIToken описывает bearer-токен доступа к API.
+// Scopes содержит права токена: read, write или admin.
+// Если указан Tenant, токен действует только в рамках этого арендатора.
+type APIToken struct {
+	Token  string   `json:"token"`
+	Scopes []string `json:"scopes"`
+	Tenant string   `json:"tenant,omitempty"`
+}
+
+// ServerFileConfig представляет конфигурацию сервера из файла JSON или YAML.
+// Интервалы задаются длительностью ("60s", "1m") или числом секунд, в кавычках или без.
 type ServerFileConfig struct {
-	Address       string `json:"address"`
-	Restore       bool   `json:"restore"`
-	StoreInterval string `json:"store_interval"`
-	StoreFile     string `json:"store_file"`
-	DatabaseDSN   string `json:"database_dsn"`
-	CryptoKey     string `json:"crypto_key"`
+	Address string `json:"address"`
+	// Restore - указатель, чтобы отличать restore: false от отсутствующего ключа
+	Restore       *bool           `json:"restore,omitempty"`
+	StoreInterval config.Duration `json:"store_interval"`
+	StoreFile     string          `json:"store_file"`
+	DatabaseDSN   string          `json:"database_dsn"`
+	// BackupKeep - указатель, чтобы отличать backup_keep: 0 от отсутствующего ключа
+	BackupKeep *int64 `json:"backup_keep,omitempty"`
+	// Key - ключ сервера, синоним crypto_key (переменная окружения KEY)
+	Key       string `json:"key,omitempty"`
+	CryptoKey string `json:"crypto_key"`
+	// CryptoKeyPassphrase - пароль зашифрованных приватных ключей
+	CryptoKeyPassphrase string `json:"crypto_key_passphrase"`
+	// TenantTokens сопоставляет bearer-токены арендаторам
+	TenantTokens map[string]string `json:"tenant_tokens"`
+	// APITokens - токены доступа к API с их правами
+	APITokens   []APIToken `json:"api_tokens"`
+	TLSCert     string     `json:"tls_cert"`
+	TLSKey      string     `json:"tls_key"`
+	TLSClientCA string     `json:"tls_client_ca"`
+	// MaxBodySize и MaxDecompressedSize - ограничения размера тела запроса в байтах
+	MaxBodySize         int64  `json:"max_body_size"`
+	MaxDecompressedSize int64  `json:"max_decompressed_size"`
+	TraceEndpoint       string `json:"trace_endpoint"`
+	TraceFile           string `json:"trace_file"`
+	LogLevel            string `json:"log_level"`
 }
 
 type DBSettings struct {
@@ -41,39 +110,32 @@ type DBSettings struct {
 }
 
 const (
+	defaultAddress       = ":8080"
 	defaultStoreInterval = 60
 	defaultFileName      = "File_Log_Store.json"
 	defaultRestore       = true
+	defaultBackupKeep    = 3
 	defaultDatabase      = "MetricStore"
 	defaultHost          = "localhost"
 	defaultPort          = "5432"
 	defaultUser          = "postgres"
 	defaultPassword      = "admin"
 	defaultSSLMode       = "disable"
+	defaultLogLevel      = "info"
 )
 
-// ParseDuration преобразует строку длительности в секунды
+// ParseDuration преобразует длительность ("10s" или число секунд) в секунды
 func ParseDuration(duration string) (int64, error) {
-	d, err := time.ParseDuration(duration)
-	if err != nil {
-		return 0, err
-	}
-	return int64(d.Seconds()), nil
+	return config.Seconds(duration)
 }
 
-// LoadConfig загружает конфигурацию из JSON-файла
+// LoadConfig загружает конфигурацию из файла JSON или YAML
 func LoadConfig(filePath string) (*ServerFileConfig, error) {
-	data, err := os.ReadFile(filePath)
-	if err != nil {
-		return nil, fmt.Errorf("error reading config file: %w", err)
-	}
-
-	var config ServerFileConfig
-	if err := json.Unmarshal(data, &config); err != nil {
-		return nil, fmt.Errorf("error parsing JSON: %w", err)
+	var cfg ServerFileConfig
+	if err := config.Load(filePath, &cfg); err != nil {
+		return nil, err
 	}
-
-	return &config, nil
+	return &cfg, nil
 }
 
 // ApplyFileConfig применяет настройки из конфигурационного файла
@@ -82,10 +144,12 @@ func ApplyFileConfig(opt *ServerOptions, config *ServerFileConfig) error {
 		opt.FlagRunAddr = config.Address
 	}
 
-	opt.Restore = config.Restore
+	if config.Restore != nil {
+		opt.Restore = *config.Restore
+	}
 
 	if config.StoreInterval != "" {
-		storeInterval, err := ParseDuration(config.StoreInterval)
+		storeInterval, err := ParseDuration(string(config.StoreInterval))
 		if err != nil {
 			return fmt.Errorf("wrong store_interval: %w", err)
 		}
@@ -96,87 +160,337 @@ func ApplyFileConfig(opt *ServerOptions, config *ServerFileConfig) error {
 		opt.Path = config.StoreFile
 	}
 
+	if config.BackupKeep != nil {
+		opt.BackupKeep = *config.BackupKeep
+	}
+
 	if config.DatabaseDSN != "" {
 		opt.DBPath = config.DatabaseDSN
 		opt.UseDatabase = true
 	}
 
+	if config.Key != "" {
+		opt.CryptoKey = config.Key
+	}
+
 	if config.CryptoKey != "" {
 		opt.CryptoKey = config.CryptoKey
 	}
 
+	if config.CryptoKeyPassphrase != "" {
+		opt.CryptoKeyPassphrase = config.CryptoKeyPassphrase
+	}
+
+	if len(config.TenantTokens) != 0 {
+		opt.TenantTokens = config.TenantTokens
+	}
+
+	if len(config.APITokens) != 0 {
+		opt.APITokens = config.APITokens
+	}
+
+	if config.TLSCert != "" {
+		opt.TLSCert = config.TLSCert
+	}
+
+	if config.TLSKey != "" {
+		opt.TLSKey = config.TLSKey
+	}
+
+	if config.TLSClientCA != "" {
+		opt.TLSClientCA = config.TLSClientCA
+	}
+
+	if config.MaxBodySize != 0 {
+		opt.MaxBodySize = config.MaxBodySize
+	}
+
+	if config.MaxDecompressedSize != 0 {
+		opt.MaxDecompressedSize = config.MaxDecompressedSize
+	}
+
+	if config.TraceEndpoint != "" {
+		opt.TraceEndpoint = config.TraceEndpoint
+	}
+
+	if config.TraceFile != "" {
+		opt.TraceFile = config.TraceFile
+	}
+
+	if config.LogLevel != "" {
+		opt.LogLevel = config.LogLevel
+	}
+
 	return nil
 }
 
+// ParseServerFlags собирает настройки сервера из аргументов командной строки,
+// переменных окружения и файла конфигурации. При ошибке в настройках
+// выводит все найденные ошибки и завершает процесс.
 func ParseServerFlags() *ServerOptions {
-	opt := &ServerOptions{}
-	defaultPathDB := initDefaulthPathDB()
-	flag.StringVar(&opt.FlagRunAddr, "a", ":8080", "address and port to run server")
-	flag.Int64Var(&opt.StoreInterval, "i", defaultStoreInterval, "address and port to run server")
-	flag.StringVar(&opt.Path, "f", defaultFileName, "address and port to run server")
-	flag.BoolVar(&opt.Restore, "r", defaultRestore, "address and port to run server")
-	flag.StringVar(&opt.DBPath, "d", defaultPathDB, "address and port to run server")
-	flag.StringVar(&opt.CryptoKey, "k", "", "key to encrypt/decrypt metrics")
-	flag.StringVar(&opt.CryptoKey, "crypto-key", "", "path to private key file for decryption")
-	flag.StringVar(&opt.ConfigPath, "c", "", "path to config file")
-	flag.StringVar(&opt.ConfigPath, "config", "", "path to config file")
-
-	flag.Parse()
-	if len(flag.Args()) > 0 {
-		fmt.Fprintln(os.Stderr, "Unknown flags:", flag.Args())
-		os.Exit(1)
-	}
-
-	configPath := opt.ConfigPath
-	if configPath == "" {
-		configPath = os.Getenv("CONFIG")
-	}
-
-	if configPath != "" {
-		if cfg, err := LoadConfig(configPath); err == nil {
-			if err := ApplyFileConfig(opt, cfg); err != nil {
-				fmt.Fprintf(os.Stderr, "Error applying configuration: %v\n", err)
-			}
-		} else {
-			fmt.Fprintf(os.Stderr, "Error loading configuration: %v\n", err)
-		}
+	opt, err := Load(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
 	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid configuration:\n%v\n", err)
+		os.Exit(2)
+	}
+	return opt
+}
 
-	if addr := os.Getenv("ADDRESS"); addr != "" {
-		opt.FlagRunAddr = addr
+// Load собирает и проверяет настройки сервера. Приоритет источников:
+// флаги командной строки args > переменные окружения > файл конфигурации > значения по умолчанию.
+func Load(args []string) (*ServerOptions, error) {
+	opt := defaultOptions()
+	if err := opt.load(args); err != nil {
+		return nil, err
 	}
+	return opt, nil
+}
 
-	if interval, err := strconv.ParseInt(os.Getenv("STORE_INTERVAL"), 10, 64); err == nil {
-		opt.StoreInterval = interval
+func defaultOptions() *ServerOptions {
+	return &ServerOptions{
+		FlagRunAddr:         defaultAddress,
+		StoreInterval:       defaultStoreInterval,
+		Path:                defaultFileName,
+		Restore:             defaultRestore,
+		BackupKeep:          defaultBackupKeep,
+		DBPath:              initDefaulthPathDB(),
+		MaxBodySize:         limits.DefaultMaxBodySize,
+		MaxDecompressedSize: limits.DefaultMaxDecompressedSize,
+		LogLevel:            defaultLogLevel,
 	}
+}
+
+// newFlagSet связывает флаги с полями opt. Значениями по умолчанию
+// становятся текущие значения полей, поэтому повторный разбор args
+// меняет только явно переданные флаги.
+func newFlagSet(opt *ServerOptions) *flag.FlagSet {
+	fs := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+	fs.StringVar(&opt.FlagRunAddr, "a", opt.FlagRunAddr, "address and port to run server")
+	fs.Var(secondsValue{&opt.StoreInterval}, "i", "store interval: seconds or duration (60s); 0 and 1s save synchronously on every update")
+	fs.StringVar(&opt.Path, "f", opt.Path, "path to the metrics backup file")
+	fs.BoolVar(&opt.Restore, "r", opt.Restore, "restore metrics from the backup file on start")
+	fs.Int64Var(&opt.BackupKeep, "backup-keep", opt.BackupKeep, "number of previous backup files to keep")
+	fs.StringVar(&opt.DBPath, "d", opt.DBPath, "database connection string")
+	fs.StringVar(&opt.CryptoKey, "k", opt.CryptoKey, "key to encrypt/decrypt metrics")
+	fs.StringVar(&opt.CryptoKey, "crypto-key", opt.CryptoKey, "private key files or directories for decryption, comma separated")
+	fs.StringVar(&opt.ConfigPath, "c", opt.ConfigPath, "path to config file (JSON or YAML)")
+	fs.StringVar(&opt.ConfigPath, "config", opt.ConfigPath, "path to config file (JSON or YAML)")
+	fs.StringVar(&opt.TLSCert, "tls-cert", opt.TLSCert, "path to server TLS certificate")
+	fs.StringVar(&opt.TLSKey, "tls-key", opt.TLSKey, "path to server TLS private key")
+	fs.StringVar(&opt.TLSClientCA, "tls-client-ca", opt.TLSClientCA, "path to CA certificate used to verify client certificates")
+	fs.Int64Var(&opt.MaxBodySize, "max-body-size", opt.MaxBodySize, "maximum request body size in bytes, negative disables the limit")
+	fs.Int64Var(&opt.MaxDecompressedSize, "max-decompressed-size", opt.MaxDecompressedSize, "maximum decompressed request body size in bytes, negative disables the limit")
+
+	fs.StringVar(&opt.TraceEndpoint, "trace-endpoint", opt.TraceEndpoint, "OTLP/HTTP collector address for trace spans")
+	fs.StringVar(&opt.TraceFile, "trace-file", opt.TraceFile, "file to write trace spans to")
+	fs.StringVar(&opt.LogLevel, "log-level", opt.LogLevel, "log level: debug, info, warn or error")
+	fs.BoolVar(&opt.PrintConfig, "print-config", opt.PrintConfig, "print effective configuration and exit")
+	fs.BoolVar(&opt.CheckConfig, "check-config", opt.CheckConfig, "validate configuration and exit")
+	return fs
+}
 
-	if path := os.Getenv("FILE_STORAGE_PATH"); path != "" {
-		opt.Path = path
+// load применяет к opt файл конфигурации, переменные окружения и флаги args
+// и проверяет результат. Флаги разбираются дважды: сначала чтобы узнать путь
+// к файлу конфигурации, затем поверх файла и окружения, чтобы иметь наивысший приоритет.
+func (o *ServerOptions) load(args []string) error {
+	fs := newFlagSet(o)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("unknown arguments: %v", fs.Args())
+	}
+
+	if path := o.configPath(); path != "" {
+		cfg, err := LoadConfig(path)
+		if err != nil {
+			return err
+		}
+		if err := ApplyFileConfig(o, cfg); err != nil {
+			return err
+		}
 	}
 
-	if restore, err := strconv.ParseBool(os.Getenv("RESTORE")); err == nil {
-		opt.Restore = restore
+	// ошибки окружения выводятся вместе с ошибками проверки
+	envErr := applyEnv(o)
+
+	if err := newFlagSet(o).Parse(args); err != nil {
+		return err
 	}
+	o.UseDatabase = o.DBPath != ""
+	o.args = args
+	return errors.Join(envErr, o.Validate())
+}
 
-	if dbPath := os.Getenv("DATABASE_DSN"); dbPath != "" {
-		opt.DBPath = dbPath
+// configPath возвращает путь к файлу конфигурации из флага или переменной CONFIG.
+func (o *ServerOptions) configPath() string {
+	if o.ConfigPath != "" {
+		return o.ConfigPath
 	}
+	return os.Getenv("CONFIG")
+}
 
-	if opt.DBPath != "" {
-		opt.UseDatabase = true
-	} else {
-		opt.UseDatabase = false
+// applyEnv применяет переменные окружения поверх файла конфигурации.
+// Возвращает ошибки разбора всех некорректных переменных.
+func applyEnv(opt *ServerOptions) error {
+	env := config.NewEnv(os.Getenv)
+	env.String("ADDRESS", &opt.FlagRunAddr)
+	env.Seconds("STORE_INTERVAL", &opt.StoreInterval)
+	env.String("FILE_STORAGE_PATH", &opt.Path)
+	env.Bool("RESTORE", &opt.Restore)
+	env.Int64("BACKUP_KEEP", &opt.BackupKeep)
+	env.String("DATABASE_DSN", &opt.DBPath)
+	env.String("KEY", &opt.CryptoKey)
+	env.String("CRYPTO_KEY", &opt.CryptoKey)
+	env.String("CRYPTO_KEY_PASSPHRASE", &opt.CryptoKeyPassphrase)
+	env.String("TLS_CERT", &opt.TLSCert)
+	env.String("TLS_KEY", &opt.TLSKey)
+	env.String("TLS_CLIENT_CA", &opt.TLSClientCA)
+	env.Int64("MAX_BODY_SIZE", &opt.MaxBodySize)
+	env.Int64("MAX_DECOMPRESSED_SIZE", &opt.MaxDecompressedSize)
+	env.String("OTEL_EXPORTER_OTLP_ENDPOINT", &opt.TraceEndpoint)
+	env.String("TRACE_FILE", &opt.TraceFile)
+	env.String("LOG_LEVEL", &opt.LogLevel)
+	return env.Err()
+}
+
+// apiScopes - допустимые права токенов API
+var apiScopes = []string{"read", "write", "admin"}
+
+// Validate проверяет настройки и возвращает все найденные ошибки.
+// Имена параметров в ошибках совпадают с ключами файла конфигурации.
+func (o *ServerOptions) Validate() error {
+	var errs config.Errors
+	if o.FlagRunAddr == "" {
+		errs.Addf("address", "must not be empty")
+	}
+	if o.StoreInterval < 0 {
+		errs.Addf("store_interval", "must not be negative, got %ds", o.StoreInterval)
+	}
+	if o.BackupKeep < 0 {
+		errs.Addf("backup_keep", "must not be negative, got %d", o.BackupKeep)
+	}
+	if _, err := zapcore.ParseLevel(o.LogLevel); err != nil {
+		errs.Addf("log_level", "unknown level %q, use debug, info, warn or error", o.LogLevel)
+	}
+	o.validateTLS(&errs)
+	for i, t := range o.APITokens {
+		if t.Token == "" {
+			errs.Addf(fmt.Sprintf("api_tokens[%d]", i), "token must not be empty")
+		}
+		if len(t.Scopes) == 0 {
+			errs.Addf(fmt.Sprintf("api_tokens[%d]", i), "scopes must not be empty")
+		}
+		for _, scope := range t.Scopes {
+			if !slices.Contains(apiScopes, scope) {
+				errs.Addf(fmt.Sprintf("api_tokens[%d]", i), "unknown scope %q, use %s", scope, strings.Join(apiScopes, ", "))
+			}
+		}
+	}
+	return errs.Err()
+}
+
+// FileConfig возвращает настройки в виде файла конфигурации.
+// Секреты, включая ключ подписи, и пароль в строке подключения заменяются маской.
+func (o *ServerOptions) FileConfig() *ServerFileConfig {
+	cfg := &ServerFileConfig{
+		Address:             o.FlagRunAddr,
+		Restore:             &o.Restore,
+		StoreInterval:       config.Duration(config.FormatSeconds(o.StoreInterval)),
+		StoreFile:           o.Path,
+		BackupKeep:          &o.BackupKeep,
+		CryptoKey:           config.SecretOrPath(o.CryptoKey),
+		CryptoKeyPassphrase: config.Secret(o.CryptoKeyPassphrase),
+		TLSCert:             o.TLSCert,
+		TLSKey:              o.TLSKey,
+		TLSClientCA:         o.TLSClientCA,
+		MaxBodySize:         o.MaxBodySize,
+		MaxDecompressedSize: o.MaxDecompressedSize,
+		TraceEndpoint:       o.TraceEndpoint,
+		TraceFile:           o.TraceFile,
+		LogLevel:            o.LogLevel,
 	}
+	if o.UseDatabase {
+		cfg.DatabaseDSN = config.RedactDSN(o.DBPath)
+	}
+	if len(o.TenantTokens) != 0 {
+		cfg.TenantTokens = make(map[string]string, len(o.TenantTokens))
+		i := 0
+		for _, token := range slices.Sorted(maps.Keys(o.TenantTokens)) {
+			i++
+			cfg.TenantTokens[fmt.Sprintf("%s%d", config.Mask, i)] = o.TenantTokens[token]
+		}
+	}
+	for _, t := range o.APITokens {
+		t.Token = config.Secret(t.Token)
+		cfg.APITokens = append(cfg.APITokens, t)
+	}
+	return cfg
+}
+
+// WriteConfig выводит итоговые настройки в формате файла конфигурации.
+func (o *ServerOptions) WriteConfig(w io.Writer) error {
+	return config.Print(w, o.FileConfig())
+}
+
+// secondsValue - флаг длительности в секундах: число секунд или длительность Go.
+type secondsValue struct {
+	seconds *int64
+}
+
+func (v secondsValue) String() string {
+	if v.seconds == nil {
+		return ""
+	}
+	return strconv.FormatInt(*v.seconds, 10)
+}
 
-	if key := os.Getenv("KEY"); key != "" {
-		opt.CryptoKey = key
+func (v secondsValue) Set(s string) error {
+	n, err := config.Seconds(s)
+	if err != nil {
+		return err
 	}
+	*v.seconds = n
+	return nil
+}
 
-	if path := os.Getenv("CRYPTO_KEY"); path != "" {
-		opt.CryptoKey = path
+// BodyLimits возвращает ограничения размера тела запроса до и после распаковки
+// с учетом значений по умолчанию. Значение <= 0 означает отсутствие ограничения.
+func (o *ServerOptions) BodyLimits() (maxBody, maxDecompressed int64) {
+	maxBody, maxDecompressed = o.MaxBodySize, o.MaxDecompressedSize
+	if maxBody == 0 {
+		maxBody = limits.DefaultMaxBodySize
 	}
+	if maxDecompressed == 0 {
+		maxDecompressed = limits.DefaultMaxDecompressedSize
+	}
+	return maxBody, maxDecompressed
+}
 
-	return opt
+// UseTLS сообщает, должен ли сервер принимать соединения по HTTPS.
+func (o *ServerOptions) UseTLS() bool {
+	return o.TLSCert != ""
+}
+
+// ValidateTLS проверяет только настройки TLS. Сервер проверяет их перед
+// запуском: удостоверяющий центр клиентских сертификатов без сертификата
+// сервера иначе привел бы к запуску без HTTPS.
+func (o *ServerOptions) ValidateTLS() error {
+	var errs config.Errors
+	o.validateTLS(&errs)
+	return errs.Err()
+}
+
+func (o *ServerOptions) validateTLS(errs *config.Errors) {
+	if (o.TLSCert == "") != (o.TLSKey == "") {
+		errs.Addf("tls_cert", "tls_cert and tls_key must be set together")
+	}
+	if o.TLSClientCA != "" && !o.UseTLS() {
+		errs.Addf("tls_client_ca", "requires tls_cert and tls_key")
+	}
 }
 
 func initDefaulthPathDB() string {
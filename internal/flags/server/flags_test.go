@@ -1,6 +1,7 @@
 package flags
 
 import (
+	"bytes"
 	"flag"
 	"os"
 	"path/filepath"
@@ -99,9 +100,9 @@ func TestParseServerFlags(t *testing.T) {
 		assert.Equal(t, "envkey", opt.CryptoKey)
 	})
 
-	t.Run("env overrides flags", func(t *testing.T) {
+	t.Run("flags override env", func(t *testing.T) {
 		flag.CommandLine = flag.NewFlagSet("test", flag.ExitOnError)
-		os.Args = []string{"test", "-a", ":9090", "-i", "120", "-f", "custom.json", "-r=false", "-d", "postgres://test", "-k", "testkey"}
+		os.Args = []string{"test", "-a", ":9090", "-i", "120", "-r=false", "-d", "postgres://test", "-k", "testkey"}
 		_ = os.Setenv("ADDRESS", ":7070")
 		_ = os.Setenv("STORE_INTERVAL", "180")
 		_ = os.Setenv("FILE_STORAGE_PATH", "env.json")
@@ -110,13 +111,13 @@ func TestParseServerFlags(t *testing.T) {
 		_ = os.Setenv("KEY", "envkey")
 
 		opt := ParseServerFlags()
-		assert.Equal(t, ":7070", opt.FlagRunAddr)
-		assert.Equal(t, int64(180), opt.StoreInterval)
-		assert.Equal(t, "env.json", opt.Path)
-		assert.Equal(t, true, opt.Restore)
-		assert.Equal(t, "postgres://env", opt.DBPath)
+		assert.Equal(t, ":9090", opt.FlagRunAddr)
+		assert.Equal(t, int64(120), opt.StoreInterval)
+		assert.Equal(t, "env.json", opt.Path, "env applies to flags that were not passed")
+		assert.Equal(t, false, opt.Restore)
+		assert.Equal(t, "postgres://test", opt.DBPath)
 		assert.Equal(t, true, opt.UseDatabase)
-		assert.Equal(t, "envkey", opt.CryptoKey)
+		assert.Equal(t, "testkey", opt.CryptoKey)
 	})
 
 	t.Run("database connection test", func(t *testing.T) {
@@ -238,3 +239,132 @@ func TestParseServerFlags(t *testing.T) {
 		assert.Equal(t, "env_override_key", opt.CryptoKey)
 	})
 }
+
+func TestApplyFileConfig_TLS(t *testing.T) {
+	cfg := &ServerFileConfig{
+		TLSCert:     "server.crt",
+		TLSKey:      "server.key",
+		TLSClientCA: "ca.crt",
+	}
+	opt := &ServerOptions{}
+	require.NoError(t, ApplyFileConfig(opt, cfg))
+
+	assert.Equal(t, "server.crt", opt.TLSCert)
+	assert.Equal(t, "server.key", opt.TLSKey)
+	assert.Equal(t, "ca.crt", opt.TLSClientCA)
+	assert.True(t, opt.UseTLS())
+	assert.False(t, (&ServerOptions{}).UseTLS())
+}
+
+func TestValidateTLS(t *testing.T) {
+	tests := []struct {
+		name    string
+		opt     ServerOptions
+		wantErr string
+	}{
+		{name: "plain HTTP", opt: ServerOptions{}},
+		{name: "TLS", opt: ServerOptions{TLSCert: "server.crt", TLSKey: "server.key"}},
+		{name: "mTLS", opt: ServerOptions{TLSCert: "server.crt", TLSKey: "server.key", TLSClientCA: "ca.crt"}},
+		{name: "cert without key", opt: ServerOptions{TLSCert: "server.crt"}, wantErr: "tls_cert:"},
+		{name: "client CA without cert", opt: ServerOptions{TLSClientCA: "ca.crt"}, wantErr: "tls_client_ca:"},
+		{name: "client CA with key only", opt: ServerOptions{TLSKey: "server.key", TLSClientCA: "ca.crt"}, wantErr: "tls_client_ca:"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.opt.ValidateTLS()
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+
+	clearEnv(t)
+	_, err := Load([]string{"-tls-client-ca", "ca.crt"})
+	assert.ErrorContains(t, err, "tls_client_ca:", "client CA alone must not start plain HTTP")
+}
+
+// clearEnv сбрасывает переменные окружения сервера, оставленные другими тестами.
+func clearEnv(t *testing.T) {
+	for _, env := range []string{"ADDRESS", "STORE_INTERVAL", "FILE_STORAGE_PATH", "RESTORE", "BACKUP_KEEP", "DATABASE_DSN", "KEY",
+		"CRYPTO_KEY", "CRYPTO_KEY_PASSPHRASE", "MAX_BODY_SIZE", "LOG_LEVEL", "CONFIG"} {
+		t.Setenv(env, "")
+	}
+}
+
+func TestLoad_Precedence(t *testing.T) {
+	clearEnv(t)
+	path := filepath.Join(t.TempDir(), "server.yml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+address: ":5000"
+store_interval: 2m
+store_file: file.json
+database_dsn: postgres://file@localhost/db
+log_level: warn
+`), 0600))
+	t.Setenv("STORE_INTERVAL", "15")
+	t.Setenv("LOG_LEVEL", "debug")
+
+	opt, err := Load([]string{"-c", path, "-log-level", "error"})
+	require.NoError(t, err)
+
+	assert.Equal(t, ":5000", opt.FlagRunAddr, "file overrides defaults")
+	assert.Equal(t, "file.json", opt.Path)
+	assert.Equal(t, "postgres://file@localhost/db", opt.DBPath)
+	assert.True(t, opt.UseDatabase)
+	assert.True(t, opt.Restore, "restore keeps its default when the file does not set it")
+	assert.Equal(t, int64(15), opt.StoreInterval, "env overrides file")
+	assert.Equal(t, "error", opt.LogLevel, "flags override env")
+}
+
+func TestLoad_Errors(t *testing.T) {
+	clearEnv(t)
+
+	t.Run("env parse errors", func(t *testing.T) {
+		t.Setenv("STORE_INTERVAL", "often")
+		t.Setenv("RESTORE", "yes please")
+		t.Setenv("MAX_BODY_SIZE", "1MB")
+		_, err := Load(nil)
+		require.Error(t, err)
+		assert.ErrorContains(t, err, "STORE_INTERVAL")
+		assert.ErrorContains(t, err, "RESTORE")
+		assert.ErrorContains(t, err, "MAX_BODY_SIZE")
+	})
+
+	t.Run("validation", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "server.json")
+		require.NoError(t, os.WriteFile(path, []byte(`{
+			"api_tokens": [{"token": "t1", "scopes": ["root"]}],
+			"tls_client_ca": "ca.pem"
+		}`), 0600))
+		_, err := Load([]string{"-config", path, "-log-level", "loud", "-a", "", "-backup-keep", "-1"})
+		require.Error(t, err)
+		for _, name := range []string{"address", "log_level", "tls_client_ca", "api_tokens[0]", "backup_keep"} {
+			assert.ErrorContains(t, err, name+":")
+		}
+	})
+}
+
+func TestWriteConfig(t *testing.T) {
+	clearEnv(t)
+	t.Setenv("CRYPTO_KEY_PASSPHRASE", "pass")
+	opt, err := Load([]string{"-d", "host=db user=metrics password=hunter2", "-r=false", "-i", "0", "-backup-keep", "0", "-k", "hmac-secret"})
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	require.NoError(t, opt.WriteConfig(&buf))
+	assert.NotContains(t, buf.String(), "hunter2")
+	assert.NotContains(t, buf.String(), `"pass"`)
+	assert.NotContains(t, buf.String(), "hmac-secret", "signing key is masked")
+
+	path := filepath.Join(t.TempDir(), "printed.json")
+	require.NoError(t, os.WriteFile(path, buf.Bytes(), 0600))
+	cfg, err := LoadConfig(path)
+	require.NoError(t, err, "printed configuration must be a valid config file")
+	assert.EqualValues(t, "0s", cfg.StoreInterval)
+	require.NotNil(t, cfg.Restore)
+	assert.False(t, *cfg.Restore)
+	require.NotNil(t, cfg.BackupKeep)
+	assert.Equal(t, int64(0), *cfg.BackupKeep)
+}
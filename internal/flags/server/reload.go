@@ -0,0 +1,95 @@
+package flags
+
+import (
+	"errors"
+	"maps"
+	"slices"
+)
+
+// ErrNoConfigFile - путь к файлу конфигурации не задан, перечитывать нечего
+var ErrNoConfigFile = errors.New("config file is not set")
+
+// option описывает параметр конфигурации для сравнения при перечитывании.
+// name совпадает с ключом в файле конфигурации.
+type option struct {
+	name string
+	// live - параметр применяется без перезапуска сервера
+	live  bool
+	equal func(a, b *ServerOptions) bool
+}
+
+var reloadOptions = []option{
+	{name: "address", equal: func(a, b *ServerOptions) bool { return a.FlagRunAddr == b.FlagRunAddr }},
+	{name: "store_interval", live: true, equal: func(a, b *ServerOptions) bool { return a.StoreInterval == b.StoreInterval }},
+	{name: "store_file", equal: func(a, b *ServerOptions) bool { return a.Path == b.Path }},
+	{name: "backup_keep", live: true, equal: func(a, b *ServerOptions) bool { return a.BackupKeep == b.BackupKeep }},
+	{name: "restore", equal: func(a, b *ServerOptions) bool { return a.Restore == b.Restore }},
+	{name: "database_dsn", equal: func(a, b *ServerOptions) bool {
+		return a.DBPath == b.DBPath && a.UseDatabase == b.UseDatabase
+	}},
+	{name: "crypto_key", live: true, equal: func(a, b *ServerOptions) bool { return a.CryptoKey == b.CryptoKey }},
+	{name: "crypto_key_passphrase", live: true, equal: func(a, b *ServerOptions) bool {
+		return a.CryptoKeyPassphrase == b.CryptoKeyPassphrase
+	}},
+	{name: "tenant_tokens", equal: func(a, b *ServerOptions) bool { return maps.Equal(a.TenantTokens, b.TenantTokens) }},
+	{name: "api_tokens", equal: func(a, b *ServerOptions) bool {
+		return slices.EqualFunc(a.APITokens, b.APITokens, func(x, y APIToken) bool {
+			return x.Token == y.Token && x.Tenant == y.Tenant && slices.Equal(x.Scopes, y.Scopes)
+		})
+	}},
+	{name: "tls_cert", equal: func(a, b *ServerOptions) bool { return a.TLSCert == b.TLSCert }},
+	{name: "tls_key", equal: func(a, b *ServerOptions) bool { return a.TLSKey == b.TLSKey }},
+	{name: "tls_client_ca", equal: func(a, b *ServerOptions) bool { return a.TLSClientCA == b.TLSClientCA }},
+	{name: "max_body_size", live: true, equal: func(a, b *ServerOptions) bool { return a.MaxBodySize == b.MaxBodySize }},
+	{name: "max_decompressed_size", live: true, equal: func(a, b *ServerOptions) bool {
+		return a.MaxDecompressedSize == b.MaxDecompressedSize
+	}},
+	{name: "trace_endpoint", equal: func(a, b *ServerOptions) bool { return a.TraceEndpoint == b.TraceEndpoint }},
+	{name: "trace_file", equal: func(a, b *ServerOptions) bool { return a.TraceFile == b.TraceFile }},
+	{name: "log_level", live: true, equal: func(a, b *ServerOptions) bool { return a.LogLevel == b.LogLevel }},
+}
+
+// Reload перечитывает файл конфигурации и возвращает новые настройки на основе current.
+// Приоритеты те же, что при запуске: значения из файла заменяют текущие,
+// переменные окружения - значения из файла, а флаги командной строки - все остальное.
+// Параметры, которых нет в файле, не меняются.
+func Reload(current *ServerOptions) (*ServerOptions, error) {
+	if current.configPath() == "" {
+		return nil, ErrNoConfigFile
+	}
+	next := *current
+	if err := next.load(current.args); err != nil {
+		return nil, err
+	}
+	return &next, nil
+}
+
+// Changes возвращает имена параметров, которые в next отличаются от текущих:
+// live применяются без перезапуска, restart - только после перезапуска сервера.
+func (o *ServerOptions) Changes(next *ServerOptions) (live, restart []string) {
+	for _, opt := range reloadOptions {
+		if opt.equal(o, next) {
+			continue
+		}
+		if opt.live {
+			live = append(live, opt.name)
+		} else {
+			restart = append(restart, opt.name)
+		}
+	}
+	return live, restart
+}
+
+// WithLive возвращает копию текущих настроек, в которой параметры,
+// применяемые без перезапуска, взяты из next.
+func (o *ServerOptions) WithLive(next *ServerOptions) *ServerOptions {
+	applied := *o
+	applied.StoreInterval = next.StoreInterval
+	applied.BackupKeep = next.BackupKeep
+	applied.CryptoKey = next.CryptoKey
+	applied.CryptoKeyPassphrase = next.CryptoKeyPassphrase
+	applied.MaxBodySize = next.MaxBodySize
+	applied.MaxDecompressedSize = next.MaxDecompressedSize
+	applied.LogLevel = next.LogLevel
+	return &applied
+}
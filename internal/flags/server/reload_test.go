@@ -0,0 +1,81 @@
+package flags
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReload(t *testing.T) {
+	for _, env := range []string{"ADDRESS", "STORE_INTERVAL", "RESTORE", "KEY", "CRYPTO_KEY", "MAX_BODY_SIZE", "LOG_LEVEL"} {
+		t.Setenv(env, "")
+	}
+	path := filepath.Join(t.TempDir(), "config.json")
+	current := &ServerOptions{
+		FlagRunAddr:   ":8080",
+		StoreInterval: 60,
+		Path:          "metrics.json",
+		Restore:       true,
+		CryptoKey:     "old",
+		MaxBodySize:   1024,
+		LogLevel:      "info",
+		ConfigPath:    path,
+	}
+
+	t.Run("live and restart changes", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(path, []byte(`{
+			"address": ":9090",
+			"restore": true,
+			"store_interval": "5s",
+			"crypto_key": "new",
+			"max_body_size": 2048,
+			"log_level": "debug"
+		}`), 0600))
+
+		next, err := Reload(current)
+		require.NoError(t, err)
+
+		live, restart := current.Changes(next)
+		assert.Equal(t, []string{"store_interval", "crypto_key", "max_body_size", "log_level"}, live)
+		assert.Equal(t, []string{"address"}, restart)
+
+		applied := current.WithLive(next)
+		assert.Equal(t, ":8080", applied.FlagRunAddr)
+		assert.Equal(t, int64(5), applied.StoreInterval)
+		assert.Equal(t, "new", applied.CryptoKey)
+		assert.Equal(t, int64(2048), applied.MaxBodySize)
+		assert.Equal(t, "debug", applied.LogLevel)
+		assert.Equal(t, ":8080", current.FlagRunAddr, "current options must not change")
+		assert.Equal(t, "old", current.CryptoKey, "current options must not change")
+	})
+
+	t.Run("unchanged file", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(path, []byte(`{"restore": true}`), 0600))
+		next, err := Reload(current)
+		require.NoError(t, err)
+		live, restart := current.Changes(next)
+		assert.Empty(t, live)
+		assert.Empty(t, restart)
+	})
+
+	t.Run("wrong log level", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(path, []byte(`{"restore": true, "log_level": "loud"}`), 0600))
+		_, err := Reload(current)
+		assert.ErrorContains(t, err, "log_level")
+	})
+
+	t.Run("broken file", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(path, []byte(`{`), 0600))
+		_, err := Reload(current)
+		assert.Error(t, err)
+	})
+
+	t.Run("no config file", func(t *testing.T) {
+		t.Setenv("CONFIG", "")
+		_, err := Reload(&ServerOptions{})
+		assert.ErrorIs(t, err, ErrNoConfigFile)
+	})
+}
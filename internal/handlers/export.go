@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/sanek1/metrics-collector/internal/apierror"
+	m "github.com/sanek1/metrics-collector/internal/models"
+	"github.com/sanek1/metrics-collector/internal/payload"
+)
+
+// ExportService выгружает все метрики арендатора в формате CSV или JSON
+// (параметр format, по умолчанию json). Метрики читаются из хранилища
+// и пишутся в ответ потоком. CSV можно загрузить обратно через ImportService.
+func (s *Services) ExportService(c *gin.Context) {
+	ctx := c.Request.Context()
+	format := c.DefaultQuery("format", payload.FormatJSON)
+
+	var (
+		write func(m.Metrics) error
+		flush func() error
+	)
+	buf := bufio.NewWriter(c.Writer)
+	switch format {
+	case payload.FormatCSV:
+		c.Header("Content-Type", payload.ContentTypeCSV+"; charset=utf-8")
+		c.Header("Content-Disposition", `attachment; filename="metrics.csv"`)
+		cw := payload.NewCSVWriter(buf)
+		write, flush = cw.Write, cw.Flush
+	case payload.FormatJSON:
+		c.Header("Content-Type", payload.ContentTypeJSON)
+		write, flush = jsonArrayWriter(buf)
+	default:
+		apierror.Abort(c, http.StatusBadRequest, apierror.CodeBadRequest, "unsupported export format", format)
+		return
+	}
+	c.Status(http.StatusOK)
+
+	count := 0
+	err := s.s.ListMetrics(ctx, func(metric m.Metrics) error {
+		count++
+		return write(metric)
+	})
+	if err == nil {
+		err = flush()
+	}
+	if err == nil {
+		err = buf.Flush()
+	}
+	if err != nil {
+		// заголовки уже отправлены, клиент увидит оборванный ответ
+		s.logger.ErrorCtx(ctx, "Export failed", zap.String("format", format), zap.Int("exported", count), zap.Error(err))
+		_ = c.Error(err)
+		c.Abort()
+		return
+	}
+	s.logger.InfoCtx(ctx, "Export completed", zap.String("format", format), zap.Int("exported", count))
+}
+
+// jsonArrayWriter возвращает функции потоковой записи массива JSON.
+func jsonArrayWriter(w *bufio.Writer) (write func(m.Metrics) error, flush func() error) {
+	enc := json.NewEncoder(w)
+	first := true
+	write = func(metric m.Metrics) error {
+		sep := ","
+		if first {
+			sep, first = "[", false
+		}
+		if _, err := w.WriteString(sep); err != nil {
+			return err
+		}
+		return enc.Encode(metric)
+	}
+	flush = func() error {
+		if first {
+			_, err := w.WriteString("[]\n")
+			return err
+		}
+		_, err := w.WriteString("]\n")
+		return err
+	}
+	return write, flush
+}
@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go.uber.org/zap"
+
+	"github.com/sanek1/metrics-collector/internal/storage/server/mocks"
+	l "github.com/sanek1/metrics-collector/pkg/logging"
+)
+
+func TestExportService(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	logger, _ := l.NewZapLogger(zap.InfoLevel)
+
+	export := func(st *mocks.Storage, query string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodGet, "/api/v1/export"+query, nil)
+		NewHandlerServices(st, nil, "", logger).ExportService(c)
+		return w
+	}
+
+	t.Run("empty json", func(t *testing.T) {
+		st := mocks.NewStorage(t)
+		st.On("ListMetrics", mock.Anything, mock.Anything).Return(nil).Once()
+
+		w := export(st, "")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "[]\n", w.Body.String())
+	})
+
+	t.Run("empty csv", func(t *testing.T) {
+		st := mocks.NewStorage(t)
+		st.On("ListMetrics", mock.Anything, mock.Anything).Return(nil).Once()
+
+		w := export(st, "?format=csv")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "id,type,delta,value\n", w.Body.String())
+	})
+
+	t.Run("storage error", func(t *testing.T) {
+		st := mocks.NewStorage(t)
+		st.On("ListMetrics", mock.Anything, mock.Anything).Return(errors.New("db is down")).Once()
+
+		w := export(st, "?format=json")
+		assert.Empty(t, w.Body.String())
+	})
+}
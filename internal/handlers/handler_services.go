@@ -3,34 +3,55 @@ package handlers
 
 import (
 	"bytes"
-	"compress/gzip"
 	"context"
-	"crypto/rsa"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"strconv"
+	"strings"
+	"sync"
 
 	"github.com/gin-gonic/gin"
 	m "github.com/sanek1/metrics-collector/internal/models"
 	storage "github.com/sanek1/metrics-collector/internal/storage/server"
 	l "github.com/sanek1/metrics-collector/pkg/logging"
+	"go.opentelemetry.io/otel/attribute"
 	"go.uber.org/zap"
 
+	"github.com/sanek1/metrics-collector/internal/apierror"
+	"github.com/sanek1/metrics-collector/internal/compression"
 	"github.com/sanek1/metrics-collector/internal/crypto"
+	"github.com/sanek1/metrics-collector/internal/limits"
+	"github.com/sanek1/metrics-collector/internal/payload"
+	"github.com/sanek1/metrics-collector/internal/tracing"
+)
+
+// Ошибки разбора тела запроса, по которым классифицируются отклоненные запросы
+var (
+	// ErrDecompress - тело не удалось распаковать
+	ErrDecompress = errors.New("decompression")
+	// ErrDecrypt - тело не удалось расшифровать
+	ErrDecrypt = errors.New("decryption")
+	// ErrReservedName - имя метрики начинается с зарезервированного префикса
+	ErrReservedName = errors.New("reserved metric name")
 )
 
 // Services предоставляет сервисы для обработки метрик.
 // Реализует бизнес-логику для работы с различными типами метрик
 // и обеспечивает взаимодействие между хранилищем и HTTP-обработчиками.
 type Services struct {
-	s          storage.Storage
-	models     *[]m.Metrics
-	logger     *l.ZapLogger
-	hashKey    *string
-	privateKey *rsa.PrivateKey
+	s       storage.Storage
+	models  *[]m.Metrics
+	logger  *l.ZapLogger
+	hashKey *string
+	// mu защищает ключи и ограничения, которые меняются при перечитывании конфигурации
+	mu         sync.RWMutex
+	keys       *crypto.KeyRing
 	useDecrypt bool
+	// maxDecompressedSize - ограничение размера распакованного тела запроса
+	maxDecompressedSize int64
 }
 
 // HServices определяет интерфейс сервисов обработки метрик.
@@ -57,23 +78,32 @@ type HServices interface {
 // Параметры:
 //   - st: хранилище метрик
 //   - hashKey: ключ для хеширования
-//   - cryptoKeyPath: путь к файлу с приватным ключом
+//   - cryptoKeyPath: файлы или каталоги с приватными ключами, через запятую
 //   - zl: логгер
 //
 // Возвращает:
 //   - указатель на новый экземпляр Services
 func NewHandlerServices(st storage.Storage, hashKey *string, cryptoKeyPath string, zl *l.ZapLogger) *Services {
-	var privateKey *rsa.PrivateKey
+	var keys *crypto.KeyRing
+	if cryptoKeyPath != "" {
+		keys = crypto.NewKeyRing(cryptoKeyPath, nil)
+	}
+	return NewHandlerServicesWithKeys(st, hashKey, keys, zl)
+}
+
+// NewHandlerServicesWithKeys создает сервисы обработки метрик
+// с набором приватных ключей для расшифровки. keys может быть nil.
+func NewHandlerServicesWithKeys(st storage.Storage, hashKey *string, keys *crypto.KeyRing, zl *l.ZapLogger) *Services {
 	useDecrypt := false
 
-	if cryptoKeyPath != "" {
-		var err error
-		privateKey, err = crypto.LoadPrivateKey(cryptoKeyPath)
-		if err != nil {
-			zl.ErrorCtx(context.Background(), "Failed to load private key, continuing without decryption", zap.Error(err))
+	if keys != nil {
+		if err := keys.Reload(); err != nil {
+			zl.ErrorCtx(context.Background(), "Failed to load private keys, continuing without decryption", zap.Error(err))
+			keys = nil
 		} else {
 			useDecrypt = true
-			zl.InfoCtx(context.Background(), "Private key loaded successfully, decryption enabled")
+			zl.InfoCtx(context.Background(), "Private keys loaded successfully, decryption enabled",
+				zap.Strings("key_ids", keys.IDs()))
 		}
 	}
 
@@ -82,9 +112,34 @@ func NewHandlerServices(st storage.Storage, hashKey *string, cryptoKeyPath strin
 		models:     nil,
 		logger:     zl,
 		hashKey:    hashKey,
-		privateKey: privateKey,
+		keys:       keys,
 		useDecrypt: useDecrypt,
+
+		maxDecompressedSize: limits.DefaultMaxDecompressedSize,
+	}
+}
+
+// SetMaxDecompressedSize задает ограничение размера распакованного тела запроса.
+// Значение <= 0 снимает ограничение.
+func (s *Services) SetMaxDecompressedSize(size int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.maxDecompressedSize = size
+}
+
+// SetKeys заменяет набор приватных ключей для расшифровки. nil отключает расшифровку.
+// Если ключи не удалось загрузить, текущий набор сохраняется и возвращается ошибка.
+func (s *Services) SetKeys(keys *crypto.KeyRing) error {
+	if keys != nil {
+		if err := keys.Reload(); err != nil {
+			return fmt.Errorf("load private keys: %w", err)
+		}
 	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys = keys
+	s.useDecrypt = keys != nil
+	return nil
 }
 
 // PingService проверяет соединение с хранилищем метрик.
@@ -93,7 +148,7 @@ func NewHandlerServices(st storage.Storage, hashKey *string, cryptoKeyPath strin
 func (s *Services) PingService(c *gin.Context) {
 	if dbs, ok := s.s.(storage.DatabaseStorage); ok {
 		if !dbs.PingIsOk() {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Database connection failed"})
+			apierror.Abort(c, http.StatusBadRequest, apierror.CodeStorageUnavailable, "Database connection failed")
 			return
 		}
 	}
@@ -101,21 +156,38 @@ func (s *Services) PingService(c *gin.Context) {
 }
 
 // ParseMetricsServices разбирает метрики из тела HTTP-запроса.
-// Поддерживает разбор как одиночной метрики, так и массива метрик в формате JSON.
-// Также поддерживает сжатие gzip и шифрование данных.
+// Поддерживает разбор как одиночной метрики, так и массива метрик в формате JSON,
+// Protocol Buffers или MessagePack в зависимости от заголовка Content-Type.
+// Также поддерживает сжатие (gzip, zstd, snappy) и шифрование данных.
 //
 // Возвращает:
 //   - срез разобранных метрик
 //   - ошибку, если не удалось разобрать метрики
-func (s *Services) ParseMetricsServices(c *gin.Context) ([]m.Metrics, error) {
-	var models []m.Metrics
+func (s *Services) ParseMetricsServices(c *gin.Context) (models []m.Metrics, err error) {
+	_, span := tracing.Start(c.Request.Context(), "ParseMetricsServices",
+		attribute.String("content_type", c.GetHeader("Content-Type")),
+		attribute.String("content_encoding", c.GetHeader("Content-Encoding")),
+		attribute.Bool("encrypted", c.GetHeader("X-Encrypted") == "true"),
+		attribute.Int64("content_length", c.Request.ContentLength),
+	)
+	defer func() {
+		span.SetAttributes(attribute.Int("metrics", len(models)))
+		tracing.End(span, err)
+	}()
+
+	s.mu.RLock()
+	keys, useDecrypt, maxDecompressedSize := s.keys, s.useDecrypt, s.maxDecompressedSize
+	s.mu.RUnlock()
+
 	r := c.Request
+	contentType := c.GetHeader("Content-Type")
 
 	if r.ContentLength == 0 {
 		if err := s.buildJSONBody(c); err != nil {
 			s.logger.ErrorCtx(r.Context(), "The metric was not parsed", zap.Any("err", err.Error()))
 			return nil, fmt.Errorf("buildJSONBody: %w", err)
 		}
+		contentType = payload.ContentTypeJSON
 	}
 
 	bodyBytes, err := io.ReadAll(r.Body)
@@ -127,48 +199,47 @@ func (s *Services) ParseMetricsServices(c *gin.Context) ([]m.Metrics, error) {
 	// Проверяем, зашифрованы ли данные
 	isEncrypted := c.GetHeader("X-Encrypted") == "true"
 
-	// Проверяем, сжаты ли данные
-	if c.GetHeader("Content-Encoding") == "gzip" {
-		reader, err := gzip.NewReader(bytes.NewReader(bodyBytes))
+	// Распаковываем данные, если они сжаты (gzip, zstd или snappy)
+	if encoding := c.GetHeader("Content-Encoding"); encoding != "" {
+		reader, err := compression.NewReader(encoding, bytes.NewReader(bodyBytes))
 		if err != nil {
-			s.logger.ErrorCtx(r.Context(), "Failed to decompress gzip data", zap.Error(err))
-			return nil, fmt.Errorf("gzip decompression: %w", err)
+			s.logger.ErrorCtx(r.Context(), "Failed to decompress data", zap.String("encoding", encoding), zap.Error(err))
+			return nil, fmt.Errorf("%w: %w", ErrDecompress, err)
 		}
-		decompressed, err := io.ReadAll(reader)
+		decompressed, err := limits.ReadDecompressed(reader, maxDecompressedSize)
+		_ = reader.Close()
 		if err != nil {
 			s.logger.ErrorCtx(r.Context(), "Failed to read decompressed data", zap.Error(err))
-			return nil, fmt.Errorf("read decompressed: %w", err)
+			return nil, fmt.Errorf("%w: read: %w", ErrDecompress, err)
 		}
 		bodyBytes = decompressed
 	}
 
-	// Если данные зашифрованы и у нас есть приватный ключ, расшифровываем их
-	if isEncrypted && s.useDecrypt && s.privateKey != nil {
-		decrypted, err := crypto.DecryptData(s.privateKey, bodyBytes)
+	// Если данные зашифрованы и у нас есть приватные ключи, расшифровываем их
+	// ключом из заголовка X-Key-ID (без заголовка пробуются все ключи)
+	if isEncrypted && useDecrypt && keys != nil {
+		keyID := c.GetHeader(crypto.KeyIDHeader)
+		decrypted, err := keys.Decrypt(keyID, bodyBytes)
 		if err != nil {
-			s.logger.ErrorCtx(r.Context(), "Failed to decrypt data", zap.Error(err))
-			return nil, fmt.Errorf("decryption: %w", err)
+			s.logger.ErrorCtx(r.Context(), "Failed to decrypt data", zap.String("key_id", keyID), zap.Error(err))
+			return nil, fmt.Errorf("%w: %w", ErrDecrypt, err)
 		}
 		s.logger.InfoCtx(r.Context(), "Data decrypted successfully", zap.Int("decrypted_size", len(decrypted)))
 		bodyBytes = decrypted
-	} else if isEncrypted && (!s.useDecrypt || s.privateKey == nil) {
+	} else if isEncrypted && (!useDecrypt || keys == nil) {
 		s.logger.ErrorCtx(r.Context(), "Received encrypted data but no private key available")
-		return nil, fmt.Errorf("no private key available for decryption")
+		return nil, fmt.Errorf("%w: no private key available", ErrDecrypt)
 	}
 
-	var model m.Metrics
-	if err := json.Unmarshal(bodyBytes, &model); err != nil {
-		if err := json.Unmarshal(bodyBytes, &models); err != nil {
-			s.logger.ErrorCtx(r.Context(), "The metric was not parsed"+string(bodyBytes)+err.Error(), zap.Any("err", err.Error()))
-			return nil, fmt.Errorf("unmarshal: %w", err)
-		}
-	}
 	defer func() {
 		_ = r.Body.Close()
 	}()
 
-	if model != (m.Metrics{}) {
-		models = append(models, model)
+	models, err = payload.Unmarshal(contentType, bodyBytes)
+	if err != nil {
+		s.logger.ErrorCtx(r.Context(), "The metric was not parsed",
+			zap.String("content_type", contentType), zap.Any("err", err.Error()))
+		return nil, fmt.Errorf("unmarshal: %w", err)
 	}
 
 	for _, model := range models {
@@ -176,10 +247,22 @@ func (s *Services) ParseMetricsServices(c *gin.Context) ([]m.Metrics, error) {
 			s.logger.ErrorCtx(r.Context(), "The metric has unsupported type", zap.Any("err", "unsupported request type"))
 			return nil, fmt.Errorf("unsupported request type: %s", model.MType)
 		}
+		if err := checkName(model.ID); err != nil {
+			s.logger.ErrorCtx(r.Context(), "The metric has reserved name", zap.String("id", model.ID))
+			return nil, err
+		}
 	}
 	return models, nil
 }
 
+// checkName отклоняет имена с префиксом собственных метрик сервера.
+func checkName(id string) error {
+	if strings.HasPrefix(id, m.SelfMetricsPrefix) {
+		return fmt.Errorf("%w: %q uses prefix %s", ErrReservedName, id, m.SelfMetricsPrefix)
+	}
+	return nil
+}
+
 // CounterService обрабатывает запросы для метрик типа counter.
 // Устанавливает значение метрики и возвращает результат обновления.
 func (s *Services) CounterService(c *gin.Context) {
@@ -187,7 +270,7 @@ func (s *Services) CounterService(c *gin.Context) {
 	updatedModels, err := s.s.SetCounter(c.Request.Context(), models...)
 	if err != nil {
 		s.logger.ErrorCtx(c.Request.Context(), "The metric counter was not saved", zap.Any("err", err.Error()))
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		apierror.Abort(c, http.StatusInternalServerError, apierror.CodeInternal, "The metric counter was not saved", err.Error())
 		return
 	}
 	s.MetricsService(c, updatedModels...)
@@ -200,7 +283,7 @@ func (s *Services) GaugeService(c *gin.Context) {
 	updatedModels, err := s.s.SetGauge(c.Request.Context(), models...)
 	if err != nil {
 		s.logger.ErrorCtx(c.Request.Context(), "One or more metrics were not saved", zap.Any("err", err.Error()))
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "One or more metrics were not saved"})
+		apierror.Abort(c, http.StatusInternalServerError, apierror.CodeInternal, "One or more metrics were not saved", err.Error())
 		return
 	}
 	if len(updatedModels) == 1 {
@@ -226,11 +309,14 @@ func (s *Services) MetricsService(c *gin.Context, models ...*m.Metrics) {
 // Разбирает метрику из тела запроса, устанавливает её значение и возвращает результат.
 func (s *Services) SetMetricsByBodyGin(c *gin.Context) {
 	bodyBytes, err := c.GetRawData()
+	if limits.IsTooLarge(err) {
+		s.logger.WarnCtx(c.Request.Context(), "Request body too large", zap.Error(err))
+		limits.Reject(c, err)
+		return
+	}
 	if err != nil {
 		s.logger.ErrorCtx(c.Request.Context(), "Failed to read request body", zap.Error(err))
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "Failed to read request body",
-		})
+		apierror.Abort(c, http.StatusBadRequest, apierror.CodeBadRequest, "Failed to read request body", err.Error())
 		return
 	}
 	c.Request.Body = io.NopCloser(bytes.NewBuffer(bodyBytes))
@@ -240,9 +326,7 @@ func (s *Services) SetMetricsByBodyGin(c *gin.Context) {
 		s.logger.ErrorCtx(c.Request.Context(), "Failed to parse metric",
 			zap.Error(err),
 			zap.String("body", string(bodyBytes)))
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "Invalid metric format",
-		})
+		apierror.Abort(c, http.StatusBadRequest, apierror.CodeInvalidMetric, "Invalid metric format", err.Error())
 		return
 	}
 
@@ -250,9 +334,7 @@ func (s *Services) SetMetricsByBodyGin(c *gin.Context) {
 		s.logger.WarnCtx(c.Request.Context(), "Invalid metric value",
 			zap.String("id", metric.ID),
 			zap.String("type", metric.MType))
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "Invalid metric value",
-		})
+		apierror.Abort(c, http.StatusBadRequest, apierror.CodeInvalidMetric, "Invalid metric value")
 		return
 	}
 
@@ -267,17 +349,13 @@ func (s *Services) SetMetricsByBodyGin(c *gin.Context) {
 	default:
 		s.logger.WarnCtx(c.Request.Context(), "Unsupported metric type",
 			zap.String("type", metric.MType))
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "Unsupported metric type",
-		})
+		apierror.Abort(c, http.StatusBadRequest, apierror.CodeInvalidMetric, "Unsupported metric type", metric.MType)
 		return
 	}
 
 	if err2 != nil {
 		s.logger.ErrorCtx(c.Request.Context(), "Failed to set metric", zap.Error(err2))
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "Failed to set metric",
-		})
+		apierror.Abort(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to set metric", err2.Error())
 		return
 	}
 
@@ -308,11 +386,14 @@ func (s *Services) CheckValue(metric *m.Metrics) bool {
 // и возвращает результат.
 func (s *Services) GetMetricsByValueGin(c *gin.Context) {
 	bodyBytes, err := c.GetRawData()
+	if limits.IsTooLarge(err) {
+		s.logger.WarnCtx(c.Request.Context(), "Request body too large", zap.Error(err))
+		limits.Reject(c, err)
+		return
+	}
 	if err != nil {
 		s.logger.ErrorCtx(c.Request.Context(), "Failed to read request body", zap.Error(err))
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "Failed to read request body",
-		})
+		apierror.Abort(c, http.StatusBadRequest, apierror.CodeBadRequest, "Failed to read request body", err.Error())
 		return
 	}
 	c.Request.Body = io.NopCloser(bytes.NewBuffer(bodyBytes))
@@ -322,9 +403,7 @@ func (s *Services) GetMetricsByValueGin(c *gin.Context) {
 		s.logger.ErrorCtx(c.Request.Context(), "Failed to parse metric request",
 			zap.Error(err),
 			zap.String("body", string(bodyBytes)))
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "Invalid metric request format",
-		})
+		apierror.Abort(c, http.StatusBadRequest, apierror.CodeInvalidMetric, "Invalid metric request format", err.Error())
 		return
 	}
 
@@ -332,9 +411,7 @@ func (s *Services) GetMetricsByValueGin(c *gin.Context) {
 		s.logger.WarnCtx(c.Request.Context(), "Missing metric ID or type in request",
 			zap.String("id", requestMetric.ID),
 			zap.String("type", requestMetric.MType))
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "Metric ID and type are required",
-		})
+		apierror.Abort(c, http.StatusBadRequest, apierror.CodeInvalidMetric, "Metric ID and type are required")
 		return
 	}
 
@@ -347,9 +424,7 @@ func (s *Services) GetMetricsByValueGin(c *gin.Context) {
 		s.logger.WarnCtx(c.Request.Context(), "Metric not found",
 			zap.String("id", requestMetric.ID),
 			zap.String("type", requestMetric.MType))
-		c.JSON(http.StatusNotFound, gin.H{
-			"error": "Metric not found",
-		})
+		apierror.Abort(c, http.StatusNotFound, apierror.CodeNotFound, "Metric not found")
 		return
 	}
 
@@ -366,12 +441,12 @@ func (s *Services) GetMetricsByValueGin(c *gin.Context) {
 // Возвращает:
 //   - ошибку, если не удалось сформировать тело ответа
 func (s *Services) buildJSONBody(c *gin.Context) (err error) {
-	metricType := c.Param("metricType")
-	metricName := c.Param("metricName")
-	metricValue, err := strconv.ParseFloat(c.Param("metricValue"), 64)
+	metricType := c.Param(ParamType)
+	metricName := c.Param(ParamName)
+	metricValue, err := strconv.ParseFloat(c.Param(ParamValue), 64)
 	if err != nil {
 		s.logger.ErrorCtx(c.Request.Context(), "Failed to parse metric value", zap.Error(err))
-		c.JSON(http.StatusBadRequest, gin.H{"error": "The value does not match the expected type."})
+		apierror.Abort(c, http.StatusBadRequest, apierror.CodeInvalidMetric, "The value does not match the expected type.", err.Error())
 		return err
 	}
 
@@ -388,7 +463,7 @@ func (s *Services) buildJSONBody(c *gin.Context) (err error) {
 
 	if err != nil {
 		s.logger.ErrorCtx(c.Request.Context(), "Marshaling error", zap.Error(err))
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		apierror.Abort(c, http.StatusBadRequest, apierror.CodeInvalidMetric, "Unable to build metric", err.Error())
 		return err
 	}
 	c.Request.Body = io.NopCloser(bytes.NewReader(resp))
@@ -419,7 +494,7 @@ func SendResultStatusOK(rw http.ResponseWriter, resp []byte) {
 	rw.Header().Set("Content-Type", "application/json")
 	_, err := rw.Write(resp)
 	if err != nil {
-		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		apierror.Write(rw, http.StatusInternalServerError, apierror.CodeInternal, "Unable to write response", err.Error())
 		return
 	}
 }
@@ -429,5 +504,5 @@ func SendResultStatusOK(rw http.ResponseWriter, resp []byte) {
 //   - rw: объект ResponseWriter для записи ответа
 //   - err: ошибка для отправки
 func SendResultStatusNotOK(rw http.ResponseWriter, err error) {
-	http.Error(rw, err.Error(), http.StatusBadRequest)
+	apierror.Write(rw, http.StatusBadRequest, apierror.CodeBadRequest, err.Error())
 }
@@ -6,6 +6,8 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"strconv"
 	"testing"
 
 	"github.com/gin-gonic/gin"
@@ -34,7 +36,7 @@ func TestDecryptionOfAgentData(t *testing.T) {
 	}()
 
 	// Load only public key for encryption, private key will be loaded from file by service
-	_, err = crypto.LoadPrivateKey(privateKeyPath) // Check only that key is loaded
+	_, err = crypto.LoadPrivateKey(privateKeyPath, nil) // Check only that key is loaded
 	require.NoError(t, err, "error loading private key")
 	publicKey, err := crypto.LoadPublicKey(publicKeyPath)
 	require.NoError(t, err, "error loading public key")
@@ -65,7 +67,7 @@ func TestDecryptionOfAgentData(t *testing.T) {
 
 	// Check that decryption is enabled
 	assert.True(t, services.useDecrypt, "Decryption should be enabled")
-	assert.NotNil(t, services.privateKey, "Private key should be loaded")
+	assert.Equal(t, 1, services.keys.Len(), "Private key should be loaded")
 
 	// Create test request with encrypted data
 	req, _ := http.NewRequest("POST", "/update", bytes.NewBuffer(encryptedData))
@@ -110,7 +112,7 @@ func TestHandlingUnencryptedData(t *testing.T) {
 
 	// Check that decryption is disabled
 	assert.False(t, services.useDecrypt, "Decryption should be disabled")
-	assert.Nil(t, services.privateKey, "Private key should be nil")
+	assert.Nil(t, services.keys, "Private key should be nil")
 
 	// Encode metric to JSON (without encryption)
 	jsonData, err := json.Marshal(testMetric)
@@ -268,3 +270,113 @@ func TestEncryptedDataWithoutKey(t *testing.T) {
 	require.Error(t, err, "should be error when missing key for decryption")
 	assert.Contains(t, err.Error(), "no private key", "error should be related to missing key")
 }
+
+// Test checks that a batch larger than the RSA block size is decrypted
+func TestDecryptionOfLargeBatch(t *testing.T) {
+	tempDir := t.TempDir()
+	privateKeyPath := tempDir + "/private.pem"
+	publicKeyPath := tempDir + "/public.pem"
+	require.NoError(t, crypto.GenerateKeyPair(privateKeyPath, publicKeyPath))
+
+	publicKey, err := crypto.LoadPublicKey(publicKeyPath)
+	require.NoError(t, err)
+
+	batch := make([]m.Metrics, 0, 50)
+	for i := 0; i < 50; i++ {
+		value := float64(i)
+		batch = append(batch, m.Metrics{ID: "Metric" + strconv.Itoa(i), MType: "gauge", Value: &value})
+	}
+	jsonData, err := json.Marshal(batch)
+	require.NoError(t, err)
+	require.Greater(t, len(jsonData), 1024)
+
+	encryptedData, err := crypto.EncryptData(publicKey, jsonData)
+	require.NoError(t, err)
+
+	gin.SetMode(gin.TestMode)
+	logger, _ := l.NewZapLogger(zap.InfoLevel)
+	services := NewHandlerServices(mocks.NewStorage(t), nil, privateKeyPath, logger)
+
+	req, _ := http.NewRequest("POST", "/updates/", bytes.NewBuffer(encryptedData))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Encrypted", "true")
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = req
+
+	metrics, err := services.ParseMetricsServices(c)
+	require.NoError(t, err)
+	require.Len(t, metrics, 50)
+	assert.Equal(t, "Metric49", metrics[49].ID)
+}
+
+// Test checks that the key is selected by X-Key-ID when several keys are loaded
+func TestDecryptionWithKeyRotation(t *testing.T) {
+	keyDir := t.TempDir()
+	pubDir := t.TempDir()
+	require.NoError(t, crypto.GenerateKeyPair(keyDir+"/old.pem", pubDir+"/old.pem"))
+	require.NoError(t, crypto.GenerateKeyPair(keyDir+"/new.pem", pubDir+"/new.pem"))
+
+	gin.SetMode(gin.TestMode)
+	logger, _ := l.NewZapLogger(zap.InfoLevel)
+	services := NewHandlerServices(mocks.NewStorage(t), nil, keyDir, logger)
+	require.True(t, services.useDecrypt)
+	require.Equal(t, 2, services.keys.Len())
+
+	value := 42.0
+	jsonData, err := json.Marshal(m.Metrics{ID: "Rotated", MType: "gauge", Value: &value})
+	require.NoError(t, err)
+
+	for _, name := range []string{"old", "new"} {
+		publicKey, err := crypto.LoadPublicKey(pubDir + "/" + name + ".pem")
+		require.NoError(t, err)
+		keyID, err := crypto.Fingerprint(publicKey)
+		require.NoError(t, err)
+		encryptedData, err := crypto.EncryptData(publicKey, jsonData)
+		require.NoError(t, err)
+
+		req, _ := http.NewRequest("POST", "/update", bytes.NewBuffer(encryptedData))
+		req.Header.Set("X-Encrypted", "true")
+		req.Header.Set("X-Key-ID", keyID)
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = req
+
+		metrics, err := services.ParseMetricsServices(c)
+		require.NoError(t, err, name)
+		require.Len(t, metrics, 1)
+		assert.Equal(t, "Rotated", metrics[0].ID)
+	}
+
+	req, _ := http.NewRequest("POST", "/update", bytes.NewBufferString("encrypted"))
+	req.Header.Set("X-Encrypted", "true")
+	req.Header.Set("X-Key-ID", "unknown")
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = req
+
+	_, err = services.ParseMetricsServices(c)
+	require.Error(t, err)
+	assert.ErrorIs(t, err, crypto.ErrUnknownKeyID)
+}
+
+func TestSetKeys(t *testing.T) {
+	dir := t.TempDir()
+	privateKeyPath := filepath.Join(dir, "private.pem")
+	require.NoError(t, crypto.GenerateKeyPair(privateKeyPath, filepath.Join(dir, "public.pem")))
+
+	logger, _ := l.NewZapLogger(zap.InfoLevel)
+	services := NewHandlerServices(mocks.NewStorage(t), nil, "", logger)
+	require.False(t, services.useDecrypt)
+
+	require.NoError(t, services.SetKeys(crypto.NewKeyRing(privateKeyPath, nil)))
+	assert.True(t, services.useDecrypt)
+	assert.Equal(t, 1, services.keys.Len())
+
+	err := services.SetKeys(crypto.NewKeyRing(filepath.Join(dir, "missing.pem"), nil))
+	require.Error(t, err)
+	assert.True(t, services.useDecrypt, "current keys should be kept on error")
+	assert.Equal(t, 1, services.keys.Len())
+
+	require.NoError(t, services.SetKeys(nil))
+	assert.False(t, services.useDecrypt)
+	assert.Nil(t, services.keys)
+}
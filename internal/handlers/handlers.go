@@ -1,23 +1,25 @@
 package handlers
 
 import (
-	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
-	"os"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
 
+	"github.com/sanek1/metrics-collector/internal/apierror"
 	m "github.com/sanek1/metrics-collector/internal/models"
 	storage "github.com/sanek1/metrics-collector/internal/storage/server"
 	l "github.com/sanek1/metrics-collector/pkg/logging"
 )
 
+// Имена параметров пути в маршрутах с метрикой в URL
 const (
-	fileMode = 0600
+	ParamType  = "type"
+	ParamName  = "name"
+	ParamValue = "value"
 )
 
 // Storage представляет собой структуру для обработки HTTP-запросов к метрикам.
@@ -51,7 +53,7 @@ func (s *Storage) SetHandlerServices(hs *Services) {
 // MainPageHandler обрабатывает запрос к главной странице, отображая все доступные метрики.
 // Возвращает HTML-страницу со списком всех метрик.
 func (s Storage) MainPageHandler(c *gin.Context) {
-	metrics := s.Storage.GetAllMetrics()
+	metrics := s.Storage.GetAllMetrics(c.Request.Context())
 	htmlData := GenerateHTMLServices(metrics)
 	c.Header("Content-Type", "text/html")
 	c.String(http.StatusOK, htmlData)
@@ -59,21 +61,13 @@ func (s Storage) MainPageHandler(c *gin.Context) {
 
 // GetMetricsByNameHandler обрабатывает запрос на получение метрики по имени и типу.
 // URL-параметры:
-//   - metricName: имя метрики
-//   - metricType: тип метрики (gauge или counter)
+//   - name: имя метрики
+//   - type: тип метрики (gauge или counter)
 //
 // Возвращает значение метрики или ошибку, если метрика не найдена.
-// @Summary Получить значение метрики
-// @Description Возвращает значение метрики по имени и типу
-// @Tags Metrics
-// @Produce  json
-// @Param metricType path string true "Тип метрики"
-// @Param metricName path string true "Имя метрики"
-// @Success 200 {object} m.Metrics
-// @Router /value/{metricType}/{metricName} [get]
 func (s Storage) GetMetricsByNameHandler(c *gin.Context) {
-	nameMetric := c.Param("metricName")
-	typeMetric := c.Param("metricType")
+	nameMetric := c.Param(ParamName)
+	typeMetric := c.Param(ParamType)
 	s.Logger.InfoCtx(c.Request.Context(),
 		fmt.Sprintf("handler GetMetricsByNameHandler. GetMetricsByNameHandler typeMetric %s nameMetric %s", typeMetric, nameMetric))
 
@@ -89,34 +83,39 @@ func (s Storage) GetMetricsByNameHandler(c *gin.Context) {
 		c.String(http.StatusOK, answer)
 		return
 	}
-	c.String(http.StatusNotFound, "GetMetricsByNameHandler No such value exists")
+	apierror.Abort(c, http.StatusNotFound, apierror.CodeNotFound, "No such value exists")
 }
 
 // GetMetricsByValueHandler обрабатывает запрос на получение метрики через JSON-формат.
 // Делегирует обработку запроса сервису handlerServices.
-// @Success 200 {object} m.Metrics
-// @Failure 400 {object} m.Metrics
-// @Failure 500 {object} m.Metrics
-// @Router /metrics [get]
-// @Success 200 {object} m.Metrics
-// @Failure 400 {object} m.Metrics
 func (s Storage) GetMetricsByValueHandler(c *gin.Context) {
 	s.Logger.InfoCtx(c.Request.Context(), "Handling GetMetricsByValueHandler request")
 	s.handlerServices.GetMetricsByValueGin(c)
 }
 
+// ImportHandler обрабатывает потоковый импорт метрик в формате NDJSON или CSV.
+// Делегирует обработку запроса сервису handlerServices.
+func (s Storage) ImportHandler(c *gin.Context) {
+	s.handlerServices.ImportService(c)
+}
+
+// ExportHandler выгружает все метрики в формате CSV или JSON.
+// Делегирует обработку запроса сервису handlerServices.
+func (s Storage) ExportHandler(c *gin.Context) {
+	s.handlerServices.ExportService(c)
+}
+
 // UpdateMetricFromURLHandler обрабатывает запрос на обновление метрики через URL-параметры.
 // URL-параметры:
-//   - metricType: тип метрики (gauge или counter)
-//   - metricName: имя метрики
-//   - metricValue: значение метрики
+//   - type: тип метрики (gauge или counter)
+//   - name: имя метрики
+//   - value: значение метрики
 //
 // Обновляет метрику и возвращает результат операции.
-// @author Firstname Lastname
 func (s Storage) UpdateMetricFromURLHandler(c *gin.Context) {
-	metricType := c.Param("metricType")
-	metricName := c.Param("metricName")
-	metricValue := c.Param("metricValue")
+	metricType := c.Param(ParamType)
+	metricName := c.Param(ParamName)
+	metricValue := c.Param(ParamValue)
 
 	s.Logger.InfoCtx(c.Request.Context(), "Processing URL-based metric update",
 		zap.String("type", metricType),
@@ -134,10 +133,7 @@ func (s Storage) UpdateMetricFromURLHandler(c *gin.Context) {
 			s.Logger.WarnCtx(c.Request.Context(), "Invalid counter value",
 				zap.String("value", metricValue),
 				zap.Error(err))
-			c.JSON(http.StatusBadRequest, gin.H{
-				"error":   "Invalid counter value",
-				"details": err.Error(),
-			})
+			apierror.Abort(c, http.StatusBadRequest, apierror.CodeInvalidMetric, "Invalid counter value", err.Error())
 			return
 		}
 		metric.Delta = &delta
@@ -148,10 +144,7 @@ func (s Storage) UpdateMetricFromURLHandler(c *gin.Context) {
 			s.Logger.WarnCtx(c.Request.Context(), "Invalid gauge value",
 				zap.String("value", metricValue),
 				zap.Error(err))
-			c.JSON(http.StatusBadRequest, gin.H{
-				"error":   "Invalid gauge value",
-				"details": err.Error(),
-			})
+			apierror.Abort(c, http.StatusBadRequest, apierror.CodeInvalidMetric, "Invalid gauge value", err.Error())
 			return
 		}
 		metric.Value = &value
@@ -159,10 +152,7 @@ func (s Storage) UpdateMetricFromURLHandler(c *gin.Context) {
 	default:
 		s.Logger.WarnCtx(c.Request.Context(), "Unsupported metric type",
 			zap.String("type", metricType))
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "Unsupported metric type",
-			"type":  metricType,
-		})
+		apierror.Abort(c, http.StatusBadRequest, apierror.CodeInvalidMetric, "Unsupported metric type", metricType)
 		return
 	}
 
@@ -178,10 +168,7 @@ func (s Storage) UpdateMetricFromURLHandler(c *gin.Context) {
 	if err != nil {
 		s.Logger.ErrorCtx(c.Request.Context(), "Failed to update metric",
 			zap.Error(err))
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error":   "Failed to update metric",
-			"details": err.Error(),
-		})
+		apierror.Abort(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to update metric", err.Error())
 		return
 	}
 
@@ -204,21 +191,11 @@ func (s Storage) UpdateMetricFromURLHandler(c *gin.Context) {
 // MetricHandler обрабатывает запрос на обновление метрики через JSON в теле запроса.
 // Принимает JSON-представление метрики и делегирует обработку соответствующему сервису
 // в зависимости от типа метрики.
-// @Summary Обновление метрики через URL
-// @Description Обновляет значение метрики указанного типа
-// @Tags metrics
-// @Produce text/plain
-// @Param type path string true "Тип метрики (gauge/counter)"
-// @Param name path string true "Имя метрики"
-// @Param value path string true "Значение метрики"
-// @Success 200 {string} string "Метрика обновлена"
-// @Failure 400 {object} models.ErrorResponse
-// @Router /update/{type}/{name}/{value} [post]
 func (s Storage) MetricHandler(c *gin.Context) {
 	//ctx := context.Background()
 	val, exists := c.Get("metrics")
 	if !exists {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "metrics not found in context"})
+		apierror.Abort(c, http.StatusBadRequest, apierror.CodeInvalidMetric, "metrics not found in context")
 		return
 	}
 	models := val.([]m.Metrics)
@@ -230,28 +207,25 @@ func (s Storage) MetricHandler(c *gin.Context) {
 	case m.TypeGauge:
 		s.handlerServices.GaugeService(c)
 	default:
-		c.JSON(http.StatusNotFound, gin.H{"error": "No such value exists"})
+		apierror.Abort(c, http.StatusNotFound, apierror.CodeNotFound, "No such value exists")
 		return
 	}
 }
 
 // SaveToFile сохраняет состояние хранилища метрик в файл.
+// Сохранение выполняет хранилище синхронно и согласованно с периодическим
+// сохранением резервной копии.
 // Параметры:
 //   - fname: имя файла для сохранения
 //
 // Возвращает:
-//   - ошибку, если не удалось сохранить файл
+//   - ошибку, если хранилище не поддерживает сохранение в файл или не удалось сохранить файл
 func (s Storage) SaveToFile(fname string) error {
-	data, err := json.MarshalIndent(s.Storage, "", "   ")
-	if err != nil {
-		return err
+	fs, ok := s.Storage.(storage.FileStorage)
+	if !ok {
+		return errors.New("storage does not support saving to file")
 	}
-	go func() {
-		if err := os.WriteFile(fname, data, fileMode); err != nil {
-			s.Logger.ErrorCtx(context.Background(), "Async save failed", zap.Any("err", err.Error()))
-		}
-	}()
-	return nil
+	return fs.SaveToFile(fname)
 }
 
 // PingDBHandler обрабатывает запрос на проверку соединения с базой данных.
@@ -266,11 +240,11 @@ func (s Storage) PingDBHandler(c *gin.Context) {
 // NotImplementedHandler является обработчиком для еще не реализованных эндпоинтов.
 // Возвращает статус 404 Not Found.
 func NotImplementedHandler(rw http.ResponseWriter, r *http.Request) {
-	http.Error(rw, "Not Implemented", http.StatusNotFound)
+	apierror.Write(rw, http.StatusNotFound, apierror.CodeNotFound, "Not Implemented", r.Method+" "+r.URL.Path)
 }
 
 // BadRequestHandler является обработчиком для некорректных запросов.
 // Возвращает статус 400 Bad Request.
 func BadRequestHandler(rw http.ResponseWriter, r *http.Request) {
-	http.Error(rw, "Bad Request Handler", http.StatusBadRequest)
+	apierror.Write(rw, http.StatusBadRequest, apierror.CodeBadRequest, "Bad Request Handler")
 }
@@ -87,7 +87,7 @@ func TestGetMetricsByNameHandler(t *testing.T) {
 			metricType:     "gauge",
 			metricName:     "non_existent",
 			expectedStatus: http.StatusNotFound,
-			expectedBody:   "GetMetricsByNameHandler No such value exists",
+			expectedBody:   `{"code":"not_found","message":"No such value exists"}`,
 		},
 	}
 
@@ -98,8 +98,8 @@ func TestGetMetricsByNameHandler(t *testing.T) {
 			c, _ := gin.CreateTestContext(w)
 			c.Request = req
 			c.Params = []gin.Param{
-				{Key: "metricType", Value: tc.metricType},
-				{Key: "metricName", Value: tc.metricName},
+				{Key: ParamType, Value: tc.metricType},
+				{Key: ParamName, Value: tc.metricName},
 			}
 
 			memStorage.GetMetricsByNameHandler(c)
@@ -195,9 +195,9 @@ func TestUpdateMetricFromURLHandler(t *testing.T) {
 			c, _ := gin.CreateTestContext(w)
 			c.Request = req
 			c.Params = []gin.Param{
-				{Key: "metricType", Value: tc.metricType},
-				{Key: "metricName", Value: tc.metricName},
-				{Key: "metricValue", Value: tc.metricValue},
+				{Key: ParamType, Value: tc.metricType},
+				{Key: ParamName, Value: tc.metricName},
+				{Key: ParamValue, Value: tc.metricValue},
 			}
 
 			memStorage.UpdateMetricFromURLHandler(c)
@@ -266,8 +266,12 @@ func TestSaveToFile(t *testing.T) {
 	err = memStorage.SaveToFile("./testdata/test.json")
 	assert.NoError(t, err)
 
+	data, err := os.ReadFile("./testdata/test.json")
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"checksum"`, "file is written synchronously by the storage")
+
 	err = memStorage.SaveToFile("/non-existent-dir/test.json")
-	assert.NoError(t, err)
+	assert.Error(t, err)
 }
 
 func TestGetMetricsByBody_MetricHandler(t *testing.T) {
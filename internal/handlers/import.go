@@ -0,0 +1,244 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/sanek1/metrics-collector/internal/apierror"
+	"github.com/sanek1/metrics-collector/internal/compression"
+	m "github.com/sanek1/metrics-collector/internal/models"
+	"github.com/sanek1/metrics-collector/internal/payload"
+)
+
+const (
+	// importBatchSize - количество метрик, записываемых в хранилище за один раз
+	importBatchSize = 1000
+	// importMaxLineSize - максимальная длина строки NDJSON
+	importMaxLineSize = 64 << 10
+	// importMaxErrors - сколько ошибок разбора строк попадает в итоговый отчет
+	importMaxErrors = 100
+)
+
+// ImportError описывает строку, которую не удалось импортировать.
+type ImportError struct {
+	Line  int    `json:"line"`
+	Error string `json:"error"`
+}
+
+// ImportSummary - итог импорта метрик.
+type ImportSummary struct {
+	// Lines - количество прочитанных непустых строк (записей CSV)
+	Lines int `json:"lines"`
+	// Imported - количество метрик, записанных в хранилище
+	Imported int `json:"imported"`
+	Gauges   int `json:"gauges"`
+	Counters int `json:"counters"`
+	// Failed - количество строк, отклоненных при разборе
+	Failed int `json:"failed"`
+	// Batches - количество записей в хранилище
+	Batches int `json:"batches"`
+	// Errors - первые importMaxErrors ошибок разбора строк
+	Errors []ImportError `json:"errors,omitempty"`
+	// Error - ошибка, прервавшая импорт
+	Error string `json:"error,omitempty"`
+}
+
+// importer читает метрики построчно и записывает их в хранилище пакетами.
+type importer struct {
+	s        *Services
+	ctx      context.Context
+	gauges   []m.Metrics
+	counters []m.Metrics
+	summary  ImportSummary
+}
+
+// ImportService импортирует метрики в формате NDJSON (по одной метрике JSON в строке)
+// или CSV, выгруженном ExportService (Content-Type: text/csv или параметр format=csv).
+// Тело читается потоком и может быть сжато (Content-Encoding gzip, zstd или snappy),
+// метрики записываются в хранилище пакетами через SetGauge и SetCounter.
+// Некорректные строки пропускаются и попадают в отчет.
+// В ответе возвращается ImportSummary.
+func (s *Services) ImportService(c *gin.Context) {
+	ctx := c.Request.Context()
+	if c.GetHeader("X-Encrypted") == "true" {
+		apierror.Abort(c, http.StatusBadRequest, apierror.CodeBadRequest, "encrypted import is not supported")
+		return
+	}
+
+	body, err := compression.NewReader(c.GetHeader("Content-Encoding"), c.Request.Body)
+	if errors.Is(err, compression.ErrUnsupported) {
+		apierror.Abort(c, http.StatusUnsupportedMediaType, apierror.CodeUnsupportedMediaType, "unsupported content encoding", err.Error())
+		return
+	}
+	if err != nil {
+		apierror.Abort(c, http.StatusBadRequest, apierror.CodeBadRequest, "unable to read import", err.Error())
+		return
+	}
+	defer func() {
+		_ = body.Close()
+	}()
+
+	imp := &importer{
+		s:        s,
+		ctx:      ctx,
+		gauges:   make([]m.Metrics, 0, importBatchSize),
+		counters: make([]m.Metrics, 0, importBatchSize),
+	}
+	read := imp.readNDJSON
+	format := c.Query("format")
+	if format == "" {
+		format = payload.FormatOf(c.ContentType())
+	}
+	if format == payload.FormatCSV {
+		read = imp.readCSV
+	}
+
+	status := http.StatusOK
+	if err := imp.run(body, read); err != nil {
+		imp.summary.Error = err.Error()
+		status = http.StatusBadRequest
+		if errors.Is(err, errImportStorage) {
+			status = http.StatusInternalServerError
+		}
+		s.logger.ErrorCtx(ctx, "Import aborted", zap.Int("imported", imp.summary.Imported), zap.Error(err))
+	} else {
+		s.logger.InfoCtx(ctx, "Import completed",
+			zap.String("format", format),
+			zap.Int("imported", imp.summary.Imported),
+			zap.Int("failed", imp.summary.Failed),
+			zap.Int("batches", imp.summary.Batches))
+	}
+	c.JSON(status, imp.summary)
+}
+
+// errImportStorage - ошибка записи пакета в хранилище
+var errImportStorage = errors.New("storage error")
+
+// run читает метрики функцией read и записывает оставшийся неполный пакет.
+func (imp *importer) run(r io.Reader, read func(io.Reader) error) error {
+	err := read(r)
+	if errors.Is(err, errImportStorage) {
+		return err
+	}
+	// метрики, прочитанные до ошибки чтения, все равно записываются
+	if err := imp.flush(); err != nil {
+		return err
+	}
+	return err
+}
+
+func (imp *importer) readNDJSON(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 4096), importMaxLineSize)
+
+	line := 0
+	for scanner.Scan() {
+		line++
+		data := bytes.TrimSpace(scanner.Bytes())
+		if len(data) == 0 {
+			continue
+		}
+
+		var metric m.Metrics
+		if err := json.Unmarshal(data, &metric); err != nil {
+			imp.summary.Lines++
+			imp.fail(line, err)
+			continue
+		}
+		if err := imp.add(line, metric); err != nil {
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		if errors.Is(err, bufio.ErrTooLong) {
+			return fmt.Errorf("line %d: longer than %d bytes", line+1, importMaxLineSize)
+		}
+		return fmt.Errorf("read body: %w", err)
+	}
+	return nil
+}
+
+func (imp *importer) readCSV(r io.Reader) error {
+	cr := payload.NewCSVReader(r)
+	for {
+		metric, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if errors.Is(err, payload.ErrInvalidRecord) {
+			imp.summary.Lines++
+			imp.fail(cr.Line(), err)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if err := imp.add(cr.Line(), metric); err != nil {
+			return err
+		}
+	}
+}
+
+// add проверяет метрику и добавляет ее в пакет, записывая заполненный пакет.
+func (imp *importer) add(line int, metric m.Metrics) error {
+	imp.summary.Lines++
+	if metric.ID == "" || !imp.s.CheckValue(&metric) {
+		imp.fail(line, fmt.Errorf("invalid metric %q of type %q", metric.ID, metric.MType))
+		return nil
+	}
+	if err := checkName(metric.ID); err != nil {
+		imp.fail(line, err)
+		return nil
+	}
+
+	if metric.MType == m.TypeCounter {
+		imp.counters = append(imp.counters, metric)
+	} else {
+		imp.gauges = append(imp.gauges, metric)
+	}
+	if len(imp.gauges)+len(imp.counters) >= importBatchSize {
+		return imp.flush()
+	}
+	return nil
+}
+
+func (imp *importer) fail(line int, err error) {
+	imp.summary.Failed++
+	if len(imp.summary.Errors) < importMaxErrors {
+		imp.summary.Errors = append(imp.summary.Errors, ImportError{Line: line, Error: err.Error()})
+	}
+}
+
+// flush записывает накопленный пакет в хранилище.
+func (imp *importer) flush() error {
+	if len(imp.gauges) == 0 && len(imp.counters) == 0 {
+		return nil
+	}
+	if len(imp.gauges) > 0 {
+		if _, err := imp.s.s.SetGauge(imp.ctx, imp.gauges...); err != nil {
+			return fmt.Errorf("%w: %w", errImportStorage, err)
+		}
+		imp.summary.Gauges += len(imp.gauges)
+		imp.summary.Imported += len(imp.gauges)
+		imp.gauges = imp.gauges[:0]
+	}
+	if len(imp.counters) > 0 {
+		if _, err := imp.s.s.SetCounter(imp.ctx, imp.counters...); err != nil {
+			return fmt.Errorf("%w: %w", errImportStorage, err)
+		}
+		imp.summary.Counters += len(imp.counters)
+		imp.summary.Imported += len(imp.counters)
+		imp.counters = imp.counters[:0]
+	}
+	imp.summary.Batches++
+	return nil
+}
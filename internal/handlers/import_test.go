@@ -0,0 +1,200 @@
+package handlers
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	m "github.com/sanek1/metrics-collector/internal/models"
+	storage "github.com/sanek1/metrics-collector/internal/storage/server"
+	"github.com/sanek1/metrics-collector/internal/storage/server/mocks"
+	l "github.com/sanek1/metrics-collector/pkg/logging"
+)
+
+// countingStorage учитывает размеры пакетов, записанных в хранилище
+type countingStorage struct {
+	storage.Storage
+	stored   int
+	maxBatch int
+}
+
+func (s *countingStorage) count(n int) {
+	s.stored += n
+	s.maxBatch = max(s.maxBatch, n)
+}
+
+func (s *countingStorage) SetGauge(ctx context.Context, metrics ...m.Metrics) ([]*m.Metrics, error) {
+	s.count(len(metrics))
+	return s.Storage.SetGauge(ctx, metrics...)
+}
+
+func (s *countingStorage) SetCounter(ctx context.Context, metrics ...m.Metrics) ([]*m.Metrics, error) {
+	s.count(len(metrics))
+	return s.Storage.SetCounter(ctx, metrics...)
+}
+
+func runImport(t *testing.T, services *Services, body []byte, headers map[string]string) (*httptest.ResponseRecorder, ImportSummary) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/api/v1/import", bytes.NewReader(body))
+	for k, v := range headers {
+		c.Request.Header.Set(k, v)
+	}
+
+	services.ImportService(c)
+
+	var summary ImportSummary
+	if w.Header().Get("Content-Type") != "" {
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &summary))
+	}
+	return w, summary
+}
+
+func ndjson(gauges, counters int) []byte {
+	var b strings.Builder
+	for i := 0; i < gauges; i++ {
+		fmt.Fprintf(&b, `{"id":"g%d","type":"gauge","value":%d.5}`+"\n", i, i)
+	}
+	for i := 0; i < counters; i++ {
+		fmt.Fprintf(&b, `{"id":"c%d","type":"counter","delta":%d}`+"\n", i, i)
+	}
+	return []byte(b.String())
+}
+
+func TestImportService(t *testing.T) {
+	logger, _ := l.NewZapLogger(zap.InfoLevel)
+
+	t.Run("batches", func(t *testing.T) {
+		st := &countingStorage{Storage: storage.GetStorage(false, nil, logger)}
+
+		services := NewHandlerServices(st, nil, "", logger)
+		w, summary := runImport(t, services, ndjson(importBatchSize+500, importBatchSize), nil)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, 2*importBatchSize+500, summary.Lines)
+		assert.Equal(t, 2*importBatchSize+500, summary.Imported)
+		assert.Equal(t, importBatchSize+500, summary.Gauges)
+		assert.Equal(t, importBatchSize, summary.Counters)
+		assert.Equal(t, 3, summary.Batches)
+		assert.Zero(t, summary.Failed)
+		assert.Equal(t, summary.Imported, st.stored)
+		assert.LessOrEqual(t, st.maxBatch, importBatchSize)
+	})
+
+	t.Run("invalid lines are skipped", func(t *testing.T) {
+		st := mocks.NewStorage(t)
+		st.On("SetGauge", mock.Anything, mock.Anything, mock.Anything).Return(nil, nil).Once()
+
+		body := []byte(`{"id":"a","type":"gauge","value":1}
+
+not json
+{"id":"b","type":"gauge"}
+{"id":"c","type":"histogram","value":1}
+{"id":"d","type":"gauge","value":2}
+`)
+		services := NewHandlerServices(st, nil, "", logger)
+		w, summary := runImport(t, services, body, nil)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, 5, summary.Lines)
+		assert.Equal(t, 2, summary.Imported)
+		assert.Equal(t, 3, summary.Failed)
+		require.Len(t, summary.Errors, 3)
+		assert.Equal(t, 3, summary.Errors[0].Line)
+		assert.Equal(t, 4, summary.Errors[1].Line)
+		assert.Equal(t, 5, summary.Errors[2].Line)
+	})
+
+	t.Run("reserved prefix is rejected", func(t *testing.T) {
+		st := mocks.NewStorage(t)
+		st.On("SetGauge", mock.Anything, mock.Anything).Return(nil, nil).Once()
+
+		body := []byte(`{"id":"_collector.rejected","type":"gauge","value":1}
+{"id":"a","type":"gauge","value":1}
+`)
+		services := NewHandlerServices(st, nil, "", logger)
+		w, summary := runImport(t, services, body, nil)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, 1, summary.Imported)
+		require.Len(t, summary.Errors, 1)
+		assert.Contains(t, summary.Errors[0].Error, ErrReservedName.Error())
+	})
+
+	t.Run("gzip", func(t *testing.T) {
+		st := mocks.NewStorage(t)
+		st.On("SetCounter", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil, nil).Once()
+
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		_, err := zw.Write(ndjson(0, 3))
+		require.NoError(t, err)
+		require.NoError(t, zw.Close())
+
+		services := NewHandlerServices(st, nil, "", logger)
+		w, summary := runImport(t, services, buf.Bytes(), map[string]string{"Content-Encoding": "gzip"})
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, 3, summary.Counters)
+	})
+
+	t.Run("storage error", func(t *testing.T) {
+		st := mocks.NewStorage(t)
+		st.On("SetGauge", mock.Anything, mock.Anything).Return(nil, errors.New("db is down")).Once()
+
+		services := NewHandlerServices(st, nil, "", logger)
+		w, summary := runImport(t, services, ndjson(1, 0), nil)
+
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+		assert.Zero(t, summary.Imported)
+		assert.Contains(t, summary.Error, "db is down")
+	})
+
+	t.Run("line too long", func(t *testing.T) {
+		st := mocks.NewStorage(t)
+		st.On("SetGauge", mock.Anything, mock.Anything).Return(nil, nil).Once()
+
+		body := append(ndjson(1, 0), bytes.Repeat([]byte("x"), importMaxLineSize+1)...)
+		services := NewHandlerServices(st, nil, "", logger)
+		w, summary := runImport(t, services, body, nil)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Equal(t, 1, summary.Imported)
+		assert.Contains(t, summary.Error, "line 2")
+	})
+
+	t.Run("csv", func(t *testing.T) {
+		st := &countingStorage{Storage: storage.GetStorage(false, nil, logger)}
+
+		body := []byte("id,type,delta,value\nAlloc,gauge,,1.5\nPollCount,counter,x,\nPollCount,counter,3,\n")
+		services := NewHandlerServices(st, nil, "", logger)
+		w, summary := runImport(t, services, body, map[string]string{"Content-Type": "text/csv"})
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, 3, summary.Lines)
+		assert.Equal(t, 2, summary.Imported)
+		require.Len(t, summary.Errors, 1)
+		assert.Equal(t, 3, summary.Errors[0].Line)
+	})
+
+	t.Run("unsupported encoding", func(t *testing.T) {
+		services := NewHandlerServices(mocks.NewStorage(t), nil, "", logger)
+		w, _ := runImport(t, services, ndjson(1, 0), map[string]string{"Content-Encoding": "br"})
+		assert.Equal(t, http.StatusUnsupportedMediaType, w.Code)
+	})
+}
@@ -0,0 +1,176 @@
+// Package health собирает состояние компонентов сервера для проверок
+// живости (/healthz) и готовности (/readyz).
+package health
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Status - состояние сервера или компонента
+type Status string
+
+const (
+	// StatusUp - компонент работает
+	StatusUp Status = "up"
+	// StatusStarting - компонент еще не готов, например не завершено восстановление
+	StatusStarting Status = "starting"
+	// StatusDown - компонент неисправен
+	StatusDown Status = "down"
+)
+
+// DefaultCheckTimeout - время, отводимое на проверку одного компонента
+const DefaultCheckTimeout = 2 * time.Second
+
+// Component - результат проверки компонента.
+type Component struct {
+	Status  Status                 `json:"status"`
+	Details map[string]interface{} `json:"details,omitempty"`
+	Error   string                 `json:"error,omitempty"`
+}
+
+// Report - ответ проверок живости и готовности.
+type Report struct {
+	Status     Status               `json:"status"`
+	StartedAt  time.Time            `json:"started_at"`
+	Uptime     string               `json:"uptime"`
+	Components map[string]Component `json:"components,omitempty"`
+}
+
+// CheckFunc проверяет компонент. Контекст ограничен таймаутом проверки.
+type CheckFunc func(ctx context.Context) Component
+
+type check struct {
+	name string
+	fn   CheckFunc
+}
+
+// Registry хранит проверки компонентов и фазу запуска сервера.
+// До вызова MarkReady сервер считается запускающимся, после MarkStopping - останавливающимся.
+type Registry struct {
+	mu        sync.RWMutex
+	checks    []check
+	ready     atomic.Bool
+	stopping  atomic.Bool
+	startedAt time.Time
+	timeout   time.Duration
+}
+
+// NewRegistry создает реестр проверок в фазе запуска.
+func NewRegistry() *Registry {
+	return &Registry{
+		startedAt: time.Now(),
+		timeout:   DefaultCheckTimeout,
+	}
+}
+
+// Register добавляет проверку компонента. Повторная регистрация имени заменяет проверку.
+func (r *Registry) Register(name string, fn CheckFunc) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i := range r.checks {
+		if r.checks[i].name == name {
+			r.checks[i].fn = fn
+			return
+		}
+	}
+	r.checks = append(r.checks, check{name: name, fn: fn})
+}
+
+// MarkReady завершает фазу запуска.
+func (r *Registry) MarkReady() {
+	r.ready.Store(true)
+}
+
+// MarkStopping переводит сервер в фазу остановки: готовность снимается,
+// чтобы балансировщик перестал направлять новые запросы.
+func (r *Registry) MarkStopping() {
+	r.stopping.Store(true)
+}
+
+// Liveness сообщает, что процесс жив. Компоненты не проверяются,
+// поэтому отказ базы данных не приводит к перезапуску процесса.
+func (r *Registry) Liveness() Report {
+	report := r.report()
+	report.Status = StatusUp
+	if !r.ready.Load() {
+		report.Status = StatusStarting
+	}
+	return report
+}
+
+// Readiness проверяет все компоненты параллельно.
+// Итоговое состояние - down, если хотя бы один компонент неисправен или сервер
+// останавливается, starting - если сервер или компонент еще запускается, иначе up.
+func (r *Registry) Readiness(ctx context.Context) Report {
+	r.mu.RLock()
+	checks := append([]check(nil), r.checks...)
+	r.mu.RUnlock()
+
+	results := make([]Component, len(checks))
+	var wg sync.WaitGroup
+	for i, c := range checks {
+		wg.Add(1)
+		go func(i int, c check) {
+			defer wg.Done()
+			results[i] = r.run(ctx, c.fn)
+		}(i, c)
+	}
+	wg.Wait()
+
+	report := r.report()
+	report.Status = StatusUp
+	if !r.ready.Load() {
+		report.Status = StatusStarting
+	}
+	report.Components = make(map[string]Component, len(checks))
+	for i, c := range checks {
+		report.Components[c.name] = results[i]
+		report.Status = worst(report.Status, results[i].Status)
+	}
+	if r.stopping.Load() {
+		report.Status = StatusDown
+	}
+	return report
+}
+
+func (r *Registry) run(ctx context.Context, fn CheckFunc) Component {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	done := make(chan Component, 1)
+	go func() {
+		done <- fn(ctx)
+	}()
+	select {
+	case c := <-done:
+		return c
+	case <-ctx.Done():
+		return Component{Status: StatusDown, Error: "check timed out: " + ctx.Err().Error()}
+	}
+}
+
+func (r *Registry) report() Report {
+	return Report{
+		StartedAt: r.startedAt,
+		Uptime:    time.Since(r.startedAt).Truncate(time.Second).String(),
+	}
+}
+
+// Failed возвращает проверку, которая всегда сообщает о неисправности
+// компонента, например после неудачного применения миграций.
+func Failed(err error) CheckFunc {
+	return func(context.Context) Component {
+		return Component{Status: StatusDown, Error: err.Error()}
+	}
+}
+
+func worst(a, b Status) Status {
+	rank := map[Status]int{StatusUp: 0, StatusStarting: 1, StatusDown: 2}
+	if rank[b] > rank[a] {
+		return b
+	}
+	return a
+}
@@ -0,0 +1,64 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func up(context.Context) Component {
+	return Component{Status: StatusUp}
+}
+
+func TestRegistry_Phases(t *testing.T) {
+	r := NewRegistry()
+	r.Register("db", up)
+
+	assert.Equal(t, StatusStarting, r.Liveness().Status)
+	assert.Equal(t, StatusStarting, r.Readiness(context.Background()).Status)
+
+	r.MarkReady()
+	assert.Equal(t, StatusUp, r.Liveness().Status)
+	report := r.Readiness(context.Background())
+	assert.Equal(t, StatusUp, report.Status)
+	assert.Equal(t, StatusUp, report.Components["db"].Status)
+
+	r.MarkStopping()
+	assert.Equal(t, StatusDown, r.Readiness(context.Background()).Status)
+	assert.Equal(t, StatusUp, r.Liveness().Status, "liveness does not depend on readiness")
+}
+
+func TestRegistry_WorstComponentWins(t *testing.T) {
+	r := NewRegistry()
+	r.MarkReady()
+	r.Register("db", up)
+	r.Register("backup", func(context.Context) Component { return Component{Status: StatusStarting} })
+	assert.Equal(t, StatusStarting, r.Readiness(context.Background()).Status)
+
+	r.Register("migrations", Failed(errors.New("dirty database version 3")))
+	report := r.Readiness(context.Background())
+	assert.Equal(t, StatusDown, report.Status)
+	assert.Equal(t, "dirty database version 3", report.Components["migrations"].Error)
+	assert.Len(t, report.Components, 3)
+
+	r.Register("migrations", up)
+	assert.Equal(t, StatusStarting, r.Readiness(context.Background()).Status, "re-registration replaces the check")
+}
+
+func TestRegistry_CheckTimeout(t *testing.T) {
+	r := NewRegistry()
+	r.timeout = 10 * time.Millisecond
+	r.MarkReady()
+	r.Register("slow", func(ctx context.Context) Component {
+		<-ctx.Done()
+		time.Sleep(50 * time.Millisecond)
+		return Component{Status: StatusUp}
+	})
+
+	report := r.Readiness(context.Background())
+	assert.Equal(t, StatusDown, report.Status)
+	assert.Contains(t, report.Components["slow"].Error, "timed out")
+}
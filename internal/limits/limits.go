@@ -0,0 +1,78 @@
+// Package limits ограничивает размер тел запросов, принимаемых сервером,
+// в том числе после распаковки, и учитывает отклоненные запросы.
+package limits
+
+import (
+	"errors"
+	"expvar"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/sanek1/metrics-collector/internal/apierror"
+)
+
+const (
+	// DefaultMaxBodySize - максимальный размер тела запроса по умолчанию
+	DefaultMaxBodySize = 1 << 20 // 1 MB
+	// DefaultMaxDecompressedSize - максимальный размер распакованного тела по умолчанию
+	DefaultMaxDecompressedSize = 10 << 20 // 10 MB
+
+	// ReasonBody - тело запроса превышает ограничение
+	ReasonBody = "body"
+	// ReasonDecompressed - распакованное тело запроса превышает ограничение
+	ReasonDecompressed = "decompressed"
+)
+
+var (
+	// ErrBodyTooLarge возвращается, если тело запроса превышает ограничение.
+	ErrBodyTooLarge = errors.New("request body too large")
+	// ErrDecompressedTooLarge возвращается, если распакованное тело превышает ограничение.
+	ErrDecompressedTooLarge = fmt.Errorf("decompressed %w", ErrBodyTooLarge)
+)
+
+// rejections - количество отклоненных запросов по причинам,
+// доступно через /debug/vars
+var rejections = expvar.NewMap("body_limit_rejections")
+
+// IsTooLarge сообщает, вызвана ли ошибка превышением ограничения размера.
+func IsTooLarge(err error) bool {
+	var maxBytesErr *http.MaxBytesError
+	return errors.Is(err, ErrBodyTooLarge) || errors.As(err, &maxBytesErr)
+}
+
+// ReadDecompressed читает распакованные данные, но не более limit байт.
+// При превышении возвращает ErrDecompressedTooLarge. limit <= 0 снимает ограничение.
+func ReadDecompressed(r io.Reader, limit int64) ([]byte, error) {
+	if limit <= 0 {
+		return io.ReadAll(r)
+	}
+	data, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		return nil, fmt.Errorf("%w: limit %d bytes", ErrDecompressedTooLarge, limit)
+	}
+	return data, nil
+}
+
+// Reject учитывает отклоненный запрос и отвечает 413 Request Entity Too Large.
+func Reject(c *gin.Context, err error) {
+	reason := ReasonBody
+	if errors.Is(err, ErrDecompressedTooLarge) {
+		reason = ReasonDecompressed
+	}
+	rejections.Add(reason, 1)
+	apierror.Abort(c, http.StatusRequestEntityTooLarge, apierror.CodePayloadTooLarge, "request body too large", err.Error())
+}
+
+// Rejections возвращает количество отклоненных запросов по указанной причине.
+func Rejections(reason string) int64 {
+	if v, ok := rejections.Get(reason).(*expvar.Int); ok {
+		return v.Value()
+	}
+	return 0
+}
@@ -0,0 +1,53 @@
+package limits
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadDecompressed(t *testing.T) {
+	data, err := ReadDecompressed(strings.NewReader("12345"), 5)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("12345"), data)
+
+	_, err = ReadDecompressed(strings.NewReader("123456"), 5)
+	assert.ErrorIs(t, err, ErrDecompressedTooLarge)
+	assert.ErrorIs(t, err, ErrBodyTooLarge)
+	assert.True(t, IsTooLarge(err))
+
+	data, err = ReadDecompressed(bytes.NewReader(make([]byte, 100)), 0)
+	require.NoError(t, err)
+	assert.Len(t, data, 100)
+}
+
+func TestIsTooLarge(t *testing.T) {
+	assert.False(t, IsTooLarge(nil))
+	assert.False(t, IsTooLarge(fmt.Errorf("read body: %w", assert.AnError)))
+	assert.True(t, IsTooLarge(fmt.Errorf("read body: %w", &http.MaxBytesError{Limit: 10})))
+}
+
+func TestReject(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	bodyBefore := Rejections(ReasonBody)
+	decompressedBefore := Rejections(ReasonDecompressed)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	Reject(c, ErrBodyTooLarge)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	assert.True(t, c.IsAborted())
+
+	c, _ = gin.CreateTestContext(httptest.NewRecorder())
+	Reject(c, fmt.Errorf("read decompressed: %w", ErrDecompressedTooLarge))
+
+	assert.Equal(t, bodyBefore+1, Rejections(ReasonBody))
+	assert.Equal(t, decompressedBefore+1, Rejections(ReasonDecompressed))
+}
@@ -0,0 +1,11 @@
+package models
+
+// ErrorResponse - единый формат тела ответа с ошибкой.
+type ErrorResponse struct {
+	// Code - машиночитаемый код ошибки, например invalid_metric
+	Code string `json:"code"`
+	// Message - описание ошибки для человека
+	Message string `json:"message"`
+	// Details - дополнительные сведения, например текст исходной ошибки
+	Details string `json:"details,omitempty"`
+}
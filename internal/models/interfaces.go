@@ -23,8 +23,8 @@ type MetricsStorage interface {
 	// Возвращает указатель на метрику и флаг существования метрики.
 	GetMetrics(ctx context.Context, metricType, metricName string) (*Metrics, bool)
 
-	// GetAllMetrics возвращает список всех доступных метрик.
-	GetAllMetrics() []string
+	// GetAllMetrics возвращает список всех доступных метрик арендатора из контекста.
+	GetAllMetrics(ctx context.Context) []string
 
 	// Ping проверяет доступность хранилища метрик.
 	// Возвращает ошибку, если хранилище недоступно.
@@ -9,6 +9,10 @@ const (
 	TypeCounter = "counter"
 )
 
+// SelfMetricsPrefix - зарезервированный префикс имен собственных метрик сервера.
+// Метрики клиентов с таким префиксом отклоняются.
+const SelfMetricsPrefix = "_collector."
+
 // Metrics представляет собой структуру метрики, используемую для сбора и хранения
 // различных типов метрик в системе мониторинга.
 // Поддерживает два типа метрик: gauge (значение с плавающей точкой) и counter (целочисленный счетчик).
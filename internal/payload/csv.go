@@ -0,0 +1,168 @@
+package payload
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	m "github.com/sanek1/metrics-collector/internal/models"
+)
+
+// Колонки CSV в порядке записи
+const (
+	csvColumnID    = "id"
+	csvColumnType  = "type"
+	csvColumnDelta = "delta"
+	csvColumnValue = "value"
+)
+
+var csvHeader = []string{csvColumnID, csvColumnType, csvColumnDelta, csvColumnValue}
+
+var (
+	// ErrCSVHeader возвращается, если в заголовке CSV нет обязательных колонок.
+	ErrCSVHeader = errors.New("csv header must contain id and type columns")
+	// ErrInvalidRecord возвращается для строки CSV, которую не удалось разобрать.
+	// Чтение можно продолжить со следующей строки.
+	ErrInvalidRecord = errors.New("invalid csv record")
+)
+
+// CSVWriter записывает метрики в CSV с заголовком id,type,delta,value.
+type CSVWriter struct {
+	w      *csv.Writer
+	header bool
+}
+
+// NewCSVWriter создает CSVWriter поверх w.
+func NewCSVWriter(w io.Writer) *CSVWriter {
+	return &CSVWriter{w: csv.NewWriter(w)}
+}
+
+// Write записывает метрику, перед первой метрикой записывается заголовок.
+func (cw *CSVWriter) Write(metric m.Metrics) error {
+	if err := cw.writeHeader(); err != nil {
+		return err
+	}
+	record := []string{metric.ID, metric.MType, "", ""}
+	if metric.Delta != nil {
+		record[2] = strconv.FormatInt(*metric.Delta, 10)
+	}
+	if metric.Value != nil {
+		record[3] = strconv.FormatFloat(*metric.Value, 'g', -1, 64)
+	}
+	return cw.w.Write(record)
+}
+
+// Flush записывает буферизованные данные, в том числе заголовок пустого файла.
+func (cw *CSVWriter) Flush() error {
+	if err := cw.writeHeader(); err != nil {
+		return err
+	}
+	cw.w.Flush()
+	return cw.w.Error()
+}
+
+func (cw *CSVWriter) writeHeader() error {
+	if cw.header {
+		return nil
+	}
+	cw.header = true
+	return cw.w.Write(csvHeader)
+}
+
+// CSVReader читает метрики из CSV, записанного CSVWriter.
+// Колонки определяются по заголовку, их порядок не важен.
+type CSVReader struct {
+	r       *csv.Reader
+	columns map[string]int
+	line    int
+}
+
+// NewCSVReader создает CSVReader поверх r.
+func NewCSVReader(r io.Reader) *CSVReader {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.ReuseRecord = true
+	return &CSVReader{r: cr}
+}
+
+// Line возвращает номер строки последней прочитанной записи.
+func (cr *CSVReader) Line() int {
+	return cr.line
+}
+
+// Read возвращает следующую метрику или io.EOF в конце данных.
+// Ошибки отдельных строк оборачивают ErrInvalidRecord.
+func (cr *CSVReader) Read() (m.Metrics, error) {
+	if cr.columns == nil {
+		if err := cr.readHeader(); err != nil {
+			return m.Metrics{}, err
+		}
+	}
+
+	record, err := cr.r.Read()
+	var parseErr *csv.ParseError
+	if errors.As(err, &parseErr) {
+		cr.line = parseErr.StartLine
+		return m.Metrics{}, fmt.Errorf("%w: %w", ErrInvalidRecord, parseErr.Err)
+	}
+	if err != nil {
+		return m.Metrics{}, err
+	}
+	cr.line, _ = cr.r.FieldPos(0)
+
+	field := func(name string) string {
+		if i, ok := cr.columns[name]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	metric := m.Metrics{ID: field(csvColumnID), MType: field(csvColumnType)}
+	if s := field(csvColumnDelta); s != "" {
+		delta, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return metric, fmt.Errorf("%w: delta: %w", ErrInvalidRecord, err)
+		}
+		metric.Delta = &delta
+	}
+	if s := field(csvColumnValue); s != "" {
+		value, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return metric, fmt.Errorf("%w: value: %w", ErrInvalidRecord, err)
+		}
+		metric.Value = &value
+	}
+	return metric, nil
+}
+
+func (cr *CSVReader) readHeader() error {
+	header, err := cr.r.Read()
+	if errors.Is(err, io.EOF) {
+		return io.EOF
+	}
+	if err != nil {
+		return fmt.Errorf("csv header: %w", err)
+	}
+	cr.line = 1
+
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if i == 0 {
+			// пропускаем BOM, который добавляют табличные редакторы
+			name = strings.TrimPrefix(name, "\ufeff")
+		}
+		columns[name] = i
+	}
+	if _, ok := columns[csvColumnID]; !ok {
+		return ErrCSVHeader
+	}
+	if _, ok := columns[csvColumnType]; !ok {
+		return ErrCSVHeader
+	}
+	cr.columns = columns
+	return nil
+}
@@ -0,0 +1,84 @@
+package payload
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	m "github.com/sanek1/metrics-collector/internal/models"
+)
+
+func TestCSVRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewCSVWriter(&buf)
+	for _, metric := range testBatch() {
+		require.NoError(t, w.Write(metric))
+	}
+	require.NoError(t, w.Flush())
+
+	assert.Equal(t, "id,type,delta,value\nAlloc,gauge,,123.456\nZero,gauge,,0\nPollCount,counter,-42,\n", buf.String())
+
+	r := NewCSVReader(&buf)
+	var got []m.Metrics
+	for {
+		metric, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		require.NoError(t, err)
+		got = append(got, metric)
+	}
+	assert.Equal(t, testBatch(), got)
+}
+
+func TestCSVWriterEmpty(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, NewCSVWriter(&buf).Flush())
+	assert.Equal(t, "id,type,delta,value\n", buf.String())
+}
+
+func TestCSVReader(t *testing.T) {
+	t.Run("columns in any order", func(t *testing.T) {
+		r := NewCSVReader(strings.NewReader("\ufeffValue,ID,Type\n1.5,Alloc,gauge\n"))
+		metric, err := r.Read()
+		require.NoError(t, err)
+		assert.Equal(t, "Alloc", metric.ID)
+		assert.Equal(t, 1.5, *metric.Value)
+		assert.Equal(t, 2, r.Line())
+
+		_, err = r.Read()
+		assert.ErrorIs(t, err, io.EOF)
+	})
+
+	t.Run("invalid records", func(t *testing.T) {
+		r := NewCSVReader(strings.NewReader("id,type,delta,value\nc,counter,abc,\ng,gauge,,1\"x\ng,gauge,,2\n"))
+
+		_, err := r.Read()
+		assert.ErrorIs(t, err, ErrInvalidRecord)
+		assert.Equal(t, 2, r.Line())
+
+		_, err = r.Read()
+		assert.ErrorIs(t, err, ErrInvalidRecord)
+		assert.Equal(t, 3, r.Line())
+
+		metric, err := r.Read()
+		require.NoError(t, err)
+		assert.Equal(t, 2.0, *metric.Value)
+		assert.Equal(t, 4, r.Line())
+	})
+
+	t.Run("missing header columns", func(t *testing.T) {
+		_, err := NewCSVReader(strings.NewReader("name,value\nx,1\n")).Read()
+		assert.ErrorIs(t, err, ErrCSVHeader)
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		_, err := NewCSVReader(strings.NewReader("")).Read()
+		assert.ErrorIs(t, err, io.EOF)
+	})
+}
@@ -0,0 +1,147 @@
+// Package payload кодирует и разбирает пакеты метрик в форматах JSON,
+// Protocol Buffers и MessagePack, а также выгрузки метрик в CSV.
+// Формат определяется заголовком Content-Type.
+package payload
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"strings"
+
+	"github.com/vmihailenco/msgpack/v5"
+
+	m "github.com/sanek1/metrics-collector/internal/models"
+)
+
+// Форматы тела запроса
+const (
+	FormatJSON     = "json"
+	FormatProtobuf = "protobuf"
+	FormatMsgpack  = "msgpack"
+	FormatCSV      = "csv"
+	FormatNDJSON   = "ndjson"
+)
+
+// Значения заголовка Content-Type
+const (
+	ContentTypeJSON     = "application/json"
+	ContentTypeProtobuf = "application/x-protobuf"
+	ContentTypeMsgpack  = "application/msgpack"
+	ContentTypeCSV      = "text/csv"
+	ContentTypeNDJSON   = "application/x-ndjson"
+)
+
+// ErrUnsupportedFormat возвращается для неизвестного формата.
+var ErrUnsupportedFormat = errors.New("unsupported payload format")
+
+// contentTypes сопоставляет варианты Content-Type форматам
+var contentTypes = map[string]string{
+	ContentTypeProtobuf:       FormatProtobuf,
+	"application/protobuf":    FormatProtobuf,
+	ContentTypeMsgpack:        FormatMsgpack,
+	"application/x-msgpack":   FormatMsgpack,
+	"application/vnd.msgpack": FormatMsgpack,
+	ContentTypeJSON:           FormatJSON,
+	ContentTypeCSV:            FormatCSV,
+	ContentTypeNDJSON:         FormatNDJSON,
+	"application/ndjson":      FormatNDJSON,
+}
+
+// FormatOf возвращает формат по значению заголовка Content-Type.
+// Пустой и прочие типы считаются JSON для совместимости со старыми клиентами.
+// Для CSV и NDJSON Marshal и Unmarshal не применяются, их читают потоком.
+func FormatOf(contentType string) string {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return FormatJSON
+	}
+	if format, ok := contentTypes[strings.ToLower(mediaType)]; ok {
+		return format
+	}
+	return FormatJSON
+}
+
+// ContentType возвращает значение заголовка Content-Type для формата.
+func ContentType(format string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(format)) {
+	case "", FormatJSON:
+		return ContentTypeJSON, nil
+	case FormatProtobuf, "proto":
+		return ContentTypeProtobuf, nil
+	case FormatMsgpack:
+		return ContentTypeMsgpack, nil
+	default:
+		return "", fmt.Errorf("%w: %s", ErrUnsupportedFormat, format)
+	}
+}
+
+// Marshal кодирует пакет метрик в формате, соответствующем Content-Type.
+func Marshal(contentType string, metrics []m.Metrics) ([]byte, error) {
+	switch FormatOf(contentType) {
+	case FormatProtobuf:
+		return marshalProto(metrics), nil
+	case FormatMsgpack:
+		var buf bytes.Buffer
+		enc := msgpack.NewEncoder(&buf)
+		enc.SetCustomStructTag("json")
+		enc.SetOmitEmpty(true)
+		if err := enc.Encode(metrics); err != nil {
+			return nil, fmt.Errorf("msgpack encode: %w", err)
+		}
+		return buf.Bytes(), nil
+	default:
+		return json.Marshal(metrics)
+	}
+}
+
+// Unmarshal разбирает одиночную метрику или пакет метрик
+// в формате, соответствующем Content-Type.
+func Unmarshal(contentType string, data []byte) ([]m.Metrics, error) {
+	switch FormatOf(contentType) {
+	case FormatProtobuf:
+		return unmarshalProto(data)
+	case FormatMsgpack:
+		return unmarshalMsgpack(data)
+	default:
+		return unmarshalJSON(data)
+	}
+}
+
+func unmarshalJSON(data []byte) ([]m.Metrics, error) {
+	var model m.Metrics
+	if err := json.Unmarshal(data, &model); err != nil {
+		var models []m.Metrics
+		if err := json.Unmarshal(data, &models); err != nil {
+			return nil, err
+		}
+		return models, nil
+	}
+	if model == (m.Metrics{}) {
+		return nil, nil
+	}
+	return []m.Metrics{model}, nil
+}
+
+func unmarshalMsgpack(data []byte) ([]m.Metrics, error) {
+	newDecoder := func() *msgpack.Decoder {
+		dec := msgpack.NewDecoder(bytes.NewReader(data))
+		dec.SetCustomStructTag("json")
+		return dec
+	}
+
+	var models []m.Metrics
+	if err := newDecoder().Decode(&models); err == nil {
+		return models, nil
+	}
+	var model m.Metrics
+	if err := newDecoder().Decode(&model); err != nil {
+		return nil, fmt.Errorf("msgpack decode: %w", err)
+	}
+	if model == (m.Metrics{}) {
+		return nil, nil
+	}
+	return []m.Metrics{model}, nil
+}
@@ -0,0 +1,134 @@
+package payload
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/encoding/protowire"
+
+	m "github.com/sanek1/metrics-collector/internal/models"
+)
+
+func testBatch() []m.Metrics {
+	value := 123.456
+	zero := 0.0
+	delta := int64(-42)
+	return []m.Metrics{
+		{ID: "Alloc", MType: m.TypeGauge, Value: &value},
+		{ID: "Zero", MType: m.TypeGauge, Value: &zero},
+		{ID: "PollCount", MType: m.TypeCounter, Delta: &delta},
+	}
+}
+
+func TestMarshalRoundTrip(t *testing.T) {
+	for _, contentType := range []string{ContentTypeJSON, ContentTypeProtobuf, ContentTypeMsgpack} {
+		t.Run(contentType, func(t *testing.T) {
+			data, err := Marshal(contentType, testBatch())
+			require.NoError(t, err)
+
+			got, err := Unmarshal(contentType, data)
+			require.NoError(t, err)
+			assert.Equal(t, testBatch(), got)
+		})
+	}
+}
+
+func TestBinarySmallerThanJSON(t *testing.T) {
+	batch := make([]m.Metrics, 0, 100)
+	for i := 0; i < 100; i++ {
+		v := float64(i) * 1.123456789
+		batch = append(batch, m.Metrics{ID: "RandomValue", MType: m.TypeGauge, Value: &v})
+	}
+	jsonData, err := Marshal(ContentTypeJSON, batch)
+	require.NoError(t, err)
+	for _, contentType := range []string{ContentTypeProtobuf, ContentTypeMsgpack} {
+		data, err := Marshal(contentType, batch)
+		require.NoError(t, err)
+		assert.Less(t, len(data), len(jsonData), contentType)
+	}
+}
+
+func TestUnmarshalSingle(t *testing.T) {
+	value := 1.5
+	metric := m.Metrics{ID: "Alloc", MType: m.TypeGauge, Value: &value}
+
+	got, err := Unmarshal(ContentTypeJSON, []byte(`{"id":"Alloc","type":"gauge","value":1.5}`))
+	require.NoError(t, err)
+	assert.Equal(t, []m.Metrics{metric}, got)
+
+	enc, err := msgpack.Marshal(map[string]any{"id": "Alloc", "type": "gauge", "value": 1.5})
+	require.NoError(t, err)
+	got, err = Unmarshal(ContentTypeMsgpack, enc)
+	require.NoError(t, err)
+	assert.Equal(t, []m.Metrics{metric}, got)
+}
+
+func TestUnmarshalProtoSkipsUnknownFields(t *testing.T) {
+	var msg []byte
+	msg = protowire.AppendTag(msg, fieldMetricID, protowire.BytesType)
+	msg = protowire.AppendString(msg, "PollCount")
+	msg = protowire.AppendTag(msg, 15, protowire.VarintType)
+	msg = protowire.AppendVarint(msg, 7)
+	msg = protowire.AppendTag(msg, fieldMetricType, protowire.BytesType)
+	msg = protowire.AppendString(msg, m.TypeCounter)
+
+	var batch []byte
+	batch = protowire.AppendTag(batch, 2, protowire.BytesType)
+	batch = protowire.AppendString(batch, "ignored")
+	batch = protowire.AppendTag(batch, fieldBatchMetrics, protowire.BytesType)
+	batch = protowire.AppendBytes(batch, msg)
+
+	got, err := Unmarshal(ContentTypeProtobuf, batch)
+	require.NoError(t, err)
+	assert.Equal(t, []m.Metrics{{ID: "PollCount", MType: m.TypeCounter}}, got)
+}
+
+func TestUnmarshalInvalid(t *testing.T) {
+	_, err := Unmarshal(ContentTypeProtobuf, []byte{0x0a, 0x10, 0x01})
+	assert.Error(t, err)
+
+	_, err = Unmarshal(ContentTypeMsgpack, []byte{0xc1})
+	assert.Error(t, err)
+
+	_, err = Unmarshal(ContentTypeJSON, []byte("not json"))
+	assert.Error(t, err)
+}
+
+func TestFormatOf(t *testing.T) {
+	tests := map[string]string{
+		"":                                   FormatJSON,
+		"application/json":                   FormatJSON,
+		"application/json; charset=utf-8":    FormatJSON,
+		"text/plain":                         FormatJSON,
+		"application/x-protobuf":             FormatProtobuf,
+		"application/protobuf":               FormatProtobuf,
+		"application/msgpack":                FormatMsgpack,
+		"Application/X-Msgpack":              FormatMsgpack,
+		"application/vnd.msgpack; charset=x": FormatMsgpack,
+		"text/csv; charset=utf-8":            FormatCSV,
+		"application/x-ndjson":               FormatNDJSON,
+	}
+	for contentType, want := range tests {
+		assert.Equal(t, want, FormatOf(contentType), contentType)
+	}
+}
+
+func TestContentType(t *testing.T) {
+	for format, want := range map[string]string{
+		"":         ContentTypeJSON,
+		"json":     ContentTypeJSON,
+		"protobuf": ContentTypeProtobuf,
+		"proto":    ContentTypeProtobuf,
+		"MsgPack":  ContentTypeMsgpack,
+	} {
+		got, err := ContentType(format)
+		require.NoError(t, err)
+		assert.Equal(t, want, got)
+	}
+
+	_, err := ContentType("xml")
+	assert.True(t, errors.Is(err, ErrUnsupportedFormat))
+}
@@ -0,0 +1,119 @@
+package payload
+
+import (
+	"fmt"
+	"math"
+
+	"google.golang.org/protobuf/encoding/protowire"
+
+	m "github.com/sanek1/metrics-collector/internal/models"
+)
+
+// Номера полей сообщений из metrics.proto
+const (
+	fieldBatchMetrics protowire.Number = 1
+
+	fieldMetricID    protowire.Number = 1
+	fieldMetricType  protowire.Number = 2
+	fieldMetricDelta protowire.Number = 3
+	fieldMetricValue protowire.Number = 4
+)
+
+// marshalProto кодирует пакет метрик в сообщение MetricsBatch.
+func marshalProto(metrics []m.Metrics) []byte {
+	var buf, msg []byte
+	for i := range metrics {
+		msg = appendMetric(msg[:0], &metrics[i])
+		buf = protowire.AppendTag(buf, fieldBatchMetrics, protowire.BytesType)
+		buf = protowire.AppendBytes(buf, msg)
+	}
+	return buf
+}
+
+func appendMetric(b []byte, metric *m.Metrics) []byte {
+	if metric.ID != "" {
+		b = protowire.AppendTag(b, fieldMetricID, protowire.BytesType)
+		b = protowire.AppendString(b, metric.ID)
+	}
+	if metric.MType != "" {
+		b = protowire.AppendTag(b, fieldMetricType, protowire.BytesType)
+		b = protowire.AppendString(b, metric.MType)
+	}
+	if metric.Delta != nil {
+		b = protowire.AppendTag(b, fieldMetricDelta, protowire.VarintType)
+		b = protowire.AppendVarint(b, protowire.EncodeZigZag(*metric.Delta))
+	}
+	if metric.Value != nil {
+		b = protowire.AppendTag(b, fieldMetricValue, protowire.Fixed64Type)
+		b = protowire.AppendFixed64(b, math.Float64bits(*metric.Value))
+	}
+	return b
+}
+
+// unmarshalProto разбирает сообщение MetricsBatch. Неизвестные поля пропускаются.
+func unmarshalProto(b []byte) ([]m.Metrics, error) {
+	var metrics []m.Metrics
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return nil, fmt.Errorf("protobuf decode: %w", protowire.ParseError(n))
+		}
+		b = b[n:]
+
+		if num == fieldBatchMetrics && typ == protowire.BytesType {
+			msg, n := protowire.ConsumeBytes(b)
+			if n < 0 {
+				return nil, fmt.Errorf("protobuf decode: %w", protowire.ParseError(n))
+			}
+			metric, err := unmarshalMetric(msg)
+			if err != nil {
+				return nil, err
+			}
+			metrics = append(metrics, metric)
+			b = b[n:]
+			continue
+		}
+
+		n = protowire.ConsumeFieldValue(num, typ, b)
+		if n < 0 {
+			return nil, fmt.Errorf("protobuf decode: %w", protowire.ParseError(n))
+		}
+		b = b[n:]
+	}
+	return metrics, nil
+}
+
+func unmarshalMetric(b []byte) (m.Metrics, error) {
+	var metric m.Metrics
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return metric, fmt.Errorf("protobuf decode metric: %w", protowire.ParseError(n))
+		}
+		b = b[n:]
+
+		switch {
+		case num == fieldMetricID && typ == protowire.BytesType:
+			metric.ID, n = protowire.ConsumeString(b)
+		case num == fieldMetricType && typ == protowire.BytesType:
+			metric.MType, n = protowire.ConsumeString(b)
+		case num == fieldMetricDelta && typ == protowire.VarintType:
+			var v uint64
+			v, n = protowire.ConsumeVarint(b)
+			delta := protowire.DecodeZigZag(v)
+			metric.Delta = &delta
+		case num == fieldMetricValue && typ == protowire.Fixed64Type:
+			var v uint64
+			v, n = protowire.ConsumeFixed64(b)
+			value := math.Float64frombits(v)
+			metric.Value = &value
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, b)
+		}
+		if n < 0 {
+			return metric, fmt.Errorf("protobuf decode metric: %w", protowire.ParseError(n))
+		}
+		b = b[n:]
+	}
+	return metric, nil
+}
@@ -0,0 +1,66 @@
+// Package requestid предоставляет функции для работы с идентификаторами запросов
+// и агентов, по которым журналы агента и сервера сопоставляются друг с другом.
+package requestid
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+)
+
+const (
+	// Header - заголовок запроса и ответа с идентификатором запроса
+	Header = "X-Request-ID"
+	// AgentHeader - заголовок запроса с идентификатором агента
+	AgentHeader = "X-Agent-ID"
+
+	maxLength = 128
+	idBytes   = 16
+)
+
+type ctxKey struct{}
+
+// New возвращает случайный идентификатор запроса из 32 шестнадцатеричных символов.
+func New() string {
+	b := make([]byte, idBytes)
+	if _, err := rand.Read(b); err != nil {
+		panic(fmt.Sprintf("requestid: crypto/rand failed: %v", err))
+	}
+	return hex.EncodeToString(b)
+}
+
+// WithID возвращает копию контекста с идентификатором запроса.
+func WithID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, ctxKey{}, id)
+}
+
+// FromContext возвращает идентификатор запроса из контекста или пустую строку.
+func FromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	id, _ := ctx.Value(ctxKey{}).(string)
+	return id
+}
+
+// Validate проверяет идентификатор запроса или агента, полученный от клиента.
+// Допускаются латинские буквы, цифры и символы '-', '_', '.', ':' длиной до 128 символов,
+// чтобы значение можно было без экранирования записать в журнал.
+func Validate(id string) error {
+	if id == "" {
+		return fmt.Errorf("id is empty")
+	}
+	if len(id) > maxLength {
+		return fmt.Errorf("id is longer than %d characters", maxLength)
+	}
+	for _, r := range id {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case r == '-', r == '_', r == '.', r == ':':
+		default:
+			return fmt.Errorf("id contains invalid character %q", r)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package requestid
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNew(t *testing.T) {
+	id := New()
+	assert.Len(t, id, 2*idBytes)
+	require.NoError(t, Validate(id))
+	assert.NotEqual(t, id, New())
+}
+
+func TestFromContext(t *testing.T) {
+	assert.Empty(t, FromContext(context.Background()))
+	assert.Equal(t, "abc", FromContext(WithID(context.Background(), "abc")))
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		id      string
+		wantErr bool
+	}{
+		{name: "hex", id: "4bf92f3577b34da6a3ce929d0e0e4736", wantErr: false},
+		{name: "uuid", id: "0f8fad5b-d9cb-469f-a165-70867728950e", wantErr: false},
+		{name: "host", id: "agent-01.example.com:8080", wantErr: false},
+		{name: "empty", id: "", wantErr: true},
+		{name: "newline", id: "abc\ndef", wantErr: true},
+		{name: "quote", id: `abc"def`, wantErr: true},
+		{name: "too long", id: strings.Repeat("a", 129), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Validate(tt.id)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,322 @@
+package routing
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/sanek1/metrics-collector/internal/apierror"
+	h "github.com/sanek1/metrics-collector/internal/handlers"
+	m "github.com/sanek1/metrics-collector/internal/models"
+	"github.com/sanek1/metrics-collector/internal/payload"
+	v "github.com/sanek1/metrics-collector/internal/validation"
+)
+
+// apiPrefix - префикс версионированного API
+const apiPrefix = "/api/v1"
+
+// endpoint описывает маршрут: основной путь, устаревшие пути-псевдонимы,
+// требуемую область доступа, обработчики и документацию OpenAPI.
+// По таблице endpoints регистрируются маршруты gin и строится документ OpenAPI,
+// поэтому документ всегда соответствует фактическим маршрутам.
+type endpoint struct {
+	method string
+	path   string
+	// legacy - пути, сохраненные для совместимости со старыми клиентами
+	legacy []string
+	// scope - область доступа токена API, пустая для открытых маршрутов
+	scope string
+	// ingest - маршрут принимает метрики и учитывается в очереди приема
+	ingest  bool
+	handler func(r *Router) []gin.HandlerFunc
+	doc     operation
+}
+
+// metricBody и batchBody - тело запроса с одной метрикой и с пакетом метрик
+var (
+	metricBody = requestBody{
+		schema: schemaRef("Metrics"),
+		types:  []string{payload.ContentTypeJSON, payload.ContentTypeMsgpack, payload.ContentTypeProtobuf},
+	}
+	batchBody = requestBody{
+		schema: schemaRef("MetricsBatch"),
+		types:  []string{payload.ContentTypeJSON, payload.ContentTypeMsgpack, payload.ContentTypeProtobuf},
+	}
+)
+
+// endpoints возвращает таблицу маршрутов сервера.
+func endpoints() []endpoint {
+	update := func(r *Router) []gin.HandlerFunc {
+		return []gin.HandlerFunc{r.middlewareParser.HandleMetrics(), r.s.MetricHandler}
+	}
+	updated := map[int]response{
+		http.StatusOK:                    jsonResponse("Обновленная метрика или пакет метрик", oneOf("Metrics", "MetricsBatch")),
+		http.StatusBadRequest:            errorResponse("Некорректная метрика"),
+		http.StatusRequestEntityTooLarge: errorResponse("Тело запроса превышает ограничение"),
+		http.StatusUnsupportedMediaType:  errorResponse("Неподдерживаемая кодировка тела"),
+		http.StatusInternalServerError:   errorResponse("Ошибка хранилища"),
+	}
+
+	return []endpoint{
+		{
+			method: http.MethodPost,
+			path:   apiPrefix + "/update/:" + h.ParamType + "/:" + h.ParamName + "/:" + h.ParamValue,
+			legacy: []string{"/update/:" + h.ParamType + "/:" + h.ParamName + "/:" + h.ParamValue},
+			scope:  v.ScopeWrite,
+			ingest: true,
+			handler: func(r *Router) []gin.HandlerFunc {
+				return append([]gin.HandlerFunc{validateURLMetric}, update(r)...)
+			},
+			doc: operation{
+				id:      "updateMetricFromURL",
+				summary: "Обновить метрику, переданную в пути запроса",
+				responses: map[int]response{
+					http.StatusOK:                  jsonResponse("Обновленная метрика", schemaRef("Metrics")),
+					http.StatusBadRequest:          errorResponse("Некорректный тип или значение метрики"),
+					http.StatusInternalServerError: errorResponse("Ошибка хранилища"),
+				},
+			},
+		},
+		{
+			method:  http.MethodPost,
+			path:    apiPrefix + "/update",
+			legacy:  []string{"/update/"},
+			scope:   v.ScopeWrite,
+			ingest:  true,
+			handler: update,
+			doc: operation{
+				id:        "updateMetric",
+				summary:   "Обновить метрику из тела запроса",
+				body:      &metricBody,
+				responses: updated,
+			},
+		},
+		{
+			method:  http.MethodPost,
+			path:    apiPrefix + "/updates",
+			legacy:  []string{"/updates/"},
+			scope:   v.ScopeWrite,
+			ingest:  true,
+			handler: update,
+			doc: operation{
+				id:        "updateMetrics",
+				summary:   "Обновить пакет метрик",
+				body:      &batchBody,
+				responses: updated,
+			},
+		},
+		{
+			method: http.MethodPost,
+			path:   apiPrefix + "/value",
+			legacy: []string{"/value/"},
+			scope:  v.ScopeRead,
+			handler: func(r *Router) []gin.HandlerFunc {
+				return []gin.HandlerFunc{r.s.GetMetricsByValueHandler}
+			},
+			doc: operation{
+				id:      "getMetric",
+				summary: "Получить метрику по типу и имени из тела запроса",
+				body:    &requestBody{schema: schemaRef("Metrics"), types: []string{payload.ContentTypeJSON}},
+				responses: map[int]response{
+					http.StatusOK:                    jsonResponse("Метрика", schemaRef("Metrics")),
+					http.StatusBadRequest:            errorResponse("Некорректный запрос"),
+					http.StatusNotFound:              errorResponse("Метрика не найдена"),
+					http.StatusRequestEntityTooLarge: errorResponse("Тело запроса превышает ограничение"),
+				},
+			},
+		},
+		{
+			method: http.MethodGet,
+			path:   apiPrefix + "/value/:" + h.ParamType + "/:" + h.ParamName,
+			legacy: []string{"/value/:" + h.ParamType + "/:" + h.ParamName},
+			scope:  v.ScopeRead,
+			handler: func(r *Router) []gin.HandlerFunc {
+				return []gin.HandlerFunc{r.s.GetMetricsByNameHandler}
+			},
+			doc: operation{
+				id:      "getMetricValue",
+				summary: "Получить значение метрики в виде текста",
+				responses: map[int]response{
+					http.StatusOK:       textResponse("Значение метрики", "text/plain"),
+					http.StatusNotFound: errorResponse("Метрика не найдена"),
+				},
+			},
+		},
+		{
+			method: http.MethodPost,
+			path:   importRoute,
+			scope:  v.ScopeAdmin,
+			ingest: true,
+			handler: func(r *Router) []gin.HandlerFunc {
+				return []gin.HandlerFunc{v.NoDeadlines(), r.middlewareHash.HashStreamMiddleware(), r.s.ImportHandler}
+			},
+			doc: operation{
+				id:      "importMetrics",
+				summary: "Потоковый импорт метрик в формате NDJSON или CSV",
+				query:   []parameter{formatParam("Формат тела, по умолчанию определяется Content-Type", payload.FormatNDJSON, payload.FormatCSV)},
+				body: &requestBody{
+					schema: &schema{Type: "string"},
+					types:  []string{payload.ContentTypeNDJSON, payload.ContentTypeCSV},
+				},
+				responses: map[int]response{
+					http.StatusOK:                   jsonResponse("Итог импорта", schemaRef("ImportSummary")),
+					http.StatusBadRequest:           jsonResponse("Импорт прерван или отклонен", oneOf("ImportSummary", "ErrorResponse")),
+					http.StatusUnsupportedMediaType: errorResponse("Неподдерживаемая кодировка тела"),
+					http.StatusInternalServerError:  jsonResponse("Ошибка хранилища", oneOf("ImportSummary", "ErrorResponse")),
+				},
+			},
+		},
+		{
+			method: http.MethodGet,
+			path:   apiPrefix + "/export",
+			scope:  v.ScopeAdmin,
+			handler: func(r *Router) []gin.HandlerFunc {
+				return []gin.HandlerFunc{r.s.ExportHandler}
+			},
+			doc: operation{
+				id:      "exportMetrics",
+				summary: "Выгрузить все метрики в формате JSON или CSV",
+				query:   []parameter{formatParam("Формат выгрузки", payload.FormatJSON, payload.FormatCSV)},
+				responses: map[int]response{
+					http.StatusOK: {
+						description: "Метрики",
+						content: map[string]*schema{
+							payload.ContentTypeJSON: schemaRef("MetricsBatch"),
+							payload.ContentTypeCSV:  {Type: "string"},
+						},
+					},
+					http.StatusBadRequest: errorResponse("Неподдерживаемый формат"),
+				},
+			},
+		},
+		{
+			method: http.MethodGet,
+			path:   apiPrefix + "/ping",
+			legacy: []string{"/ping"},
+			handler: func(r *Router) []gin.HandlerFunc {
+				return []gin.HandlerFunc{r.s.PingDBHandler}
+			},
+			doc: operation{
+				id:      "ping",
+				summary: "Проверить соединение с хранилищем",
+				responses: map[int]response{
+					http.StatusOK:         jsonResponse("Хранилище доступно", &schema{Type: "object"}),
+					http.StatusBadRequest: errorResponse("База данных недоступна"),
+				},
+			},
+		},
+		{
+			method: http.MethodGet,
+			path:   apiPrefix + "/openapi.json",
+			handler: func(r *Router) []gin.HandlerFunc {
+				return []gin.HandlerFunc{openAPIHandler}
+			},
+			doc: operation{
+				id:      "openapi",
+				summary: "Документ OpenAPI с описанием маршрутов сервера",
+				responses: map[int]response{
+					http.StatusOK: jsonResponse("Документ OpenAPI 3", &schema{Type: "object"}),
+				},
+			},
+		},
+		{
+			method: http.MethodGet,
+			path:   apiPrefix + "/self/metrics",
+			scope:  v.ScopeAdmin,
+			handler: func(r *Router) []gin.HandlerFunc {
+				return []gin.HandlerFunc{r.selfMetricsHandler}
+			},
+			doc: operation{
+				id: "selfMetrics",
+				summary: "Собственные метрики сервера: запросы и задержки по маршрутам, прием метрик, " +
+					"задержки хранилища, пул соединений, резервное копирование и отклоненные запросы",
+				responses: map[int]response{
+					http.StatusOK:                  jsonResponse("Метрики с префиксом "+m.SelfMetricsPrefix, schemaRef("MetricsBatch")),
+					http.StatusInternalServerError: errorResponse("Не удалось снять метрики"),
+				},
+			},
+		},
+		{
+			method: http.MethodGet,
+			path:   "/healthz",
+			handler: func(r *Router) []gin.HandlerFunc {
+				return []gin.HandlerFunc{r.healthzHandler}
+			},
+			doc: operation{
+				id:      "healthz",
+				summary: "Проверка живости процесса",
+				responses: map[int]response{
+					http.StatusOK: jsonResponse("Процесс жив: up или starting", schemaRef("HealthReport")),
+				},
+			},
+		},
+		{
+			method: http.MethodGet,
+			path:   "/readyz",
+			handler: func(r *Router) []gin.HandlerFunc {
+				return []gin.HandlerFunc{r.readyzHandler}
+			},
+			doc: operation{
+				id:      "readyz",
+				summary: "Проверка готовности с состоянием компонентов",
+				responses: map[int]response{
+					http.StatusOK:                 jsonResponse("Сервер готов принимать запросы", schemaRef("HealthReport")),
+					http.StatusServiceUnavailable: jsonResponse("Сервер запускается (starting) или неисправен (down)", schemaRef("HealthReport")),
+				},
+			},
+		},
+		{
+			method: http.MethodGet,
+			path:   "/",
+			scope:  v.ScopeRead,
+			handler: func(r *Router) []gin.HandlerFunc {
+				return []gin.HandlerFunc{r.s.MainPageHandler}
+			},
+			doc: operation{
+				id:      "mainPage",
+				summary: "HTML-страница со списком метрик",
+				responses: map[int]response{
+					http.StatusOK: textResponse("Список метрик", "text/html"),
+				},
+			},
+		},
+	}
+}
+
+// registerEndpoints регистрирует маршруты по основному пути и путям-псевдонимам.
+func (r *Router) registerEndpoints() {
+	for _, e := range endpoints() {
+		handlers := e.handler(r)
+		if e.ingest {
+			handlers = append([]gin.HandlerFunc{v.InFlight(&r.ingestion)}, handlers...)
+		}
+		if e.scope != "" {
+			handlers = append([]gin.HandlerFunc{r.auth.Require(e.scope)}, handlers...)
+		}
+		for _, path := range append([]string{e.path}, e.legacy...) {
+			r.router.Handle(e.method, path, handlers...)
+		}
+	}
+}
+
+// validateURLMetric проверяет тип и значение метрики, переданной в пути запроса.
+func validateURLMetric(c *gin.Context) {
+	metricType := c.Param(h.ParamType)
+	metricValue := c.Param(h.ParamValue)
+
+	var err error
+	switch metricType {
+	case m.TypeCounter:
+		_, err = parseCounterValue(metricValue)
+	case m.TypeGauge:
+		_, err = parseGaugeValue(metricValue)
+	default:
+		apierror.Abort(c, http.StatusBadRequest, apierror.CodeInvalidMetric, "Unsupported metric type", metricType)
+		return
+	}
+	if err != nil {
+		apierror.Abort(c, http.StatusBadRequest, apierror.CodeInvalidMetric, "Invalid metric value", err.Error())
+		return
+	}
+	c.Next()
+}
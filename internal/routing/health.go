@@ -0,0 +1,40 @@
+package routing
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/sanek1/metrics-collector/internal/health"
+)
+
+// Health возвращает реестр проверок живости и готовности сервера.
+func (r *Router) Health() *health.Registry {
+	return r.health
+}
+
+// checkIngestion сообщает глубину очереди приема метрик -
+// количество запросов на запись, которые еще обрабатываются.
+func (r *Router) checkIngestion(context.Context) health.Component {
+	return health.Component{
+		Status:  health.StatusUp,
+		Details: map[string]interface{}{"queue_depth": r.ingestion.Load()},
+	}
+}
+
+// healthzHandler отвечает 200, пока процесс жив.
+func (r *Router) healthzHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, r.health.Liveness())
+}
+
+// readyzHandler отвечает 200, если сервер запущен и все компоненты исправны,
+// иначе 503 с состоянием starting или down и отчетом по компонентам.
+func (r *Router) readyzHandler(c *gin.Context) {
+	report := r.health.Readiness(c.Request.Context())
+	status := http.StatusOK
+	if report.Status != health.StatusUp {
+		status = http.StatusServiceUnavailable
+	}
+	c.JSON(status, report)
+}
@@ -0,0 +1,366 @@
+package routing
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	h "github.com/sanek1/metrics-collector/internal/handlers"
+	"github.com/sanek1/metrics-collector/internal/health"
+	m "github.com/sanek1/metrics-collector/internal/models"
+	"github.com/sanek1/metrics-collector/internal/payload"
+)
+
+// bearerAuth - имя схемы авторизации токенами API в документе OpenAPI
+const bearerAuth = "bearerAuth"
+
+// operation - документация маршрута в таблице endpoints
+type operation struct {
+	id        string
+	summary   string
+	query     []parameter
+	body      *requestBody
+	responses map[int]response
+}
+
+// requestBody описывает тело запроса: схему и допустимые значения Content-Type.
+type requestBody struct {
+	schema *schema
+	types  []string
+}
+
+// response описывает ответ: схему тела для каждого Content-Type.
+type response struct {
+	description string
+	content     map[string]*schema
+}
+
+type schema struct {
+	Ref         string             `json:"$ref,omitempty"`
+	Type        string             `json:"type,omitempty"`
+	Format      string             `json:"format,omitempty"`
+	Description string             `json:"description,omitempty"`
+	Enum        []string           `json:"enum,omitempty"`
+	Items       *schema            `json:"items,omitempty"`
+	Properties  map[string]*schema `json:"properties,omitempty"`
+	Required    []string           `json:"required,omitempty"`
+	OneOf       []*schema          `json:"oneOf,omitempty"`
+	// AdditionalProperties - схема значений объекта-словаря
+	AdditionalProperties *schema `json:"additionalProperties,omitempty"`
+}
+
+type parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required"`
+	Schema      *schema `json:"schema"`
+}
+
+type mediaType struct {
+	Schema *schema `json:"schema"`
+}
+
+type openAPIDocument struct {
+	OpenAPI    string                       `json:"openapi"`
+	Info       openAPIInfo                  `json:"info"`
+	Paths      map[string]map[string]*apiOp `json:"paths"`
+	Components openAPIComponents            `json:"components"`
+}
+
+type openAPIInfo struct {
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	Version     string `json:"version"`
+}
+
+type openAPIComponents struct {
+	Schemas         map[string]*schema           `json:"schemas"`
+	SecuritySchemes map[string]map[string]string `json:"securitySchemes"`
+}
+
+type apiOp struct {
+	OperationID string                 `json:"operationId"`
+	Summary     string                 `json:"summary"`
+	Description string                 `json:"description,omitempty"`
+	Deprecated  bool                   `json:"deprecated,omitempty"`
+	Parameters  []parameter            `json:"parameters,omitempty"`
+	RequestBody *apiRequestBody        `json:"requestBody,omitempty"`
+	Responses   map[string]apiResponse `json:"responses"`
+	Security    []map[string][]string  `json:"security,omitempty"`
+}
+
+type apiRequestBody struct {
+	Required bool                 `json:"required"`
+	Content  map[string]mediaType `json:"content"`
+}
+
+type apiResponse struct {
+	Description string               `json:"description"`
+	Content     map[string]mediaType `json:"content,omitempty"`
+}
+
+// pathParams - описания параметров пути
+var pathParams = map[string]*parameter{
+	h.ParamType: {
+		Description: "Тип метрики",
+		Schema:      &schema{Type: "string", Enum: []string{m.TypeGauge, m.TypeCounter}},
+	},
+	h.ParamName: {
+		Description: "Имя метрики",
+		Schema:      &schema{Type: "string"},
+	},
+	h.ParamValue: {
+		Description: "Значение метрики: целое для counter, число с плавающей точкой для gauge",
+		Schema:      &schema{Type: "string"},
+	},
+}
+
+// componentTypes - типы Go, схемы которых публикуются в components/schemas
+var componentTypes = map[string]reflect.Type{
+	"Metrics":       reflect.TypeOf(m.Metrics{}),
+	"ErrorResponse": reflect.TypeOf(m.ErrorResponse{}),
+	"ImportSummary": reflect.TypeOf(h.ImportSummary{}),
+	"ImportError":   reflect.TypeOf(h.ImportError{}),
+	"HealthReport":  reflect.TypeOf(health.Report{}),
+	"HealthCheck":   reflect.TypeOf(health.Component{}),
+}
+
+var (
+	openAPIOnce sync.Once
+	openAPIDoc  []byte
+	openAPIErr  error
+)
+
+// openAPIJSON возвращает документ OpenAPI, построенный один раз при первом запросе.
+func openAPIJSON() ([]byte, error) {
+	openAPIOnce.Do(func() {
+		openAPIDoc, openAPIErr = json.MarshalIndent(buildOpenAPI(), "", "  ")
+	})
+	return openAPIDoc, openAPIErr
+}
+
+// openAPIHandler отдает документ OpenAPI в формате JSON.
+func openAPIHandler(c *gin.Context) {
+	doc, err := openAPIJSON()
+	if err != nil {
+		_ = c.Error(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	c.Data(http.StatusOK, payload.ContentTypeJSON, doc)
+}
+
+// buildOpenAPI строит документ OpenAPI 3 по таблице endpoints.
+// Пути-псевдонимы публикуются с тем же описанием и пометкой deprecated.
+func buildOpenAPI() *openAPIDocument {
+	doc := &openAPIDocument{
+		OpenAPI: "3.0.3",
+		Info: openAPIInfo{
+			Title: "Metrics Collector API",
+			Description: "Сервис для сбора и хранения метрик. Основные маршруты находятся в группе " + apiPrefix +
+				", прежние пути сохранены как псевдонимы. Ошибки возвращаются в формате ErrorResponse.",
+			Version: "1.0.0",
+		},
+		Paths: make(map[string]map[string]*apiOp),
+		Components: openAPIComponents{
+			Schemas: componentSchemas(),
+			SecuritySchemes: map[string]map[string]string{
+				bearerAuth: {"type": "http", "scheme": "bearer"},
+			},
+		},
+	}
+
+	for _, e := range endpoints() {
+		op := e.openAPIOperation()
+		doc.addOperation(e.method, e.path, op)
+		for _, path := range e.legacy {
+			legacy := *op
+			legacy.OperationID += "Legacy"
+			legacy.Deprecated = true
+			doc.addOperation(e.method, path, &legacy)
+		}
+	}
+	return doc
+}
+
+func (d *openAPIDocument) addOperation(method, path string, op *apiOp) {
+	path = openAPIPath(path)
+	if d.Paths[path] == nil {
+		d.Paths[path] = make(map[string]*apiOp)
+	}
+	d.Paths[path][strings.ToLower(method)] = op
+}
+
+func (e endpoint) openAPIOperation() *apiOp {
+	op := &apiOp{
+		OperationID: e.doc.id,
+		Summary:     e.doc.summary,
+		Responses:   make(map[string]apiResponse),
+	}
+
+	for _, segment := range strings.Split(e.path, "/") {
+		name, ok := strings.CutPrefix(segment, ":")
+		if !ok {
+			continue
+		}
+		p := parameter{Name: name, In: "path", Required: true, Schema: &schema{Type: "string"}}
+		if known, ok := pathParams[name]; ok {
+			p.Description, p.Schema = known.Description, known.Schema
+		}
+		op.Parameters = append(op.Parameters, p)
+	}
+	op.Parameters = append(op.Parameters, e.doc.query...)
+
+	if b := e.doc.body; b != nil {
+		op.RequestBody = &apiRequestBody{Required: true, Content: make(map[string]mediaType)}
+		for _, ct := range b.types {
+			s := b.schema
+			if ct == payload.ContentTypeProtobuf {
+				s = &schema{Type: "string", Format: "binary", Description: "MetricsBatch в формате Protocol Buffers"}
+			}
+			op.RequestBody.Content[ct] = mediaType{Schema: s}
+		}
+	}
+
+	responses := make(map[int]response, len(e.doc.responses)+2)
+	for status, r := range e.doc.responses {
+		responses[status] = r
+	}
+	if e.scope != "" {
+		op.Description = "Требуется токен API с областью доступа " + e.scope + ", если токены настроены."
+		op.Security = []map[string][]string{{bearerAuth: {}}}
+		responses[http.StatusUnauthorized] = errorResponse("Токен не передан или неизвестен")
+		responses[http.StatusForbidden] = errorResponse("Недостаточно прав")
+	}
+	for status, r := range responses {
+		resp := apiResponse{Description: r.description}
+		if len(r.content) > 0 {
+			resp.Content = make(map[string]mediaType, len(r.content))
+			for ct, s := range r.content {
+				resp.Content[ct] = mediaType{Schema: s}
+			}
+		}
+		op.Responses[strconv.Itoa(status)] = resp
+	}
+	return op
+}
+
+// openAPIPath заменяет параметры пути gin (:name) на параметры OpenAPI ({name}).
+func openAPIPath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if name, ok := strings.CutPrefix(segment, ":"); ok {
+			segments[i] = "{" + name + "}"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// componentSchemas строит схемы компонентов по тегам json типов Go.
+func componentSchemas() map[string]*schema {
+	names := make(map[reflect.Type]string, len(componentTypes))
+	for name, t := range componentTypes {
+		names[t] = name
+	}
+
+	schemas := make(map[string]*schema, len(componentTypes)+1)
+	for name, t := range componentTypes {
+		schemas[name] = structSchema(t, names)
+	}
+	schemas["Metrics"].Properties["type"].Enum = []string{m.TypeGauge, m.TypeCounter}
+	schemas["MetricsBatch"] = &schema{Type: "array", Items: schemaRef("Metrics")}
+	return schemas
+}
+
+func structSchema(t reflect.Type, names map[reflect.Type]string) *schema {
+	s := &schema{Type: "object", Properties: make(map[string]*schema)}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if !f.IsExported() || tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if name == "" {
+			name = f.Name
+		}
+		s.Properties[name] = typeSchema(f.Type, names)
+		if opts != "omitempty" && f.Type.Kind() != reflect.Ptr {
+			s.Required = append(s.Required, name)
+		}
+	}
+	return s
+}
+
+func typeSchema(t reflect.Type, names map[reflect.Type]string) *schema {
+	if name, ok := names[t]; ok {
+		return schemaRef(name)
+	}
+	if t == reflect.TypeOf(time.Time{}) {
+		return &schema{Type: "string", Format: "date-time"}
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		return typeSchema(t.Elem(), names)
+	case reflect.Map:
+		return &schema{Type: "object", AdditionalProperties: typeSchema(t.Elem(), names)}
+	case reflect.Slice, reflect.Array:
+		return &schema{Type: "array", Items: typeSchema(t.Elem(), names)}
+	case reflect.Struct:
+		return structSchema(t, names)
+	case reflect.String:
+		return &schema{Type: "string"}
+	case reflect.Bool:
+		return &schema{Type: "boolean"}
+	case reflect.Int64, reflect.Uint64:
+		return &schema{Type: "integer", Format: "int64"}
+	case reflect.Int, reflect.Int32, reflect.Int16, reflect.Int8, reflect.Uint, reflect.Uint32, reflect.Uint16, reflect.Uint8:
+		return &schema{Type: "integer"}
+	case reflect.Float64:
+		return &schema{Type: "number", Format: "double"}
+	case reflect.Float32:
+		return &schema{Type: "number", Format: "float"}
+	default:
+		return &schema{}
+	}
+}
+
+func schemaRef(name string) *schema {
+	return &schema{Ref: "#/components/schemas/" + name}
+}
+
+func oneOf(names ...string) *schema {
+	s := &schema{}
+	for _, name := range names {
+		s.OneOf = append(s.OneOf, schemaRef(name))
+	}
+	return s
+}
+
+func jsonResponse(description string, s *schema) response {
+	return response{description: description, content: map[string]*schema{payload.ContentTypeJSON: s}}
+}
+
+func textResponse(description, contentType string) response {
+	return response{description: description, content: map[string]*schema{contentType: {Type: "string"}}}
+}
+
+func errorResponse(description string) response {
+	return jsonResponse(description, schemaRef("ErrorResponse"))
+}
+
+func formatParam(description string, values ...string) parameter {
+	return parameter{
+		Name:        "format",
+		In:          "query",
+		Description: description,
+		Schema:      &schema{Type: "string", Enum: values},
+	}
+}
@@ -0,0 +1,103 @@
+package routing
+
+import (
+	"encoding/json"
+	"flag"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	sf "github.com/sanek1/metrics-collector/internal/flags/server"
+	ss "github.com/sanek1/metrics-collector/internal/storage/server"
+	"github.com/sanek1/metrics-collector/pkg/logging"
+)
+
+// openAPIFile - опубликованная копия документа OpenAPI
+const openAPIFile = "../../docs/openapi.json"
+
+var updateOpenAPI = flag.Bool("update", false, "rewrite docs/openapi.json from the route table")
+
+func TestOpenAPI_DescribesRegisteredRoutes(t *testing.T) {
+	l, _ := logging.NewZapLogger(zap.InfoLevel)
+	handler := NewRouting(ss.NewMetricsStorage(l), &sf.ServerOptions{}, l).InitRouting()
+	routes := handler.(*gin.Engine).Routes()
+	doc := buildOpenAPI()
+
+	registered := make(map[string]bool, len(routes))
+	for _, route := range routes {
+		path := openAPIPath(route.Path)
+		key := route.Method + " " + path
+		registered[key] = true
+		assert.Contains(t, doc.Paths[path], strings.ToLower(route.Method), "route %s is not documented", key)
+	}
+
+	documented := 0
+	for path, item := range doc.Paths {
+		for method, op := range item {
+			documented++
+			key := strings.ToUpper(method) + " " + path
+			assert.True(t, registered[key], "documented operation %s is not registered", key)
+			assert.Equal(t, op.Deprecated, strings.HasSuffix(op.OperationID, "Legacy"), key)
+			for status, resp := range op.Responses {
+				if status >= "400" {
+					assert.Contains(t, resp.Content, "application/json", "%s %s", key, status)
+				}
+			}
+		}
+	}
+	assert.Equal(t, len(routes), documented)
+	assert.True(t, doc.Paths["/updates/"]["post"].Deprecated)
+	assert.False(t, doc.Paths[apiPrefix+"/updates"]["post"].Deprecated)
+}
+
+func TestOpenAPI_Schemas(t *testing.T) {
+	schemas := buildOpenAPI().Components.Schemas
+
+	errorSchema := schemas["ErrorResponse"]
+	require.NotNil(t, errorSchema)
+	assert.ElementsMatch(t, []string{"code", "message"}, errorSchema.Required)
+	assert.Contains(t, errorSchema.Properties, "details")
+
+	metrics := schemas["Metrics"]
+	require.NotNil(t, metrics)
+	assert.Equal(t, "integer", metrics.Properties["delta"].Type)
+	assert.Equal(t, "double", metrics.Properties["value"].Format)
+	assert.Equal(t, []string{"gauge", "counter"}, metrics.Properties["type"].Enum)
+
+	assert.Equal(t, "#/components/schemas/ImportError", schemas["ImportSummary"].Properties["errors"].Items.Ref)
+}
+
+func TestOpenAPI_Handler(t *testing.T) {
+	l, _ := logging.NewZapLogger(zap.InfoLevel)
+	handler := NewRouting(ss.NewMetricsStorage(l), &sf.ServerOptions{}, l).InitRouting()
+
+	resp := httptest.NewRecorder()
+	handler.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/api/v1/openapi.json", nil))
+
+	require.Equal(t, http.StatusOK, resp.Code)
+	var doc map[string]interface{}
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &doc))
+	assert.Equal(t, "3.0.3", doc["openapi"])
+}
+
+// TestOpenAPI_File проверяет, что docs/openapi.json соответствует таблице маршрутов.
+// Обновление файла: go test ./internal/routing -run TestOpenAPI_File -update
+func TestOpenAPI_File(t *testing.T) {
+	doc, err := openAPIJSON()
+	require.NoError(t, err)
+	doc = append(doc, '\n')
+
+	if *updateOpenAPI {
+		require.NoError(t, os.WriteFile(openAPIFile, doc, 0o644))
+	}
+	published, err := os.ReadFile(openAPIFile)
+	require.NoError(t, err)
+	assert.JSONEq(t, string(doc), string(published), "docs/openapi.json is stale, run the test with -update")
+}
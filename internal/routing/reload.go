@@ -0,0 +1,24 @@
+package routing
+
+import (
+	"github.com/sanek1/metrics-collector/internal/crypto"
+	sf "github.com/sanek1/metrics-collector/internal/flags/server"
+)
+
+// Reload применяет настройки, которые меняются без перезапуска сервера:
+// ключ подписи, приватные ключи для расшифровки и ограничения размера тела.
+// Если приватные ключи не удалось загрузить, остальные настройки применяются,
+// расшифровка продолжает работать с прежними ключами, а ошибка возвращается.
+func (r *Router) Reload(opt *sf.ServerOptions) error {
+	r.middlewareHash.SetKey(opt.CryptoKey)
+
+	maxBody, maxDecompressed := opt.BodyLimits()
+	r.maxBody.Store(maxBody)
+	r.handlerServices.SetMaxDecompressedSize(maxDecompressed)
+
+	var keys *crypto.KeyRing
+	if opt.CryptoKey != "" {
+		keys = crypto.NewKeyRing(opt.CryptoKey, []byte(opt.CryptoKeyPassphrase))
+	}
+	return r.handlerServices.SetKeys(keys)
+}
@@ -0,0 +1,56 @@
+package routing
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	sf "github.com/sanek1/metrics-collector/internal/flags/server"
+	ss "github.com/sanek1/metrics-collector/internal/storage/server"
+	v "github.com/sanek1/metrics-collector/internal/validation"
+	"github.com/sanek1/metrics-collector/pkg/logging"
+)
+
+func TestRouter_Reload(t *testing.T) {
+	l, _ := logging.NewZapLogger(zap.InfoLevel)
+	router := NewRouting(ss.NewMetricsStorage(l), &sf.ServerOptions{MaxBodySize: 1024}, l)
+	handler := router.InitRouting()
+
+	post := func(body []byte) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/update", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, req)
+		return resp
+	}
+	signature := func(key string, body []byte) string {
+		sum := sha256.Sum256(append(append([]byte{}, body...), key...))
+		return hex.EncodeToString(sum[:])
+	}
+
+	// метрика, дополненная пробелами до размера больше исходного ограничения
+	body := []byte(`{"id":"load","type":"gauge","value":1.5}`)
+	body = append(body, bytes.Repeat([]byte(" "), 2048-len(body))...)
+	resp := post(body)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, resp.Code)
+	assert.Empty(t, resp.Header().Get(v.HashHeader), "no key - no signature")
+
+	require.Error(t, router.Reload(&sf.ServerOptions{MaxBodySize: 4096, CryptoKey: "new-key"}),
+		"hash key is not a private key file")
+
+	resp = post(body)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, signature("new-key", body), resp.Header().Get(v.HashHeader))
+
+	require.NoError(t, router.Reload(&sf.ServerOptions{MaxBodySize: 4096}))
+	resp = post(body)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Empty(t, resp.Header().Get(v.HashHeader))
+}
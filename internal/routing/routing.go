@@ -5,24 +5,41 @@ import (
 	"fmt"
 	"net/http"
 	"strconv"
+	"sync/atomic"
 
 	"github.com/gin-gonic/gin"
+	"github.com/sanek1/metrics-collector/internal/crypto"
 	sf "github.com/sanek1/metrics-collector/internal/flags/server"
 	h "github.com/sanek1/metrics-collector/internal/handlers"
+	"github.com/sanek1/metrics-collector/internal/health"
+	"github.com/sanek1/metrics-collector/internal/selfmetrics"
 	ss "github.com/sanek1/metrics-collector/internal/storage/server"
+	"github.com/sanek1/metrics-collector/internal/tracing"
 	v "github.com/sanek1/metrics-collector/internal/validation"
 	l "github.com/sanek1/metrics-collector/pkg/logging"
 )
 
+// importRoute - потоковый импорт метрик, тело которого не ограничивается
+// по размеру и не буферизуется целиком
+const importRoute = "/api/v1/import"
+
 type Router struct {
 	router           *gin.Engine
 	l                *l.ZapLogger
 	middleware       *v.MiddlewareController
 	middlewareHash   *v.Secret
 	middlewareParser *v.Parser
+	auth             *v.Auth
 	storage          ss.Storage
 	s                *h.Storage
 	opt              *sf.ServerOptions
+	health           *health.Registry
+	metrics          *selfmetrics.Collector
+	handlerServices  *h.Services
+	// ingestion - количество запросов на запись метрик в обработке
+	ingestion atomic.Int64
+	// maxBody - ограничение размера тела запроса, меняется в Reload
+	maxBody atomic.Int64
 }
 type Routing interface {
 	InitRouting() http.Handler
@@ -31,66 +48,69 @@ type Routing interface {
 func NewRouting(s ss.Storage, opt *sf.ServerOptions, logger *l.ZapLogger) *Router {
 	c := &Router{
 		l:       logger,
-		router:  gin.Default(),
+		router:  gin.New(),
 		storage: s,
 		opt:     opt,
+		metrics: selfmetrics.New(logger),
 	}
+	s = c.metrics.Instrument(s)
 
-	handlerServices := h.NewHandlerServices(s, &opt.CryptoKey, opt.CryptoKey, logger)
+	var keys *crypto.KeyRing
+	if opt.CryptoKey != "" {
+		keys = crypto.NewKeyRing(opt.CryptoKey, []byte(opt.CryptoKeyPassphrase))
+	}
+	handlerServices := h.NewHandlerServicesWithKeys(s, &opt.CryptoKey, keys, logger)
+	maxBody, maxDecompressed := opt.BodyLimits()
+	c.maxBody.Store(maxBody)
+	handlerServices.SetMaxDecompressedSize(maxDecompressed)
+	c.handlerServices = handlerServices
 	c.s = h.NewStorage(s, logger)
 	c.s.SetHandlerServices(handlerServices)
 	c.middleware = v.NewValidation(c.s, logger)
 	c.middlewareHash = v.NewHash(opt.CryptoKey)
+	c.middlewareHash.SetCollector(c.metrics)
 	c.middlewareParser = v.NewParser(handlerServices)
+	c.middlewareParser.SetCollector(c.metrics)
+	c.auth = v.NewAuth(opt.APITokens, logger)
+	c.health = health.NewRegistry()
+	c.health.Register("ingestion", c.checkIngestion)
+	c.metrics.AddSampler(c.sampleIngestion)
 	return c
 }
 
 func (r *Router) InitRouting() http.Handler {
-	if r.opt.CryptoKey != "" {
-		r.router.Use(r.middlewareHash.HashMiddleware())
-	}
-	r.router.GET("/debug/")
-
-	r.router.Use(v.GzipMiddleware())
-	r.router.Use(func(c *gin.Context) {
-		if c.Request.Method == "POST" && c.FullPath() == "/update/:metricType/:metricName/:metricValue" {
-			metricType := c.Param("metricType")
-			metricValue := c.Param("metricValue")
-
-			if metricType != "counter" && metricType != "gauge" {
-				c.AbortWithStatus(http.StatusBadRequest)
-				return
-			}
-			if metricType == "counter" {
-				if _, err := parseCounterValue(metricValue); err != nil {
-					c.AbortWithStatus(http.StatusBadRequest)
-					return
-				}
-			}
-			if metricType == "gauge" {
-				if _, err := parseGaugeValue(metricValue); err != nil {
-					c.AbortWithStatus(http.StatusBadRequest)
-					return
-				}
-			}
-		}
+	r.router.Use(v.RequestID(r.l))
+	r.router.Use(v.AccessLog(r.l))
+	r.router.Use(v.Recovery(r.l))
+	r.router.Use(tracing.Middleware(r.l))
+	r.router.Use(r.metrics.Middleware())
 
-		c.Next()
-	})
+	r.router.Use(v.SkipRoutes(v.BodyLimit(&r.maxBody), importRoute))
+	// подпись проверяется, только если задан ключ: его можно задать в Reload.
+	// Импорт проверяет подпись без буферизации тела в памяти (HashStreamMiddleware)
+	r.router.Use(v.SkipRoutes(r.middlewareHash.HashMiddleware(), importRoute))
+	r.router.Use(v.TenantMiddleware(r.tenantTokens()))
 
-	r.router.POST("/update/:metricType/:metricName/:metricValue", r.middlewareParser.HandleMetrics(), r.s.MetricHandler)
-	r.router.POST("/updates/", r.middlewareParser.HandleMetrics(), r.s.MetricHandler)
-	r.router.POST("/update/", r.middlewareParser.HandleMetrics(), r.s.MetricHandler)
-	r.router.POST("/value/", r.s.GetMetricsByValueHandler)
-	r.router.POST("/", gin.WrapF(h.NotImplementedHandler))
-	r.router.GET("/", r.s.MainPageHandler)
-	r.router.GET("/ping", r.s.PingDBHandler)
-	r.router.GET("/:metricValue/:metricType/:metricName", r.s.GetMetricsByNameHandler)
+	r.router.Use(v.CompressionMiddleware())
+	r.registerEndpoints()
 
 	r.router.NoRoute(gin.WrapF(h.NotImplementedHandler))
 	return r.router
 }
 
+// tenantTokens объединяет соответствие токенов арендаторам из конфигурации
+// с арендаторами, к которым привязаны токены API.
+func (r *Router) tenantTokens() map[string]string {
+	tokens := make(map[string]string, len(r.opt.TenantTokens))
+	for token, t := range r.opt.TenantTokens {
+		tokens[token] = t
+	}
+	for token, t := range r.auth.TenantTokens() {
+		tokens[token] = t
+	}
+	return tokens
+}
+
 func parseCounterValue(value string) (int64, error) {
 	intValue, err := strconv.ParseInt(value, 10, 64)
 	if err != nil {
@@ -2,20 +2,37 @@ package routing
 
 import (
 	"bytes"
+	"compress/gzip"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
 	"go.uber.org/zap"
 
+	"github.com/sanek1/metrics-collector/internal/apierror"
+	"github.com/sanek1/metrics-collector/internal/compression"
 	sf "github.com/sanek1/metrics-collector/internal/flags/server"
+	h "github.com/sanek1/metrics-collector/internal/handlers"
+	"github.com/sanek1/metrics-collector/internal/health"
+	"github.com/sanek1/metrics-collector/internal/limits"
 	m "github.com/sanek1/metrics-collector/internal/models"
+	"github.com/sanek1/metrics-collector/internal/payload"
+	"github.com/sanek1/metrics-collector/internal/requestid"
+	"github.com/sanek1/metrics-collector/internal/selfmetrics"
+	ss "github.com/sanek1/metrics-collector/internal/storage/server"
 	"github.com/sanek1/metrics-collector/internal/storage/server/mocks"
+	v "github.com/sanek1/metrics-collector/internal/validation"
 	"github.com/sanek1/metrics-collector/pkg/logging"
 )
 
@@ -70,7 +87,7 @@ func TestRouterWithMocks_InitRouting(t *testing.T) {
 	}
 	mockStorage.On("SetCounter", mock.Anything, mock.Anything).Return([]*m.Metrics{mockCounterMetric}, nil).Maybe()
 	mockStorage.On("GetMetrics", mock.Anything, "counter", "TestCounter").Return(mockCounterMetric, true).Maybe()
-	mockStorage.On("GetAllMetrics").Return([]string{"gauge:TestGauge=123.45", "counter:TestCounter=42"}).Maybe()
+	mockStorage.On("GetAllMetrics", mock.Anything).Return([]string{"gauge:TestGauge=123.45", "counter:TestCounter=42"}).Maybe()
 	mockStorage.On("Ping", mock.Anything).Return(nil).Maybe()
 
 	l, _ := logging.NewZapLogger(zap.InfoLevel)
@@ -172,3 +189,506 @@ func TestRouterWithMocks_InitRouting(t *testing.T) {
 		})
 	}
 }
+
+func TestRouter_APITokens(t *testing.T) {
+	mockStorage := new(mocks.Storage)
+	gaugeValue := float64(1.5)
+	mockGaugeMetric := &m.Metrics{ID: "TestGauge", MType: "gauge", Value: &gaugeValue}
+	mockStorage.On("SetGauge", mock.Anything, mock.Anything).Return([]*m.Metrics{mockGaugeMetric}, nil).Maybe()
+	mockStorage.On("GetAllMetrics", mock.Anything).Return([]string{"TestGauge: 1.5"}).Maybe()
+	mockStorage.On("ListMetrics", mock.Anything, mock.Anything).Return(nil).Maybe()
+
+	opts := &sf.ServerOptions{
+		APITokens: []sf.APIToken{
+			{Token: "writer", Scopes: []string{"write"}},
+			{Token: "reader", Scopes: []string{"read"}},
+			{Token: "admin", Scopes: []string{"admin"}},
+		},
+	}
+	l, _ := logging.NewZapLogger(zap.InfoLevel)
+	handler := NewRouting(mockStorage, opts, l).InitRouting()
+
+	tests := []struct {
+		name           string
+		method         string
+		path           string
+		token          string
+		expectedStatus int
+	}{
+		{name: "update without token", method: http.MethodPost, path: "/update/gauge/TestGauge/1.5", expectedStatus: http.StatusUnauthorized},
+		{name: "update with reader", method: http.MethodPost, path: "/update/gauge/TestGauge/1.5", token: "reader", expectedStatus: http.StatusForbidden},
+		{name: "update with writer", method: http.MethodPost, path: "/update/gauge/TestGauge/1.5", token: "writer", expectedStatus: http.StatusOK},
+		{name: "list with writer", method: http.MethodGet, path: "/", token: "writer", expectedStatus: http.StatusForbidden},
+		{name: "list with reader", method: http.MethodGet, path: "/", token: "reader", expectedStatus: http.StatusOK},
+		{name: "ping without token", method: http.MethodGet, path: "/ping", expectedStatus: http.StatusOK},
+		{name: "import with writer", method: http.MethodPost, path: "/api/v1/import", token: "writer", expectedStatus: http.StatusForbidden},
+		{name: "import with admin", method: http.MethodPost, path: "/api/v1/import", token: "admin", expectedStatus: http.StatusOK},
+		{name: "export with reader", method: http.MethodGet, path: "/api/v1/export", token: "reader", expectedStatus: http.StatusForbidden},
+		{name: "export with writer", method: http.MethodGet, path: "/api/v1/export", token: "writer", expectedStatus: http.StatusForbidden},
+		{name: "export with admin", method: http.MethodGet, path: "/api/v1/export", token: "admin", expectedStatus: http.StatusOK},
+		{name: "self metrics with writer", method: http.MethodGet, path: "/api/v1/self/metrics", token: "writer", expectedStatus: http.StatusForbidden},
+		{name: "self metrics with admin", method: http.MethodGet, path: "/api/v1/self/metrics", token: "admin", expectedStatus: http.StatusOK},
+		{name: "update with admin", method: http.MethodPost, path: "/update/gauge/TestGauge/1.5", token: "admin", expectedStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			resp := httptest.NewRecorder()
+			handler.ServeHTTP(resp, req)
+			assert.Equal(t, tt.expectedStatus, resp.Code)
+		})
+	}
+}
+
+func TestRouter_BodyLimits(t *testing.T) {
+	mockStorage := new(mocks.Storage)
+	gaugeValue := float64(1.5)
+	mockGaugeMetric := &m.Metrics{ID: "TestGauge", MType: "gauge", Value: &gaugeValue}
+	mockStorage.On("SetGauge", mock.Anything, mock.Anything).Return([]*m.Metrics{mockGaugeMetric}, nil).Maybe()
+
+	opts := &sf.ServerOptions{MaxBodySize: 1024, MaxDecompressedSize: 4096}
+	l, _ := logging.NewZapLogger(zap.InfoLevel)
+	handler := NewRouting(mockStorage, opts, l).InitRouting()
+
+	gzipped := func(data []byte) []byte {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		_, err := zw.Write(data)
+		require.NoError(t, err)
+		require.NoError(t, zw.Close())
+		return buf.Bytes()
+	}
+	metric, err := json.Marshal([]m.Metrics{*mockGaugeMetric})
+	require.NoError(t, err)
+
+	t.Run("within limits", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/updates/", bytes.NewReader(gzipped(metric)))
+		req.Header.Set("Content-Encoding", "gzip")
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, req)
+		assert.Equal(t, http.StatusOK, resp.Code)
+	})
+
+	t.Run("raw body too large", func(t *testing.T) {
+		before := limits.Rejections(limits.ReasonBody)
+		req := httptest.NewRequest(http.MethodPost, "/updates/", bytes.NewReader(make([]byte, 2048)))
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, req)
+		assert.Equal(t, http.StatusRequestEntityTooLarge, resp.Code)
+		assert.Equal(t, before+1, limits.Rejections(limits.ReasonBody))
+	})
+
+	t.Run("raw body too large without content length", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/update/", io.NopCloser(bytes.NewReader(make([]byte, 2048))))
+		req.ContentLength = -1
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, req)
+		assert.Equal(t, http.StatusRequestEntityTooLarge, resp.Code)
+	})
+
+	t.Run("decompression bomb", func(t *testing.T) {
+		before := limits.Rejections(limits.ReasonDecompressed)
+		bomb := gzipped(bytes.Repeat([]byte(" "), 1<<18))
+		require.Less(t, len(bomb), 1024)
+
+		req := httptest.NewRequest(http.MethodPost, "/updates/", bytes.NewReader(bomb))
+		req.Header.Set("Content-Encoding", "gzip")
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, req)
+		assert.Equal(t, http.StatusRequestEntityTooLarge, resp.Code)
+		assert.Equal(t, before+1, limits.Rejections(limits.ReasonDecompressed))
+	})
+}
+
+func TestRouter_Encodings(t *testing.T) {
+	mockStorage := new(mocks.Storage)
+	gaugeValue := float64(1.5)
+	mockGaugeMetric := &m.Metrics{ID: "TestGauge", MType: "gauge", Value: &gaugeValue}
+	mockStorage.On("SetGauge", mock.Anything, mock.Anything).Return([]*m.Metrics{mockGaugeMetric}, nil).Maybe()
+
+	l, _ := logging.NewZapLogger(zap.InfoLevel)
+	handler := NewRouting(mockStorage, &sf.ServerOptions{}, l).InitRouting()
+
+	metric, err := json.Marshal([]m.Metrics{*mockGaugeMetric})
+	require.NoError(t, err)
+
+	for _, encoding := range compression.Supported() {
+		t.Run(encoding, func(t *testing.T) {
+			body, err := compression.Compress(encoding, metric)
+			require.NoError(t, err)
+
+			req := httptest.NewRequest(http.MethodPost, "/updates/", bytes.NewReader(body))
+			req.Header.Set("Content-Encoding", encoding)
+			req.Header.Set("Accept-Encoding", encoding)
+			resp := httptest.NewRecorder()
+			handler.ServeHTTP(resp, req)
+
+			require.Equal(t, http.StatusOK, resp.Code)
+			assert.Equal(t, compression.AcceptEncoding(), resp.Header().Get("Accept-Encoding"))
+			assert.Equal(t, encoding, resp.Header().Get("Content-Encoding"))
+
+			r, err := compression.NewReader(encoding, resp.Body)
+			require.NoError(t, err)
+			_, err = io.ReadAll(r)
+			require.NoError(t, err)
+		})
+	}
+
+	t.Run("unsupported", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/updates/", bytes.NewReader(metric))
+		req.Header.Set("Content-Encoding", "br")
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, req)
+		assert.Equal(t, http.StatusUnsupportedMediaType, resp.Code)
+	})
+}
+
+func TestRouter_PayloadFormats(t *testing.T) {
+	gaugeValue := float64(1.5)
+	delta := int64(3)
+	batch := []m.Metrics{
+		{ID: "TestGauge", MType: m.TypeGauge, Value: &gaugeValue},
+		{ID: "TestCounter", MType: m.TypeCounter, Delta: &delta},
+	}
+
+	l, _ := logging.NewZapLogger(zap.InfoLevel)
+	for _, contentType := range []string{payload.ContentTypeProtobuf, payload.ContentTypeMsgpack} {
+		t.Run(contentType, func(t *testing.T) {
+			mockStorage := new(mocks.Storage)
+			mockStorage.On("SetGauge", mock.Anything, batch[0], batch[1]).Return([]*m.Metrics{&batch[0], &batch[1]}, nil).Once()
+			handler := NewRouting(mockStorage, &sf.ServerOptions{}, l).InitRouting()
+
+			body, err := payload.Marshal(contentType, batch)
+			require.NoError(t, err)
+
+			req := httptest.NewRequest(http.MethodPost, "/updates/", bytes.NewReader(body))
+			req.Header.Set("Content-Type", contentType)
+			resp := httptest.NewRecorder()
+			handler.ServeHTTP(resp, req)
+
+			assert.Equal(t, http.StatusOK, resp.Code)
+			mockStorage.AssertExpectations(t)
+		})
+	}
+}
+
+func TestRouter_Import(t *testing.T) {
+	const lines = 50
+	var body bytes.Buffer
+	for i := 0; i < lines; i++ {
+		fmt.Fprintf(&body, `{"id":"Gauge%d","type":"gauge","value":%d}`+"\n", i, i)
+	}
+	data := body.Bytes()
+	hash := sha256.Sum256(append(append([]byte{}, data...), "secret"...))
+	signature := hex.EncodeToString(hash[:])
+
+	args := []interface{}{mock.Anything}
+	for i := 0; i < lines; i++ {
+		args = append(args, mock.Anything)
+	}
+	mockStorage := new(mocks.Storage)
+	mockStorage.On("SetGauge", args...).Return(nil, nil).Once()
+
+	opts := &sf.ServerOptions{MaxBodySize: 1024, CryptoKey: "secret"}
+	l, _ := logging.NewZapLogger(zap.InfoLevel)
+	handler := NewRouting(mockStorage, opts, l).InitRouting()
+	post := func(hash string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/import", bytes.NewReader(data))
+		req.Header.Set("Content-Type", "application/x-ndjson")
+		req.Header.Set("HashSHA256", hash)
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, req)
+		return resp
+	}
+
+	// подпись проверяется, как на остальных маршрутах записи, до применения метрик
+	resp := post("bad")
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+	assert.Contains(t, resp.Body.String(), apierror.CodeInvalidHash)
+	mockStorage.AssertNotCalled(t, "SetGauge", args...)
+
+	// тело больше MaxBodySize: импорт не ограничивается по размеру
+	require.Greater(t, len(data), 1024)
+	resp = post(signature)
+	require.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, signature, resp.Header().Get("HashSHA256"))
+	var summary h.ImportSummary
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &summary))
+	assert.Equal(t, lines, summary.Imported)
+	mockStorage.AssertExpectations(t)
+}
+
+func TestRouter_ImportSlowBody(t *testing.T) {
+	const lines = 8
+	l, _ := logging.NewZapLogger(zap.InfoLevel)
+	storage := ss.NewMetricsStorage(l)
+	server := httptest.NewUnstartedServer(NewRouting(storage, &sf.ServerOptions{CryptoKey: "secret"}, l).InitRouting())
+	server.Config.ReadTimeout = 100 * time.Millisecond
+	server.Config.WriteTimeout = 100 * time.Millisecond
+	server.Start()
+	defer server.Close()
+
+	// тело передается дольше ReadTimeout и WriteTimeout сервера
+	body, w := io.Pipe()
+	go func() {
+		for i := 0; i < lines; i++ {
+			time.Sleep(40 * time.Millisecond)
+			fmt.Fprintf(w, `{"id":"Gauge%d","type":"gauge","value":%d}`+"\n", i, i)
+		}
+		_ = w.Close()
+	}()
+	resp, err := server.Client().Post(server.URL+"/api/v1/import", payload.ContentTypeNDJSON, body)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var summary h.ImportSummary
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&summary))
+	assert.Equal(t, lines, summary.Imported)
+}
+
+func TestRouter_ExportImportCSV(t *testing.T) {
+	l, _ := logging.NewZapLogger(zap.InfoLevel)
+	ctx := context.Background()
+
+	source := ss.NewMetricsStorage(l)
+	value := 0.1 + 0.2
+	delta := int64(42)
+	_, err := source.SetGauge(ctx, m.Metrics{ID: "Alloc", MType: m.TypeGauge, Value: &value})
+	require.NoError(t, err)
+	_, err = source.SetCounter(ctx, m.Metrics{ID: "PollCount", MType: m.TypeCounter, Delta: &delta})
+	require.NoError(t, err)
+	sourceHandler := NewRouting(source, &sf.ServerOptions{}, l).InitRouting()
+
+	t.Run("json", func(t *testing.T) {
+		resp := httptest.NewRecorder()
+		sourceHandler.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/api/v1/export", nil))
+		require.Equal(t, http.StatusOK, resp.Code)
+
+		var exported []m.Metrics
+		require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &exported))
+		require.Len(t, exported, 2)
+		assert.Equal(t, "PollCount", exported[0].ID)
+		assert.Equal(t, value, *exported[1].Value)
+	})
+
+	t.Run("unsupported format", func(t *testing.T) {
+		resp := httptest.NewRecorder()
+		sourceHandler.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/api/v1/export?format=xml", nil))
+		assert.Equal(t, http.StatusBadRequest, resp.Code)
+	})
+
+	t.Run("csv round trip", func(t *testing.T) {
+		resp := httptest.NewRecorder()
+		sourceHandler.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/api/v1/export?format=csv", nil))
+		require.Equal(t, http.StatusOK, resp.Code)
+		assert.Contains(t, resp.Header().Get("Content-Type"), payload.ContentTypeCSV)
+
+		target := ss.NewMetricsStorage(l)
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/import", bytes.NewReader(resp.Body.Bytes()))
+		req.Header.Set("Content-Type", payload.ContentTypeCSV)
+		importResp := httptest.NewRecorder()
+		NewRouting(target, &sf.ServerOptions{}, l).InitRouting().ServeHTTP(importResp, req)
+		require.Equal(t, http.StatusOK, importResp.Code, importResp.Body.String())
+
+		var summary h.ImportSummary
+		require.NoError(t, json.Unmarshal(importResp.Body.Bytes(), &summary))
+		assert.Equal(t, 2, summary.Imported)
+
+		list := func(s ss.Storage) []m.Metrics {
+			var metrics []m.Metrics
+			require.NoError(t, s.ListMetrics(ctx, func(metric m.Metrics) error {
+				metrics = append(metrics, metric)
+				return nil
+			}))
+			return metrics
+		}
+		assert.Equal(t, list(source), list(target))
+	})
+}
+
+func TestRouter_APIv1(t *testing.T) {
+	l, _ := logging.NewZapLogger(zap.InfoLevel)
+	handler := NewRouting(ss.NewMetricsStorage(l), &sf.ServerOptions{}, l).InitRouting()
+
+	serve := func(method, path string, body []byte) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, bytes.NewReader(body))
+		if body != nil {
+			req.Header.Set("Content-Type", payload.ContentTypeJSON)
+		}
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, req)
+		return resp
+	}
+	errorBody := func(t *testing.T, resp *httptest.ResponseRecorder) m.ErrorResponse {
+		var body m.ErrorResponse
+		require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &body), resp.Body.String())
+		return body
+	}
+
+	t.Run("v1 and legacy paths share storage", func(t *testing.T) {
+		require.Equal(t, http.StatusOK, serve(http.MethodPost, "/api/v1/update/counter/hits/2", nil).Code)
+		require.Equal(t, http.StatusOK, serve(http.MethodPost, "/update/counter/hits/3", nil).Code)
+
+		for _, path := range []string{"/api/v1/value/counter/hits", "/value/counter/hits"} {
+			resp := serve(http.MethodGet, path, nil)
+			assert.Equal(t, http.StatusOK, resp.Code, path)
+			assert.Equal(t, "5", resp.Body.String(), path)
+		}
+
+		metric, _ := json.Marshal(m.Metrics{ID: "hits", MType: m.TypeCounter})
+		for _, path := range []string{"/api/v1/value", "/value/"} {
+			resp := serve(http.MethodPost, path, metric)
+			require.Equal(t, http.StatusOK, resp.Code, path)
+			var got m.Metrics
+			require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &got))
+			assert.Equal(t, int64(5), *got.Delta)
+		}
+
+		batch, _ := json.Marshal([]m.Metrics{*m.NewMetricGauge("load", ptrFloat(0.5))})
+		assert.Equal(t, http.StatusOK, serve(http.MethodPost, "/api/v1/updates", batch).Code)
+		assert.Equal(t, http.StatusOK, serve(http.MethodGet, "/api/v1/ping", nil).Code)
+	})
+
+	t.Run("errors use the common schema", func(t *testing.T) {
+		resp := serve(http.MethodPost, "/api/v1/update/histogram/x/1", nil)
+		require.Equal(t, http.StatusBadRequest, resp.Code)
+		body := errorBody(t, resp)
+		assert.Equal(t, apierror.CodeInvalidMetric, body.Code)
+		assert.Equal(t, "histogram", body.Details)
+
+		resp = serve(http.MethodPost, "/update/counter/x/1.5", nil)
+		require.Equal(t, http.StatusBadRequest, resp.Code)
+		assert.Equal(t, apierror.CodeInvalidMetric, errorBody(t, resp).Code)
+
+		resp = serve(http.MethodGet, "/api/v1/value/gauge/missing", nil)
+		require.Equal(t, http.StatusNotFound, resp.Code)
+		assert.Equal(t, apierror.CodeNotFound, errorBody(t, resp).Code)
+
+		resp = serve(http.MethodGet, "/api/v2/metrics", nil)
+		require.Equal(t, http.StatusNotFound, resp.Code)
+		assert.Equal(t, apierror.CodeNotFound, errorBody(t, resp).Code)
+
+		resp = serve(http.MethodPost, "/api/v1/updates", []byte("{"))
+		require.Equal(t, http.StatusBadRequest, resp.Code)
+		body = errorBody(t, resp)
+		assert.Equal(t, apierror.CodeInvalidMetric, body.Code)
+		assert.NotEmpty(t, body.Message)
+		assert.NotEmpty(t, body.Details)
+	})
+}
+
+func ptrFloat(v float64) *float64 {
+	return &v
+}
+
+func TestRouter_Health(t *testing.T) {
+	l, _ := logging.NewZapLogger(zap.InfoLevel)
+	router := NewRouting(ss.NewMetricsStorage(l), &sf.ServerOptions{}, l)
+	handler := router.InitRouting()
+
+	probe := func(path string) (int, health.Report) {
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, path, nil))
+		var report health.Report
+		require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &report), resp.Body.String())
+		return resp.Code, report
+	}
+
+	code, report := probe("/healthz")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, health.StatusStarting, report.Status)
+
+	code, report = probe("/readyz")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, health.StatusStarting, report.Status)
+
+	router.Health().MarkReady()
+	code, report = probe("/readyz")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, health.StatusUp, report.Status)
+	assert.EqualValues(t, 0, report.Components["ingestion"].Details["queue_depth"])
+
+	router.Health().Register("database", health.Failed(errors.New("connection refused")))
+	code, report = probe("/readyz")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, health.StatusDown, report.Status)
+	assert.Equal(t, "connection refused", report.Components["database"].Error)
+
+	code, _ = probe("/healthz")
+	assert.Equal(t, http.StatusOK, code)
+}
+
+func TestRouter_SelfMetrics(t *testing.T) {
+	l, _ := logging.NewZapLogger(zap.InfoLevel)
+	storage := ss.NewMetricsStorage(l)
+	handler := NewRouting(storage, &sf.ServerOptions{CryptoKey: "secret"}, l).InitRouting()
+
+	serve := func(method, path string, body []byte, headers map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, bytes.NewReader(body))
+		req.Header.Set("Content-Type", payload.ContentTypeJSON)
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, req)
+		return resp
+	}
+
+	batch, _ := json.Marshal([]m.Metrics{
+		*m.NewMetricGauge("load", ptrFloat(0.5)),
+		*m.NewMetricGauge("temp", ptrFloat(36.6)),
+	})
+	require.Equal(t, http.StatusOK, serve(http.MethodPost, "/api/v1/updates", batch, nil).Code)
+	assert.Equal(t, http.StatusBadRequest, serve(http.MethodPost, "/api/v1/updates", []byte("{"), nil).Code)
+	assert.Equal(t, http.StatusBadRequest, serve(http.MethodPost, "/api/v1/updates", batch, map[string]string{v.HashHeader: "bad"}).Code)
+	assert.Equal(t, http.StatusBadRequest, serve(http.MethodPost, "/api/v1/updates", batch, map[string]string{"X-Encrypted": "true"}).Code)
+
+	reserved, _ := json.Marshal(m.NewMetricGauge(m.SelfMetricsPrefix+"fake", ptrFloat(1)))
+	assert.Equal(t, http.StatusBadRequest, serve(http.MethodPost, "/api/v1/update", reserved, nil).Code)
+
+	resp := serve(http.MethodGet, "/api/v1/self/metrics", nil, nil)
+	require.Equal(t, http.StatusOK, resp.Code)
+	var metrics []m.Metrics
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &metrics))
+	byName := make(map[string]m.Metrics, len(metrics))
+	for _, metric := range metrics {
+		byName[metric.ID] = metric
+	}
+
+	counter := func(name string, labels ...string) int64 {
+		metric, ok := byName[selfmetrics.Name(name, labels...)]
+		require.True(t, ok, selfmetrics.Name(name, labels...))
+		return *metric.Delta
+	}
+	assert.EqualValues(t, 4, counter("http.requests.count", "route", "POST /api/v1/updates"))
+	assert.EqualValues(t, 1, counter("http.responses", "route", "POST /api/v1/updates", "status", "2xx"))
+	assert.EqualValues(t, 2, counter("ingest.metrics", "type", m.TypeGauge))
+	assert.EqualValues(t, 1, counter("storage.count", "op", "SetGauge"))
+	assert.EqualValues(t, 1, counter("rejected", "reason", selfmetrics.ReasonHash))
+	assert.EqualValues(t, 1, counter("rejected", "reason", selfmetrics.ReasonDecrypt))
+	assert.EqualValues(t, 2, counter("rejected", "reason", selfmetrics.ReasonParse))
+	assert.Contains(t, byName, selfmetrics.Name("ingest.in_flight"))
+
+	_, ok := storage.GetMetrics(context.Background(), m.TypeCounter, selfmetrics.Name("http.requests.count", "route", "POST /api/v1/updates"))
+	assert.False(t, ok, "self metrics are kept out of the client storage")
+}
+
+func TestRouter_RequestID(t *testing.T) {
+	l, _ := logging.NewZapLogger(zap.InfoLevel)
+	handler := NewRouting(ss.NewMetricsStorage(l), &sf.ServerOptions{}, l).InitRouting()
+
+	req := httptest.NewRequest(http.MethodGet, "/healthz", nil)
+	req.Header.Set(requestid.Header, "agent-request-1")
+	resp := httptest.NewRecorder()
+	handler.ServeHTTP(resp, req)
+	assert.Equal(t, "agent-request-1", resp.Header().Get(requestid.Header))
+
+	resp = httptest.NewRecorder()
+	handler.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/unknown", nil))
+	assert.Len(t, resp.Header().Get(requestid.Header), 32)
+}
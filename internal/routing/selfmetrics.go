@@ -0,0 +1,30 @@
+package routing
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/sanek1/metrics-collector/internal/apierror"
+	"github.com/sanek1/metrics-collector/internal/selfmetrics"
+)
+
+// SelfMetrics возвращает сборщик собственных метрик сервера.
+func (r *Router) SelfMetrics() *selfmetrics.Collector {
+	return r.metrics
+}
+
+// sampleIngestion снимает количество запросов на запись, которые еще обрабатываются.
+func (r *Router) sampleIngestion(c *selfmetrics.Collector) {
+	c.Set(selfmetrics.Name("ingest.in_flight"), float64(r.ingestion.Load()))
+}
+
+// selfMetricsHandler отдает собственные метрики сервера в формате JSON.
+func (r *Router) selfMetricsHandler(c *gin.Context) {
+	metrics, err := r.metrics.Snapshot(c.Request.Context())
+	if err != nil {
+		apierror.Abort(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to collect self metrics", err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, metrics)
+}
@@ -0,0 +1,204 @@
+// Package selfmetrics собирает собственные метрики сервера: запросы и задержки
+// по маршрутам, скорость приема метрик, задержки хранилища, использование пула
+// соединений, длительность резервного копирования и отклоненные запросы.
+// Метрики хранятся в отдельном хранилище под зарезервированным префиксом
+// models.SelfMetricsPrefix и не смешиваются с метриками клиентов.
+package selfmetrics
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/sanek1/metrics-collector/internal/limits"
+	m "github.com/sanek1/metrics-collector/internal/models"
+	ss "github.com/sanek1/metrics-collector/internal/storage/server"
+	l "github.com/sanek1/metrics-collector/pkg/logging"
+)
+
+// Причины отклонения запросов
+const (
+	// ReasonHash - подпись HashSHA256 не совпала с телом запроса
+	ReasonHash = "hash"
+	// ReasonDecrypt - тело не удалось расшифровать
+	ReasonDecrypt = "decrypt"
+	// ReasonDecompress - тело не удалось распаковать
+	ReasonDecompress = "decompress"
+	// ReasonParse - тело не удалось разобрать или метрика некорректна
+	ReasonParse = "parse"
+)
+
+// Sampler записывает в сборщик значения, которые снимаются по запросу,
+// например состояние пула соединений.
+type Sampler func(c *Collector)
+
+// Collector хранит собственные метрики сервера.
+// Методы записи безопасны для вызова на nil, что позволяет не проверять
+// наличие сборщика в обработчиках.
+type Collector struct {
+	storage *ss.MetricsStorage
+	logger  *l.ZapLogger
+
+	mu       sync.Mutex
+	samplers []Sampler
+	// lastSample и ingested - время предыдущего снимка и количество принятых
+	// к тому моменту метрик по типам для расчета скорости приема
+	lastSample time.Time
+	ingested   map[string]int64
+}
+
+// New создает сборщик с собственным хранилищем в памяти.
+// Хранилище пишет в журнал только ошибки, чтобы каждый запрос
+// не порождал записи об обновлении служебных метрик.
+func New(logger *l.ZapLogger) *Collector {
+	quiet, err := l.NewZapLogger(zap.ErrorLevel)
+	if err != nil {
+		quiet = logger
+	}
+	c := &Collector{
+		storage:    ss.NewMetricsStorage(quiet),
+		logger:     logger,
+		lastSample: time.Now(),
+		ingested:   make(map[string]int64),
+	}
+	c.AddSampler(sampleLimits)
+	return c
+}
+
+// Storage возвращает хранилище собственных метрик.
+func (c *Collector) Storage() ss.Storage {
+	return c.storage
+}
+
+// Name возвращает имя метрики с зарезервированным префиксом.
+// labels - пары ключ, значение, которые добавляются к имени в виде {key="value"}.
+func Name(name string, labels ...string) string {
+	var b strings.Builder
+	b.WriteString(m.SelfMetricsPrefix)
+	b.WriteString(name)
+	for i := 0; i+1 < len(labels); i += 2 {
+		if i == 0 {
+			b.WriteByte('{')
+		} else {
+			b.WriteByte(',')
+		}
+		b.WriteString(labels[i])
+		b.WriteByte('=')
+		b.WriteString(strconv.Quote(labels[i+1]))
+	}
+	if len(labels) > 1 {
+		b.WriteByte('}')
+	}
+	return b.String()
+}
+
+// Add увеличивает счетчик name на delta.
+func (c *Collector) Add(name string, delta int64) {
+	if c == nil {
+		return
+	}
+	if _, err := c.storage.SetCounter(context.Background(), *m.NewMetricCounter(name, &delta)); err != nil {
+		c.logger.ErrorCtx(context.Background(), "Failed to record self metric", zap.String("name", name), zap.Error(err))
+	}
+}
+
+// Set устанавливает значение gauge name.
+func (c *Collector) Set(name string, value float64) {
+	if c == nil {
+		return
+	}
+	if _, err := c.storage.SetGauge(context.Background(), *m.NewMetricGauge(name, &value)); err != nil {
+		c.logger.ErrorCtx(context.Background(), "Failed to record self metric", zap.String("name", name), zap.Error(err))
+	}
+}
+
+// Observe учитывает операцию длительностью d: количество операций (name.count),
+// суммарную длительность в микросекундах (name.duration_us), длительность
+// последней операции в миллисекундах (name.last_ms) и количество ошибок (name.errors).
+func (c *Collector) Observe(name string, d time.Duration, err error, labels ...string) {
+	if c == nil {
+		return
+	}
+	c.Add(Name(name+".count", labels...), 1)
+	c.Add(Name(name+".duration_us", labels...), d.Microseconds())
+	c.Set(Name(name+".last_ms", labels...), float64(d)/float64(time.Millisecond))
+	if err != nil {
+		c.Add(Name(name+".errors", labels...), 1)
+	}
+}
+
+// Reject учитывает запрос, отклоненный по причине reason.
+func (c *Collector) Reject(reason string) {
+	c.Add(Name("rejected", "reason", reason), 1)
+}
+
+// Ingested учитывает n принятых метрик типа mType.
+func (c *Collector) Ingested(mType string, n int) {
+	if n == 0 {
+		return
+	}
+	c.Add(Name("ingest.metrics", "type", mType), int64(n))
+}
+
+// ObserveBackup учитывает сохранение метрик в файл.
+func (c *Collector) ObserveBackup(d time.Duration, err error) {
+	c.Observe("backup", d, err)
+}
+
+// AddSampler добавляет функцию, вызываемую перед каждым снимком метрик.
+func (c *Collector) AddSampler(fn Sampler) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.samplers = append(c.samplers, fn)
+}
+
+// Snapshot обновляет снимаемые значения и скорость приема метрик
+// и возвращает все собственные метрики, упорядоченные по типу и имени.
+func (c *Collector) Snapshot(ctx context.Context) ([]m.Metrics, error) {
+	c.mu.Lock()
+	for _, fn := range c.samplers {
+		fn(c)
+	}
+	c.sampleIngestRate()
+	c.mu.Unlock()
+
+	var metrics []m.Metrics
+	err := c.storage.ListMetrics(context.Background(), func(metric m.Metrics) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		metrics = append(metrics, metric)
+		return nil
+	})
+	return metrics, err
+}
+
+// sampleIngestRate рассчитывает скорость приема метрик каждого типа
+// (метрик в секунду) с момента предыдущего снимка. Вызывается под c.mu.
+func (c *Collector) sampleIngestRate() {
+	now := time.Now()
+	elapsed := now.Sub(c.lastSample).Seconds()
+	c.lastSample = now
+	for _, mType := range []string{m.TypeGauge, m.TypeCounter} {
+		var total int64
+		if metric, ok := c.storage.GetMetrics(context.Background(), m.TypeCounter, Name("ingest.metrics", "type", mType)); ok && metric.Delta != nil {
+			total = *metric.Delta
+		}
+		var rate float64
+		if elapsed > 0 {
+			rate = float64(total-c.ingested[mType]) / elapsed
+		}
+		c.ingested[mType] = total
+		c.Set(Name("ingest.rate_per_sec", "type", mType), rate)
+	}
+}
+
+// sampleLimits переносит счетчики запросов, отклоненных из-за размера тела.
+func sampleLimits(c *Collector) {
+	c.Set(Name("rejected", "reason", "body_limit"), float64(limits.Rejections(limits.ReasonBody)))
+	c.Set(Name("rejected", "reason", "decompressed_limit"), float64(limits.Rejections(limits.ReasonDecompressed)))
+}
@@ -0,0 +1,95 @@
+package selfmetrics
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	m "github.com/sanek1/metrics-collector/internal/models"
+	"github.com/sanek1/metrics-collector/pkg/logging"
+)
+
+func newCollector(t *testing.T) *Collector {
+	t.Helper()
+	logger, err := logging.NewZapLogger(zap.InfoLevel)
+	require.NoError(t, err)
+	return New(logger)
+}
+
+func snapshot(t *testing.T, c *Collector) map[string]m.Metrics {
+	t.Helper()
+	metrics, err := c.Snapshot(context.Background())
+	require.NoError(t, err)
+	byName := make(map[string]m.Metrics, len(metrics))
+	for _, metric := range metrics {
+		byName[metric.ID] = metric
+	}
+	return byName
+}
+
+func TestName(t *testing.T) {
+	assert.Equal(t, "_collector.backup.count", Name("backup.count"))
+	assert.Equal(t, `_collector.rejected{reason="hash"}`, Name("rejected", "reason", "hash"))
+	assert.Equal(t, `_collector.http.responses{route="GET /",status="2xx"}`,
+		Name("http.responses", "route", "GET /", "status", "2xx"))
+}
+
+func TestCollector_Observe(t *testing.T) {
+	c := newCollector(t)
+	c.Observe("backup", 3*time.Millisecond, nil)
+	c.Observe("backup", 5*time.Millisecond, errors.New("disk full"))
+
+	metrics := snapshot(t, c)
+	assert.EqualValues(t, 2, *metrics[Name("backup.count")].Delta)
+	assert.EqualValues(t, 8000, *metrics[Name("backup.duration_us")].Delta)
+	assert.EqualValues(t, 5, *metrics[Name("backup.last_ms")].Value)
+	assert.EqualValues(t, 1, *metrics[Name("backup.errors")].Delta)
+	for id := range metrics {
+		assert.Contains(t, id, m.SelfMetricsPrefix)
+	}
+}
+
+func TestCollector_IngestRate(t *testing.T) {
+	c := newCollector(t)
+	c.Ingested(m.TypeGauge, 10)
+	c.Ingested(m.TypeGauge, 5)
+	c.Ingested(m.TypeCounter, 0)
+
+	metrics := snapshot(t, c)
+	assert.EqualValues(t, 15, *metrics[Name("ingest.metrics", "type", m.TypeGauge)].Delta)
+	assert.Greater(t, *metrics[Name("ingest.rate_per_sec", "type", m.TypeGauge)].Value, 0.0)
+	assert.Zero(t, *metrics[Name("ingest.rate_per_sec", "type", m.TypeCounter)].Value)
+
+	metrics = snapshot(t, c)
+	assert.Zero(t, *metrics[Name("ingest.rate_per_sec", "type", m.TypeGauge)].Value, "no metrics since the previous snapshot")
+}
+
+func TestCollector_Samplers(t *testing.T) {
+	c := newCollector(t)
+	calls := 0
+	c.AddSampler(func(c *Collector) {
+		calls++
+		c.Set(Name("queue"), float64(calls))
+	})
+
+	metrics := snapshot(t, c)
+	assert.EqualValues(t, 1, *metrics[Name("queue")].Value)
+	assert.Contains(t, metrics, Name("rejected", "reason", "body_limit"))
+
+	metrics = snapshot(t, c)
+	assert.EqualValues(t, 2, *metrics[Name("queue")].Value)
+}
+
+func TestCollector_Nil(t *testing.T) {
+	var c *Collector
+	assert.NotPanics(t, func() {
+		c.Reject(ReasonHash)
+		c.Ingested(m.TypeGauge, 1)
+		c.ObserveBackup(time.Second, nil)
+	})
+}
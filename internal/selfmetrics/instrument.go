@@ -0,0 +1,148 @@
+package selfmetrics
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	m "github.com/sanek1/metrics-collector/internal/models"
+	ss "github.com/sanek1/metrics-collector/internal/storage/server"
+)
+
+// unmatchedRoute - метка запросов, для которых не найден маршрут
+const unmatchedRoute = "unmatched"
+
+// Middleware учитывает количество и длительность запросов по маршрутам
+// и количество ответов по классам статусов (2xx, 4xx, 5xx).
+// Маршрут определяется шаблоном пути gin, а не фактическим путем,
+// чтобы имена метрик не зависели от имен метрик клиентов.
+func (c *Collector) Middleware() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		start := time.Now()
+		ctx.Next()
+
+		route := ctx.FullPath()
+		if route == "" {
+			route = unmatchedRoute
+		}
+		route = ctx.Request.Method + " " + route
+		c.Observe("http.requests", time.Since(start), nil, "route", route)
+		c.Add(Name("http.responses", "route", route, "status", strconv.Itoa(ctx.Writer.Status()/100)+"xx"), 1)
+	}
+}
+
+// Instrument возвращает хранилище, которое учитывает длительность операций
+// и количество принятых метрик по типам. Методы DatabaseStorage сохраняются.
+// Если хранилище сохраняет резервные копии или использует пул соединений,
+// сборщик также подписывается на сохранения и снимает статистику пула.
+func (c *Collector) Instrument(s ss.Storage) ss.Storage {
+	if bo, ok := s.(ss.BackupObserver); ok {
+		bo.ObserveBackups(c.ObserveBackup)
+	}
+	if pr, ok := s.(ss.PoolReporter); ok {
+		c.AddSampler(poolSampler(pr))
+	}
+
+	is := &instrumented{s: s, c: c}
+	if dbs, ok := s.(ss.DatabaseStorage); ok {
+		return &instrumentedDB{instrumented: is, db: dbs}
+	}
+	return is
+}
+
+type instrumented struct {
+	s ss.Storage
+	c *Collector
+}
+
+func (is *instrumented) observe(op string, start time.Time, err error) {
+	is.c.Observe("storage", time.Since(start), err, "op", op)
+}
+
+func (is *instrumented) SetGauge(ctx context.Context, models ...m.Metrics) ([]*m.Metrics, error) {
+	start := time.Now()
+	res, err := is.s.SetGauge(ctx, models...)
+	is.observe("SetGauge", start, err)
+	if err == nil {
+		is.ingested(models)
+	}
+	return res, err
+}
+
+func (is *instrumented) SetCounter(ctx context.Context, models ...m.Metrics) ([]*m.Metrics, error) {
+	start := time.Now()
+	res, err := is.s.SetCounter(ctx, models...)
+	is.observe("SetCounter", start, err)
+	if err == nil {
+		is.ingested(models)
+	}
+	return res, err
+}
+
+func (is *instrumented) GetAllMetrics(ctx context.Context) []string {
+	start := time.Now()
+	res := is.s.GetAllMetrics(ctx)
+	is.observe("GetAllMetrics", start, nil)
+	return res
+}
+
+func (is *instrumented) GetMetrics(ctx context.Context, metricType, metricName string) (*m.Metrics, bool) {
+	start := time.Now()
+	res, ok := is.s.GetMetrics(ctx, metricType, metricName)
+	is.observe("GetMetrics", start, nil)
+	return res, ok
+}
+
+func (is *instrumented) ListMetrics(ctx context.Context, fn func(m.Metrics) error) error {
+	start := time.Now()
+	err := is.s.ListMetrics(ctx, fn)
+	is.observe("ListMetrics", start, err)
+	return err
+}
+
+// ingested учитывает принятые метрики по их типу: в SetGauge
+// обработчики передают пакет, содержащий метрики обоих типов.
+func (is *instrumented) ingested(models []m.Metrics) {
+	counts := make(map[string]int, 2)
+	for _, model := range models {
+		counts[model.MType]++
+	}
+	for mType, n := range counts {
+		is.c.Ingested(mType, n)
+	}
+}
+
+// instrumentedDB сохраняет методы DatabaseStorage обернутого хранилища.
+type instrumentedDB struct {
+	*instrumented
+	db ss.DatabaseStorage
+}
+
+func (is *instrumentedDB) PingIsOk() bool {
+	start := time.Now()
+	ok := is.db.PingIsOk()
+	is.observe("Ping", start, nil)
+	return ok
+}
+
+func (is *instrumentedDB) EnsureMetricsTableExists(ctx context.Context) error {
+	return is.db.EnsureMetricsTableExists(ctx)
+}
+
+// poolSampler снимает статистику пула соединений с базой данных.
+func poolSampler(pr ss.PoolReporter) Sampler {
+	return func(c *Collector) {
+		stat := pr.PoolStat()
+		if stat == nil {
+			return
+		}
+		c.Set(Name("db.pool.max_conns"), float64(stat.MaxConns()))
+		c.Set(Name("db.pool.total_conns"), float64(stat.TotalConns()))
+		c.Set(Name("db.pool.idle_conns"), float64(stat.IdleConns()))
+		c.Set(Name("db.pool.acquired_conns"), float64(stat.AcquiredConns()))
+		c.Set(Name("db.pool.empty_acquire_count"), float64(stat.EmptyAcquireCount()))
+		c.Set(Name("db.pool.acquire_duration_ms"), float64(stat.AcquireDuration().Milliseconds()))
+	}
+}
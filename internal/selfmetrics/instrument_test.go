@@ -0,0 +1,68 @@
+package selfmetrics
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	m "github.com/sanek1/metrics-collector/internal/models"
+	ss "github.com/sanek1/metrics-collector/internal/storage/server"
+	"github.com/sanek1/metrics-collector/pkg/logging"
+)
+
+func TestCollector_Middleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	c := newCollector(t)
+	router := gin.New()
+	router.Use(c.Middleware())
+	router.GET("/value/:name", func(ctx *gin.Context) { ctx.Status(http.StatusOK) })
+
+	for _, path := range []string{"/value/a", "/value/b", "/missing"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	metrics := snapshot(t, c)
+	assert.EqualValues(t, 2, *metrics[Name("http.requests.count", "route", "GET /value/:name")].Delta)
+	assert.EqualValues(t, 2, *metrics[Name("http.responses", "route", "GET /value/:name", "status", "2xx")].Delta)
+	assert.EqualValues(t, 1, *metrics[Name("http.responses", "route", "GET unmatched", "status", "4xx")].Delta)
+	assert.Contains(t, metrics, Name("http.requests.last_ms", "route", "GET /value/:name"))
+}
+
+func TestCollector_Instrument(t *testing.T) {
+	logger, err := logging.NewZapLogger(zap.InfoLevel)
+	require.NoError(t, err)
+	c := New(logger)
+	memory := ss.NewMetricsStorage(logger)
+	s := c.Instrument(memory)
+
+	_, isDB := s.(ss.DatabaseStorage)
+	assert.False(t, isDB, "memory storage must not become a database storage")
+
+	ctx := context.Background()
+	_, err = s.SetGauge(ctx, *m.NewMetricGauge("Alloc", ptr(1.5)), *m.NewMetricCounter("PollCount", ptr(int64(2))))
+	require.NoError(t, err)
+	_, err = s.SetCounter(ctx, *m.NewMetricCounter("PollCount", ptr(int64(3))))
+	require.NoError(t, err)
+	_, ok := s.GetMetrics(ctx, m.TypeGauge, "Alloc")
+	assert.True(t, ok)
+
+	_, ok = memory.GetMetrics(ctx, m.TypeGauge, Name("storage.count", "op", "SetGauge"))
+	assert.False(t, ok, "self metrics must not be written to the instrumented storage")
+
+	metrics := snapshot(t, c)
+	assert.EqualValues(t, 1, *metrics[Name("ingest.metrics", "type", m.TypeGauge)].Delta)
+	assert.EqualValues(t, 2, *metrics[Name("ingest.metrics", "type", m.TypeCounter)].Delta)
+	assert.EqualValues(t, 1, *metrics[Name("storage.count", "op", "SetGauge")].Delta)
+	assert.EqualValues(t, 1, *metrics[Name("storage.count", "op", "GetMetrics")].Delta)
+	assert.NotContains(t, metrics, Name("storage.errors", "op", "SetGauge"))
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
@@ -0,0 +1,55 @@
+package services
+
+import (
+	"strings"
+	"sync/atomic"
+
+	"github.com/sanek1/metrics-collector/internal/compression"
+)
+
+const (
+	// encodingAuto - кодировка выбирается по заголовку Accept-Encoding ответа сервера
+	encodingAuto = "auto"
+	// encodingNone - тело запроса не сжимается
+	encodingNone = "none"
+)
+
+// encodingSelector выбирает кодировку тела запроса: заданную в конфигурации
+// или, в режиме auto, лучшую из объявленных сервером в Accept-Encoding.
+// До первого ответа сервера в режиме auto используется gzip.
+type encodingSelector struct {
+	auto    bool
+	current atomic.Value
+}
+
+func newEncodingSelector(mode string) *encodingSelector {
+	e := &encodingSelector{}
+	switch mode = strings.ToLower(strings.TrimSpace(mode)); mode {
+	case "", encodingAuto:
+		e.auto = true
+		e.current.Store(compression.Gzip)
+	case encodingNone, compression.Identity:
+		e.current.Store(compression.Identity)
+	default:
+		e.current.Store(mode)
+	}
+	return e
+}
+
+// Current возвращает кодировку для очередного запроса.
+func (e *encodingSelector) Current() string {
+	if e == nil {
+		return compression.Gzip
+	}
+	return e.current.Load().(string)
+}
+
+// Learn учитывает кодировки, объявленные сервером в заголовке Accept-Encoding.
+func (e *encodingSelector) Learn(acceptEncoding string) {
+	if e == nil || !e.auto || acceptEncoding == "" {
+		return
+	}
+	if encoding := compression.Negotiate(acceptEncoding); encoding != "" {
+		e.current.Store(encoding)
+	}
+}
@@ -0,0 +1,96 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/sanek1/metrics-collector/internal/compression"
+	flags "github.com/sanek1/metrics-collector/internal/flags/agent"
+	l "github.com/sanek1/metrics-collector/pkg/logging"
+)
+
+func TestEncodingSelector(t *testing.T) {
+	t.Run("NilIsGzip", func(t *testing.T) {
+		var e *encodingSelector
+		assert.Equal(t, compression.Gzip, e.Current())
+		e.Learn("zstd")
+		assert.Equal(t, compression.Gzip, e.Current())
+	})
+
+	t.Run("AutoLearnsFromServer", func(t *testing.T) {
+		e := newEncodingSelector("auto")
+		assert.Equal(t, compression.Gzip, e.Current())
+
+		e.Learn("")
+		assert.Equal(t, compression.Gzip, e.Current())
+
+		e.Learn("zstd, snappy, gzip")
+		assert.Equal(t, compression.Zstd, e.Current())
+
+		e.Learn("gzip, snappy;q=0.5")
+		assert.Equal(t, compression.Gzip, e.Current())
+
+		e.Learn("br")
+		assert.Equal(t, compression.Gzip, e.Current())
+	})
+
+	t.Run("Fixed", func(t *testing.T) {
+		e := newEncodingSelector("Snappy")
+		e.Learn("zstd")
+		assert.Equal(t, compression.Snappy, e.Current())
+
+		assert.Equal(t, compression.Identity, newEncodingSelector("none").Current())
+	})
+}
+
+func TestPreparingMetricsEncodings(t *testing.T) {
+	logger, _ := l.NewZapLogger(zap.InfoLevel)
+	body := []byte(`{"id":"test","type":"gauge","value":123.45}`)
+
+	for _, mode := range []string{"zstd", "snappy", "gzip", "none"} {
+		t.Run(mode, func(t *testing.T) {
+			s := NewServices(&flags.Options{Compression: mode}, logger)
+
+			req, err := s.preparingMetrics(context.Background(), "http://example.com/updates/", body)
+			require.NoError(t, err)
+
+			encoding := req.Header.Get("Content-Encoding")
+			if mode == "none" {
+				assert.Empty(t, encoding)
+			} else {
+				assert.Equal(t, mode, encoding)
+			}
+
+			r, err := compression.NewReader(encoding, req.Body)
+			require.NoError(t, err)
+			got, err := io.ReadAll(r)
+			require.NoError(t, err)
+			assert.Equal(t, body, got)
+		})
+	}
+}
+
+func TestProcessingResponseServerLearnsEncoding(t *testing.T) {
+	logger, _ := l.NewZapLogger(zap.InfoLevel)
+	s := NewServices(&flags.Options{Compression: "auto"}, logger)
+
+	payload, err := compression.Compress(compression.Zstd, []byte(`{"status":"ok"}`))
+	require.NoError(t, err)
+
+	resp := &http.Response{
+		Body:   io.NopCloser(bytes.NewReader(payload)),
+		Header: make(http.Header),
+	}
+	resp.Header.Set("Content-Encoding", compression.Zstd)
+	resp.Header.Set("Accept-Encoding", "zstd, snappy, gzip")
+
+	require.NoError(t, s.processingResponseServer(context.Background(), resp))
+	assert.Equal(t, compression.Zstd, s.encodings.Current())
+}
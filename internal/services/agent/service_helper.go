@@ -1,20 +1,21 @@
 package services
 
 import (
-	"bufio"
 	"bytes"
-	"compress/gzip"
 	"context"
-	"crypto/rsa"
 	"io"
 	"net/http"
 	"os"
 
 	"go.uber.org/zap"
 
+	"github.com/sanek1/metrics-collector/internal/compression"
 	"github.com/sanek1/metrics-collector/internal/crypto"
 	flags "github.com/sanek1/metrics-collector/internal/flags/agent"
 	"github.com/sanek1/metrics-collector/internal/models"
+	"github.com/sanek1/metrics-collector/internal/payload"
+	"github.com/sanek1/metrics-collector/internal/requestid"
+	"github.com/sanek1/metrics-collector/internal/tenant"
 	l "github.com/sanek1/metrics-collector/pkg/logging"
 )
 
@@ -29,8 +30,14 @@ type EncryptFunc func(ctx context.Context, data []byte) ([]byte, error)
 type Services struct {
 	options    *flags.Options
 	l          *l.ZapLogger
-	publicKey  *rsa.PublicKey
+	publicKey  crypto.PublicKey
 	useEncrypt bool
+	// keyID - отпечаток публичного ключа, по которому сервер выбирает приватный ключ
+	keyID string
+	// encodings выбирает кодировку сжатия тела запроса
+	encodings *encodingSelector
+	// contentType - формат тела пакетов метрик
+	contentType string
 	// encryptData - функция шифрования данных, может быть заменена в тестах
 	encryptData EncryptFunc
 }
@@ -38,7 +45,7 @@ type Services struct {
 // NewServices создает новый экземпляр Services
 // Возвращает *Services и ошибку, если не удалось загрузить ключ
 func NewServices(options *flags.Options, zl *l.ZapLogger) *Services {
-	var publicKey *rsa.PublicKey
+	var publicKey crypto.PublicKey
 	useEncrypt := false
 
 	s := &Services{
@@ -46,8 +53,16 @@ func NewServices(options *flags.Options, zl *l.ZapLogger) *Services {
 		l:          zl,
 		publicKey:  nil,
 		useEncrypt: false,
+		encodings:  newEncodingSelector(options.Compression),
 	}
 
+	contentType, err := payload.ContentType(options.Format)
+	if err != nil {
+		zl.WarnCtx(context.Background(), "Unknown metrics format, using JSON", zap.Error(err))
+		contentType = payload.ContentTypeJSON
+	}
+	s.contentType = contentType
+
 	// Загружаем публичный ключ, если указан путь
 	if options.CryptoKey != "" {
 		var err error
@@ -64,6 +79,9 @@ func NewServices(options *flags.Options, zl *l.ZapLogger) *Services {
 		// Обновляем поля после успешной загрузки ключа
 		s.publicKey = publicKey
 		s.useEncrypt = useEncrypt
+		if s.keyID, err = crypto.Fingerprint(publicKey); err != nil {
+			zl.WarnCtx(context.Background(), "Failed to compute key fingerprint", zap.Error(err))
+		}
 	}
 
 	// Устанавливаем функцию шифрования по умолчанию
@@ -99,7 +117,8 @@ func (s Services) preparingMetrics(ctx context.Context, url string, body []byte)
 	}
 
 	// Сжимаем данные
-	compressedBody, err := s.compressedBody(ctx, processedBody)
+	encoding := s.encodings.Current()
+	compressedBody, err := s.compressBody(ctx, encoding, processedBody)
 	if err != nil {
 		s.l.WarnCtx(ctx, "Error compressing request body", zap.Error(err))
 		return nil, err
@@ -112,87 +131,84 @@ func (s Services) preparingMetrics(ctx context.Context, url string, body []byte)
 	}
 
 	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("content-encoding", "gzip")
-	req.Header.Set("Accept-Encoding", "gzip")
+	if encoding != compression.Identity {
+		req.Header.Set("Content-Encoding", encoding)
+	}
+	req.Header.Set("Accept-Encoding", compression.AcceptEncoding())
 
 	// Добавляем заголовок, указывающий что данные зашифрованы
 	if s.useEncrypt {
 		req.Header.Set("X-Encrypted", "true")
+		if s.keyID != "" {
+			req.Header.Set(crypto.KeyIDHeader, s.keyID)
+		}
+	}
+
+	if s.options.Tenant != "" {
+		req.Header.Set(tenant.Header, s.options.Tenant)
+	}
+
+	if s.options.APIToken != "" {
+		req.Header.Set("Authorization", "Bearer "+s.options.APIToken)
+	}
+
+	// Идентификаторы запроса и агента позволяют найти запрос в журнале сервера
+	req.Header.Set(requestid.Header, requestid.New())
+	if requestid.Validate(s.options.AgentID) == nil {
+		req.Header.Set(requestid.AgentHeader, s.options.AgentID)
 	}
 
 	return req, nil
 }
 
 func (s Services) processingResponseServer(ctx context.Context, resp *http.Response) error {
-	if resp.Header.Get("Content-Encoding") == "gzip" {
-		buf, err := s.decompressBody(ctx, resp.Body)
-		if err != nil {
-			s.l.ErrorCtx(ctx, "Error decompressing response body", zap.Error(err))
-			return err
-		}
-		_, err = os.Stdout.Write(buf.Bytes())
-		if err != nil {
-			s.l.ErrorCtx(ctx, "Error writing response body", zap.Error(err))
-		}
-	} else {
-		body, err := io.ReadAll(resp.Body)
-		if err != nil {
-			s.l.ErrorCtx(ctx, "Error reading response body", zap.Error(err))
-			return err
-		}
-		_, err = os.Stdout.Write(body)
-		if err != nil {
-			s.l.ErrorCtx(ctx, "Error writing response body", zap.Error(err))
-		}
-	}
 	defer func() {
 		_ = resp.Body.Close()
 	}()
 
+	s.encodings.Learn(resp.Header.Get("Accept-Encoding"))
+
+	buf, err := s.decompressBody(ctx, resp.Header.Get("Content-Encoding"), resp.Body)
+	if err != nil {
+		s.l.ErrorCtx(ctx, "Error decompressing response body", zap.Error(err))
+		return err
+	}
+	if _, err = os.Stdout.Write(buf.Bytes()); err != nil {
+		s.l.ErrorCtx(ctx, "Error writing response body", zap.Error(err))
+	}
+
 	if _, err := io.Copy(io.Discard, resp.Body); err != nil {
 		s.l.ErrorCtx(ctx, "Error discarding response body", zap.Error(err))
 	}
 	return nil
 }
 
-func (s Services) compressedBody(ctx context.Context, body []byte) ([]byte, error) {
-	var buf bytes.Buffer
-	zw := gzip.NewWriter(&buf)
-	if _, err := zw.Write(body); err != nil {
-		s.l.ErrorCtx(ctx, "error compressing body content", zap.Error(err))
-		return nil, err
-	}
-	if err := zw.Close(); err != nil {
-		s.l.ErrorCtx(ctx, "error closing gzip", zap.Error(err))
+// compressBody сжимает тело запроса в указанной кодировке.
+func (s Services) compressBody(ctx context.Context, encoding string, body []byte) ([]byte, error) {
+	compressed, err := compression.Compress(encoding, body)
+	if err != nil {
+		s.l.ErrorCtx(ctx, "error compressing body content", zap.String("encoding", encoding), zap.Error(err))
 		return nil, err
 	}
-	return buf.Bytes(), nil
+	return compressed, nil
 }
 
-func (s Services) decompressBody(ctx context.Context, body io.ReadCloser) (*bytes.Buffer, error) {
-	gzReader, err := gzip.NewReader(body)
+// decompressBody распаковывает тело ответа сервера, но не более maxDecompressedSize байт.
+func (s Services) decompressBody(ctx context.Context, encoding string, body io.Reader) (*bytes.Buffer, error) {
+	reader, err := compression.NewReader(encoding, body)
 	if err != nil {
-		s.l.FatalCtx(ctx, "Error reading response body", zap.Error(err))
+		s.l.ErrorCtx(ctx, "Error reading response body", zap.Error(err))
+		return nil, err
 	}
 	defer func() {
-		_ = gzReader.Close()
+		_ = reader.Close()
 	}()
 
 	buf := new(bytes.Buffer)
-	writer := bufio.NewWriter(buf)
-	limitedReader := io.LimitReader(gzReader, maxDecompressedSize)
-
-	_, err = io.Copy(writer, limitedReader)
-	if err != nil && err != io.EOF {
-		s.l.FatalCtx(ctx, "Error when copying", zap.Error(err))
+	if _, err = io.Copy(buf, io.LimitReader(reader, maxDecompressedSize)); err != nil {
+		s.l.ErrorCtx(ctx, "Error when copying", zap.Error(err))
 		return nil, err
 	}
-
-	if err := writer.Flush(); err != nil {
-		s.l.FatalCtx(ctx, "Error flushing writer", zap.Error(err))
-		return nil, err
-	}
-
 	return buf, nil
 }
 
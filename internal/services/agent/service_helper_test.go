@@ -23,34 +23,6 @@ import (
 	l "github.com/sanek1/metrics-collector/pkg/logging"
 )
 
-func TestCompressedBody(t *testing.T) {
-	logger, _ := l.NewZapLogger(zap.InfoLevel)
-	s := &Services{
-		options:    &flags.Options{},
-		l:          logger,
-		publicKey:  nil,
-		useEncrypt: false,
-	}
-
-	ctx := context.Background()
-	testData := []byte("test data for compression")
-
-	// Test compression of data
-	compressed, err := s.compressedBody(ctx, testData)
-	require.NoError(t, err)
-	assert.NotNil(t, compressed)
-	assert.NotEmpty(t, compressed)
-
-	assert.Less(t, len(compressed), len(testData)*2)
-
-	reader, err := gzip.NewReader(bytes.NewReader(compressed))
-	require.NoError(t, err)
-
-	decompressed, err := io.ReadAll(reader)
-	require.NoError(t, err)
-	assert.Equal(t, testData, decompressed)
-}
-
 func TestDecompressBody(t *testing.T) {
 	logger, _ := l.NewZapLogger(zap.InfoLevel)
 	s := &Services{
@@ -72,7 +44,7 @@ func TestDecompressBody(t *testing.T) {
 
 	readCloser := io.NopCloser(bytes.NewReader(buf.Bytes()))
 
-	decompressed, err := s.decompressBody(ctx, readCloser)
+	decompressed, err := s.decompressBody(ctx, "gzip", readCloser)
 	require.NoError(t, err)
 	assert.NotNil(t, decompressed)
 
@@ -105,7 +77,7 @@ func TestPreparingMetrics(t *testing.T) {
 		assert.Equal(t, url, req.URL.String())
 		assert.Equal(t, "application/json", req.Header.Get("Content-Type"))
 		assert.Equal(t, "gzip", req.Header.Get("content-encoding"))
-		assert.Equal(t, "gzip", req.Header.Get("Accept-Encoding"))
+		assert.Equal(t, "zstd, snappy, gzip", req.Header.Get("Accept-Encoding"))
 		assert.Empty(t, req.Header.Get("X-Encrypted"), "Заголовок X-Encrypted не должен быть установлен")
 
 		assert.NotNil(t, req.Body)
@@ -120,6 +92,7 @@ func TestPreparingMetrics(t *testing.T) {
 			l:          logger,
 			publicKey:  &privateKey.PublicKey,
 			useEncrypt: true,
+			keyID:      "key-fingerprint",
 			encryptData: func(ctx context.Context, data []byte) ([]byte, error) {
 				return data, nil
 			},
@@ -134,6 +107,22 @@ func TestPreparingMetrics(t *testing.T) {
 		assert.NotNil(t, req)
 
 		assert.Equal(t, "true", req.Header.Get("X-Encrypted"))
+		assert.Equal(t, "key-fingerprint", req.Header.Get("X-Key-ID"))
+	})
+
+	t.Run("WithTenantAndToken", func(t *testing.T) {
+		s := &Services{
+			options: &flags.Options{Tenant: "team-a", APIToken: "agent-token"},
+			l:       logger,
+			encryptData: func(ctx context.Context, data []byte) ([]byte, error) {
+				return data, nil
+			},
+		}
+
+		req, err := s.preparingMetrics(context.Background(), "http://example.com/updates/", []byte(`[]`))
+		require.NoError(t, err)
+		assert.Equal(t, "team-a", req.Header.Get("X-Scope-OrgID"))
+		assert.Equal(t, "Bearer agent-token", req.Header.Get("Authorization"))
 	})
 }
 
@@ -286,6 +275,7 @@ func TestNewServices(t *testing.T) {
 		assert.True(t, s.useEncrypt)
 		assert.NotNil(t, s.publicKey)
 		assert.NotNil(t, s.encryptData)
+		assert.Len(t, s.keyID, 64)
 	})
 }
 
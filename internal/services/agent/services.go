@@ -2,17 +2,22 @@
 package services
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"sync"
 
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
 	"go.uber.org/zap"
 
 	"github.com/sanek1/metrics-collector/internal/models"
+	"github.com/sanek1/metrics-collector/internal/payload"
+	"github.com/sanek1/metrics-collector/internal/requestid"
+	"github.com/sanek1/metrics-collector/internal/tracing"
 )
 
 func (s Services) SendToServerAsync(ctx context.Context, client *http.Client, url string, m []models.Metrics) error {
@@ -41,22 +46,33 @@ func (s Services) SendToServerAsync(ctx context.Context, client *http.Client, ur
 }
 
 func (s Services) SendToServerBatchMetrics(ctx context.Context, client *http.Client, url string, m []models.Metrics) error {
-	var buf bytes.Buffer
-	enc := json.NewEncoder(&buf)
-	if err := enc.Encode(m); err != nil {
-		s.l.ErrorCtx(ctx, "Error encoding metrics to JSON",
+	contentType := s.batchContentType()
+	body, err := payload.Marshal(contentType, m)
+	if err != nil {
+		s.l.ErrorCtx(ctx, "Error encoding metrics",
+			zap.String("content_type", contentType),
 			zap.Error(err),
 		)
 		return fmt.Errorf("error encoding metrics: %w", err)
 	}
 
-	req, err := s.preparingMetrics(ctx, url, buf.Bytes())
+	req, err := s.preparingMetrics(ctx, url, body)
 	if err != nil {
 		return err
 	}
+	req.Header.Set("Content-Type", contentType)
 
 	return s.sendToServer(ctx, client, req)
 }
+
+// batchContentType возвращает Content-Type пакетов метрик, по умолчанию JSON.
+func (s Services) batchContentType() string {
+	if s.contentType == "" {
+		return payload.ContentTypeJSON
+	}
+	return s.contentType
+}
+
 func (s Services) SendToServerMetric(ctx context.Context, client *http.Client, url string, model models.Metrics) error {
 	body, err := json.Marshal(model)
 	if err != nil {
@@ -74,7 +90,23 @@ func (s Services) SendToServerMetric(ctx context.Context, client *http.Client, u
 	return s.sendToServer(ctx, client, req)
 }
 
-func (s Services) sendToServer(ctx context.Context, client *http.Client, req *http.Request) error {
+// ErrRejected - сервер ответил на запрос статусом, отличным от 2xx
+var ErrRejected = errors.New("server rejected metrics")
+
+// sendToServer отправляет запрос в спане agent.sendToServer и передает
+// контекст трассы серверу в заголовке traceparent.
+func (s Services) sendToServer(ctx context.Context, client *http.Client, req *http.Request) (err error) {
+	ctx, span := tracing.Start(ctx, "agent.sendToServer",
+		semconv.HTTPRequestMethodKey.String(req.Method),
+		semconv.URLFull(req.URL.String()),
+		attribute.Int64("content_length", req.ContentLength),
+	)
+	defer func() { tracing.End(span, err) }()
+	ctx = tracing.WithLogFields(ctx, s.l)
+	ctx = s.l.WithContextFields(ctx, zap.String("request_id", req.Header.Get(requestid.Header)))
+	req = req.WithContext(ctx)
+	tracing.Inject(ctx, req.Header)
+
 	resp, err := client.Do(req)
 	if err != nil {
 		s.l.ErrorCtx(ctx, "sendToServer Request sending failed",
@@ -89,6 +121,16 @@ func (s Services) sendToServer(ctx context.Context, client *http.Client, req *ht
 		_, _ = io.Copy(io.Discard, resp.Body)
 		_ = resp.Body.Close()
 	}()
+	span.SetAttributes(semconv.HTTPResponseStatusCode(resp.StatusCode))
+
+	// сервер не принял метрики: вызывающий код должен отправить их повторно
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		s.l.ErrorCtx(ctx, "Server rejected metrics",
+			zap.Int("status_code", resp.StatusCode),
+			zap.String("status", resp.Status),
+		)
+		return fmt.Errorf("%w: %s", ErrRejected, resp.Status)
+	}
 
 	if err := s.processingResponseServer(ctx, resp); err != nil {
 		s.l.ErrorCtx(ctx, "Response processing failed",
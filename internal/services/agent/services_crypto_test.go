@@ -36,7 +36,7 @@ func TestEncryptedMetricsSending(t *testing.T) {
 	}()
 
 	// Проверяем только наличие приватного ключа, сам ключ не нужен в этом тесте
-	_, err = cryptoutils.LoadPrivateKey(privateKeyPath)
+	_, err = cryptoutils.LoadPrivateKey(privateKeyPath, nil)
 	require.NoError(t, err, "Ошибка при загрузке приватного ключа")
 
 	// Create logger
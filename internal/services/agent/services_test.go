@@ -3,16 +3,24 @@ package services
 import (
 	"context"
 	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 	"go.uber.org/zap"
 
+	"github.com/sanek1/metrics-collector/internal/compression"
 	flags "github.com/sanek1/metrics-collector/internal/flags/agent"
 	m "github.com/sanek1/metrics-collector/internal/models"
+	"github.com/sanek1/metrics-collector/internal/payload"
+	"github.com/sanek1/metrics-collector/internal/requestid"
+	"github.com/sanek1/metrics-collector/internal/tracing"
 	l "github.com/sanek1/metrics-collector/pkg/logging"
 )
 
@@ -66,7 +74,8 @@ func Test_reportClient(t *testing.T) {
 	ctx := context.Background()
 	logger, _ := l.NewZapLogger(zap.InfoLevel)
 	logger.InfoCtx(ctx, "agent started ", zap.String("time: ", time.DateTime))
-	opt := flags.ParseFlags()
+	opt, err := flags.Load(nil)
+	require.NoError(t, err)
 	s := NewServices(opt, logger)
 
 	for _, tt := range tests {
@@ -77,3 +86,99 @@ func Test_reportClient(t *testing.T) {
 		})
 	}
 }
+
+func TestSendToServerBatchMetricsFormats(t *testing.T) {
+	value := 1.25
+	delta := int64(5)
+	batch := []m.Metrics{
+		{ID: "Alloc", MType: m.TypeGauge, Value: &value},
+		{ID: "PollCount", MType: m.TypeCounter, Delta: &delta},
+	}
+	logger, _ := l.NewZapLogger(zap.InfoLevel)
+
+	for format, contentType := range map[string]string{
+		"json":     payload.ContentTypeJSON,
+		"protobuf": payload.ContentTypeProtobuf,
+		"msgpack":  payload.ContentTypeMsgpack,
+	} {
+		t.Run(format, func(t *testing.T) {
+			var received []m.Metrics
+			testServer := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, contentType, r.Header.Get("Content-Type"))
+				reader, err := compression.NewReader(r.Header.Get("Content-Encoding"), r.Body)
+				require.NoError(t, err)
+				body, err := io.ReadAll(reader)
+				require.NoError(t, err)
+				received, err = payload.Unmarshal(r.Header.Get("Content-Type"), body)
+				require.NoError(t, err)
+			}))
+			defer testServer.Close()
+
+			s := NewServices(&flags.Options{Format: format}, logger)
+			err := s.SendToServerBatchMetrics(context.Background(), testServer.Client(), testServer.URL+"/updates/", batch)
+			require.NoError(t, err)
+			assert.Equal(t, batch, received)
+		})
+	}
+}
+
+func TestSendToServerPropagatesTrace(t *testing.T) {
+	provider := sdktrace.NewTracerProvider()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+	_, err := tracing.Setup(context.Background(), tracing.Options{})
+	require.NoError(t, err)
+
+	var traceparent string
+	testServer := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("traceparent")
+	}))
+	defer testServer.Close()
+
+	logger, _ := l.NewZapLogger(zap.InfoLevel)
+	s := NewServices(&flags.Options{}, logger)
+	value := 1.0
+	err = s.SendToServerMetric(context.Background(), testServer.Client(), testServer.URL+"/update/",
+		m.Metrics{ID: "Alloc", MType: m.TypeGauge, Value: &value})
+	require.NoError(t, err)
+	assert.Regexp(t, `^00-[0-9a-f]{32}-[0-9a-f]{16}-01$`, traceparent)
+}
+
+func TestSendToServerSetsRequestAndAgentID(t *testing.T) {
+	var requestID, agentID string
+	testServer := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		requestID = r.Header.Get(requestid.Header)
+		agentID = r.Header.Get(requestid.AgentHeader)
+	}))
+	defer testServer.Close()
+
+	logger, _ := l.NewZapLogger(zap.InfoLevel)
+	s := NewServices(&flags.Options{AgentID: "host-1"}, logger)
+	value := 1.0
+	err := s.SendToServerMetric(context.Background(), testServer.Client(), testServer.URL+"/update/",
+		m.Metrics{ID: "Alloc", MType: m.TypeGauge, Value: &value})
+	require.NoError(t, err)
+	assert.Len(t, requestID, 32)
+	assert.Equal(t, "host-1", agentID)
+}
+
+func TestSendToServerRejectsNonSuccessStatus(t *testing.T) {
+	logger, _ := l.NewZapLogger(zap.InfoLevel)
+	s := NewServices(&flags.Options{}, logger)
+	value := 1.0
+	metric := m.Metrics{ID: "Alloc", MType: m.TypeGauge, Value: &value}
+
+	for _, status := range []int{http.StatusUnauthorized, http.StatusRequestEntityTooLarge, http.StatusInternalServerError} {
+		t.Run(http.StatusText(status), func(t *testing.T) {
+			testServer := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+				rw.WriteHeader(status)
+			}))
+			defer testServer.Close()
+
+			err := s.SendToServerMetric(context.Background(), testServer.Client(), testServer.URL+"/update/", metric)
+			require.ErrorIs(t, err, ErrRejected)
+			assert.ErrorContains(t, err, fmt.Sprint(status))
+		})
+	}
+}
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS metrics_tenant_key_m_type_idx;
+
+ALTER TABLE metrics DROP COLUMN IF EXISTS tenant;
@@ -0,0 +1,3 @@
+ALTER TABLE metrics ADD COLUMN IF NOT EXISTS tenant text NOT NULL DEFAULT 'default';
+
+CREATE INDEX IF NOT EXISTS metrics_tenant_key_m_type_idx ON metrics (tenant, "key", m_type);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS metrics_tenant_key_m_type_key;
+
+CREATE INDEX IF NOT EXISTS metrics_tenant_key_m_type_idx ON metrics (tenant, "key", m_type);
@@ -0,0 +1,24 @@
+-- Конкурентные вставки без ограничения уникальности могли создать дубликаты.
+-- Перед созданием индекса они объединяются в последнюю запись:
+-- значения счетчика складываются, для gauge остается последнее значение.
+WITH duplicates AS (
+    SELECT tenant, "key", m_type, max(id) AS keep_id, sum(delta) AS total_delta
+    FROM metrics
+    GROUP BY tenant, "key", m_type
+    HAVING count(*) > 1
+)
+UPDATE metrics
+SET delta = duplicates.total_delta
+FROM duplicates
+WHERE metrics.id = duplicates.keep_id AND metrics.m_type = 'counter';
+
+DELETE FROM metrics
+USING metrics AS newer
+WHERE metrics.tenant = newer.tenant
+  AND metrics."key" = newer."key"
+  AND metrics.m_type = newer.m_type
+  AND metrics.id < newer.id;
+
+DROP INDEX IF EXISTS metrics_tenant_key_m_type_idx;
+
+CREATE UNIQUE INDEX IF NOT EXISTS metrics_tenant_key_m_type_key ON metrics (tenant, "key", m_type);
@@ -0,0 +1,10 @@
+// Package migrations содержит миграции схемы базы данных сервера,
+// встроенные в исполняемый файл.
+package migrations
+
+import "embed"
+
+// FS - файлы миграций в формате golang-migrate: NNNN_name.up.sql и NNNN_name.down.sql
+//
+//go:embed *.sql
+var FS embed.FS
@@ -0,0 +1,30 @@
+package migrations
+
+import (
+	"testing"
+
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFS(t *testing.T) {
+	source, err := iofs.New(FS, ".")
+	require.NoError(t, err)
+	defer source.Close()
+
+	var versions []uint
+	version, err := source.First()
+	for err == nil {
+		versions = append(versions, version)
+		version, err = source.Next(version)
+	}
+	assert.Equal(t, []uint{1, 2, 3}, versions)
+
+	// у каждой миграции есть отмена
+	for _, v := range versions {
+		down, _, err := source.ReadDown(v)
+		require.NoError(t, err, v)
+		_ = down.Close()
+	}
+}
@@ -7,13 +7,16 @@ import (
 
 	"github.com/golang-migrate/migrate/v4"
 	"github.com/golang-migrate/migrate/v4/database/pgx/v5"
-	_ "github.com/golang-migrate/migrate/v4/source/file"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
 
 	"github.com/jackc/pgx/v5/pgxpool"
 	"go.uber.org/zap"
 
 	flags "github.com/sanek1/metrics-collector/internal/flags/server"
+	"github.com/sanek1/metrics-collector/internal/health"
 	m "github.com/sanek1/metrics-collector/internal/models"
+	"github.com/sanek1/metrics-collector/internal/storage/migrations"
+	"github.com/sanek1/metrics-collector/internal/tenant"
 	l "github.com/sanek1/metrics-collector/pkg/logging"
 )
 
@@ -23,7 +26,9 @@ type DBStorage struct {
 }
 
 const (
-	selectAllMetricsQuery = "SELECT key, m_type, delta, value FROM metrics"
+	selectAllMetricsQuery     = "SELECT key, m_type, delta, value FROM metrics WHERE tenant = $1"
+	selectOrderedMetricsQuery = selectAllMetricsQuery + " ORDER BY m_type, key"
+	selectTenantsQuery        = "SELECT DISTINCT tenant FROM metrics ORDER BY tenant"
 )
 
 func NewDBStorage(opt *flags.ServerOptions, logger *l.ZapLogger) *DBStorage {
@@ -45,10 +50,9 @@ func (s *DBStorage) SetCounter(ctx context.Context, models ...m.Metrics) ([]*m.M
 	return s.SetMetrics(ctx, models...)
 }
 
-func (s *DBStorage) GetAllMetrics() []string {
+func (s *DBStorage) GetAllMetrics(ctx context.Context) []string {
 	var res []string
-	ctx := context.Background()
-	rows, err := s.conn.Query(ctx, selectAllMetricsQuery)
+	rows, err := s.conn.Query(ctx, selectAllMetricsQuery, tenant.FromContext(ctx))
 	if err != nil {
 		s.Logger.ErrorCtx(ctx, "failed to get all metrics from database", zap.Error(err))
 		return nil
@@ -82,6 +86,48 @@ func (s *DBStorage) GetMetrics(ctx context.Context, mType, id string) (*m.Metric
 	return model, true
 }
 
+// ListMetrics построчно читает метрики арендатора из базы данных и передает их fn.
+func (s *DBStorage) ListMetrics(ctx context.Context, fn func(m.Metrics) error) error {
+	rows, err := s.conn.Query(ctx, selectOrderedMetricsQuery, tenant.FromContext(ctx))
+	if err != nil {
+		s.Logger.ErrorCtx(ctx, "failed to list metrics from database", zap.Error(err))
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var metric m.Metrics
+		if err := rows.Scan(&metric.ID, &metric.MType, &metric.Delta, &metric.Value); err != nil {
+			s.Logger.ErrorCtx(ctx, "failed to scan metric from database", zap.Error(err))
+			return err
+		}
+		if err := fn(metric); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// Tenants возвращает упорядоченный список арендаторов, у которых есть метрики.
+func (s *DBStorage) Tenants(ctx context.Context) ([]string, error) {
+	rows, err := s.conn.Query(ctx, selectTenantsQuery)
+	if err != nil {
+		s.Logger.ErrorCtx(ctx, "failed to list tenants from database", zap.Error(err))
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tenants []string
+	for rows.Next() {
+		var t string
+		if err := rows.Scan(&t); err != nil {
+			return nil, err
+		}
+		tenants = append(tenants, t)
+	}
+	return tenants, rows.Err()
+}
+
 func (s *DBStorage) PingIsOk() bool {
 	if s.conn == nil {
 		return false
@@ -89,6 +135,51 @@ func (s *DBStorage) PingIsOk() bool {
 	return s.conn.Ping(context.Background()) == nil
 }
 
+// CheckHealth проверяет соединение с базой данных и сообщает статистику пула соединений.
+func (s *DBStorage) CheckHealth(ctx context.Context) health.Component {
+	if s.conn == nil {
+		return health.Component{Status: health.StatusDown, Error: "database connection is not established"}
+	}
+
+	stat := s.conn.Stat()
+	component := health.Component{
+		Status: health.StatusUp,
+		Details: map[string]interface{}{
+			"max_conns":              stat.MaxConns(),
+			"total_conns":            stat.TotalConns(),
+			"idle_conns":             stat.IdleConns(),
+			"acquired_conns":         stat.AcquiredConns(),
+			"constructing_conns":     stat.ConstructingConns(),
+			"acquire_count":          stat.AcquireCount(),
+			"empty_acquire_count":    stat.EmptyAcquireCount(),
+			"canceled_acquire_count": stat.CanceledAcquireCount(),
+			"acquire_duration_ms":    stat.AcquireDuration().Milliseconds(),
+		},
+	}
+	if err := s.conn.Ping(ctx); err != nil {
+		component.Status = health.StatusDown
+		component.Error = err.Error()
+	}
+	return component
+}
+
+// Close закрывает пул соединений с базой данных, дожидаясь возврата
+// выданных соединений. Повторный вызов безопасен.
+func (s *DBStorage) Close() error {
+	if s.conn != nil {
+		s.conn.Close()
+	}
+	return nil
+}
+
+// PoolStat возвращает статистику пула соединений или nil, если соединение не установлено.
+func (s *DBStorage) PoolStat() *pgxpool.Stat {
+	if s.conn == nil {
+		return nil
+	}
+	return s.conn.Stat()
+}
+
 func (s *DBStorage) EnsureMetricsTableExists(ctx context.Context) error {
 	var exists bool
 	err := s.conn.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM pg_catalog.pg_tables WHERE tablename = 'metrics')`).Scan(&exists)
@@ -97,29 +188,53 @@ func (s *DBStorage) EnsureMetricsTableExists(ctx context.Context) error {
 		return err
 	}
 
-	if !exists {
-		db, err := sql.Open("postgres", s.conn.Config().ConnString())
-		if err != nil {
-			s.Logger.ErrorCtx(ctx, "failed to acquire connection: %w", zap.Error(err))
-		}
-		driver, err := pgx.WithInstance(db, &pgx.Config{})
-		if err != nil {
-			s.Logger.ErrorCtx(ctx, "failed to create migration driver %w", zap.Error(err))
-		}
-
-		migration, err := migrate.NewWithDatabaseInstance(
-			"file:../../internal/storage/migrations",
-			"MetricStore",
-			driver,
-		)
-		if err != nil {
-			s.Logger.ErrorCtx(ctx, "failed to create migration instance %w", zap.Error(err))
-		}
+	migration, err := s.newMigration(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_, _ = migration.Close()
+	}()
 
-		if err := migration.Up(); err != nil && err != migrate.ErrNoChange {
-			return err
-		}
+	// миграции применяются и к существующей таблице, чтобы добавить новые колонки
+	if err := migration.Up(); err != nil && err != migrate.ErrNoChange {
+		return err
+	}
+	if !exists {
 		s.Logger.InfoCtx(ctx, "created Metrics table")
 	}
 	return nil
 }
+
+// newMigration подготавливает миграции схемы базы данных хранилища.
+// Соединение, открытое для миграций, закрывается вместе с ними.
+func (s *DBStorage) newMigration(ctx context.Context) (*migrate.Migrate, error) {
+	db, err := sql.Open("postgres", s.conn.Config().ConnString())
+	if err != nil {
+		s.Logger.ErrorCtx(ctx, "failed to acquire connection", zap.Error(err))
+		return nil, err
+	}
+
+	driver, err := pgx.WithInstance(db, &pgx.Config{})
+	if err != nil {
+		_ = db.Close()
+		s.Logger.ErrorCtx(ctx, "failed to create migration driver", zap.Error(err))
+		return nil, err
+	}
+
+	// миграции встроены в исполняемый файл и не зависят от рабочего каталога
+	source, err := iofs.New(migrations.FS, ".")
+	if err != nil {
+		_ = driver.Close()
+		s.Logger.ErrorCtx(ctx, "failed to open migrations", zap.Error(err))
+		return nil, err
+	}
+	migration, err := migrate.NewWithInstance("iofs", source, "MetricStore", driver)
+	if err != nil {
+		_ = source.Close()
+		_ = driver.Close()
+		s.Logger.ErrorCtx(ctx, "failed to create migration instance", zap.Error(err))
+		return nil, err
+	}
+	return migration, nil
+}
@@ -5,6 +5,7 @@ import (
 	"database/sql"
 	"encoding/json"
 	"fmt"
+	"slices"
 	"strings"
 
 	"github.com/jackc/pgx/v5"
@@ -14,10 +15,16 @@ import (
 
 	flags "github.com/sanek1/metrics-collector/internal/flags/server"
 	m "github.com/sanek1/metrics-collector/internal/models"
+	"github.com/sanek1/metrics-collector/internal/tenant"
 )
 
 func startDBConnection(ctx context.Context, opt *flags.ServerOptions) (*pgxpool.Pool, error) {
-	pool, err := pgxpool.New(ctx, opt.DBPath)
+	config, err := pgxpool.ParseConfig(opt.DBPath)
+	if err != nil {
+		return nil, err
+	}
+	config.ConnConfig.Tracer = queryTracer{}
+	pool, err := pgxpool.NewWithConfig(ctx, config)
 	if err != nil {
 		return nil, err
 	}
@@ -52,28 +59,6 @@ func FilterBatchesBeforeSaving(metrics []m.Metrics) []m.Metrics {
 	return result
 }
 
-func SortingBatchData(existingMetrics []*m.Metrics, metrics []m.Metrics) (updatingBatch, insertingBatch []m.Metrics) {
-	updatingBatch = make([]m.Metrics, 0, len(existingMetrics))
-	insertingBatch = make([]m.Metrics, 0, len(metrics)-len(existingMetrics))
-
-	for _, m := range metrics {
-		found := false
-		for _, r := range existingMetrics {
-			if m.ID == r.ID && m.MType == r.MType {
-				found = true
-				break
-			}
-		}
-
-		if found {
-			updatingBatch = append(updatingBatch, m)
-		} else {
-			insertingBatch = append(insertingBatch, m)
-		}
-	}
-	return updatingBatch, insertingBatch
-}
-
 func CollectorQuery(ctx context.Context, metrics []m.Metrics) (query string, mTypes []string, args []interface{}) {
 	mTypes = make([]string, 0, len(metrics))
 	keys := make([]string, 0, len(metrics))
@@ -85,59 +70,84 @@ func CollectorQuery(ctx context.Context, metrics []m.Metrics) (query string, mTy
 	query = `
 	SELECT key, m_type, delta, value
 	FROM metrics
-	WHERE m_type = ANY($1) AND key = ANY($2)
+	WHERE m_type = ANY($1) AND key = ANY($2) AND tenant = $3
   `
-	args = []interface{}{pq.Array(mTypes), pq.Array(keys)}
+	args = []interface{}{pq.Array(mTypes), pq.Array(keys), tenant.FromContext(ctx)}
 	return query, mTypes, args
 }
 
-func (s *DBStorage) UpdateMetrics(ctx context.Context, models []m.Metrics) error {
-	batch := &pgx.Batch{}
-	for _, model := range models {
-		if model.MType == m.TypeCounter {
-			batch.Queue("UPDATE metrics SET delta=delta+$1 WHERE m_type=$2 AND key=$3", model.Delta, model.MType, model.ID)
-		} else if model.MType == m.TypeGauge {
-			batch.Queue("UPDATE metrics SET value=$1 WHERE m_type=$2 AND key=$3", model.Value, model.MType, model.ID)
+// upsertMetricQuery вставляет метрику или обновляет существующую: значение
+// счетчика увеличивается на переданное, значение gauge заменяется.
+const upsertMetricQuery = `
+	INSERT INTO metrics (tenant, key, m_type, delta, value)
+	VALUES ($1, $2, $3, $4, $5)
+	ON CONFLICT (tenant, key, m_type) DO UPDATE
+	SET delta = CASE WHEN metrics.m_type = 'counter'
+			THEN COALESCE(metrics.delta, 0) + EXCLUDED.delta
+			ELSE EXCLUDED.delta END,
+		value = EXCLUDED.value
+	RETURNING key, m_type, delta, value
+`
+
+// UpsertMetrics записывает метрики одним пакетом запросов в одной транзакции
+// и возвращает их значения после записи. Метрики записываются в порядке
+// типа и имени, чтобы конкурентные транзакции блокировали строки
+// в одинаковом порядке и не приводили к взаимной блокировке.
+func (s *DBStorage) UpsertMetrics(ctx context.Context, models []m.Metrics) ([]*m.Metrics, error) {
+	models = slices.Clone(models)
+	sortMetrics(models)
+
+	t := tenant.FromContext(ctx)
+	results := make([]*m.Metrics, 0, len(models))
+	err := pgx.BeginFunc(ctx, s.conn, func(tx pgx.Tx) error {
+		batch := &pgx.Batch{}
+		for _, model := range models {
+			batch.Queue(upsertMetricQuery, t, model.ID, model.MType, model.Delta, model.Value)
 		}
-	}
 
-	br := s.conn.SendBatch(ctx, batch)
-	defer func() {
-		_ = br.Close()
-	}()
-
-	var err error
-	if _, err = br.Exec(); err != nil {
-		s.Logger.ErrorCtx(ctx, "failed to execute batch request:  %w"+err.Error(), zap.Error(err))
-	}
-	return err
-}
-func (s *DBStorage) InsertMetric(ctx context.Context, models []m.Metrics) error {
-	conn, err := s.conn.Acquire(ctx)
+		br := tx.SendBatch(ctx, batch)
+		for range models {
+			metric, err := scanMetric(br.QueryRow())
+			if err != nil {
+				_ = br.Close()
+				return err
+			}
+			results = append(results, metric)
+		}
+		return br.Close()
+	})
 	if err != nil {
-		return fmt.Errorf("failed to acquire connection: %w", err)
+		s.Logger.ErrorCtx(ctx, "failed to upsert metrics", zap.Error(err))
+		return nil, fmt.Errorf("upsert metrics: %w", err)
 	}
+	return results, nil
+}
 
-	defer conn.Release()
+// sortMetrics упорядочивает метрики по типу и имени.
+func sortMetrics(models []m.Metrics) {
+	slices.SortFunc(models, func(a, b m.Metrics) int {
+		if c := strings.Compare(a.MType, b.MType); c != 0 {
+			return c
+		}
+		return strings.Compare(a.ID, b.ID)
+	})
+}
 
-	batch := &pgx.Batch{}
-	for _, model := range models {
-		batch.Queue("INSERT INTO metrics (key, m_type, value, delta) VALUES ($1, $2, $3, $4)", model.ID, model.MType, model.Value, model.Delta)
+// scanMetric читает метрику из строки с колонками key, m_type, delta, value.
+func scanMetric(row pgx.Row) (*m.Metrics, error) {
+	metric := new(m.Metrics)
+	var delta sql.NullInt64
+	var value sql.NullFloat64
+	if err := row.Scan(&metric.ID, &metric.MType, &delta, &value); err != nil {
+		return nil, err
 	}
-
-	br := s.conn.SendBatch(ctx, batch)
-	defer func() {
-		_ = br.Close()
-	}()
-
-	for i := 0; i < batch.Len(); i++ {
-		_, err := br.Exec()
-		if err != nil {
-			s.Logger.ErrorCtx(ctx, "failed to execute batch request - "+err.Error(), zap.Error(err))
-			return fmt.Errorf("failed to execute batch request: %w", err)
-		}
+	if delta.Valid {
+		metric.Delta = &delta.Int64
+	}
+	if value.Valid {
+		metric.Value = &value.Float64
 	}
-	return nil
+	return metric, nil
 }
 
 func (s *DBStorage) GetMetricsOnDBs(ctx context.Context, metrics ...m.Metrics) ([]*m.Metrics, error) {
@@ -155,58 +165,18 @@ func (s *DBStorage) GetMetricsOnDBs(ctx context.Context, metrics ...m.Metrics) (
 
 	results := make([]*m.Metrics, 0, len(mTypes))
 	for rows.Next() {
-		metric := new(m.Metrics)
-		var delta sql.NullInt64
-		var value sql.NullFloat64
-
-		if err := rows.Scan(&metric.ID, &metric.MType, &delta, &value); err != nil {
+		metric, err := scanMetric(rows)
+		if err != nil {
 			s.Logger.ErrorCtx(ctx, "Failed to scan row", zap.Error(err))
 			continue
 		}
-
-		if delta.Valid {
-			metric.Delta = new(int64)
-			*metric.Delta = delta.Int64
-		} else {
-			metric.Delta = nil
-		}
-
-		if value.Valid {
-			metric.Value = new(float64)
-			*metric.Value = value.Float64
-		} else {
-			metric.Value = nil
-		}
 		results = append(results, metric)
 	}
 	return results, nil
 }
 
+// SetMetrics объединяет обновления одной метрики и записывает метрики
+// в базу данных одной транзакцией.
 func (s *DBStorage) SetMetrics(ctx context.Context, models ...m.Metrics) ([]*m.Metrics, error) {
-	models = FilterBatchesBeforeSaving(models)
-
-	existingMetrics, err := s.GetMetricsOnDBs(ctx, models...)
-	if err != nil {
-		return nil, err
-	}
-	updatingBatch, insertingBatch := SortingBatchData(existingMetrics, models)
-
-	if len(updatingBatch) != 0 {
-		if err = s.UpdateMetrics(ctx, updatingBatch); err != nil {
-			s.Logger.ErrorCtx(ctx, "failed to update metric", zap.Error(err))
-			return nil, err
-		}
-	}
-	if len(insertingBatch) != 0 {
-		if err = s.InsertMetric(ctx, insertingBatch); err != nil {
-			s.Logger.ErrorCtx(ctx, "failed to insert metric", zap.Error(err))
-			return nil, err
-		}
-	}
-
-	metrics, err := s.GetMetricsOnDBs(ctx, models...)
-	if err != nil {
-		return nil, err
-	}
-	return metrics, nil
+	return s.UpsertMetrics(ctx, FilterBatchesBeforeSaving(models))
 }
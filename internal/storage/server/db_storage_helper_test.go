@@ -2,6 +2,7 @@ package storage
 
 import (
 	"context"
+	"sync"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -10,6 +11,7 @@ import (
 
 	"github.com/sanek1/metrics-collector/internal/models"
 	"github.com/sanek1/metrics-collector/internal/storage/server/mocks"
+	"github.com/sanek1/metrics-collector/internal/tenant"
 )
 
 func TestFilterBatchesBeforeSaving(t *testing.T) {
@@ -54,28 +56,53 @@ func Test_GetMetricsOnDBs(t *testing.T) {
 	})
 }
 
-func TestStorageHelper_InsertUpdateMetrics(t *testing.T) {
-	mockStorage := mocks.NewStorageHelper(t)
+func TestDBStorage_UpsertMetrics(t *testing.T) {
+	s := testDBStorage(t)
 	ctx := context.Background()
-	metrics := []models.Metrics{
-		{ID: "test1", MType: "gauge"},
+	require.NoError(t, s.EnsureMetricsTableExists(ctx))
+
+	result, err := s.SetMetrics(ctx,
+		models.Metrics{ID: "hits", MType: "counter", Delta: ptr(int64(2))},
+		models.Metrics{ID: "load", MType: "gauge", Value: ptr(1.5)},
+		models.Metrics{ID: "hits", MType: "counter", Delta: ptr(int64(3))},
+	)
+	require.NoError(t, err)
+	require.Len(t, result, 2)
+	assert.Equal(t, int64(5), *result[0].Delta, "counters of one batch are summed")
+	assert.Equal(t, 1.5, *result[1].Value)
+
+	result, err = s.SetMetrics(ctx,
+		models.Metrics{ID: "hits", MType: "counter", Delta: ptr(int64(4))},
+		models.Metrics{ID: "load", MType: "gauge", Value: ptr(7.0)},
+	)
+	require.NoError(t, err)
+	assert.Equal(t, int64(9), *result[0].Delta, "counter is added to the stored value")
+	assert.Equal(t, 7.0, *result[1].Value, "gauge replaces the stored value")
+
+	// метрика с тем же именем у другого арендатора хранится отдельно
+	_, err = s.SetMetrics(tenant.WithTenant(ctx, "acme"), models.Metrics{ID: "hits", MType: "counter", Delta: ptr(int64(1))})
+	require.NoError(t, err)
+	got, ok := s.GetMetrics(ctx, "counter", "hits")
+	require.True(t, ok)
+	assert.Equal(t, int64(9), *got.Delta)
+
+	// конкурентные вставки новой метрики не создают дубликатов
+	const writers = 10
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := s.SetMetrics(ctx, models.Metrics{ID: "new", MType: "counter", Delta: ptr(int64(1))})
+			assert.NoError(t, err)
+		}()
 	}
-
-	t.Run("insert metrics", func(t *testing.T) {
-		mockStorage.On("InsertMetric", ctx, metrics).Return(nil).Once()
-
-		err := mockStorage.InsertMetric(ctx, metrics)
-		assert.NoError(t, err)
-		mockStorage.AssertExpectations(t)
-	})
-
-	t.Run("update metrics", func(t *testing.T) {
-		mockStorage.On("UpdateMetrics", ctx, metrics).Return(nil).Once()
-
-		err := mockStorage.UpdateMetrics(ctx, metrics)
-		assert.NoError(t, err)
-		mockStorage.AssertExpectations(t)
-	})
+	wg.Wait()
+	var rows int
+	require.NoError(t, s.conn.QueryRow(ctx, "SELECT count(*) FROM metrics WHERE key = 'new'").Scan(&rows))
+	assert.Equal(t, 1, rows)
+	got, _ = s.GetMetrics(ctx, "counter", "new")
+	assert.Equal(t, int64(writers), *got.Delta)
 }
 
 func TestStorageHelper_SetMetrics(t *testing.T) {
@@ -101,28 +128,21 @@ func TestStorageHelper_SetMetrics(t *testing.T) {
 	})
 }
 
-func TestStorageHelper_SortingBatchData(t *testing.T) {
-	mockStorage := mocks.NewStorageHelper(t)
-
-	existing := []*models.Metrics{
-		{ID: "test1", MType: "counter"},
-	}
-	input := []models.Metrics{
-		{ID: "test1", MType: "counter"},
-		{ID: "test2", MType: "gauge"},
+func TestSortMetrics(t *testing.T) {
+	metrics := []models.Metrics{
+		{ID: "b", MType: "gauge"},
+		{ID: "b", MType: "counter"},
+		{ID: "a", MType: "gauge"},
+		{ID: "a", MType: "counter"},
 	}
 
-	t.Run("sort metrics", func(t *testing.T) {
-		expectedUpdates := []models.Metrics{{ID: "test1", MType: "counter"}}
-		expectedInserts := []models.Metrics{{ID: "test2", MType: "gauge"}}
-
-		mockStorage.On("SortingBatchData", existing, input).Return(expectedUpdates, expectedInserts).Once()
-
-		updates, inserts := mockStorage.SortingBatchData(existing, input)
-		assert.Equal(t, expectedUpdates, updates)
-		assert.Equal(t, expectedInserts, inserts)
-		mockStorage.AssertExpectations(t)
-	})
+	sortMetrics(metrics)
+	assert.Equal(t, []models.Metrics{
+		{ID: "a", MType: "counter"},
+		{ID: "b", MType: "counter"},
+		{ID: "a", MType: "gauge"},
+		{ID: "b", MType: "gauge"},
+	}, metrics)
 }
 
 func TestStorageHelper_CollectorQuery(t *testing.T) {
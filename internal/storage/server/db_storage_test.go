@@ -3,15 +3,104 @@ package storage
 import (
 	"context"
 	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"go.uber.org/zap"
 
+	flags "github.com/sanek1/metrics-collector/internal/flags/server"
+	"github.com/sanek1/metrics-collector/internal/health"
 	m "github.com/sanek1/metrics-collector/internal/models"
+	"github.com/sanek1/metrics-collector/internal/tenant"
 	l "github.com/sanek1/metrics-collector/pkg/logging"
 )
 
+// testDBStorage подключается к PostgreSQL из DATABASE_DSN в отдельной схеме,
+// которая удаляется после теста. Без DATABASE_DSN тест пропускается.
+// Миграции не применяются.
+func testDBStorage(t *testing.T) *DBStorage {
+	t.Helper()
+	dsn := os.Getenv("DATABASE_DSN")
+	if dsn == "" {
+		t.Skip("DATABASE_DSN is not set")
+	}
+
+	ctx := context.Background()
+	admin, err := pgxpool.New(ctx, dsn)
+	require.NoError(t, err)
+	t.Cleanup(admin.Close)
+	schema := fmt.Sprintf("metrics_test_%d", time.Now().UnixNano())
+	_, err = admin.Exec(ctx, "CREATE SCHEMA "+schema)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_, _ = admin.Exec(context.Background(), "DROP SCHEMA "+schema+" CASCADE")
+	})
+
+	logger, err := l.NewZapLogger(zap.WarnLevel)
+	require.NoError(t, err)
+	s := NewDBStorage(&flags.ServerOptions{DBPath: withSearchPath(t, dsn, schema), UseDatabase: true}, logger)
+	require.True(t, s.PingIsOk())
+	t.Cleanup(func() { _ = s.Close() })
+	return s
+}
+
+// withSearchPath добавляет в строку подключения схему по умолчанию.
+func withSearchPath(t *testing.T, dsn, schema string) string {
+	if !strings.HasPrefix(dsn, "postgres://") && !strings.HasPrefix(dsn, "postgresql://") {
+		return dsn + " search_path=" + schema
+	}
+	u, err := url.Parse(dsn)
+	require.NoError(t, err)
+	q := u.Query()
+	q.Set("search_path", schema)
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+func TestDBStorage_MigrationMergesDuplicates(t *testing.T) {
+	s := testDBStorage(t)
+	ctx := context.Background()
+
+	migration, err := s.newMigration(ctx)
+	require.NoError(t, err)
+	require.NoError(t, migration.Migrate(2))
+	_, _ = migration.Close()
+
+	// до уникального индекса конкурентные вставки могли создать дубликаты
+	_, err = s.conn.Exec(ctx, `INSERT INTO metrics (tenant, key, m_type, delta, value) VALUES
+		('default', 'hits', 'counter', 2, NULL),
+		('default', 'hits', 'counter', 3, NULL),
+		('default', 'load', 'gauge', NULL, 1.5),
+		('default', 'load', 'gauge', NULL, 2.5),
+		('acme', 'hits', 'counter', 7, NULL)`)
+	require.NoError(t, err)
+
+	require.NoError(t, s.EnsureMetricsTableExists(ctx))
+
+	var rows int
+	require.NoError(t, s.conn.QueryRow(ctx, "SELECT count(*) FROM metrics").Scan(&rows))
+	assert.Equal(t, 3, rows)
+	got, ok := s.GetMetrics(ctx, m.TypeCounter, "hits")
+	require.True(t, ok)
+	assert.Equal(t, int64(5), *got.Delta, "duplicate counters are summed")
+	got, ok = s.GetMetrics(ctx, m.TypeGauge, "load")
+	require.True(t, ok)
+	assert.Equal(t, 2.5, *got.Value, "the latest gauge value is kept")
+	got, ok = s.GetMetrics(tenant.WithTenant(ctx, "acme"), m.TypeCounter, "hits")
+	require.True(t, ok)
+	assert.Equal(t, int64(7), *got.Delta)
+
+	_, err = s.conn.Exec(ctx, `INSERT INTO metrics (tenant, key, m_type, delta) VALUES ('default', 'hits', 'counter', 1)`)
+	assert.Error(t, err, "unique index rejects duplicates")
+}
+
 type MockDBStorage struct {
 	*DBStorage
 	PingError       error
@@ -40,7 +129,7 @@ func (m *MockDBStorage) GetMetrics(ctx context.Context, mType, id string) (*m.Me
 	return metric, ok || m.GetMetricsFound
 }
 
-func (m *MockDBStorage) GetAllMetrics() []string {
+func (m *MockDBStorage) GetAllMetrics(ctx context.Context) []string {
 	return m.AllMetrics
 }
 
@@ -64,6 +153,15 @@ func TestDBStorage_PingIsOk(t *testing.T) {
 	})
 }
 
+func TestDBStorage_CheckHealthWithoutConnection(t *testing.T) {
+	logger, _ := l.NewZapLogger(zap.InfoLevel)
+	s := &DBStorage{Logger: logger}
+
+	component := s.CheckHealth(context.Background())
+	assert.Equal(t, health.StatusDown, component.Status)
+	assert.NotEmpty(t, component.Error)
+}
+
 func TestMockDBStorage_GetMetrics(t *testing.T) {
 	logger, _ := l.NewZapLogger(zap.InfoLevel)
 	mockStorage := NewMockDBStorage(logger)
@@ -110,14 +208,14 @@ func TestMockDBStorage_GetAllMetrics(t *testing.T) {
 
 	// Check the empty list of metrics
 	t.Run("EmptyList", func(t *testing.T) {
-		result := mockStorage.GetAllMetrics()
+		result := mockStorage.GetAllMetrics(context.Background())
 		assert.Empty(t, result)
 	})
 
 	// Check the non-empty list of metrics
 	t.Run("NonEmptyList", func(t *testing.T) {
 		mockStorage.AllMetrics = []string{"gauge:metric1", "counter:metric2"}
-		result := mockStorage.GetAllMetrics()
+		result := mockStorage.GetAllMetrics(context.Background())
 		assert.Len(t, result, 2)
 		assert.Contains(t, result, "gauge:metric1")
 		assert.Contains(t, result, "counter:metric2")
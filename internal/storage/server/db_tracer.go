@@ -0,0 +1,78 @@
+package storage
+
+import (
+	"context"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/sanek1/metrics-collector/internal/tracing"
+)
+
+// queryTracer создает спан OpenTelemetry для каждого запроса и пакета запросов
+// к базе данных, выполненного через пул соединений DBStorage.
+type queryTracer struct{}
+
+type querySpanKey struct{}
+
+var (
+	_ pgx.QueryTracer = queryTracer{}
+	_ pgx.BatchTracer = queryTracer{}
+)
+
+func (queryTracer) TraceQueryStart(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	ctx, span := tracing.Start(ctx, "db."+queryOperation(data.SQL),
+		semconv.DBSystemPostgreSQL,
+		semconv.DBQueryText(data.SQL),
+	)
+	return context.WithValue(ctx, querySpanKey{}, span)
+}
+
+func (queryTracer) TraceQueryEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryEndData) {
+	span, ok := ctx.Value(querySpanKey{}).(trace.Span)
+	if !ok {
+		return
+	}
+	span.SetAttributes(attribute.Int64("db.rows_affected", data.CommandTag.RowsAffected()))
+	tracing.End(span, data.Err)
+}
+
+func (queryTracer) TraceBatchStart(ctx context.Context, _ *pgx.Conn, data pgx.TraceBatchStartData) context.Context {
+	ctx, span := tracing.Start(ctx, "db.batch",
+		semconv.DBSystemPostgreSQL,
+		attribute.Int("db.batch.size", data.Batch.Len()),
+	)
+	return context.WithValue(ctx, querySpanKey{}, span)
+}
+
+func (queryTracer) TraceBatchQuery(ctx context.Context, _ *pgx.Conn, data pgx.TraceBatchQueryData) {
+	span, ok := ctx.Value(querySpanKey{}).(trace.Span)
+	if !ok {
+		return
+	}
+	attrs := []attribute.KeyValue{semconv.DBQueryText(data.SQL)}
+	if data.Err != nil {
+		attrs = append(attrs, attribute.String("error", data.Err.Error()))
+	}
+	span.AddEvent("query", trace.WithAttributes(attrs...))
+}
+
+func (queryTracer) TraceBatchEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceBatchEndData) {
+	span, ok := ctx.Value(querySpanKey{}).(trace.Span)
+	if !ok {
+		return
+	}
+	tracing.End(span, data.Err)
+}
+
+// queryOperation возвращает первое слово запроса в нижнем регистре: select, insert, update.
+func queryOperation(sql string) string {
+	fields := strings.Fields(sql)
+	if len(fields) == 0 {
+		return "query"
+	}
+	return strings.ToLower(fields[0])
+}
@@ -0,0 +1,41 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestQueryTracer(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+
+	tracer := queryTracer{}
+	ctx := tracer.TraceQueryStart(context.Background(), nil, pgx.TraceQueryStartData{SQL: "  SELECT id FROM metrics"})
+	tracer.TraceQueryEnd(ctx, nil, pgx.TraceQueryEndData{CommandTag: pgconn.NewCommandTag("SELECT 3")})
+
+	batch := &pgx.Batch{}
+	batch.Queue("UPDATE metrics SET value = $1")
+	ctx = tracer.TraceBatchStart(context.Background(), nil, pgx.TraceBatchStartData{Batch: batch})
+	tracer.TraceBatchQuery(ctx, nil, pgx.TraceBatchQueryData{SQL: "UPDATE metrics SET value = $1"})
+	tracer.TraceBatchEnd(ctx, nil, pgx.TraceBatchEndData{Err: errors.New("deadlock detected")})
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 2)
+	assert.Equal(t, "db.select", spans[0].Name())
+	assert.Equal(t, codes.Unset, spans[0].Status().Code)
+	assert.Equal(t, "db.batch", spans[1].Name())
+	assert.Equal(t, codes.Error, spans[1].Status().Code)
+	require.Len(t, spans[1].Events(), 2, "batch query event and recorded error")
+}
@@ -3,28 +3,259 @@ package storage
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
 	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/sanek1/metrics-collector/internal/health"
+	m "github.com/sanek1/metrics-collector/internal/models"
+	"github.com/sanek1/metrics-collector/internal/tenant"
 )
 
-func (ms *MetricsStorage) SaveToFile(fname string) error {
-	// serialize to json
-	data, err := json.MarshalIndent(ms.Metrics, "", "   ")
-	if err != nil {
-		return err
+// backupStaleIntervals - через сколько интервалов сохранения без успешного
+// сохранения резервная копия считается устаревшей
+const backupStaleIntervals = 3
+
+// syncRotateInterval - при синхронном сохранении предыдущие резервные копии
+// сдвигаются не чаще этого интервала. Иначе копии отличались бы одним
+// обновлением, а каждое обновление требовало бы переименования всех копий.
+const syncRotateInterval = time.Minute
+
+// backupState - результат последнего сохранения метрик в файл
+type backupState struct {
+	mu           sync.Mutex
+	path         string
+	interval     time.Duration
+	lastAttempt  time.Time
+	lastSuccess  time.Time
+	lastDuration time.Duration
+	lastErr      error
+	// wal - журнал упреждающей записи, который ведется вместе с резервной копией
+	wal *writeAheadLog
+	// keep - число хранимых предыдущих резервных копий
+	keep int
+	// lastRotation - время последнего сдвига предыдущих копий
+	lastRotation time.Time
+	// seqs - номера последних записей журнала, вошедших в текущую копию
+	// и в предыдущие копии filename.1, filename.2 и так далее
+	seqs []uint64
+	// files сериализует запись и ротацию файлов резервной копии
+	files sync.Mutex
+	// observer получает длительность и результат каждого сохранения
+	observer func(duration time.Duration, err error)
+	// intervals передает PeriodicallySaveBackUp новый интервал сохранения
+	intervals chan time.Duration
+}
+
+// retain запоминает номер записи журнала новой копии и возвращает номер,
+// до которого журнал можно сжать: записи нужны, пока цела самая старая копия.
+// Номера копий, оставшихся от прежнего запуска, неизвестны, поэтому до их
+// замены журнал не сжимается. Вызывается под b.mu.
+func (b *backupState) retain(seq uint64, rotate bool) uint64 {
+	if rotate || len(b.seqs) == 0 {
+		b.seqs = slices.Insert(b.seqs, 0, seq)
+	} else {
+		b.seqs[0] = seq
+	}
+	if len(b.seqs) > b.keep+1 {
+		b.seqs = b.seqs[:b.keep+1]
+	}
+	if len(b.seqs) <= b.keep {
+		return 0
+	}
+	return slices.Min(b.seqs)
+}
+
+// intervalUpdates возвращает канал новых интервалов сохранения. Вызывается под b.mu.
+func (b *backupState) intervalUpdates() chan time.Duration {
+	if b.intervals == nil {
+		b.intervals = make(chan time.Duration, 1)
 	}
-	// save to file
-	err = os.WriteFile(fname, data, fileMode)
+	return b.intervals
+}
+
+// backupVersion - текущая версия формата файла резервной копии.
+// Версия 1 - объект, ключами которого служат имена метрик (с префиксом
+// арендатора "tenant/"), поэтому метрики разных типов с одинаковым именем
+// в нем не различались. Начиная с версии 2 файл содержит список записей,
+// с версии 3 - контрольную сумму.
+const backupVersion = 3
+
+// backupFile - содержимое файла резервной копии
+type backupFile struct {
+	Version int `json:"version"`
+	// Checksum - контрольная сумма backupPayload, начиная с версии 3
+	Checksum string `json:"checksum,omitempty"`
+	backupPayload
+}
+
+// backupPayload - данные резервной копии, защищенные контрольной суммой
+type backupPayload struct {
+	// WALSeq - номер последней записи журнала упреждающей записи,
+	// учтенной в резервной копии
+	WALSeq  uint64         `json:"wal_seq,omitempty"`
+	Metrics []backupRecord `json:"metrics"`
+}
+
+// checksum возвращает контрольную сумму данных в виде "sha256:<hex>".
+// Сумма считается по компактному JSON, поэтому не зависит от форматирования файла.
+func (p backupPayload) checksum() (string, error) {
+	data, err := json.Marshal(p)
 	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:]), nil
+}
+
+// backupRecord - метрика в файле резервной копии.
+// Арендатор по умолчанию не записывается.
+type backupRecord struct {
+	Tenant string `json:"tenant,omitempty"`
+	m.Metrics
+}
+
+// newBackupRecord возвращает запись с копией метрики арендатора t.
+func newBackupRecord(t string, metric m.Metrics) backupRecord {
+	record := backupRecord{Metrics: copyMetric(metric)}
+	if t != tenant.Default {
+		record.Tenant = t
+	}
+	return record
+}
+
+// key возвращает ключ метрики записи в хранилище.
+func (r backupRecord) key() MetricKey {
+	t := r.Tenant
+	if t == "" {
+		t = tenant.Default
+	}
+	return Key(t, r.MType, r.ID)
+}
+
+func (ms *MetricsStorage) SaveToFile(fname string) error {
+	if _, _, err := ms.saveSnapshot(fname, true); err != nil {
 		return err
 	}
 	fmt.Printf("Data saved to file: %s\n", fname)
 	return nil
 }
 
+// saveSnapshot сохраняет резервную копию и возвращает номер записи журнала
+// упреждающей записи, до которого журнал можно сжать. При rotate прежняя
+// копия сохраняется как fname.1, иначе она заменяется.
+//
+// Если обновления подтверждает журнал, в копию входят только записанные в него
+// обновления, а номер записи в копии предшествует первому ожидающему: при
+// восстановлении они применяются из журнала, если запись удалась. При
+// синхронном сохранении обновления подтверждает сама копия.
+// walFailure - ошибка журнала, все обновления которой отменены к моменту
+// снимка: после сохранения ее можно сбросить при сжатии журнала.
+func (ms *MetricsStorage) saveSnapshot(fname string, rotate bool) (upTo uint64, walFailure error, err error) {
+	ms.backup.files.Lock()
+	defer ms.backup.files.Unlock()
+
+	ms.mtx.RLock()
+	confirmedOnly := ms.saver == nil
+	backup := backupFile{Version: backupVersion}
+	backup.WALSeq = ms.walSeq
+	if confirmedOnly {
+		backup.WALSeq = ms.durableSeq()
+	}
+	backup.Metrics = make([]backupRecord, 0, len(ms.Metrics))
+	for key, metric := range ms.Metrics {
+		if confirmedOnly {
+			var ok bool
+			if metric, ok = ms.confirmedMetric(key, metric); !ok {
+				continue
+			}
+		}
+		backup.Metrics = append(backup.Metrics, newBackupRecord(key.Tenant, metric))
+	}
+	if ms.wal != nil && len(ms.pending) == 0 {
+		walFailure = ms.wal.Err()
+	}
+	ms.mtx.RUnlock()
+
+	sort.Slice(backup.Metrics, func(i, j int) bool {
+		a, b := backup.Metrics[i], backup.Metrics[j]
+		if a.Tenant != b.Tenant {
+			return a.Tenant < b.Tenant
+		}
+		if a.MType != b.MType {
+			return a.MType < b.MType
+		}
+		return a.ID < b.ID
+	})
+
+	checksum, err := backup.checksum()
+	if err != nil {
+		return 0, nil, err
+	}
+	backup.Checksum = checksum
+
+	// serialize to json
+	data, err := json.MarshalIndent(backup, "", "   ")
+	if err != nil {
+		return 0, nil, err
+	}
+
+	ms.backup.mu.Lock()
+	keep := ms.backup.keep
+	ms.backup.mu.Unlock()
+
+	// save to file: прежняя копия становится fname.1 непосредственно перед
+	// заменой, поэтому при сбое остается хотя бы одна целая копия
+	var before func() error
+	if rotate {
+		before = func() error { return rotateBackups(fname, keep) }
+	}
+	if err := writeFileAtomic(fname, data, before); err != nil {
+		return 0, nil, err
+	}
+	ms.backup.mu.Lock()
+	defer ms.backup.mu.Unlock()
+	if rotate {
+		ms.backup.lastRotation = time.Now()
+	}
+	return ms.backup.retain(backup.WALSeq, rotate), walFailure, nil
+}
+
+// LoadFromFile загружает метрики из резервной копии filename. Если копия
+// повреждена или отсутствует, используется самая новая из целых предыдущих
+// копий filename.1, filename.2 и так далее.
 func (ms *MetricsStorage) LoadFromFile(filename string) error {
+	var errs []error
+	for _, name := range backupCandidates(filename) {
+		err := ms.loadSnapshot(name)
+		if err == nil {
+			if len(errs) > 0 {
+				ms.Logger.WarnCtx(context.Background(), "Backup is damaged, loaded a previous copy",
+					zap.String("backup", filename),
+					zap.String("loaded", name),
+					zap.Int("skipped", len(errs)),
+					zap.Error(errors.Join(errs...)))
+			}
+			return nil
+		}
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// loadSnapshot загружает метрики из одного файла резервной копии.
+// Метрики применяются, только если файл прочитан и проверен целиком.
+func (ms *MetricsStorage) loadSnapshot(filename string) error {
 	content, err := os.ReadFile(filename)
 	if err != nil {
 		if os.IsNotExist(err) {
@@ -33,44 +264,389 @@ func (ms *MetricsStorage) LoadFromFile(filename string) error {
 		return fmt.Errorf("file read error: %v", err)
 	}
 
-	err = json.Unmarshal(content, &ms.Metrics)
+	metrics, walSeq, err := decodeBackup(content)
 	if err != nil {
-		return fmt.Errorf("data unmarshalling error: %v", err)
+		return fmt.Errorf("%s: data unmarshalling error: %v", filename, err)
+	}
+
+	ms.mtx.Lock()
+	for key, metric := range metrics {
+		ms.Metrics[key] = metric
 	}
+	ms.walSeq = max(ms.walSeq, walSeq)
+	ms.mtx.Unlock()
 
 	fmt.Println("Previous metric values have been loaded.")
 	return nil
 }
 
+// decodeBackup разбирает файл резервной копии любой поддерживаемой версии
+// и возвращает метрики и номер последней учтенной записи журнала.
+// Файл версии 1 не содержит поля version с числовым значением.
+func decodeBackup(content []byte) (map[MetricKey]m.Metrics, uint64, error) {
+	var header map[string]json.RawMessage
+	if err := json.Unmarshal(content, &header); err != nil {
+		return nil, 0, err
+	}
+	var version int
+	if raw, ok := header["version"]; !ok || json.Unmarshal(raw, &version) != nil {
+		metrics, err := decodeBackupV1(content)
+		return metrics, 0, err
+	}
+	if version != 2 && version != backupVersion {
+		return nil, 0, fmt.Errorf("unsupported backup version %d", version)
+	}
+
+	var backup backupFile
+	if err := json.Unmarshal(content, &backup); err != nil {
+		return nil, 0, err
+	}
+	// версия 2 не содержит контрольной суммы
+	if version >= 3 {
+		checksum, err := backup.checksum()
+		if err != nil {
+			return nil, 0, err
+		}
+		if backup.Checksum != checksum {
+			return nil, 0, errors.New("backup checksum mismatch")
+		}
+	}
+	metrics := make(map[MetricKey]m.Metrics, len(backup.Metrics))
+	for _, record := range backup.Metrics {
+		metrics[record.key()] = record.Metrics
+	}
+	return metrics, backup.WALSeq, nil
+}
+
+// decodeBackupV1 разбирает файл версии 1: ключ "tenant/id" или "id"
+// для арендатора по умолчанию. Тип метрики берется из ее значения.
+func decodeBackupV1(content []byte) (map[MetricKey]m.Metrics, error) {
+	var legacy map[string]m.Metrics
+	if err := json.Unmarshal(content, &legacy); err != nil {
+		return nil, err
+	}
+	metrics := make(map[MetricKey]m.Metrics, len(legacy))
+	for name, metric := range legacy {
+		t := tenant.Default
+		if prefix, ok := strings.CutSuffix(name, "/"+metric.ID); ok && prefix != "" {
+			t = prefix
+		}
+		metrics[Key(t, metric.MType, metric.ID)] = metric
+	}
+	return metrics, nil
+}
+
+// PeriodicallySaveBackUp сохраняет метрики в файл filename каждые interval.
+// Между сохранениями каждое изменение записывается в журнал упреждающей записи
+// filename+".wal", который сжимается после каждого успешного сохранения.
+// Интервал не больше syncSaveMaxInterval включает синхронное сохранение:
+// обновление завершается после записи файла, а журнал не ведется.
+// При restore метрики восстанавливаются из файла и записей журнала после него.
 func (ms *MetricsStorage) PeriodicallySaveBackUp(ctx context.Context, filename string, restore bool, interval time.Duration) {
-	ticker := time.NewTicker(interval)
+	// таймер запускается только для периодического сохранения
+	ticker := time.NewTicker(time.Hour)
+	ticker.Stop()
 	defer ticker.Stop()
 
+	ms.backup.mu.Lock()
+	ms.backup.path, ms.backup.interval = filename, interval
+	updates := ms.backup.intervalUpdates()
+	ms.backup.mu.Unlock()
+
+	walPath := filename + walSuffix
+	walSize := int64(-1)
 	if restore {
 		err := ms.LoadFromFile(filename)
 		if err != nil {
 			ms.Logger.ErrorCtx(ctx, "Error loading metrics from file")
 		}
+		if walSize, err = ms.replayWAL(walPath); err != nil {
+			ms.Logger.ErrorCtx(ctx, "Error replaying write-ahead log: "+err.Error())
+		}
+	} else if err := os.Remove(walPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		ms.Logger.ErrorCtx(ctx, "Error removing write-ahead log: "+err.Error())
 	}
-	err := ms.SaveToFile(filename)
-	if err != nil {
-		ms.Logger.ErrorCtx(ctx, "Error saving metrics to file: "+err.Error())
+
+	defer ms.detachSaver(ctx)
+	defer ms.detachWAL(ctx)
+	synchronous := synchronousSave(interval)
+	if synchronous {
+		ms.startSyncSave(ctx, filename, interval)
 	} else {
-		ms.Logger.InfoCtx(ctx, "saving to file was successful")
+		ms.startPeriodicSave(ctx, filename, walSize)
+		ticker.Reset(interval)
 	}
 
 	for {
 		select {
 		case <-ticker.C:
-			err := ms.SaveToFile(filename)
-			if err != nil {
-				ms.Logger.ErrorCtx(ctx, "Error saving metrics to file: "+err.Error())
-			} else {
-				ms.Logger.InfoCtx(ctx, "saving to file was successful")
+			_ = ms.saveBackUp(ctx, filename)
+		case d := <-updates:
+			switch {
+			case synchronousSave(d) && synchronous:
+				ms.mtx.RLock()
+				ms.saver.setWindow(d)
+				ms.mtx.RUnlock()
+			case synchronousSave(d):
+				ticker.Stop()
+				ms.detachWAL(ctx)
+				ms.startSyncSave(ctx, filename, d)
+			case synchronous:
+				ms.detachSaver(ctx)
+				ms.startPeriodicSave(ctx, filename, -1)
+				ticker.Reset(d)
+			default:
+				ticker.Reset(d)
 			}
+			synchronous = synchronousSave(d)
+			ms.Logger.InfoCtx(ctx, "Backup interval changed", zap.Duration("interval", d), zap.Bool("synchronous", synchronous))
 		case <-ctx.Done():
 			ms.Logger.InfoCtx(ctx, "Backup process stopped.")
 			return
 		}
 	}
 }
+
+// startPeriodicSave включает журнал упреждающей записи и сохраняет резервную
+// копию, которая становится началом журнала. walSize - размер корректной
+// части существующего журнала или -1, чтобы дописывать журнал целиком.
+func (ms *MetricsStorage) startPeriodicSave(ctx context.Context, filename string, walSize int64) {
+	wal, err := openWAL(filename+walSuffix, walSize)
+	if err != nil {
+		ms.Logger.ErrorCtx(ctx, "Error opening write-ahead log: "+err.Error())
+	} else {
+		ms.attachWAL(wal)
+	}
+	_ = ms.saveBackUp(ctx, filename)
+}
+
+// startSyncSave включает синхронное сохранение с промежутком window между
+// сохранениями. Журнал упреждающей записи удаляется после того, как его
+// записи вошли в резервную копию.
+func (ms *MetricsStorage) startSyncSave(ctx context.Context, filename string, window time.Duration) {
+	saver := newSyncSaver(window, func() error { return ms.saveBackUp(ctx, filename) })
+	ms.mtx.Lock()
+	ms.saver = saver
+	ms.mtx.Unlock()
+
+	if ms.saveBackUp(ctx, filename) != nil {
+		return
+	}
+	if err := os.Remove(filename + walSuffix); err != nil && !errors.Is(err, os.ErrNotExist) {
+		ms.Logger.ErrorCtx(ctx, "Error removing write-ahead log: "+err.Error())
+	}
+}
+
+// detachSaver отключает синхронное сохранение, выполнив последнее сохранение.
+func (ms *MetricsStorage) detachSaver(ctx context.Context) {
+	ms.mtx.Lock()
+	saver := ms.saver
+	ms.saver = nil
+	ms.mtx.Unlock()
+
+	if saver == nil {
+		return
+	}
+	if err := saver.close(); err != nil {
+		ms.Logger.ErrorCtx(ctx, "Error saving metrics to file: "+err.Error())
+	}
+}
+
+// RestoreFromFile восстанавливает метрики так же, как сервер при запуске:
+// из резервной копии filename и записей журнала упреждающей записи после нее.
+// Отсутствие резервной копии ошибкой не считается.
+func (ms *MetricsStorage) RestoreFromFile(filename string) error {
+	if err := ms.LoadFromFile(filename); err != nil && !missingBackup(filename) {
+		return err
+	}
+	_, err := ms.replayWAL(filename + walSuffix)
+	return err
+}
+
+// replayWAL применяет записи журнала, не вошедшие в загруженную резервную копию,
+// и возвращает размер корректной части журнала. Если журнала нет, возвращает -1.
+func (ms *MetricsStorage) replayWAL(path string) (int64, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return -1, nil
+	}
+	if err != nil {
+		return -1, err
+	}
+	defer f.Close()
+
+	ms.mtx.Lock()
+	defer ms.mtx.Unlock()
+	return scanWAL(f, func(_ []byte, record walRecord) error {
+		if record.Seq <= ms.walSeq {
+			return nil
+		}
+		ms.Metrics[record.key()] = record.Metrics
+		ms.walSeq = record.Seq
+		return nil
+	})
+}
+
+// attachWAL включает запись изменений в журнал wal.
+func (ms *MetricsStorage) attachWAL(wal *writeAheadLog) {
+	ms.mtx.Lock()
+	ms.wal = wal
+	ms.mtx.Unlock()
+
+	ms.backup.mu.Lock()
+	ms.backup.wal = wal
+	ms.backup.mu.Unlock()
+}
+
+// detachWAL отключает и закрывает журнал, накопленные записи сбрасываются на диск.
+func (ms *MetricsStorage) detachWAL(ctx context.Context) {
+	ms.mtx.Lock()
+	wal := ms.wal
+	ms.wal = nil
+	ms.mtx.Unlock()
+
+	ms.backup.mu.Lock()
+	ms.backup.wal = nil
+	ms.backup.mu.Unlock()
+
+	if wal == nil {
+		return
+	}
+	if err := wal.Close(); err != nil {
+		ms.Logger.ErrorCtx(ctx, "Error closing write-ahead log: "+err.Error())
+	}
+}
+
+// saveBackUp сохраняет метрики в файл и запоминает результат для проверки готовности.
+// После успешного сохранения из журнала удаляются записи, вошедшие во все
+// хранимые копии: при загрузке предыдущей копии журнал восполнит обновления.
+// Периодическое сохранение сдвигает предыдущие копии каждый раз, а синхронное -
+// не чаще syncRotateInterval.
+func (ms *MetricsStorage) saveBackUp(ctx context.Context, filename string) error {
+	start := time.Now()
+	ms.backup.mu.Lock()
+	rotate := !synchronousSave(ms.backup.interval) || start.Sub(ms.backup.lastRotation) >= syncRotateInterval
+	ms.backup.mu.Unlock()
+
+	seq, walFailure, err := ms.saveSnapshot(filename, rotate)
+	if err != nil {
+		ms.Logger.ErrorCtx(ctx, "Error saving metrics to file: "+err.Error())
+	} else {
+		// при синхронном сохранении запись в журнал выполняется на каждое обновление
+		ms.Logger.DebugCtx(ctx, "saving to file was successful")
+	}
+
+	ms.backup.mu.Lock()
+	wal := ms.backup.wal
+	ms.backup.mu.Unlock()
+	if err == nil && wal != nil {
+		if err = wal.compact(seq, walFailure); err != nil {
+			ms.Logger.ErrorCtx(ctx, "Error compacting write-ahead log: "+err.Error())
+		}
+	}
+
+	duration := time.Since(start)
+
+	ms.backup.mu.Lock()
+	ms.backup.lastAttempt = start
+	ms.backup.lastDuration = duration
+	ms.backup.lastErr = err
+	if err == nil {
+		ms.backup.lastSuccess = start
+	}
+	observer := ms.backup.observer
+	ms.backup.mu.Unlock()
+
+	if observer != nil {
+		observer(duration, err)
+	}
+	return err
+}
+
+// SetBackupRetention задает число хранимых предыдущих резервных копий
+// filename.1 ... filename.keep. Отрицательное значение игнорируется.
+func (ms *MetricsStorage) SetBackupRetention(keep int) {
+	if keep < 0 {
+		return
+	}
+	ms.backup.mu.Lock()
+	defer ms.backup.mu.Unlock()
+	ms.backup.keep = keep
+}
+
+// SetBackupInterval изменяет интервал периодического сохранения метрик в файл
+// без перезапуска. Интервал не больше syncSaveMaxInterval включает синхронное
+// сохранение. Отрицательный интервал игнорируется.
+func (ms *MetricsStorage) SetBackupInterval(interval time.Duration) {
+	if interval < 0 {
+		return
+	}
+	ms.backup.mu.Lock()
+	ms.backup.interval = interval
+	updates := ms.backup.intervalUpdates()
+	ms.backup.mu.Unlock()
+
+	// в канале остается только последний интервал
+	select {
+	case <-updates:
+	default:
+	}
+	select {
+	case updates <- interval:
+	default:
+	}
+}
+
+// ObserveBackups задает функцию, которой сообщается длительность и результат
+// каждого сохранения метрик в файл.
+func (ms *MetricsStorage) ObserveBackups(fn func(duration time.Duration, err error)) {
+	ms.backup.mu.Lock()
+	defer ms.backup.mu.Unlock()
+	ms.backup.observer = fn
+}
+
+// CheckBackup сообщает состояние периодического сохранения метрик в файл.
+// До первого сохранения (в том числе пока идет восстановление) компонент запускается.
+// Компонент неисправен, если последнее сохранение завершилось ошибкой
+// или успешного сохранения не было дольше backupStaleIntervals интервалов.
+// При синхронном сохранении файл записывается только при обновлениях,
+// поэтому давность сохранения не проверяется.
+func (ms *MetricsStorage) CheckBackup(context.Context) health.Component {
+	ms.backup.mu.Lock()
+	defer ms.backup.mu.Unlock()
+
+	b := &ms.backup
+	if b.lastAttempt.IsZero() {
+		return health.Component{Status: health.StatusStarting}
+	}
+
+	component := health.Component{
+		Status: health.StatusUp,
+		Details: map[string]interface{}{
+			"path":             b.path,
+			"interval":         b.interval.String(),
+			"synchronous":      synchronousSave(b.interval),
+			"last_attempt":     b.lastAttempt,
+			"last_duration_ms": b.lastDuration.Milliseconds(),
+		},
+	}
+	if !b.lastSuccess.IsZero() {
+		component.Details["last_success"] = b.lastSuccess
+	}
+	var walErr error
+	if b.wal != nil {
+		walErr = b.wal.Err()
+	}
+	switch {
+	case b.lastErr != nil:
+		component.Status = health.StatusDown
+		component.Error = b.lastErr.Error()
+	case walErr != nil:
+		component.Status = health.StatusDown
+		component.Error = walErr.Error()
+	case !synchronousSave(b.interval) && time.Since(b.lastSuccess) > backupStaleIntervals*b.interval:
+		component.Status = health.StatusDown
+		component.Error = "no successful backup since " + b.lastSuccess.Format(time.RFC3339)
+	}
+	return component
+}
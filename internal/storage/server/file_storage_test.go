@@ -5,11 +5,14 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/sanek1/metrics-collector/internal/health"
 	"github.com/sanek1/metrics-collector/internal/models"
 	"github.com/sanek1/metrics-collector/internal/storage/server/mocks"
+	"github.com/sanek1/metrics-collector/internal/tenant"
 	"github.com/sanek1/metrics-collector/pkg/logging"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
@@ -150,9 +153,9 @@ func TestSaveAndLoadFromFile(t *testing.T) {
 	t.Run("LoadFromFile", func(t *testing.T) {
 		newStorage := NewMetricsStorage(logger)
 
-		newStorage.Metrics = map[string]models.Metrics{
-			"test_gauge":   gaugeMetric,
-			"test_counter": counterMetric,
+		newStorage.Metrics = map[MetricKey]models.Metrics{
+			Key(tenant.Default, "gauge", "test_gauge"):     gaugeMetric,
+			Key(tenant.Default, "counter", "test_counter"): counterMetric,
 		}
 
 		err := mockFileStorage.LoadFromFile(testFile)
@@ -263,3 +266,106 @@ func TestPeriodicallySaveBackUp_WithFileStorage(t *testing.T) {
 	require.NotNil(t, c.Delta, "Значение метрики counter не должно быть nil")
 	assert.Equal(t, counterValue, *c.Delta)
 }
+
+func TestMetricsStorage_CheckBackup(t *testing.T) {
+	logger, _ := logging.NewZapLogger(zap.InfoLevel)
+	ctx := context.Background()
+
+	t.Run("starting before first save", func(t *testing.T) {
+		storage := NewMetricsStorage(logger)
+		assert.Equal(t, health.StatusStarting, storage.CheckBackup(ctx).Status)
+	})
+
+	t.Run("up after successful save", func(t *testing.T) {
+		storage := NewMetricsStorage(logger)
+		storage.backup.interval = time.Minute
+		storage.saveBackUp(ctx, filepath.Join(t.TempDir(), "metrics.json"))
+
+		component := storage.CheckBackup(ctx)
+		assert.Equal(t, health.StatusUp, component.Status)
+		assert.Contains(t, component.Details, "last_success")
+	})
+
+	t.Run("down after failed save", func(t *testing.T) {
+		storage := NewMetricsStorage(logger)
+		storage.saveBackUp(ctx, filepath.Join(t.TempDir(), "missing", "metrics.json"))
+
+		component := storage.CheckBackup(ctx)
+		assert.Equal(t, health.StatusDown, component.Status)
+		assert.NotEmpty(t, component.Error)
+		assert.NotContains(t, component.Details, "last_success")
+	})
+
+	t.Run("down when backup is stale", func(t *testing.T) {
+		storage := NewMetricsStorage(logger)
+		storage.backup.interval = time.Minute
+		storage.backup.lastAttempt = time.Now().Add(-time.Hour)
+		storage.backup.lastSuccess = storage.backup.lastAttempt
+
+		component := storage.CheckBackup(ctx)
+		assert.Equal(t, health.StatusDown, component.Status)
+		assert.Contains(t, component.Error, "no successful backup")
+	})
+}
+
+func TestMetricsStorage_ObserveBackups(t *testing.T) {
+	logger, _ := logging.NewZapLogger(zap.InfoLevel)
+	storage := NewMetricsStorage(logger)
+
+	var errs []error
+	storage.ObserveBackups(func(duration time.Duration, err error) {
+		assert.GreaterOrEqual(t, duration, time.Duration(0))
+		errs = append(errs, err)
+	})
+	storage.saveBackUp(context.Background(), filepath.Join(t.TempDir(), "metrics.json"))
+	storage.saveBackUp(context.Background(), filepath.Join(t.TempDir(), "missing", "metrics.json"))
+
+	require.Len(t, errs, 2)
+	assert.NoError(t, errs[0])
+	assert.Error(t, errs[1])
+}
+
+func TestMetricsStorage_SetBackupInterval(t *testing.T) {
+	logger, _ := logging.NewZapLogger(zap.InfoLevel)
+	storage := NewMetricsStorage(logger)
+
+	var (
+		mu    sync.Mutex
+		saves int
+	)
+	storage.ObserveBackups(func(time.Duration, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		saves++
+	})
+	count := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return saves
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		storage.PeriodicallySaveBackUp(ctx, filepath.Join(t.TempDir(), "metrics.json"), false, time.Hour)
+	}()
+	require.Eventually(t, func() bool { return count() == 1 }, time.Second, 5*time.Millisecond)
+
+	storage.SetBackupInterval(-time.Second)
+	storage.SetBackupInterval(20 * time.Millisecond)
+	require.Eventually(t, func() bool {
+		return storage.CheckBackup(ctx).Details["interval"] == "20ms"
+	}, time.Second, 5*time.Millisecond)
+
+	// короткий интервал включает синхронное сохранение при каждом обновлении
+	require.Eventually(t, func() bool { return count() == 2 }, time.Second, 5*time.Millisecond)
+	value := 1.0
+	_, err := storage.SetGauge(ctx, models.Metrics{ID: "load", MType: models.TypeGauge, Value: &value})
+	require.NoError(t, err)
+	assert.Equal(t, 3, count(), "update must return after the backup is saved")
+	assert.Equal(t, true, storage.CheckBackup(ctx).Details["synchronous"])
+
+	cancel()
+	<-done
+}
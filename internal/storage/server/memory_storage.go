@@ -4,11 +4,15 @@ package storage
 import (
 	"context"
 	"fmt"
+	"maps"
+	"slices"
+	"sort"
 	"strconv"
 	"sync"
 
 	"github.com/sanek1/metrics-collector/internal/config"
 	m "github.com/sanek1/metrics-collector/internal/models"
+	"github.com/sanek1/metrics-collector/internal/tenant"
 	l "github.com/sanek1/metrics-collector/pkg/logging"
 )
 
@@ -16,90 +20,157 @@ const (
 	fileMode = 0600
 )
 
+// MetricKey - ключ метрики в хранилище: арендатор, тип и имя.
+// Метрики разных типов с одинаковым именем хранятся независимо.
+type MetricKey struct {
+	Tenant string
+	MType  string
+	ID     string
+}
+
+// Key возвращает ключ метрики арендатора t.
+func Key(t, mType, id string) MetricKey {
+	return MetricKey{Tenant: t, MType: mType, ID: id}
+}
+
 type MetricsStorage struct {
 	mtx     sync.RWMutex
-	Metrics map[string]m.Metrics
+	Metrics map[MetricKey]m.Metrics
 	Logger  *l.ZapLogger
 	Errors  []string
+	backup  backupState
+	// wal - журнал упреждающей записи, nil если журнал не ведется.
+	// walSeq - номер последней записи журнала, учтенной в Metrics.
+	wal    *writeAheadLog
+	walSeq uint64
+	// saver - синхронное сохранение резервной копии, nil если копия
+	// сохраняется периодически
+	saver *syncSaver
+	// pending - обновления, ожидающие записи на диск, по метрикам
+	// в порядке применения, см. rollback
+	pending map[MetricKey][]*pendingUpdate
 }
 
 func NewMetricsStorage(logger *l.ZapLogger) *MetricsStorage {
 	return &MetricsStorage{
-		Metrics: make(map[string]m.Metrics),
+		Metrics: make(map[MetricKey]m.Metrics),
 		Logger:  logger,
 	}
 }
 
+// SetGauge сохраняет метрики. Пакет может содержать метрики обоих типов:
+// каждая метрика обновляется по правилам своего типа, см. set.
 func (ms *MetricsStorage) SetGauge(ctx context.Context, models ...m.Metrics) ([]*m.Metrics, error) {
+	return ms.setMetrics(ctx, models)
+}
+
+// SetCounter сохраняет метрики, увеличивая значения счетчиков.
+func (ms *MetricsStorage) SetCounter(ctx context.Context, models ...m.Metrics) ([]*m.Metrics, error) {
+	return ms.setMetrics(ctx, models)
+}
+
+// setMetrics обновляет метрики и, если ведется журнал упреждающей записи или
+// включено синхронное сохранение, возвращает результат только после записи
+// изменений на диск. Если запись не удалась, обновления отменяются:
+// ошибка означает, что ни одно из них не применено.
+// Ожидание записи идет без блокировки хранилища, что позволяет
+// объединять в один сброс на диск изменения из конкурентных запросов.
+func (ms *MetricsStorage) setMetrics(ctx context.Context, models []m.Metrics) ([]*m.Metrics, error) {
+	t := tenant.FromContext(ctx)
 	ms.mtx.Lock()
-	defer ms.mtx.Unlock()
+	wal, saver := ms.wal, ms.saver
+	if wal != nil {
+		// после ошибки сброса журнал не принимает записи до его сжатия
+		if err := wal.Err(); err != nil {
+			ms.mtx.Unlock()
+			return nil, err
+		}
+	}
 
+	durable := wal != nil || saver != nil
 	results := make([]*m.Metrics, len(models))
-	errors := make([]error, len(models))
-
+	updates := make([]*pendingUpdate, 0, len(models))
 	for i, model := range models {
 		ms.SetLog(ctx, &model)
-		ms.Metrics[model.ID] = m.Metrics{ID: model.ID, MType: model.MType, Value: model.Value}
-		res := ms.Metrics[model.ID]
+		update := ms.set(t, model)
+		res := copyMetric(update.stored)
 		results[i] = &res
-		errors[i] = nil
+		updates = append(updates, update)
 	}
+	if !durable {
+		ms.mtx.Unlock()
+		return results, nil
+	}
+	ms.track(updates...)
 
-	hasErrors := false
-	for _, err := range errors {
-		if err != nil {
-			hasErrors = true
-			break
+	var batch *walBatch
+	if wal != nil {
+		records := make([]walRecord, len(results))
+		for i, res := range results {
+			ms.walSeq++
+			updates[i].seq = ms.walSeq
+			records[i] = walRecord{Seq: ms.walSeq, backupRecord: newBackupRecord(t, *res)}
 		}
+		batch = wal.write(records)
 	}
+	ms.mtx.Unlock()
 
-	if hasErrors {
-		return results, fmt.Errorf("errors: %v", errors)
+	var err error
+	if wal != nil {
+		err = wal.wait(batch)
+	}
+	if saver != nil {
+		err = saver.wait()
 	}
-	return results, nil
-}
 
-func (ms *MetricsStorage) SetCounter(ctx context.Context, models ...m.Metrics) ([]*m.Metrics, error) {
 	ms.mtx.Lock()
 	defer ms.mtx.Unlock()
-
-	results := make([]*m.Metrics, len(models))
-	errors := make([]error, len(models))
-
-	for i, model := range models {
-		ms.SetLog(ctx, &model)
-		metric, exists := ms.Metrics[model.ID]
-		if exists && metric.Delta != nil {
-			*metric.Delta += *model.Delta
-		} else {
-			metric = m.Metrics{
-				ID:    model.ID,
-				MType: model.MType,
-				Delta: model.Delta,
-			}
-		}
-		ms.Metrics[model.ID] = metric
-		results[i] = &metric
+	if err != nil {
+		ms.rollback(updates)
+		return nil, err
 	}
+	ms.confirm(updates)
+	return results, nil
+}
 
-	hasErrors := false
-	for _, err := range errors {
-		if err != nil {
-			hasErrors = true
-			break
-		}
+// set обновляет метрику арендатора t и возвращает сведения об обновлении
+// с новым значением метрики в поле stored. Значение счетчика увеличивается
+// на Delta, значение gauge заменяется. Новое значение всегда размещается
+// заново, чтобы отмена обновления могла отличить его от более поздних.
+// Вызывается под ms.mtx.
+func (ms *MetricsStorage) set(t string, model m.Metrics) *pendingUpdate {
+	key := Key(t, model.MType, model.ID)
+	prev, existed := ms.Metrics[key]
+	update := &pendingUpdate{key: key, prev: prev, existed: existed}
+	if model.MType != config.Counter {
+		update.stored = copyMetric(m.Metrics{ID: model.ID, MType: model.MType, Value: model.Value})
+		ms.Metrics[key] = update.stored
+		return update
 	}
 
-	if hasErrors {
-		return results, fmt.Errorf("errors: %v", errors)
+	metric := copyMetric(m.Metrics{ID: model.ID, MType: model.MType, Delta: model.Delta})
+	if metric.Delta != nil {
+		update.delta = *metric.Delta
+		if existed && prev.Delta != nil {
+			*metric.Delta += *prev.Delta
+		}
 	}
-
-	return results, nil
+	update.stored = metric
+	ms.Metrics[key] = metric
+	return update
 }
 
-func (ms *MetricsStorage) GetAllMetrics() []string {
+func (ms *MetricsStorage) GetAllMetrics(ctx context.Context) []string {
+	ms.mtx.RLock()
+	defer ms.mtx.RUnlock()
+
+	t := tenant.FromContext(ctx)
 	result := make([]string, 0, len(ms.Metrics))
-	for id, metric := range ms.Metrics {
+	for key, metric := range ms.Metrics {
+		if key.Tenant != t {
+			continue
+		}
+		id := metric.ID
 		var value string
 		if metric.MType == config.Counter && metric.Delta != nil {
 			if *metric.Delta != 0 {
@@ -117,10 +188,72 @@ func (ms *MetricsStorage) GetAllMetrics() []string {
 	return result
 }
 
-func (ms *MetricsStorage) GetMetrics(ctx context.Context, key, metricName string) (*m.Metrics, bool) {
-	metric, ok := ms.Metrics[metricName]
+// GetMetrics возвращает метрику арендатора по типу и имени.
+func (ms *MetricsStorage) GetMetrics(ctx context.Context, metricType, metricName string) (*m.Metrics, bool) {
+	ms.mtx.RLock()
+	defer ms.mtx.RUnlock()
+
+	metric, ok := ms.Metrics[Key(tenant.FromContext(ctx), metricType, metricName)]
 	if !ok {
 		return nil, false
 	}
+	metric = copyMetric(metric)
 	return &metric, true
 }
+
+// ListMetrics передает fn копии метрик арендатора, упорядоченные по типу и имени.
+// fn вызывается без удержания блокировки хранилища.
+func (ms *MetricsStorage) ListMetrics(ctx context.Context, fn func(m.Metrics) error) error {
+	t := tenant.FromContext(ctx)
+
+	ms.mtx.RLock()
+	metrics := make([]m.Metrics, 0, len(ms.Metrics))
+	for key, metric := range ms.Metrics {
+		if key.Tenant != t {
+			continue
+		}
+		metrics = append(metrics, copyMetric(metric))
+	}
+	ms.mtx.RUnlock()
+
+	sort.Slice(metrics, func(i, j int) bool {
+		if metrics[i].MType != metrics[j].MType {
+			return metrics[i].MType < metrics[j].MType
+		}
+		return metrics[i].ID < metrics[j].ID
+	})
+	for _, metric := range metrics {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := fn(metric); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// copyMetric копирует метрику вместе со значениями, на которые ссылаются указатели,
+// так как отмена обновления изменяет значение счетчика на месте.
+func copyMetric(metric m.Metrics) m.Metrics {
+	if metric.Delta != nil {
+		delta := *metric.Delta
+		metric.Delta = &delta
+	}
+	if metric.Value != nil {
+		value := *metric.Value
+		metric.Value = &value
+	}
+	return metric
+}
+
+// Tenants возвращает упорядоченный список арендаторов, у которых есть метрики.
+func (ms *MetricsStorage) Tenants(context.Context) ([]string, error) {
+	ms.mtx.RLock()
+	seen := make(map[string]struct{})
+	for key := range ms.Metrics {
+		seen[key.Tenant] = struct{}{}
+	}
+	ms.mtx.RUnlock()
+	return slices.Sorted(maps.Keys(seen)), nil
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -14,6 +15,7 @@ import (
 
 	"github.com/sanek1/metrics-collector/internal/config"
 	m "github.com/sanek1/metrics-collector/internal/models"
+	"github.com/sanek1/metrics-collector/internal/tenant"
 	l "github.com/sanek1/metrics-collector/pkg/logging"
 )
 
@@ -101,12 +103,12 @@ func TestGetAllMetrics(t *testing.T) {
 	storage := NewMetricsStorage(nil)
 	gaugeVal := 123.45
 	counterVal := int64(42)
-	storage.Metrics = map[string]m.Metrics{
-		"gauge1":   {ID: "gauge1", MType: config.Gauge, Value: &gaugeVal},
-		"counter1": {ID: "counter1", MType: config.Counter, Delta: &counterVal},
+	storage.Metrics = map[MetricKey]m.Metrics{
+		Key(tenant.Default, config.Gauge, "gauge1"):     {ID: "gauge1", MType: config.Gauge, Value: &gaugeVal},
+		Key(tenant.Default, config.Counter, "counter1"): {ID: "counter1", MType: config.Counter, Delta: &counterVal},
 	}
 
-	result := storage.GetAllMetrics()
+	result := storage.GetAllMetrics(context.Background())
 	expected := []string{
 		"counter1: 42",
 		"gauge1: 123.45",
@@ -118,20 +120,117 @@ func TestGetAllMetrics(t *testing.T) {
 func TestGetMetrics(t *testing.T) {
 	storage := NewMetricsStorage(nil)
 	gaugeVal := 99.9
-	storage.Metrics["test"] = m.Metrics{ID: "test", MType: config.Gauge, Value: &gaugeVal}
+	storage.Metrics[Key(tenant.Default, config.Gauge, "test")] = m.Metrics{ID: "test", MType: config.Gauge, Value: &gaugeVal}
 
 	t.Run("existing metric", func(t *testing.T) {
-		metric, ok := storage.GetMetrics(context.Background(), "", "test")
+		metric, ok := storage.GetMetrics(context.Background(), config.Gauge, "test")
 		require.True(t, ok)
 		assert.Equal(t, 99.9, *metric.Value)
 	})
 
 	t.Run("non-existent metric", func(t *testing.T) {
-		_, ok := storage.GetMetrics(context.Background(), "", "unknown")
+		_, ok := storage.GetMetrics(context.Background(), config.Gauge, "unknown")
+		assert.False(t, ok)
+	})
+
+	t.Run("other type", func(t *testing.T) {
+		_, ok := storage.GetMetrics(context.Background(), config.Counter, "test")
 		assert.False(t, ok)
 	})
 }
 
+func TestMetricsStorage_TenantIsolation(t *testing.T) {
+	logger, _ := l.NewZapLogger(zap.InfoLevel)
+	storage := NewMetricsStorage(logger)
+
+	ctxA := tenant.WithTenant(context.Background(), "team-a")
+	ctxB := tenant.WithTenant(context.Background(), "team-b")
+
+	valA, valB := 1.5, 2.5
+	_, err := storage.SetGauge(ctxA, m.Metrics{ID: "cpu", MType: config.Gauge, Value: &valA})
+	require.NoError(t, err)
+	_, err = storage.SetGauge(ctxB, m.Metrics{ID: "cpu", MType: config.Gauge, Value: &valB})
+	require.NoError(t, err)
+
+	deltaA, deltaB := int64(3), int64(7)
+	_, err = storage.SetCounter(ctxA, m.Metrics{ID: "requests", MType: config.Counter, Delta: &deltaA})
+	require.NoError(t, err)
+	_, err = storage.SetCounter(ctxB, m.Metrics{ID: "requests", MType: config.Counter, Delta: &deltaB})
+	require.NoError(t, err)
+
+	t.Run("reads stay inside tenant", func(t *testing.T) {
+		metric, ok := storage.GetMetrics(ctxA, config.Gauge, "cpu")
+		require.True(t, ok)
+		assert.Equal(t, valA, *metric.Value)
+
+		metric, ok = storage.GetMetrics(ctxB, config.Counter, "requests")
+		require.True(t, ok)
+		assert.Equal(t, deltaB, *metric.Delta)
+
+		_, ok = storage.GetMetrics(context.Background(), config.Gauge, "cpu")
+		assert.False(t, ok)
+	})
+
+	t.Run("listing stays inside tenant", func(t *testing.T) {
+		assert.ElementsMatch(t, []string{"cpu: 1.5", "requests: 3"}, storage.GetAllMetrics(ctxA))
+		assert.ElementsMatch(t, []string{"cpu: 2.5", "requests: 7"}, storage.GetAllMetrics(ctxB))
+		assert.Empty(t, storage.GetAllMetrics(context.Background()))
+	})
+
+	t.Run("tenants survive backup", func(t *testing.T) {
+		fname := t.TempDir() + "/metrics.json"
+		require.NoError(t, storage.SaveToFile(fname))
+
+		restored := NewMetricsStorage(logger)
+		require.NoError(t, restored.LoadFromFile(fname))
+
+		metric, ok := restored.GetMetrics(ctxB, config.Gauge, "cpu")
+		require.True(t, ok)
+		assert.Equal(t, valB, *metric.Value)
+	})
+}
+
+func TestMetricsStorage_ListMetrics(t *testing.T) {
+	logger, _ := l.NewZapLogger(zap.InfoLevel)
+	storage := NewMetricsStorage(logger)
+	ctx := context.Background()
+
+	v1, v2 := 2.5, 1.5
+	delta := int64(4)
+	_, err := storage.SetGauge(ctx, m.Metrics{ID: "b", MType: config.Gauge, Value: &v1}, m.Metrics{ID: "a", MType: config.Gauge, Value: &v2})
+	require.NoError(t, err)
+	_, err = storage.SetCounter(ctx, m.Metrics{ID: "c", MType: config.Counter, Delta: &delta})
+	require.NoError(t, err)
+	_, err = storage.SetGauge(tenant.WithTenant(ctx, "other"), m.Metrics{ID: "x", MType: config.Gauge, Value: &v1})
+	require.NoError(t, err)
+
+	var listed []m.Metrics
+	require.NoError(t, storage.ListMetrics(ctx, func(metric m.Metrics) error {
+		listed = append(listed, metric)
+		return nil
+	}))
+	require.Len(t, listed, 3)
+	assert.Equal(t, []string{"c", "a", "b"}, []string{listed[0].ID, listed[1].ID, listed[2].ID})
+
+	t.Run("returns copies", func(t *testing.T) {
+		more := int64(1)
+		_, err := storage.SetCounter(ctx, m.Metrics{ID: "c", MType: config.Counter, Delta: &more})
+		require.NoError(t, err)
+		assert.Equal(t, int64(4), *listed[0].Delta)
+	})
+
+	t.Run("stops on error", func(t *testing.T) {
+		stop := fmt.Errorf("stop")
+		calls := 0
+		err := storage.ListMetrics(ctx, func(m.Metrics) error {
+			calls++
+			return stop
+		})
+		assert.ErrorIs(t, err, stop)
+		assert.Equal(t, 1, calls)
+	})
+}
+
 func TestMetricsStorage_SaveToFile(t *testing.T) {
 	logger, _ := l.NewZapLogger(zap.InfoLevel)
 	ms := NewMetricsStorage(logger)
@@ -165,21 +264,22 @@ func TestMetricsStorage_SaveToFile(t *testing.T) {
 		require.NoError(t, err)
 		assert.NotEmpty(t, data)
 
-		var metrics map[string]m.Metrics
-		err = json.Unmarshal(data, &metrics)
+		var backup backupFile
+		err = json.Unmarshal(data, &backup)
 		require.NoError(t, err)
 
-		assert.Len(t, metrics, 2)
-
-		gauge, ok := metrics["gauge1"]
-		assert.True(t, ok)
-		assert.Equal(t, "gauge", gauge.MType)
-		assert.Equal(t, gaugeValue, *gauge.Value)
+		assert.Equal(t, backupVersion, backup.Version)
+		require.Len(t, backup.Metrics, 2)
 
-		counter, ok := metrics["counter1"]
-		assert.True(t, ok)
+		counter := backup.Metrics[0]
+		assert.Equal(t, "counter1", counter.ID)
 		assert.Equal(t, "counter", counter.MType)
 		assert.Equal(t, counterValue, *counter.Delta)
+
+		gauge := backup.Metrics[1]
+		assert.Equal(t, "gauge1", gauge.ID)
+		assert.Equal(t, "gauge", gauge.MType)
+		assert.Equal(t, gaugeValue, *gauge.Value)
 	})
 
 	t.Run("LoadFromFile", func(t *testing.T) {
@@ -252,11 +352,10 @@ func TestPeriodicallySaveBackUp(t *testing.T) {
 	require.NoError(t, err)
 	assert.NotEmpty(t, data)
 
-	var metrics map[string]m.Metrics
-	err = json.Unmarshal(data, &metrics)
+	metrics, _, err := decodeBackup(data)
 	require.NoError(t, err)
 
-	gauge, ok := metrics["test_gauge"]
+	gauge, ok := metrics[Key(tenant.Default, "gauge", "test_gauge")]
 	assert.True(t, ok)
 	assert.Equal(t, "gauge", gauge.MType)
 	assert.Equal(t, gaugeValue, *gauge.Value)
@@ -295,3 +394,80 @@ func TestPeriodicallySaveBackUpRestore(t *testing.T) {
 	assert.Equal(t, "gauge", gauge.MType)
 	assert.Equal(t, gaugeValue, *gauge.Value)
 }
+
+func TestMetricsStorage_TypeScopedKeys(t *testing.T) {
+	logger, _ := l.NewZapLogger(zap.InfoLevel)
+	storage := NewMetricsStorage(logger)
+	ctx := context.Background()
+
+	value := 1.5
+	delta := int64(2)
+	_, err := storage.SetGauge(ctx, m.Metrics{ID: "load", MType: config.Gauge, Value: &value})
+	require.NoError(t, err)
+	_, err = storage.SetCounter(ctx, m.Metrics{ID: "load", MType: config.Counter, Delta: &delta})
+	require.NoError(t, err)
+
+	gauge, ok := storage.GetMetrics(ctx, config.Gauge, "load")
+	require.True(t, ok)
+	assert.Equal(t, value, *gauge.Value)
+
+	counter, ok := storage.GetMetrics(ctx, config.Counter, "load")
+	require.True(t, ok)
+	assert.Equal(t, delta, *counter.Delta)
+
+	t.Run("mixed batch", func(t *testing.T) {
+		more := int64(3)
+		newValue := 2.5
+		_, err := storage.SetGauge(ctx,
+			m.Metrics{ID: "load", MType: config.Counter, Delta: &more},
+			m.Metrics{ID: "load", MType: config.Gauge, Value: &newValue})
+		require.NoError(t, err)
+
+		counter, ok := storage.GetMetrics(ctx, config.Counter, "load")
+		require.True(t, ok)
+		assert.Equal(t, int64(5), *counter.Delta)
+		gauge, ok := storage.GetMetrics(ctx, config.Gauge, "load")
+		require.True(t, ok)
+		assert.Equal(t, newValue, *gauge.Value)
+	})
+
+	t.Run("survives backup", func(t *testing.T) {
+		fname := filepath.Join(t.TempDir(), "metrics.json")
+		require.NoError(t, storage.SaveToFile(fname))
+
+		restored := NewMetricsStorage(logger)
+		require.NoError(t, restored.LoadFromFile(fname))
+		assert.Len(t, restored.Metrics, 2)
+		assert.ElementsMatch(t, []string{"load: 2.5", "load: 5"}, restored.GetAllMetrics(ctx))
+	})
+}
+
+func TestMetricsStorage_LoadLegacyBackup(t *testing.T) {
+	logger, _ := l.NewZapLogger(zap.InfoLevel)
+	fname := filepath.Join(t.TempDir(), "legacy.json")
+	require.NoError(t, os.WriteFile(fname, []byte(`{
+		"cpu": {"id": "cpu", "type": "gauge", "value": 0.5},
+		"version": {"id": "version", "type": "counter", "delta": 3},
+		"team-a/requests": {"id": "requests", "type": "counter", "delta": 7}
+	}`), 0600))
+
+	storage := NewMetricsStorage(logger)
+	require.NoError(t, storage.LoadFromFile(fname))
+
+	cpu, ok := storage.GetMetrics(context.Background(), config.Gauge, "cpu")
+	require.True(t, ok)
+	assert.Equal(t, 0.5, *cpu.Value)
+
+	version, ok := storage.GetMetrics(context.Background(), config.Counter, "version")
+	require.True(t, ok, "metric named version must not be mistaken for the format version")
+	assert.Equal(t, int64(3), *version.Delta)
+
+	requests, ok := storage.GetMetrics(tenant.WithTenant(context.Background(), "team-a"), config.Counter, "requests")
+	require.True(t, ok)
+	assert.Equal(t, int64(7), *requests.Delta)
+
+	t.Run("unsupported version", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(fname, []byte(`{"version": 99, "metrics": []}`), 0600))
+		assert.ErrorContains(t, NewMetricsStorage(logger).LoadFromFile(fname), "unsupported backup version 99")
+	})
+}
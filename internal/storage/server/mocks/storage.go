@@ -14,17 +14,17 @@ type Storage struct {
 	mock.Mock
 }
 
-// GetAllMetrics provides a mock function with no fields
-func (_m *Storage) GetAllMetrics() []string {
-	ret := _m.Called()
+// GetAllMetrics provides a mock function with given fields: ctx
+func (_m *Storage) GetAllMetrics(ctx context.Context) []string {
+	ret := _m.Called(ctx)
 
 	if len(ret) == 0 {
 		panic("no return value specified for GetAllMetrics")
 	}
 
 	var r0 []string
-	if rf, ok := ret.Get(0).(func() []string); ok {
-		r0 = rf()
+	if rf, ok := ret.Get(0).(func(context.Context) []string); ok {
+		r0 = rf(ctx)
 	} else {
 		if ret.Get(0) != nil {
 			r0 = ret.Get(0).([]string)
@@ -64,6 +64,24 @@ func (_m *Storage) GetMetrics(ctx context.Context, metricType string, metricName
 	return r0, r1
 }
 
+// ListMetrics provides a mock function with given fields: ctx, fn
+func (_m *Storage) ListMetrics(ctx context.Context, fn func(models.Metrics) error) error {
+	ret := _m.Called(ctx, fn)
+
+	if len(ret) == 0 {
+		panic("no return value specified for ListMetrics")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, func(models.Metrics) error) error); ok {
+		r0 = rf(ctx, fn)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // SetCounter provides a mock function with given fields: ctx, _a1
 func (_m *Storage) SetCounter(ctx context.Context, _a1 ...models.Metrics) ([]*models.Metrics, error) {
 	_va := make([]interface{}, len(_a1))
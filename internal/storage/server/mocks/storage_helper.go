@@ -127,24 +127,6 @@ func (_m *StorageHelper) GetMetricsOnDBs(ctx context.Context, _a1 ...models.Metr
 	return r0, r1
 }
 
-// InsertMetric provides a mock function with given fields: ctx, _a1
-func (_m *StorageHelper) InsertMetric(ctx context.Context, _a1 []models.Metrics) error {
-	ret := _m.Called(ctx, _a1)
-
-	if len(ret) == 0 {
-		panic("no return value specified for InsertMetric")
-	}
-
-	var r0 error
-	if rf, ok := ret.Get(0).(func(context.Context, []models.Metrics) error); ok {
-		r0 = rf(ctx, _a1)
-	} else {
-		r0 = ret.Error(0)
-	}
-
-	return r0
-}
-
 // SetMetrics provides a mock function with given fields: ctx, _a1
 func (_m *StorageHelper) SetMetrics(ctx context.Context, _a1 []models.Metrics) ([]*models.Metrics, error) {
 	ret := _m.Called(ctx, _a1)
@@ -175,56 +157,36 @@ func (_m *StorageHelper) SetMetrics(ctx context.Context, _a1 []models.Metrics) (
 	return r0, r1
 }
 
-// SortingBatchData provides a mock function with given fields: existingMetrics, metrics
-func (_m *StorageHelper) SortingBatchData(existingMetrics []*models.Metrics, metrics []models.Metrics) ([]models.Metrics, []models.Metrics) {
-	ret := _m.Called(existingMetrics, metrics)
+// UpsertMetrics provides a mock function with given fields: ctx, _a1
+func (_m *StorageHelper) UpsertMetrics(ctx context.Context, _a1 []models.Metrics) ([]*models.Metrics, error) {
+	ret := _m.Called(ctx, _a1)
 
 	if len(ret) == 0 {
-		panic("no return value specified for SortingBatchData")
+		panic("no return value specified for UpsertMetrics")
 	}
 
-	var r0 []models.Metrics
-	var r1 []models.Metrics
-	if rf, ok := ret.Get(0).(func([]*models.Metrics, []models.Metrics) ([]models.Metrics, []models.Metrics)); ok {
-		return rf(existingMetrics, metrics)
+	var r0 []*models.Metrics
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, []models.Metrics) ([]*models.Metrics, error)); ok {
+		return rf(ctx, _a1)
 	}
-	if rf, ok := ret.Get(0).(func([]*models.Metrics, []models.Metrics) []models.Metrics); ok {
-		r0 = rf(existingMetrics, metrics)
+	if rf, ok := ret.Get(0).(func(context.Context, []models.Metrics) []*models.Metrics); ok {
+		r0 = rf(ctx, _a1)
 	} else {
 		if ret.Get(0) != nil {
-			r0 = ret.Get(0).([]models.Metrics)
+			r0 = ret.Get(0).([]*models.Metrics)
 		}
 	}
 
-	if rf, ok := ret.Get(1).(func([]*models.Metrics, []models.Metrics) []models.Metrics); ok {
-		r1 = rf(existingMetrics, metrics)
+	if rf, ok := ret.Get(1).(func(context.Context, []models.Metrics) error); ok {
+		r1 = rf(ctx, _a1)
 	} else {
-		if ret.Get(1) != nil {
-			r1 = ret.Get(1).([]models.Metrics)
-		}
+		r1 = ret.Error(1)
 	}
 
 	return r0, r1
 }
 
-// UpdateMetrics provides a mock function with given fields: ctx, _a1
-func (_m *StorageHelper) UpdateMetrics(ctx context.Context, _a1 []models.Metrics) error {
-	ret := _m.Called(ctx, _a1)
-
-	if len(ret) == 0 {
-		panic("no return value specified for UpdateMetrics")
-	}
-
-	var r0 error
-	if rf, ok := ret.Get(0).(func(context.Context, []models.Metrics) error); ok {
-		r0 = rf(ctx, _a1)
-	} else {
-		r0 = ret.Error(0)
-	}
-
-	return r0
-}
-
 func NewStorageHelper(t interface {
 	mock.TestingT
 	Cleanup(func())
@@ -0,0 +1,158 @@
+package storage
+
+import (
+	"slices"
+
+	"github.com/sanek1/metrics-collector/internal/config"
+	m "github.com/sanek1/metrics-collector/internal/models"
+)
+
+// pendingUpdate - обновление метрики, примененное в памяти, но еще не
+// записанное на диск. Хранит сведения, нужные для отмены обновления,
+// если запись на диск не удалась.
+type pendingUpdate struct {
+	key MetricKey
+	// prev - значение метрики до обновления, existed - была ли метрика
+	prev    m.Metrics
+	existed bool
+	// delta - приращение счетчика
+	delta int64
+	// stored - записанное обновлением значение: по нему отмена определяет,
+	// не заменено ли значение gauge более поздним обновлением
+	stored m.Metrics
+	// seq - номер записи обновления в журнале упреждающей записи или 0
+	seq uint64
+}
+
+// stores сообщает, записано ли значение metric обновлением u.
+// Значения сравниваются по указателю: set всегда размещает их заново.
+func (u *pendingUpdate) stores(metric m.Metrics) bool {
+	if u.key.MType == config.Counter {
+		return metric.Delta != nil && metric.Delta == u.stored.Delta
+	}
+	return metric.Value != nil && metric.Value == u.stored.Value
+}
+
+// track запоминает обновления до подтверждения записи на диск.
+// Вызывается под ms.mtx.
+func (ms *MetricsStorage) track(updates ...*pendingUpdate) {
+	if ms.pending == nil {
+		ms.pending = make(map[MetricKey][]*pendingUpdate)
+	}
+	for _, u := range updates {
+		ms.pending[u.key] = append(ms.pending[u.key], u)
+	}
+}
+
+// confirm забывает обновления, записанные на диск. Вызывается под ms.mtx.
+func (ms *MetricsStorage) confirm(updates []*pendingUpdate) {
+	for _, u := range updates {
+		ms.untrack(u)
+	}
+}
+
+// untrack удаляет обновление из ожидающих записи и возвращает следующее
+// ожидающее обновление той же метрики или nil. Вызывается под ms.mtx.
+func (ms *MetricsStorage) untrack(u *pendingUpdate) *pendingUpdate {
+	list := ms.pending[u.key]
+	i := slices.Index(list, u)
+	if i < 0 {
+		return nil
+	}
+	list = slices.Delete(list, i, i+1)
+	if len(list) == 0 {
+		delete(ms.pending, u.key)
+		return nil
+	}
+	ms.pending[u.key] = list
+	if i < len(list) {
+		return list[i]
+	}
+	return nil
+}
+
+// confirmedMetric возвращает значение метрики key без обновлений, еще не
+// записанных на диск, и false, если без них метрики нет. metric - текущее
+// значение метрики. Вызывается под ms.mtx.
+func (ms *MetricsStorage) confirmedMetric(key MetricKey, metric m.Metrics) (m.Metrics, bool) {
+	updates := ms.pending[key]
+	if len(updates) == 0 {
+		return metric, true
+	}
+	// значение, записанное ожидающим обновлением, заменяется предыдущим,
+	// пока не найдется значение, записанное подтвержденным обновлением
+	confirmed := metric
+	for {
+		i := slices.IndexFunc(updates, func(u *pendingUpdate) bool { return u.stores(confirmed) })
+		if i < 0 {
+			break
+		}
+		if !updates[i].existed {
+			return m.Metrics{}, false
+		}
+		confirmed = updates[i].prev
+	}
+	if key.MType != config.Counter {
+		return confirmed, true
+	}
+	// прежние значения счетчика изменяются при отмене обновлений,
+	// поэтому из текущего значения вычитаются ожидающие приращения
+	confirmed = copyMetric(metric)
+	if confirmed.Delta != nil {
+		for _, u := range updates {
+			*confirmed.Delta -= u.delta
+		}
+	}
+	return confirmed, true
+}
+
+// durableSeq возвращает номер записи журнала, до которой включительно
+// все обновления записаны на диск или отменены. Вызывается под ms.mtx.
+func (ms *MetricsStorage) durableSeq() uint64 {
+	seq := ms.walSeq
+	for _, updates := range ms.pending {
+		for _, u := range updates {
+			if u.seq != 0 && u.seq <= seq {
+				seq = u.seq - 1
+			}
+		}
+	}
+	return seq
+}
+
+// rollback отменяет обновления, которые не удалось записать на диск,
+// в обратном порядке. Более поздние обновления тех же метрик сохраняются:
+// из счетчика вычитается только свое приращение, а отмененное значение gauge
+// восстанавливается, только если его не заменило другое обновление.
+// Вызывается под ms.mtx.
+func (ms *MetricsStorage) rollback(updates []*pendingUpdate) {
+	for _, u := range slices.Backward(updates) {
+		next := ms.untrack(u)
+		current, ok := ms.Metrics[u.key]
+		if u.key.MType == config.Counter {
+			if ok && current.Delta != nil {
+				*current.Delta -= u.delta
+			}
+			switch {
+			case u.existed:
+			case next != nil && u.stores(next.prev):
+				// метрику создаст следующее обновление, если и его придется отменить
+				next.existed = false
+			case ok && current.Delta == u.stored.Delta:
+				delete(ms.Metrics, u.key)
+			}
+			continue
+		}
+
+		switch {
+		case next != nil && u.stores(next.prev):
+			// следующее обновление при отмене восстановит прежнее значение
+			next.prev, next.existed = u.prev, u.existed
+		case !ok || current.Value != u.stored.Value:
+		case u.existed:
+			ms.Metrics[u.key] = u.prev
+		default:
+			delete(ms.Metrics, u.key)
+		}
+	}
+}
@@ -0,0 +1,283 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	m "github.com/sanek1/metrics-collector/internal/models"
+	"github.com/sanek1/metrics-collector/internal/tenant"
+	l "github.com/sanek1/metrics-collector/pkg/logging"
+)
+
+// applyPending применяет обновления так же, как setMetrics до записи на диск.
+func applyPending(ms *MetricsStorage, models ...m.Metrics) []*pendingUpdate {
+	updates := make([]*pendingUpdate, 0, len(models))
+	for _, model := range models {
+		updates = append(updates, ms.set(tenant.Default, model))
+	}
+	ms.track(updates...)
+	return updates
+}
+
+func counterUpdate(delta int64) m.Metrics {
+	return m.Metrics{ID: "hits", MType: m.TypeCounter, Delta: &delta}
+}
+
+func gaugeUpdate(value float64) m.Metrics {
+	return m.Metrics{ID: "load", MType: m.TypeGauge, Value: &value}
+}
+
+func TestMetricsStorage_RollbackCounter(t *testing.T) {
+	ms := NewMetricsStorage(nil)
+	ms.confirm(applyPending(ms, counterUpdate(10)))
+
+	first := applyPending(ms, counterUpdate(5))
+	second := applyPending(ms, counterUpdate(3))
+	ms.rollback(first)
+	got, _ := ms.GetMetrics(context.Background(), m.TypeCounter, "hits")
+	assert.Equal(t, int64(13), *got.Delta, "later update is kept")
+	ms.rollback(second)
+	got, _ = ms.GetMetrics(context.Background(), m.TypeCounter, "hits")
+	assert.Equal(t, int64(10), *got.Delta)
+	assert.Empty(t, ms.pending)
+
+	// отмена создания счетчика удаляет его, если отменены и все следующие обновления
+	ms = NewMetricsStorage(nil)
+	first = applyPending(ms, counterUpdate(5))
+	second = applyPending(ms, counterUpdate(3))
+	ms.rollback(first)
+	got, ok := ms.GetMetrics(context.Background(), m.TypeCounter, "hits")
+	require.True(t, ok)
+	assert.Equal(t, int64(3), *got.Delta)
+	ms.rollback(second)
+	_, ok = ms.GetMetrics(context.Background(), m.TypeCounter, "hits")
+	assert.False(t, ok)
+
+	// счетчик, созданный отмененным обновлением, остается, если его
+	// изменило подтвержденное обновление
+	ms = NewMetricsStorage(nil)
+	first = applyPending(ms, counterUpdate(5))
+	ms.confirm(applyPending(ms, counterUpdate(3)))
+	third := applyPending(ms, counterUpdate(2))
+	ms.rollback(first)
+	ms.rollback(third)
+	got, ok = ms.GetMetrics(context.Background(), m.TypeCounter, "hits")
+	require.True(t, ok)
+	assert.Equal(t, int64(3), *got.Delta)
+}
+
+func TestMetricsStorage_RollbackConcurrentRead(t *testing.T) {
+	ms := NewMetricsStorage(nil)
+	ms.confirm(applyPending(ms, counterUpdate(10)))
+
+	// как в setMetrics, блокировка снимается на время записи на диск,
+	// и обновление читается до его отмены
+	applied, read, done := make(chan struct{}), make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(done)
+		ms.mtx.Lock()
+		updates := applyPending(ms, counterUpdate(5))
+		ms.mtx.Unlock()
+		close(applied)
+		<-read
+		ms.mtx.Lock()
+		ms.rollback(updates)
+		ms.mtx.Unlock()
+	}()
+
+	<-applied
+	got, ok := ms.GetMetrics(context.Background(), m.TypeCounter, "hits")
+	require.True(t, ok)
+	close(read)
+	// отмена не изменяет уже прочитанное значение
+	value := *got.Delta
+	<-done
+	assert.Equal(t, int64(15), value)
+	assert.Equal(t, int64(15), *got.Delta)
+
+	got, _ = ms.GetMetrics(context.Background(), m.TypeCounter, "hits")
+	assert.Equal(t, int64(10), *got.Delta)
+}
+
+func TestMetricsStorage_RollbackGauge(t *testing.T) {
+	for _, reverse := range []bool{false, true} {
+		ms := NewMetricsStorage(nil)
+		ms.confirm(applyPending(ms, gaugeUpdate(1)))
+
+		first := applyPending(ms, gaugeUpdate(2))
+		second := applyPending(ms, gaugeUpdate(3))
+		if reverse {
+			first, second = second, first
+		}
+		ms.rollback(first)
+		ms.rollback(second)
+		got, _ := ms.GetMetrics(context.Background(), m.TypeGauge, "load")
+		assert.Equal(t, 1.0, *got.Value, "reverse=%v", reverse)
+	}
+
+	// подтвержденное обновление между отмененными сохраняется
+	ms := NewMetricsStorage(nil)
+	ms.confirm(applyPending(ms, gaugeUpdate(1)))
+	first := applyPending(ms, gaugeUpdate(2))
+	ms.confirm(applyPending(ms, gaugeUpdate(3)))
+	third := applyPending(ms, gaugeUpdate(4))
+	ms.rollback(first)
+	ms.rollback(third)
+	got, _ := ms.GetMetrics(context.Background(), m.TypeGauge, "load")
+	assert.Equal(t, 3.0, *got.Value)
+
+	// значение, замененное подтвержденным обновлением, не восстанавливается
+	ms = NewMetricsStorage(nil)
+	failed := applyPending(ms, gaugeUpdate(2))
+	ms.confirm(applyPending(ms, gaugeUpdate(3)))
+	ms.rollback(failed)
+	got, _ = ms.GetMetrics(context.Background(), m.TypeGauge, "load")
+	assert.Equal(t, 3.0, *got.Value)
+}
+
+func TestMetricsStorage_ConfirmedMetric(t *testing.T) {
+	ms := NewMetricsStorage(nil)
+	counterKey := Key(tenant.Default, m.TypeCounter, "hits")
+	gaugeKey := Key(tenant.Default, m.TypeGauge, "load")
+	confirmed := func(key MetricKey) (m.Metrics, bool) {
+		return ms.confirmedMetric(key, ms.Metrics[key])
+	}
+
+	applyPending(ms, counterUpdate(5), gaugeUpdate(1))
+	_, ok := confirmed(counterKey)
+	assert.False(t, ok, "metric created by a pending update")
+	_, ok = confirmed(gaugeKey)
+	assert.False(t, ok)
+
+	ms.confirm(applyPending(ms, counterUpdate(3), gaugeUpdate(2)))
+	applyPending(ms, counterUpdate(2), gaugeUpdate(3))
+	got, ok := confirmed(counterKey)
+	require.True(t, ok)
+	assert.Equal(t, int64(3), *got.Delta)
+	got, ok = confirmed(gaugeKey)
+	require.True(t, ok)
+	assert.Equal(t, 2.0, *got.Value)
+	assert.Equal(t, int64(10), *ms.Metrics[counterKey].Delta, "current value is not changed")
+}
+
+func TestMetricsStorage_SnapshotSkipsPendingUpdates(t *testing.T) {
+	logger, err := l.NewZapLogger(zap.WarnLevel)
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "metrics.json")
+	ms := NewMetricsStorage(logger)
+	w, err := openWAL(path+walSuffix, -1)
+	require.NoError(t, err)
+	ms.attachWAL(w)
+	defer ms.detachWAL(context.Background())
+
+	ctx := context.Background()
+	_, err = ms.SetCounter(ctx, counterUpdate(5))
+	require.NoError(t, err)
+
+	// обновление применено, но его запись в журнал еще не сброшена на диск
+	ms.mtx.Lock()
+	update := ms.set(tenant.Default, counterUpdate(3))
+	ms.walSeq++
+	update.seq = ms.walSeq
+	ms.track(update)
+	ms.mtx.Unlock()
+
+	require.NoError(t, ms.saveBackUp(ctx, path))
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	metrics, walSeq, err := decodeBackup(content)
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), *metrics[Key(tenant.Default, m.TypeCounter, "hits")].Delta)
+	assert.Equal(t, uint64(1), walSeq, "replay starts before the pending update")
+
+	// сброс не удался: обновление отменяется и не остается в резервной копии
+	ms.mtx.Lock()
+	ms.rollback([]*pendingUpdate{update})
+	ms.mtx.Unlock()
+	restored := NewMetricsStorage(logger)
+	require.NoError(t, restored.RestoreFromFile(path))
+	got, ok := restored.GetMetrics(ctx, m.TypeCounter, "hits")
+	require.True(t, ok)
+	assert.Equal(t, int64(5), *got.Delta)
+}
+
+func TestMetricsStorage_WALFailureRollsBack(t *testing.T) {
+	logger, err := l.NewZapLogger(zap.WarnLevel)
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "metrics.json")
+	ms := NewMetricsStorage(logger)
+	w, err := openWAL(path+walSuffix, -1)
+	require.NoError(t, err)
+	ms.attachWAL(w)
+	defer ms.detachWAL(context.Background())
+
+	ctx := context.Background()
+	_, err = ms.SetCounter(ctx, counterUpdate(5))
+	require.NoError(t, err)
+
+	// следующий сброс журнала на диск завершится ошибкой
+	require.NoError(t, w.f.Close())
+	_, err = ms.SetCounter(ctx, counterUpdate(3), gaugeUpdate(1))
+	require.Error(t, err)
+	got, _ := ms.GetMetrics(ctx, m.TypeCounter, "hits")
+	assert.Equal(t, int64(5), *got.Delta, "failed update is not applied")
+	_, ok := ms.GetMetrics(ctx, m.TypeGauge, "load")
+	assert.False(t, ok)
+
+	// до сжатия журнала обновления отклоняются, не изменяя хранилище
+	_, err = ms.SetCounter(ctx, counterUpdate(3))
+	require.Error(t, err)
+	got, _ = ms.GetMetrics(ctx, m.TypeCounter, "hits")
+	assert.Equal(t, int64(5), *got.Delta)
+	assert.Empty(t, ms.pending)
+
+	// после сохранения резервной копии журнал снова принимает записи,
+	// а отклоненные обновления не попадают ни в копию, ни в журнал
+	require.NoError(t, ms.saveBackUp(ctx, path))
+	_, err = ms.SetCounter(ctx, counterUpdate(3))
+	require.NoError(t, err)
+	ms.detachWAL(ctx)
+	records := readWAL(t, path+walSuffix)
+	require.Len(t, records, 1)
+	assert.Equal(t, int64(8), *records[0].Delta)
+	restored := NewMetricsStorage(logger)
+	require.NoError(t, restored.RestoreFromFile(path))
+	got, _ = restored.GetMetrics(ctx, m.TypeCounter, "hits")
+	assert.Equal(t, int64(8), *got.Delta)
+	_, ok = restored.GetMetrics(ctx, m.TypeGauge, "load")
+	assert.False(t, ok)
+}
+
+func TestMetricsStorage_SyncSaveFailureRollsBack(t *testing.T) {
+	logger, err := l.NewZapLogger(zap.WarnLevel)
+	require.NoError(t, err)
+	ms := NewMetricsStorage(logger)
+	errDisk := errors.New("disk full")
+	fail := true
+	ms.saver = newSyncSaver(0, func() error {
+		if fail {
+			return errDisk
+		}
+		return nil
+	})
+
+	ctx := context.Background()
+	_, err = ms.SetCounter(ctx, counterUpdate(5))
+	require.ErrorIs(t, err, errDisk)
+	_, ok := ms.GetMetrics(ctx, m.TypeCounter, "hits")
+	assert.False(t, ok, "failed update is not applied")
+
+	// повтор после восстановления диска учитывает приращение один раз
+	fail = false
+	_, err = ms.SetCounter(ctx, counterUpdate(5))
+	require.NoError(t, err)
+	got, _ := ms.GetMetrics(ctx, m.TypeCounter, "hits")
+	assert.Equal(t, int64(5), *got.Delta)
+}
@@ -0,0 +1,113 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// writeFileAtomic записывает data в файл name так, что при сбое на диске остается
+// либо прежнее, либо новое содержимое: данные пишутся во временный файл
+// в том же каталоге, сбрасываются на диск и переименовываются в name.
+// Перед переименованием вызывается before, например для ротации прежних копий.
+func writeFileAtomic(name string, data []byte, before func() error) error {
+	tmp, err := os.CreateTemp(filepath.Dir(name), filepath.Base(name)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	fail := func(err error) error {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+
+	if _, err := tmp.Write(data); err != nil {
+		return fail(err)
+	}
+	if err := tmp.Chmod(fileMode); err != nil {
+		return fail(err)
+	}
+	if err := tmp.Sync(); err != nil {
+		return fail(err)
+	}
+	if err := tmp.Close(); err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	if before != nil {
+		if err := before(); err != nil {
+			_ = os.Remove(tmp.Name())
+			return err
+		}
+	}
+	if err := os.Rename(tmp.Name(), name); err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	return syncDir(filepath.Dir(name))
+}
+
+// syncDir сбрасывает на диск каталог, чтобы после сбоя сохранились
+// созданные и переименованные в нем файлы.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+// rotatedName возвращает имя i-й предыдущей резервной копии: name.1 - самая новая.
+func rotatedName(name string, i int) string {
+	return fmt.Sprintf("%s.%d", name, i)
+}
+
+// rotateBackups сдвигает предыдущие резервные копии name.1 ... name.keep-1
+// на одну позицию и переименовывает текущую копию в name.1.
+// Копии старше keep удаляются. При keep == 0 предыдущие копии не хранятся.
+func rotateBackups(name string, keep int) error {
+	for i := keep + 1; ; i++ {
+		err := os.Remove(rotatedName(name, i))
+		if errors.Is(err, os.ErrNotExist) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if keep == 0 {
+		return nil
+	}
+	for i := keep - 1; i >= 0; i-- {
+		src := name
+		if i > 0 {
+			src = rotatedName(name, i)
+		}
+		err := os.Rename(src, rotatedName(name, i+1))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// backupCandidates возвращает имена резервных копий от новой к старой:
+// name и существующие name.1, name.2 и так далее.
+func backupCandidates(name string) []string {
+	candidates := []string{name}
+	for i := 1; ; i++ {
+		rotated := rotatedName(name, i)
+		if _, err := os.Stat(rotated); err != nil {
+			return candidates
+		}
+		candidates = append(candidates, rotated)
+	}
+}
+
+// missingBackup сообщает, что нет ни резервной копии name, ни предыдущих копий.
+func missingBackup(name string) bool {
+	_, err := os.Stat(name)
+	return errors.Is(err, os.ErrNotExist) && len(backupCandidates(name)) == 1
+}
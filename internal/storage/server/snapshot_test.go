@@ -0,0 +1,133 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	m "github.com/sanek1/metrics-collector/internal/models"
+	"github.com/sanek1/metrics-collector/internal/tenant"
+	l "github.com/sanek1/metrics-collector/pkg/logging"
+)
+
+func saveGauge(t *testing.T, ms *MetricsStorage, fname string, value float64) {
+	t.Helper()
+	_, err := ms.SetGauge(context.Background(), m.Metrics{ID: "load", MType: m.TypeGauge, Value: &value})
+	require.NoError(t, err)
+	require.NoError(t, ms.SaveToFile(fname))
+}
+
+func loadedGauge(t *testing.T, fname string) (float64, error) {
+	t.Helper()
+	logger, _ := l.NewZapLogger(zap.InfoLevel)
+	ms := NewMetricsStorage(logger)
+	if err := ms.LoadFromFile(fname); err != nil {
+		return 0, err
+	}
+	got, ok := ms.GetMetrics(context.Background(), m.TypeGauge, "load")
+	require.True(t, ok)
+	return *got.Value, nil
+}
+
+func TestMetricsStorage_BackupRotation(t *testing.T) {
+	logger, _ := l.NewZapLogger(zap.InfoLevel)
+	fname := filepath.Join(t.TempDir(), "metrics.json")
+	ms := NewMetricsStorage(logger)
+	ms.SetBackupRetention(2)
+
+	for i := 1; i <= 4; i++ {
+		saveGauge(t, ms, fname, float64(i))
+	}
+
+	for name, expected := range map[string]float64{fname: 4, fname + ".1": 3, fname + ".2": 2} {
+		_, err := os.Stat(name)
+		require.NoError(t, err, name)
+		content, err := os.ReadFile(name)
+		require.NoError(t, err)
+		metrics, _, err := decodeBackup(content)
+		require.NoError(t, err, name)
+		assert.Equal(t, expected, *metrics[Key(tenant.Default, m.TypeGauge, "load")].Value, name)
+	}
+	_, err := os.Stat(fname + ".3")
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	entries, err := os.ReadDir(filepath.Dir(fname))
+	require.NoError(t, err)
+	assert.Len(t, entries, 3, "temporary files must not be left behind")
+
+	// уменьшение числа копий удаляет лишние при следующем сохранении
+	ms.SetBackupRetention(0)
+	saveGauge(t, ms, fname, 5)
+	_, err = os.Stat(fname + ".1")
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestMetricsStorage_LoadFallback(t *testing.T) {
+	logger, _ := l.NewZapLogger(zap.InfoLevel)
+	dir := t.TempDir()
+	fname := filepath.Join(dir, "metrics.json")
+	ms := NewMetricsStorage(logger)
+	ms.SetBackupRetention(2)
+	saveGauge(t, ms, fname, 1)
+	saveGauge(t, ms, fname, 2)
+
+	t.Run("valid", func(t *testing.T) {
+		value, err := loadedGauge(t, fname)
+		require.NoError(t, err)
+		assert.Equal(t, 2.0, value)
+	})
+
+	t.Run("checksum mismatch", func(t *testing.T) {
+		content, err := os.ReadFile(fname)
+		require.NoError(t, err)
+		// значение меняется, а файл остается корректным JSON
+		corrupted := bytes.Replace(content, []byte(`"value": 2`), []byte(`"value": 7`), 1)
+		require.NotEqual(t, content, corrupted)
+		require.NoError(t, os.WriteFile(fname, corrupted, fileMode))
+
+		_, _, err = decodeBackup(corrupted)
+		assert.ErrorContains(t, err, "checksum mismatch")
+
+		value, err := loadedGauge(t, fname)
+		require.NoError(t, err)
+		assert.Equal(t, 1.0, value, "previous snapshot must be used")
+	})
+
+	t.Run("truncated and missing", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(fname, []byte(`{"version": 3, "metr`), fileMode))
+		value, err := loadedGauge(t, fname)
+		require.NoError(t, err)
+		assert.Equal(t, 1.0, value)
+
+		require.NoError(t, os.Remove(fname))
+		value, err = loadedGauge(t, fname)
+		require.NoError(t, err)
+		assert.Equal(t, 1.0, value, "crash between rotation and rename leaves only name.1")
+	})
+
+	t.Run("no good snapshot", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(fname+".1", []byte(`{`), fileMode))
+		_, err := loadedGauge(t, fname)
+		assert.ErrorContains(t, err, "data file not found")
+		assert.ErrorContains(t, err, "data unmarshalling error")
+	})
+}
+
+func TestMetricsStorage_LoadVersion2Backup(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), "metrics.json")
+	require.NoError(t, os.WriteFile(fname, []byte(`{
+		"version": 2,
+		"wal_seq": 7,
+		"metrics": [{"id": "load", "type": "gauge", "value": 1.5}]
+	}`), fileMode))
+
+	value, err := loadedGauge(t, fname)
+	require.NoError(t, err)
+	assert.Equal(t, 1.5, value)
+}
@@ -5,6 +5,9 @@ import (
 	"context"
 	"time"
 
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/sanek1/metrics-collector/internal/health"
 	m "github.com/sanek1/metrics-collector/internal/models"
 )
 
@@ -22,14 +25,19 @@ type Storage interface {
 	// Возвращает slice обновленных метрик и ошибку, если она возникла.
 	SetCounter(ctx context.Context, models ...m.Metrics) ([]*m.Metrics, error)
 
-	// GetAllMetrics возвращает список всех доступных метрик в хранилище.
+	// GetAllMetrics возвращает список всех доступных метрик арендатора из контекста.
 	// Возвращает slice строк с именами метрик.
-	GetAllMetrics() []string
+	GetAllMetrics(ctx context.Context) []string
 
 	// GetMetrics получает метрику по её типу и имени.
 	// Принимает контекст выполнения, тип метрики и имя метрики.
 	// Возвращает указатель на метрику и boolean-флаг, указывающий существует ли метрика.
 	GetMetrics(ctx context.Context, metricType, metricName string) (*m.Metrics, bool)
+
+	// ListMetrics передает fn все метрики арендатора из контекста,
+	// упорядоченные по типу и имени, не загружая их в память целиком.
+	// Обход прекращается при первой ошибке fn, она и возвращается.
+	ListMetrics(ctx context.Context, fn func(m.Metrics) error) error
 }
 
 // DatabaseStorage определяет интерфейс для хранилища метрик, использующего базу данных.
@@ -39,8 +47,8 @@ type DatabaseStorage interface {
 	// Возвращает true, если соединение с БД установлено и работает корректно.
 	PingIsOk() bool
 
-	// EnsureMetricsTableExists проверяет существование необходимой таблицы метрик
-	// и создает её, если она отсутствует.
+	// EnsureMetricsTableExists применяет миграции схемы данных,
+	// создавая таблицу метрик, если она отсутствует.
 	// Принимает контекст выполнения.
 	// Возвращает ошибку, если не удалось создать таблицу.
 	EnsureMetricsTableExists(ctx context.Context) error
@@ -68,12 +76,52 @@ type FileStorage interface {
 	PeriodicallySaveBackUp(ctx context.Context, filename string, restore bool, interval time.Duration)
 }
 
+// HealthChecker реализуется хранилищем с базой данных для проверки готовности сервера.
+type HealthChecker interface {
+	// CheckHealth проверяет соединение с хранилищем и сообщает его состояние.
+	CheckHealth(ctx context.Context) health.Component
+}
+
+// BackupChecker реализуется хранилищем, периодически сохраняющим метрики в файл.
+type BackupChecker interface {
+	// CheckBackup сообщает время и результат последнего сохранения в файл.
+	CheckBackup(ctx context.Context) health.Component
+}
+
+// BackupObserver реализуется хранилищем, периодически сохраняющим метрики в файл,
+// и сообщает fn длительность и результат каждого сохранения.
+type BackupObserver interface {
+	ObserveBackups(fn func(duration time.Duration, err error))
+}
+
+// BackupScheduler реализуется хранилищем, периодически сохраняющим метрики в файл,
+// и позволяет изменить интервал сохранения без перезапуска.
+type BackupScheduler interface {
+	SetBackupInterval(interval time.Duration)
+}
+
+// TenantLister реализуется хранилищем, которое может перечислить арендаторов с метриками.
+type TenantLister interface {
+	// Tenants возвращает упорядоченный список арендаторов, у которых есть метрики.
+	Tenants(ctx context.Context) ([]string, error)
+}
+
+// BackupRotator реализуется хранилищем, сохраняющим метрики в файл,
+// и задает число хранимых предыдущих резервных копий.
+type BackupRotator interface {
+	SetBackupRetention(keep int)
+}
+
+// PoolReporter реализуется хранилищем с пулом соединений с базой данных.
+type PoolReporter interface {
+	// PoolStat возвращает статистику пула или nil, если соединение не установлено.
+	PoolStat() *pgxpool.Stat
+}
+
 type StorageHelper interface {
 	FilterBatchesBeforeSaving(metrics []m.Metrics) []m.Metrics
-	SortingBatchData(existingMetrics []*m.Metrics, metrics []m.Metrics) (updatingBatch, insertingBatch []m.Metrics)
 	CollectorQuery(ctx context.Context, metrics []m.Metrics) (query string, mTypes []string, args []interface{})
-	UpdateMetrics(ctx context.Context, models []m.Metrics) error
-	InsertMetric(ctx context.Context, models []m.Metrics) error
+	UpsertMetrics(ctx context.Context, models []m.Metrics) ([]*m.Metrics, error)
 	GetMetricsOnDBs(ctx context.Context, models ...m.Metrics) ([]*m.Metrics, error)
 	SetMetrics(ctx context.Context, models []m.Metrics) ([]*m.Metrics, error)
 	EnsureMetricsTableExists(ctx context.Context) error
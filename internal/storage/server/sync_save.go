@@ -0,0 +1,113 @@
+package storage
+
+import (
+	"sync"
+	"time"
+)
+
+// syncSaveMaxInterval - интервалы сохранения не больше этого значения включают
+// синхронное сохранение: ответ на обновление отправляется только после записи
+// резервной копии на диск. Интервал 0 сохраняет копию сразу, ненулевой интервал
+// объединяет обновления, пришедшие в его пределах, в одну запись.
+const syncSaveMaxInterval = time.Second
+
+// synchronousSave сообщает, сохраняется ли резервная копия синхронно с обновлениями.
+func synchronousSave(interval time.Duration) bool {
+	return interval <= syncSaveMaxInterval
+}
+
+// syncSaver сохраняет резервную копию по запросам из обработки обновлений.
+// Первый из ожидающих выполняет сохранение, остальные ждут его результата,
+// а обновления, пришедшие во время сохранения, объединяются в следующее.
+// Между началами двух сохранений проходит не меньше window.
+type syncSaver struct {
+	save func() error
+
+	mu     sync.Mutex
+	cond   *sync.Cond
+	window time.Duration
+	// requested - номер последнего запроса, saved - последнего сохраненного
+	requested uint64
+	saved     uint64
+	busy      bool
+	closed    bool
+	// err - результат последнего сохранения
+	err  error
+	last time.Time
+}
+
+func newSyncSaver(window time.Duration, save func() error) *syncSaver {
+	s := &syncSaver{save: save, window: window}
+	s.cond = sync.NewCond(&s.mu)
+	return s
+}
+
+// setWindow изменяет минимальный промежуток между сохранениями.
+func (s *syncSaver) setWindow(window time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.window = window
+}
+
+// wait ждет сохранения состояния хранилища на момент вызова.
+// Вызывается после применения обновления без блокировки хранилища.
+func (s *syncSaver) wait() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.requested++
+	target := s.requested
+	for s.saved < target {
+		switch {
+		case s.closed:
+			// последнее сохранение при закрытии включает все обновления
+			return s.err
+		case s.busy:
+			s.cond.Wait()
+		default:
+			s.runLocked()
+		}
+	}
+	return s.err
+}
+
+// runLocked сохраняет резервную копию, выдержав промежуток window после
+// предыдущего сохранения. Вызывается под s.mu, на время ожидания и
+// сохранения блокировка освобождается.
+func (s *syncSaver) runLocked() {
+	s.busy = true
+	if delay := s.window - time.Since(s.last); delay > 0 {
+		s.mu.Unlock()
+		time.Sleep(delay)
+		s.mu.Lock()
+	}
+	target := s.requested
+	s.last = time.Now()
+	s.mu.Unlock()
+
+	err := s.save()
+
+	s.mu.Lock()
+	s.busy = false
+	s.saved = target
+	s.err = err
+	s.cond.Broadcast()
+}
+
+// close выполняет последнее сохранение. После закрытия wait сразу
+// возвращает его результат.
+func (s *syncSaver) close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for s.busy {
+		s.cond.Wait()
+	}
+	if s.closed {
+		return s.err
+	}
+	s.window = 0
+	s.runLocked()
+	s.closed = true
+	s.cond.Broadcast()
+	return s.err
+}
@@ -0,0 +1,143 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/sanek1/metrics-collector/internal/health"
+	m "github.com/sanek1/metrics-collector/internal/models"
+	l "github.com/sanek1/metrics-collector/pkg/logging"
+)
+
+func TestSyncSaver_Coalesce(t *testing.T) {
+	var saves atomic.Int32
+	s := newSyncSaver(0, func() error {
+		saves.Add(1)
+		time.Sleep(10 * time.Millisecond)
+		return nil
+	})
+
+	const writers = 20
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, s.wait())
+		}()
+	}
+	wg.Wait()
+	assert.Less(t, saves.Load(), int32(writers), "concurrent updates must share saves")
+
+	before := saves.Load()
+	require.NoError(t, s.close())
+	assert.Equal(t, before+1, saves.Load(), "close performs the final save")
+	require.NoError(t, s.wait())
+	assert.Equal(t, before+1, saves.Load(), "no saves after close")
+}
+
+func TestSyncSaver_Window(t *testing.T) {
+	var starts []time.Time
+	s := newSyncSaver(50*time.Millisecond, func() error {
+		starts = append(starts, time.Now())
+		return nil
+	})
+	require.NoError(t, s.wait())
+	require.NoError(t, s.wait())
+	require.Len(t, starts, 2)
+	assert.GreaterOrEqual(t, starts[1].Sub(starts[0]), 50*time.Millisecond)
+}
+
+func TestSyncSaver_Error(t *testing.T) {
+	errDisk := errors.New("disk full")
+	fail := true
+	s := newSyncSaver(0, func() error {
+		if fail {
+			return errDisk
+		}
+		return nil
+	})
+	assert.ErrorIs(t, s.wait(), errDisk)
+	fail = false
+	assert.NoError(t, s.wait(), "next successful save clears the error")
+}
+
+func TestMetricsStorage_SynchronousSave(t *testing.T) {
+	logger, _ := l.NewZapLogger(zap.InfoLevel)
+	path := filepath.Join(t.TempDir(), "metrics.json")
+	require.NoError(t, os.WriteFile(path+walSuffix, nil, fileMode))
+
+	ms := NewMetricsStorage(logger)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ms.PeriodicallySaveBackUp(ctx, path, true, 0)
+	}()
+	require.Eventually(t, func() bool {
+		ms.mtx.RLock()
+		defer ms.mtx.RUnlock()
+		return ms.saver != nil
+	}, time.Second, 5*time.Millisecond)
+
+	delta := int64(5)
+	_, err := ms.SetCounter(context.Background(), m.Metrics{ID: "billing", MType: m.TypeCounter, Delta: &delta})
+	require.NoError(t, err)
+
+	// данные уже на диске: другой экземпляр видит их без завершения первого
+	restored := NewMetricsStorage(logger)
+	require.NoError(t, restored.LoadFromFile(path))
+	got, ok := restored.GetMetrics(context.Background(), m.TypeCounter, "billing")
+	require.True(t, ok)
+	assert.Equal(t, int64(5), *got.Delta)
+
+	_, err = os.Stat(path + walSuffix)
+	assert.ErrorIs(t, err, os.ErrNotExist, "write-ahead log is not kept in synchronous mode")
+	assert.Equal(t, health.StatusUp, ms.CheckBackup(ctx).Status)
+
+	// переход на периодическое сохранение снова включает журнал
+	ms.SetBackupInterval(time.Hour)
+	require.Eventually(t, func() bool {
+		ms.mtx.RLock()
+		defer ms.mtx.RUnlock()
+		return ms.saver == nil && ms.wal != nil
+	}, time.Second, 5*time.Millisecond)
+
+	cancel()
+	<-done
+}
+
+func TestMetricsStorage_SynchronousSaveRotation(t *testing.T) {
+	logger, _ := l.NewZapLogger(zap.InfoLevel)
+	fname := filepath.Join(t.TempDir(), "metrics.json")
+	ms := NewMetricsStorage(logger)
+	ms.SetBackupRetention(2)
+	ms.SetBackupInterval(0)
+
+	for i := 0; i < 3; i++ {
+		require.NoError(t, ms.saveBackUp(context.Background(), fname))
+	}
+	_, err := os.Stat(fname + ".1")
+	assert.ErrorIs(t, err, os.ErrNotExist, "synchronous saves replace the backup without rotation")
+
+	// по истечении syncRotateInterval прежняя копия сдвигается
+	ms.backup.mu.Lock()
+	ms.backup.lastRotation = time.Now().Add(-syncRotateInterval)
+	ms.backup.mu.Unlock()
+	require.NoError(t, ms.saveBackUp(context.Background(), fname))
+	_, err = os.Stat(fname + ".1")
+	assert.NoError(t, err)
+	require.NoError(t, ms.saveBackUp(context.Background(), fname))
+	_, err = os.Stat(fname + ".2")
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
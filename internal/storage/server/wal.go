@@ -0,0 +1,313 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// walSuffix - расширение файла журнала упреждающей записи рядом с файлом резервной копии
+const walSuffix = ".wal"
+
+// errWALClosed возвращается при записи в закрытый журнал
+var errWALClosed = errors.New("write-ahead log is closed")
+
+// walRecord - строка журнала: значение метрики после обновления.
+// Запись хранит итоговое значение, а не приращение, поэтому повторное
+// применение записи не меняет результат. Seq растет монотонно и позволяет
+// пропустить при восстановлении записи, уже вошедшие в резервную копию.
+type walRecord struct {
+	Seq uint64 `json:"seq"`
+	backupRecord
+}
+
+// writeAheadLog - журнал упреждающей записи в формате JSON Lines.
+// Записи накапливаются в буфере и сбрасываются на диск группами:
+// один вызов fsync подтверждает все записи, накопленные к его началу,
+// а конкурентные запросы ждут общего сброса (group commit).
+type writeAheadLog struct {
+	path string
+
+	mu   sync.Mutex
+	cond *sync.Cond
+	f    *os.File
+	// pending - записи, еще не переданные в файл, batches - их группы
+	pending bytes.Buffer
+	batches []*walBatch
+	// synced - размер части файла, записанной на диск вызовом fsync
+	synced int64
+	// busy - файл занят сбросом или сжатием журнала
+	busy bool
+	// err - ошибка последнего сброса. До успешного сжатия журнала новые записи
+	// отклоняются, так как часть предыдущих могла не попасть на диск.
+	err    error
+	closed bool
+}
+
+// walBatch - группа записей одного обновления хранилища.
+// Поля изменяются под блокировкой журнала.
+type walBatch struct {
+	// done - группа записана на диск или отклонена с ошибкой err
+	done bool
+	err  error
+}
+
+// openWAL открывает журнал для дозаписи. Если size >= 0, файл обрезается
+// до size байт, чтобы отбросить недописанную при сбое последнюю строку.
+func openWAL(path string, size int64) (*writeAheadLog, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY, fileMode)
+	if err != nil {
+		return nil, fmt.Errorf("open write-ahead log: %w", err)
+	}
+	if size >= 0 {
+		if err := f.Truncate(size); err != nil {
+			_ = f.Close()
+			return nil, fmt.Errorf("truncate write-ahead log: %w", err)
+		}
+	}
+	synced, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		_ = f.Close()
+		return nil, fmt.Errorf("open write-ahead log: %w", err)
+	}
+	w := &writeAheadLog{path: path, f: f, synced: synced}
+	w.cond = sync.NewCond(&w.mu)
+	return w, nil
+}
+
+// write добавляет записи в буфер журнала и возвращает их группу для wait.
+// Вызывается под блокировкой хранилища, чтобы порядок записей в журнале
+// совпадал с порядком изменений. После ошибки сброса и после закрытия
+// журнала группа сразу отклоняется.
+func (w *writeAheadLog) write(records []walRecord) *walBatch {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	batch := &walBatch{}
+	switch {
+	case w.err != nil:
+		batch.done, batch.err = true, w.err
+		return batch
+	case w.closed:
+		batch.done, batch.err = true, errWALClosed
+		return batch
+	}
+
+	enc := json.NewEncoder(&w.pending)
+	for _, record := range records {
+		// кодирование структуры из строк и чисел не завершается ошибкой
+		_ = enc.Encode(record)
+	}
+	w.batches = append(w.batches, batch)
+	return batch
+}
+
+// wait ждет, пока группа batch будет записана на диск. Первый из ожидающих
+// сбрасывает на диск все накопленные записи, остальные ждут результата.
+// Ошибка означает, что записи группы не подтверждены и не будут записаны.
+func (w *writeAheadLog) wait(batch *walBatch) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for !batch.done {
+		switch {
+		case w.closed:
+			return errWALClosed
+		case w.busy:
+			w.cond.Wait()
+		default:
+			w.flushLocked()
+		}
+	}
+	return batch.err
+}
+
+// flushLocked записывает накопленные записи в файл и вызывает fsync.
+// Вызывается под w.mu, на время записи блокировка освобождается.
+// При ошибке отклоняются и записи, накопленные во время сброса:
+// после сбоя в журнал ничего не пишется до его сжатия. Отклоненные записи
+// по возможности удаляются из файла, а сжатие журнала их не переносит.
+func (w *writeAheadLog) flushLocked() {
+	w.busy = true
+	data := bytes.Clone(w.pending.Bytes())
+	w.pending.Reset()
+	batches := w.batches
+	w.batches = nil
+	synced := w.synced
+	w.mu.Unlock()
+
+	_, err := w.f.Write(data)
+	if err == nil {
+		err = w.f.Sync()
+	}
+	if err != nil {
+		_ = w.f.Truncate(synced)
+	}
+
+	w.mu.Lock()
+	w.busy = false
+	if err == nil {
+		w.synced += int64(len(data))
+	} else {
+		w.err = fmt.Errorf("write-ahead log: %w", err)
+		w.pending.Reset()
+		batches = append(batches, w.batches...)
+		w.batches = nil
+	}
+	for _, batch := range batches {
+		batch.done = true
+		if err != nil {
+			batch.err = w.err
+		}
+	}
+	w.cond.Broadcast()
+}
+
+// compact удаляет из журнала записи с номером не больше upTo, уже вошедшие
+// в резервную копию. Файл перезаписывается атомарно через переименование.
+// failure - ошибка сброса, все обновления которой уже отменены в хранилище:
+// если журнал отклоняет записи из-за нее, после успешного сжатия он снова
+// их принимает. Более поздняя ошибка не сбрасывается, так как новые записи
+// могли бы учесть еще не отмененные обновления.
+func (w *writeAheadLog) compact(upTo uint64, failure error) error {
+	w.mu.Lock()
+	for w.busy {
+		w.cond.Wait()
+	}
+	if w.closed {
+		w.mu.Unlock()
+		return errWALClosed
+	}
+	w.busy = true
+	size := w.synced
+	w.mu.Unlock()
+
+	f, synced, err := w.rewrite(upTo, size)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.busy = false
+	if f != nil {
+		_ = w.f.Close()
+		w.f, w.synced = f, synced
+	}
+	if err == nil && failure != nil && errors.Is(w.err, failure) {
+		w.err = nil
+	}
+	w.cond.Broadcast()
+	return err
+}
+
+// rewrite записывает во временный файл записи журнала с номером больше upTo
+// из первых size байт, записанных на диск, заменяет им журнал и возвращает
+// файл, открытый для дозаписи, и его размер.
+// Файл возвращается и вместе с ошибкой, если журнал уже заменен.
+func (w *writeAheadLog) rewrite(upTo uint64, size int64) (*os.File, int64, error) {
+	src, err := os.Open(w.path)
+	if err != nil {
+		return nil, 0, fmt.Errorf("compact write-ahead log: %w", err)
+	}
+	defer src.Close()
+
+	tmp, err := os.CreateTemp(filepath.Dir(w.path), filepath.Base(w.path)+".*.tmp")
+	if err != nil {
+		return nil, 0, fmt.Errorf("compact write-ahead log: %w", err)
+	}
+	fail := func(err error) (*os.File, int64, error) {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return nil, 0, fmt.Errorf("compact write-ahead log: %w", err)
+	}
+
+	out := bufio.NewWriter(tmp)
+	_, err = scanWAL(io.LimitReader(src, size), func(line []byte, record walRecord) error {
+		if record.Seq <= upTo {
+			return nil
+		}
+		_, err := out.Write(append(line, '\n'))
+		return err
+	})
+	if err != nil {
+		return fail(err)
+	}
+	if err := out.Flush(); err != nil {
+		return fail(err)
+	}
+	if err := tmp.Chmod(fileMode); err != nil {
+		return fail(err)
+	}
+	if err := tmp.Sync(); err != nil {
+		return fail(err)
+	}
+	synced, err := tmp.Seek(0, io.SeekEnd)
+	if err != nil {
+		return fail(err)
+	}
+	if err := os.Rename(tmp.Name(), w.path); err != nil {
+		return fail(err)
+	}
+	// после переименования журналом стал новый файл, даже если
+	// переименование не удалось сбросить на диск
+	if err := syncDir(filepath.Dir(w.path)); err != nil {
+		return tmp, synced, fmt.Errorf("compact write-ahead log: %w", err)
+	}
+	return tmp, synced, nil
+}
+
+// Err возвращает ошибку последнего сброса журнала на диск.
+func (w *writeAheadLog) Err() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.err
+}
+
+// Close сбрасывает накопленные записи на диск и закрывает журнал.
+func (w *writeAheadLog) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for w.busy {
+		w.cond.Wait()
+	}
+	if w.closed {
+		return nil
+	}
+	if w.pending.Len() > 0 && w.err == nil {
+		w.flushLocked()
+	}
+	w.closed = true
+	w.cond.Broadcast()
+	return errors.Join(w.err, w.f.Close())
+}
+
+// scanWAL передает fn строки журнала и их разобранные записи.
+// Разбор останавливается на первой некорректной строке: это недописанная
+// при сбое запись, после которой в журнале ничего нет. Возвращает размер
+// корректной части журнала в байтах.
+func scanWAL(r io.Reader, fn func(line []byte, record walRecord) error) (int64, error) {
+	reader := bufio.NewReader(r)
+	var size int64
+	for {
+		line, err := reader.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			// строка без перевода строки не была дописана до конца
+			return size, nil
+		}
+		if err != nil {
+			return size, err
+		}
+		var record walRecord
+		if json.Unmarshal(line, &record) != nil {
+			return size, nil
+		}
+		if err := fn(bytes.TrimSuffix(line, []byte("\n")), record); err != nil {
+			return size, err
+		}
+		size += int64(len(line))
+	}
+}
@@ -0,0 +1,246 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	m "github.com/sanek1/metrics-collector/internal/models"
+	"github.com/sanek1/metrics-collector/internal/tenant"
+	l "github.com/sanek1/metrics-collector/pkg/logging"
+)
+
+func readWAL(t *testing.T, path string) []walRecord {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	var records []walRecord
+	_, err = scanWAL(bytes.NewReader(data), func(_ []byte, record walRecord) error {
+		records = append(records, record)
+		return nil
+	})
+	require.NoError(t, err)
+	return records
+}
+
+func walGauge(seq uint64, id string, value float64) walRecord {
+	return walRecord{Seq: seq, backupRecord: backupRecord{Metrics: m.Metrics{ID: id, MType: m.TypeGauge, Value: &value}}}
+}
+
+func TestWriteAheadLog_GroupCommit(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.json.wal")
+	w, err := openWAL(path, -1)
+	require.NoError(t, err)
+
+	const writers = 50
+	var (
+		wg  sync.WaitGroup
+		mu  sync.Mutex
+		seq uint64
+	)
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			// порядок записей задается блокировкой, как в хранилище
+			mu.Lock()
+			seq++
+			batch := w.write([]walRecord{walGauge(seq, fmt.Sprintf("g%d", i), float64(i))})
+			mu.Unlock()
+			assert.NoError(t, w.wait(batch))
+		}(i)
+	}
+	wg.Wait()
+	require.NoError(t, w.Close())
+
+	records := readWAL(t, path)
+	require.Len(t, records, writers)
+	for i, record := range records {
+		assert.Equal(t, uint64(i+1), record.Seq)
+	}
+}
+
+func TestWriteAheadLog_Compact(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.json.wal")
+	w, err := openWAL(path, -1)
+	require.NoError(t, err)
+
+	require.NoError(t, w.wait(w.write([]walRecord{walGauge(1, "a", 1), walGauge(2, "b", 2)})))
+	require.NoError(t, w.compact(1, nil))
+	require.NoError(t, w.wait(w.write([]walRecord{walGauge(3, "c", 3)})))
+	require.NoError(t, w.Close())
+
+	records := readWAL(t, path)
+	require.Len(t, records, 2)
+	assert.Equal(t, "b", records[0].ID)
+	assert.Equal(t, "c", records[1].ID)
+
+	assert.ErrorIs(t, w.wait(w.write([]walRecord{walGauge(4, "d", 4)})), errWALClosed)
+}
+
+func TestWriteAheadLog_CompactAfterFailure(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.json.wal")
+	w, err := openWAL(path, -1)
+	require.NoError(t, err)
+	require.NoError(t, w.wait(w.write([]walRecord{walGauge(1, "a", 1)})))
+
+	// запись, переданная в файл, но не сброшенная на диск при сбое
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, fileMode)
+	require.NoError(t, err)
+	_, err = f.WriteString(`{"seq":2,"id":"b","type":"gauge","value":2}` + "\n")
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	require.NoError(t, w.f.Close())
+	require.Error(t, w.wait(w.write([]walRecord{walGauge(3, "c", 3)})))
+	failure := w.Err()
+	require.Error(t, failure)
+
+	// ошибка, обновления которой еще не отменены, не сбрасывается
+	require.NoError(t, w.compact(0, nil))
+	assert.ErrorIs(t, w.Err(), failure)
+	require.NoError(t, w.compact(0, failure))
+	require.NoError(t, w.Err())
+
+	require.NoError(t, w.wait(w.write([]walRecord{walGauge(4, "d", 4)})))
+	require.NoError(t, w.Close())
+	records := readWAL(t, path)
+	require.Len(t, records, 2)
+	assert.Equal(t, "a", records[0].ID)
+	assert.Equal(t, "d", records[1].ID)
+}
+
+func TestWriteAheadLog_TornTail(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.json.wal")
+	w, err := openWAL(path, -1)
+	require.NoError(t, err)
+	require.NoError(t, w.wait(w.write([]walRecord{walGauge(1, "a", 1)})))
+	require.NoError(t, w.Close())
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, fileMode)
+	require.NoError(t, err)
+	_, err = f.WriteString(`{"seq":2,"id":"b","ty`)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	ms := NewMetricsStorage(nil)
+	size, err := ms.replayWAL(path)
+	require.NoError(t, err)
+	assert.Len(t, ms.Metrics, 1)
+
+	// после обрезки недописанной строки новые записи дописываются к корректной части
+	w, err = openWAL(path, size)
+	require.NoError(t, err)
+	require.NoError(t, w.wait(w.write([]walRecord{walGauge(2, "c", 3)})))
+	require.NoError(t, w.Close())
+
+	records := readWAL(t, path)
+	require.Len(t, records, 2)
+	assert.Equal(t, "c", records[1].ID)
+}
+
+func TestMetricsStorage_RecoverFromWAL(t *testing.T) {
+	logger, _ := l.NewZapLogger(zap.InfoLevel)
+	path := filepath.Join(t.TempDir(), "metrics.json")
+
+	ms := NewMetricsStorage(logger)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		// интервал больше времени теста: после старта резервная копия не обновляется
+		ms.PeriodicallySaveBackUp(ctx, path, false, time.Hour)
+	}()
+	require.Eventually(t, func() bool {
+		ms.mtx.RLock()
+		defer ms.mtx.RUnlock()
+		return ms.wal != nil
+	}, time.Second, 10*time.Millisecond)
+
+	reqCtx := tenant.WithTenant(context.Background(), "acme")
+	gauge, delta := 2.5, int64(3)
+	_, err := ms.SetGauge(reqCtx, m.Metrics{ID: "load", MType: m.TypeGauge, Value: &gauge})
+	require.NoError(t, err)
+	for i := 0; i < 2; i++ {
+		d := delta
+		_, err = ms.SetCounter(context.Background(), m.Metrics{ID: "hits", MType: m.TypeCounter, Delta: &d})
+		require.NoError(t, err)
+	}
+
+	// изменения после последнего сохранения есть только в журнале
+	records := readWAL(t, path+walSuffix)
+	require.Len(t, records, 3)
+	assert.Equal(t, int64(6), *records[2].Delta, "journal stores the resulting counter value")
+
+	cancel()
+	<-done
+
+	restored := NewMetricsStorage(logger)
+	require.NoError(t, restored.LoadFromFile(path))
+	assert.Empty(t, restored.Metrics)
+	_, err = restored.replayWAL(path + walSuffix)
+	require.NoError(t, err)
+
+	got, ok := restored.GetMetrics(reqCtx, m.TypeGauge, "load")
+	require.True(t, ok)
+	assert.Equal(t, gauge, *got.Value)
+	got, ok = restored.GetMetrics(context.Background(), m.TypeCounter, "hits")
+	require.True(t, ok)
+	assert.Equal(t, int64(6), *got.Delta)
+
+	// повторное применение журнала не меняет значения счетчика
+	_, err = restored.replayWAL(path + walSuffix)
+	require.NoError(t, err)
+	got, _ = restored.GetMetrics(context.Background(), m.TypeCounter, "hits")
+	assert.Equal(t, int64(6), *got.Delta)
+
+	// сохранение резервной копии сжимает журнал
+	require.NoError(t, restored.SaveToFile(path))
+	w, err := openWAL(path+walSuffix, -1)
+	require.NoError(t, err)
+	restored.attachWAL(w)
+	restored.saveBackUp(context.Background(), path)
+	restored.detachWAL(context.Background())
+	assert.Empty(t, readWAL(t, path+walSuffix))
+}
+
+func TestMetricsStorage_WALCoversRetainedBackups(t *testing.T) {
+	logger, _ := l.NewZapLogger(zap.InfoLevel)
+	path := filepath.Join(t.TempDir(), "metrics.json")
+	ms := NewMetricsStorage(logger)
+	ms.SetBackupRetention(1)
+	ms.backup.interval = time.Hour
+	w, err := openWAL(path+walSuffix, -1)
+	require.NoError(t, err)
+	ms.attachWAL(w)
+
+	ctx := context.Background()
+	for _, value := range []float64{1, 2, 3} {
+		_, err = ms.SetGauge(ctx, gaugeUpdate(value))
+		require.NoError(t, err)
+		require.NoError(t, ms.saveBackUp(ctx, path))
+	}
+	ms.detachWAL(ctx)
+
+	// журнал хранит записи после самой старой из хранимых копий
+	records := readWAL(t, path+walSuffix)
+	require.Len(t, records, 1)
+	assert.Equal(t, 3.0, *records[0].Value)
+
+	// при повреждении последней копии ее обновления восполняет журнал
+	require.NoError(t, os.WriteFile(path, []byte(`{`), fileMode))
+	restored := NewMetricsStorage(logger)
+	require.NoError(t, restored.RestoreFromFile(path))
+	got, ok := restored.GetMetrics(ctx, m.TypeGauge, "load")
+	require.True(t, ok)
+	assert.Equal(t, 3.0, *got.Value)
+}
@@ -0,0 +1,259 @@
+// Package transfer копирует метрики между хранилищами через интерфейс
+// storage.Storage и проверяет результат по числу метрик и контрольным суммам.
+//
+// По умолчанию назначение должно быть пустым: повторный перенос в то же
+// хранилище, например после частичного сбоя, удвоил бы значения счетчиков.
+// С Options.Merge метрики добавляются к существующим: значения счетчиков
+// увеличиваются на значения из источника, а значения gauge заменяются.
+// Так перенос нескольких серверов в одно хранилище сохраняет сумму их счетчиков.
+package transfer
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+
+	m "github.com/sanek1/metrics-collector/internal/models"
+	storage "github.com/sanek1/metrics-collector/internal/storage/server"
+	"github.com/sanek1/metrics-collector/internal/tenant"
+)
+
+// ErrVerification возвращается, если метрики в хранилище назначения
+// после копирования не совпадают с ожидаемыми.
+var ErrVerification = errors.New("verification failed")
+
+// ErrDestinationNotEmpty возвращается, если у арендатора в хранилище
+// назначения уже есть метрики, а объединение не разрешено Options.Merge.
+var ErrDestinationNotEmpty = errors.New("destination already has metrics")
+
+// Options - параметры копирования
+type Options struct {
+	// Tenants - арендаторы для копирования. Если список пуст, копируются
+	// все арендаторы источника, а если источник не умеет их перечислять -
+	// арендатор по умолчанию.
+	Tenants []string
+	// DryRun - только прочитать источник и посчитать контрольные суммы
+	DryRun bool
+	// Verify - после копирования сравнить метрики назначения с ожидаемыми
+	Verify bool
+	// Merge - добавить метрики к уже имеющимся в назначении. Без него
+	// копирование не начинается, если в назначении есть метрики арендаторов.
+	Merge bool
+}
+
+// TenantReport - результат копирования метрик одного арендатора
+type TenantReport struct {
+	Tenant string
+	// Source - число метрик и контрольная сумма в источнике
+	Source   int
+	Checksum string
+	// Expected - число метрик и контрольная сумма, ожидаемые в назначении
+	Expected         int
+	ExpectedChecksum string
+	// Verified - метрики назначения совпали с ожидаемыми
+	Verified bool
+}
+
+// Copy копирует метрики из src в dst и возвращает отчет по каждому арендатору.
+func Copy(ctx context.Context, src, dst storage.Storage, opt Options) ([]TenantReport, error) {
+	tenants := opt.Tenants
+	if len(tenants) == 0 {
+		var err error
+		if tenants, err = listTenants(ctx, src); err != nil {
+			return nil, fmt.Errorf("list source tenants: %w", err)
+		}
+	}
+
+	// проверка выполняется до записи, чтобы отказ не оставлял назначение
+	// скопированным частично
+	if !opt.Merge {
+		if err := ensureEmpty(ctx, dst, tenants); err != nil {
+			return nil, err
+		}
+	}
+
+	reports := make([]TenantReport, 0, len(tenants))
+	for _, t := range tenants {
+		report, err := copyTenant(tenant.WithTenant(ctx, t), src, dst, opt)
+		reports = append(reports, report)
+		if err != nil {
+			return reports, fmt.Errorf("tenant %s: %w", t, err)
+		}
+	}
+	return reports, nil
+}
+
+// ensureEmpty проверяет, что у арендаторов tenants нет метрик в dst.
+func ensureEmpty(ctx context.Context, dst storage.Storage, tenants []string) error {
+	var filled []string
+	for _, t := range tenants {
+		count, _, err := Summarize(tenant.WithTenant(ctx, t), dst)
+		if err != nil {
+			return fmt.Errorf("tenant %s: read destination: %w", t, err)
+		}
+		if count > 0 {
+			filled = append(filled, t)
+		}
+	}
+	if len(filled) > 0 {
+		return fmt.Errorf("%w: tenants %s", ErrDestinationNotEmpty, strings.Join(filled, ", "))
+	}
+	return nil
+}
+
+func listTenants(ctx context.Context, s storage.Storage) ([]string, error) {
+	if lister, ok := s.(storage.TenantLister); ok {
+		return lister.Tenants(ctx)
+	}
+	return []string{tenant.Default}, nil
+}
+
+// copyTenant копирует метрики арендатора из контекста.
+func copyTenant(ctx context.Context, src, dst storage.Storage, opt Options) (TenantReport, error) {
+	report := TenantReport{Tenant: tenant.FromContext(ctx)}
+
+	source, err := readAll(ctx, src)
+	if err != nil {
+		return report, fmt.Errorf("read source: %w", err)
+	}
+	report.Source, report.Checksum = len(source), Checksum(source)
+
+	before, err := readAll(ctx, dst)
+	if err != nil {
+		return report, fmt.Errorf("read destination: %w", err)
+	}
+	expected := merge(before, source)
+	report.Expected, report.ExpectedChecksum = len(expected), Checksum(expected)
+
+	if opt.DryRun {
+		return report, nil
+	}
+	if err := write(ctx, dst, source); err != nil {
+		return report, fmt.Errorf("write destination: %w", err)
+	}
+	if !opt.Verify {
+		return report, nil
+	}
+
+	after, err := readAll(ctx, dst)
+	if err != nil {
+		return report, fmt.Errorf("read destination: %w", err)
+	}
+	if len(after) != report.Expected || Checksum(after) != report.ExpectedChecksum {
+		return report, fmt.Errorf("%w: expected %d metrics (%s), destination has %d (%s)",
+			ErrVerification, report.Expected, report.ExpectedChecksum, len(after), Checksum(after))
+	}
+	report.Verified = true
+	return report, nil
+}
+
+// Summarize возвращает число метрик арендатора из контекста и их контрольную сумму.
+func Summarize(ctx context.Context, s storage.Storage) (int, string, error) {
+	metrics, err := readAll(ctx, s)
+	if err != nil {
+		return 0, "", err
+	}
+	return len(metrics), Checksum(metrics), nil
+}
+
+func readAll(ctx context.Context, s storage.Storage) ([]m.Metrics, error) {
+	var metrics []m.Metrics
+	err := s.ListMetrics(ctx, func(metric m.Metrics) error {
+		metrics = append(metrics, clone(metric))
+		return nil
+	})
+	return metrics, err
+}
+
+// write записывает метрики одним пакетом gauge и одним пакетом counter.
+func write(ctx context.Context, dst storage.Storage, metrics []m.Metrics) error {
+	var gauges, counters []m.Metrics
+	for _, metric := range metrics {
+		switch metric.MType {
+		case m.TypeGauge:
+			gauges = append(gauges, clone(metric))
+		case m.TypeCounter:
+			counters = append(counters, clone(metric))
+		default:
+			return fmt.Errorf("metric %s: unknown type %q", metric.ID, metric.MType)
+		}
+	}
+	if len(gauges) > 0 {
+		if _, err := dst.SetGauge(ctx, gauges...); err != nil {
+			return err
+		}
+	}
+	if len(counters) > 0 {
+		if _, err := dst.SetCounter(ctx, counters...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// merge возвращает метрики назначения после записи source поверх before:
+// счетчики складываются, значения gauge заменяются.
+func merge(before, source []m.Metrics) []m.Metrics {
+	type key struct{ mType, id string }
+	merged := make(map[key]m.Metrics, len(before)+len(source))
+	for _, metric := range before {
+		merged[key{metric.MType, metric.ID}] = clone(metric)
+	}
+	for _, metric := range source {
+		k := key{metric.MType, metric.ID}
+		current, ok := merged[k]
+		if ok && metric.MType == m.TypeCounter && current.Delta != nil && metric.Delta != nil {
+			*current.Delta += *metric.Delta
+			continue
+		}
+		merged[k] = clone(metric)
+	}
+	return slices.Collect(maps.Values(merged))
+}
+
+// Checksum возвращает контрольную сумму набора метрик в виде "sha256:<hex>".
+// Сумма не зависит от порядка метрик.
+func Checksum(metrics []m.Metrics) string {
+	lines := make([]string, 0, len(metrics))
+	for _, metric := range metrics {
+		lines = append(lines, line(metric))
+	}
+	slices.Sort(lines)
+
+	h := sha256.New()
+	for _, l := range lines {
+		h.Write([]byte(l))
+		h.Write([]byte{'\n'})
+	}
+	return "sha256:" + hex.EncodeToString(h.Sum(nil))
+}
+
+// line записывает метрику в каноническом виде "тип/имя=значение".
+func line(metric m.Metrics) string {
+	value := "null"
+	switch {
+	case metric.Delta != nil:
+		value = strconv.FormatInt(*metric.Delta, 10)
+	case metric.Value != nil:
+		value = strconv.FormatFloat(*metric.Value, 'g', -1, 64)
+	}
+	return metric.MType + "/" + metric.ID + "=" + value
+}
+
+func clone(metric m.Metrics) m.Metrics {
+	if metric.Delta != nil {
+		delta := *metric.Delta
+		metric.Delta = &delta
+	}
+	if metric.Value != nil {
+		value := *metric.Value
+		metric.Value = &value
+	}
+	return metric
+}
@@ -0,0 +1,123 @@
+package transfer
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	m "github.com/sanek1/metrics-collector/internal/models"
+	storage "github.com/sanek1/metrics-collector/internal/storage/server"
+	"github.com/sanek1/metrics-collector/internal/tenant"
+	l "github.com/sanek1/metrics-collector/pkg/logging"
+)
+
+func counter(id string, delta int64) m.Metrics {
+	return m.Metrics{ID: id, MType: m.TypeCounter, Delta: &delta}
+}
+
+func gauge(id string, value float64) m.Metrics {
+	return m.Metrics{ID: id, MType: m.TypeGauge, Value: &value}
+}
+
+func newStorage(t *testing.T, metrics map[string][]m.Metrics) *storage.MetricsStorage {
+	t.Helper()
+	logger, err := l.NewZapLogger(zap.WarnLevel)
+	require.NoError(t, err)
+	ms := storage.NewMetricsStorage(logger)
+	for id, list := range metrics {
+		for _, metric := range list {
+			ms.Metrics[storage.Key(id, metric.MType, metric.ID)] = metric
+		}
+	}
+	return ms
+}
+
+// lossyStorage теряет записи счетчиков, чтобы проверка обнаружила расхождение.
+type lossyStorage struct {
+	*storage.MetricsStorage
+}
+
+func (s lossyStorage) SetCounter(context.Context, ...m.Metrics) ([]*m.Metrics, error) {
+	return nil, nil
+}
+
+func TestCopy(t *testing.T) {
+	src := newStorage(t, map[string][]m.Metrics{
+		tenant.Default: {counter("hits", 2), gauge("load", 0.5)},
+		"acme":         {counter("hits", 3)},
+	})
+	dst := newStorage(t, map[string][]m.Metrics{
+		tenant.Default: {counter("hits", 40), gauge("load", 7)},
+	})
+
+	reports, err := Copy(context.Background(), src, dst, Options{Verify: true, Merge: true})
+	require.NoError(t, err)
+	require.Len(t, reports, 2)
+	assert.Equal(t, "acme", reports[0].Tenant)
+	assert.Equal(t, tenant.Default, reports[1].Tenant)
+	for _, r := range reports {
+		assert.True(t, r.Verified, r.Tenant)
+	}
+
+	got, ok := dst.GetMetrics(context.Background(), m.TypeCounter, "hits")
+	require.True(t, ok)
+	assert.Equal(t, int64(42), *got.Delta)
+
+	// источник не меняется при записи в назначение
+	got, _ = src.GetMetrics(context.Background(), m.TypeCounter, "hits")
+	assert.Equal(t, int64(2), *got.Delta)
+}
+
+func TestCopy_DestinationNotEmpty(t *testing.T) {
+	src := newStorage(t, map[string][]m.Metrics{
+		tenant.Default: {counter("hits", 2)},
+		"acme":         {counter("hits", 3)},
+	})
+	dst := newStorage(t, map[string][]m.Metrics{"acme": {counter("hits", 3)}})
+
+	// повторный перенос после частичного сбоя не удваивает счетчики
+	_, err := Copy(context.Background(), src, dst, Options{Verify: true})
+	require.ErrorIs(t, err, ErrDestinationNotEmpty)
+	assert.ErrorContains(t, err, "acme")
+	_, ok := dst.GetMetrics(context.Background(), m.TypeCounter, "hits")
+	assert.False(t, ok, "nothing is written after the refusal")
+
+	// перенос только арендаторов с пустым назначением разрешен
+	_, err = Copy(context.Background(), src, dst, Options{Tenants: []string{tenant.Default}})
+	require.NoError(t, err)
+}
+
+func TestCopy_DryRun(t *testing.T) {
+	src := newStorage(t, map[string][]m.Metrics{tenant.Default: {counter("hits", 2)}})
+	dst := newStorage(t, nil)
+
+	reports, err := Copy(context.Background(), src, dst, Options{DryRun: true, Verify: true})
+	require.NoError(t, err)
+	require.Len(t, reports, 1)
+	assert.Equal(t, 1, reports[0].Source)
+	assert.Equal(t, reports[0].Checksum, reports[0].ExpectedChecksum)
+	assert.False(t, reports[0].Verified)
+	assert.Empty(t, dst.Metrics)
+}
+
+func TestCopy_VerificationFailure(t *testing.T) {
+	src := newStorage(t, map[string][]m.Metrics{tenant.Default: {counter("hits", 2)}})
+	dst := lossyStorage{newStorage(t, nil)}
+
+	_, err := Copy(context.Background(), src, dst, Options{Verify: true})
+	assert.ErrorIs(t, err, ErrVerification)
+
+	_, err = Copy(context.Background(), src, dst, Options{})
+	assert.NoError(t, err, "without verification the loss is not detected")
+}
+
+func TestChecksum(t *testing.T) {
+	a := []m.Metrics{counter("hits", 1), gauge("load", 0.1)}
+	b := []m.Metrics{gauge("load", 0.1), counter("hits", 1)}
+	assert.Equal(t, Checksum(a), Checksum(b), "order must not matter")
+	assert.NotEqual(t, Checksum(a), Checksum([]m.Metrics{counter("hits", 2), gauge("load", 0.1)}))
+	assert.NotEqual(t, Checksum(a), Checksum(a[:1]))
+}
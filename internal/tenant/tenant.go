@@ -0,0 +1,56 @@
+// Package tenant предоставляет функции для работы с арендаторами (tenant),
+// между которыми разделяются хранимые метрики.
+package tenant
+
+import (
+	"context"
+	"fmt"
+)
+
+const (
+	// Header - заголовок запроса, в котором передается идентификатор арендатора
+	Header = "X-Scope-OrgID"
+	// Default - арендатор, используемый при отсутствии явного указания
+	Default = "default"
+
+	maxLength = 64
+)
+
+type ctxKey struct{}
+
+// WithTenant возвращает копию контекста с указанным арендатором.
+func WithTenant(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, ctxKey{}, id)
+}
+
+// FromContext возвращает арендатора из контекста.
+// Если арендатор не задан, возвращается Default.
+func FromContext(ctx context.Context) string {
+	if ctx == nil {
+		return Default
+	}
+	if id, ok := ctx.Value(ctxKey{}).(string); ok && id != "" {
+		return id
+	}
+	return Default
+}
+
+// Validate проверяет идентификатор арендатора.
+// Допускаются латинские буквы, цифры и символы '-', '_', '.' длиной до 64 символов.
+func Validate(id string) error {
+	if id == "" {
+		return fmt.Errorf("tenant id is empty")
+	}
+	if len(id) > maxLength {
+		return fmt.Errorf("tenant id is longer than %d characters", maxLength)
+	}
+	for _, r := range id {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case r == '-', r == '_', r == '.':
+		default:
+			return fmt.Errorf("tenant id contains invalid character %q", r)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package tenant
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFromContext(t *testing.T) {
+	t.Run("default tenant", func(t *testing.T) {
+		assert.Equal(t, Default, FromContext(context.Background()))
+	})
+
+	t.Run("tenant from context", func(t *testing.T) {
+		ctx := WithTenant(context.Background(), "team-a")
+		assert.Equal(t, "team-a", FromContext(ctx))
+	})
+
+	t.Run("empty tenant", func(t *testing.T) {
+		ctx := WithTenant(context.Background(), "")
+		assert.Equal(t, Default, FromContext(ctx))
+	})
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		id      string
+		wantErr bool
+	}{
+		{name: "simple", id: "team-a", wantErr: false},
+		{name: "with dots", id: "org.team_1", wantErr: false},
+		{name: "empty", id: "", wantErr: true},
+		{name: "slash", id: "team/a", wantErr: true},
+		{name: "space", id: "team a", wantErr: true},
+		{name: "too long", id: strings.Repeat("a", 65), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Validate(tt.id)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,59 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+
+	l "github.com/sanek1/metrics-collector/pkg/logging"
+)
+
+func TestMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	recorder := recordSpans(t)
+	_, err := Setup(context.Background(), Options{})
+	require.NoError(t, err)
+	logger, err := l.NewZapLogger(zap.InfoLevel)
+	require.NoError(t, err)
+
+	var handlerCtx context.Context
+	router := gin.New()
+	router.Use(Middleware(logger))
+	router.POST("/updates/:tenant", func(c *gin.Context) {
+		handlerCtx = c.Request.Context()
+		_, child := Start(c.Request.Context(), "ParseMetricsServices")
+		child.End()
+		c.Status(http.StatusInternalServerError)
+	})
+
+	ctx, client := Start(context.Background(), "agent.sendToServer")
+	req := httptest.NewRequest(http.MethodPost, "/updates/acme", nil)
+	Inject(ctx, req.Header)
+	router.ServeHTTP(httptest.NewRecorder(), req)
+	client.End()
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 3)
+	child, server := spans[0], spans[1]
+
+	assert.Equal(t, "POST /updates/:tenant", server.Name())
+	assert.Equal(t, trace.SpanKindServer, server.SpanKind())
+	assert.Equal(t, client.SpanContext().TraceID(), server.SpanContext().TraceID())
+	assert.Equal(t, client.SpanContext().SpanID(), server.Parent().SpanID())
+	assert.Equal(t, server.SpanContext().SpanID(), child.Parent().SpanID())
+	assert.Equal(t, codes.Error, server.Status().Code)
+	assert.Contains(t, server.Attributes(), attribute.Int("http.response.status_code", http.StatusInternalServerError))
+
+	fields, ok := handlerCtx.Value(l.FieldKey("zapFields")).(l.ZapFields)
+	require.True(t, ok)
+	assert.Equal(t, server.SpanContext().TraceID().String(), fields["trace_id"].String)
+}
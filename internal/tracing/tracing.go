@@ -0,0 +1,146 @@
+// Package tracing настраивает трассировку OpenTelemetry для агента и сервера:
+// экспорт спанов по OTLP или в локальный файл, распространение контекста
+// через заголовок traceparent и добавление идентификаторов трассы в поля журнала.
+package tracing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+
+	l "github.com/sanek1/metrics-collector/pkg/logging"
+)
+
+// instrumentationName - имя библиотеки инструментирования в спанах
+const instrumentationName = "github.com/sanek1/metrics-collector"
+
+// fileMode - права файла со спанами
+const fileMode = 0600
+
+// Options описывает экспорт спанов. Если не указаны ни Endpoint, ни File,
+// спаны не записываются, но контекст трассы по-прежнему передается дальше.
+type Options struct {
+	// ServiceName - имя сервиса в ресурсе трассы, например agent или server
+	ServiceName string
+	// Endpoint - адрес OTLP/HTTP коллектора: host:port (без TLS) или URL
+	Endpoint string
+	// File - файл, в который спаны записываются построчно в формате JSON
+	File string
+}
+
+// ShutdownFunc отправляет накопленные спаны и освобождает ресурсы экспортера.
+type ShutdownFunc func(ctx context.Context) error
+
+// Setup настраивает глобальные провайдер трассировки и распространитель контекста.
+func Setup(ctx context.Context, opts Options) (ShutdownFunc, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{}, propagation.Baggage{},
+	))
+
+	var (
+		exporters []sdktrace.SpanExporter
+		closers   []func() error
+	)
+	if opts.Endpoint != "" {
+		exp, err := otlptracehttp.New(ctx, endpointOption(opts.Endpoint)...)
+		if err != nil {
+			return nil, fmt.Errorf("otlp exporter: %w", err)
+		}
+		exporters = append(exporters, exp)
+	}
+	if opts.File != "" {
+		f, err := os.OpenFile(opts.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, fileMode)
+		if err != nil {
+			return nil, fmt.Errorf("open trace file: %w", err)
+		}
+		exp, err := stdouttrace.New(stdouttrace.WithWriter(f))
+		if err != nil {
+			_ = f.Close()
+			return nil, fmt.Errorf("file exporter: %w", err)
+		}
+		exporters = append(exporters, exp)
+		closers = append(closers, f.Close)
+	}
+	if len(exporters) == 0 {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(
+		semconv.ServiceName(opts.ServiceName),
+	))
+	if err != nil {
+		return nil, fmt.Errorf("trace resource: %w", err)
+	}
+	providerOpts := []sdktrace.TracerProviderOption{sdktrace.WithResource(res)}
+	for _, exp := range exporters {
+		providerOpts = append(providerOpts, sdktrace.WithBatcher(exp))
+	}
+	provider := sdktrace.NewTracerProvider(providerOpts...)
+	otel.SetTracerProvider(provider)
+
+	return func(ctx context.Context) error {
+		err := provider.Shutdown(ctx)
+		for _, closeFn := range closers {
+			err = errors.Join(err, closeFn())
+		}
+		return err
+	}, nil
+}
+
+// endpointOption принимает адрес коллектора в виде URL или host:port.
+func endpointOption(endpoint string) []otlptracehttp.Option {
+	if strings.Contains(endpoint, "://") {
+		return []otlptracehttp.Option{otlptracehttp.WithEndpointURL(endpoint)}
+	}
+	return []otlptracehttp.Option{otlptracehttp.WithEndpoint(endpoint), otlptracehttp.WithInsecure()}
+}
+
+// Start начинает спан name, дочерний по отношению к спану из ctx.
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(instrumentationName).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// End завершает спан, отмечая его ошибкой, если err не nil.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// Inject записывает контекст трассы из ctx в заголовки исходящего запроса (traceparent).
+func Inject(ctx context.Context, header map[string][]string) {
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(header))
+}
+
+// Extract возвращает ctx с контекстом трассы из заголовков входящего запроса.
+func Extract(ctx context.Context, header map[string][]string) context.Context {
+	return otel.GetTextMapPropagator().Extract(ctx, propagation.HeaderCarrier(header))
+}
+
+// WithLogFields добавляет идентификаторы трассы и спана из ctx в поля журнала контекста.
+func WithLogFields(ctx context.Context, logger *l.ZapLogger) context.Context {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return ctx
+	}
+	return logger.WithContextFields(ctx,
+		zap.String("trace_id", sc.TraceID().String()),
+		zap.String("span_id", sc.SpanID().String()),
+	)
+}
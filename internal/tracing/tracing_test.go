@@ -0,0 +1,109 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+
+	l "github.com/sanek1/metrics-collector/pkg/logging"
+)
+
+// recordSpans устанавливает провайдер, сохраняющий завершенные спаны в памяти.
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	t.Cleanup(func() {
+		otel.SetTracerProvider(previous)
+		_ = provider.Shutdown(context.Background())
+	})
+	return recorder
+}
+
+func TestSetup_File(t *testing.T) {
+	previous := otel.GetTracerProvider()
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+
+	path := filepath.Join(t.TempDir(), "spans.json")
+	shutdown, err := Setup(context.Background(), Options{ServiceName: "test", File: path})
+	require.NoError(t, err)
+
+	_, span := Start(context.Background(), "file-span")
+	traceID := span.SpanContext().TraceID().String()
+	End(span, errors.New("boom"))
+	require.NoError(t, shutdown(context.Background()))
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "file-span")
+	assert.Contains(t, string(data), traceID)
+	assert.Contains(t, string(data), "boom")
+}
+
+func TestSetup_WithoutExporters(t *testing.T) {
+	shutdown, err := Setup(context.Background(), Options{ServiceName: "test"})
+	require.NoError(t, err)
+	assert.NoError(t, shutdown(context.Background()))
+}
+
+func TestInjectExtract(t *testing.T) {
+	recordSpans(t)
+	_, err := Setup(context.Background(), Options{})
+	require.NoError(t, err)
+
+	ctx, span := Start(context.Background(), "client")
+	defer span.End()
+
+	header := http.Header{}
+	Inject(ctx, header)
+	require.NotEmpty(t, header.Get("traceparent"))
+
+	remote := trace.SpanContextFromContext(Extract(context.Background(), header))
+	assert.True(t, remote.IsRemote())
+	assert.Equal(t, span.SpanContext().TraceID(), remote.TraceID())
+	assert.Equal(t, span.SpanContext().SpanID(), remote.SpanID())
+}
+
+func TestEnd(t *testing.T) {
+	recorder := recordSpans(t)
+
+	_, span := Start(context.Background(), "ok")
+	End(span, nil)
+	_, span = Start(context.Background(), "failed")
+	End(span, errors.New("boom"))
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 2)
+	assert.Equal(t, codes.Unset, spans[0].Status().Code)
+	assert.Equal(t, codes.Error, spans[1].Status().Code)
+	assert.Equal(t, "boom", spans[1].Status().Description)
+}
+
+func TestWithLogFields(t *testing.T) {
+	recordSpans(t)
+	logger, err := l.NewZapLogger(zap.InfoLevel)
+	require.NoError(t, err)
+
+	assert.Equal(t, context.Background(), WithLogFields(context.Background(), logger))
+
+	ctx, span := Start(context.Background(), "logged")
+	defer span.End()
+	fields, ok := WithLogFields(ctx, logger).Value(l.FieldKey("zapFields")).(l.ZapFields)
+	require.True(t, ok)
+	assert.Equal(t, span.SpanContext().TraceID().String(), fields["trace_id"].String)
+	assert.Equal(t, span.SpanContext().SpanID().String(), fields["span_id"].String)
+}
@@ -0,0 +1,57 @@
+package validation
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/sanek1/metrics-collector/internal/tenant"
+	l "github.com/sanek1/metrics-collector/pkg/logging"
+)
+
+// AccessLog записывает в журнал одну запись о каждом обработанном запросе:
+// метод, шаблон маршрута, статус, длительность, размеры тела запроса и ответа,
+// адрес клиента и арендатора. Поля контекста (request_id, agent_id, trace_id)
+// берутся из запроса после обработки, поэтому в запись попадают и поля,
+// добавленные middleware, стоящими дальше в цепочке.
+// Ответы 5xx записываются с уровнем error, 4xx - warn, остальные - info.
+func AccessLog(logger *l.ZapLogger) gin.HandlerFunc {
+	logger = logger.Unsampled()
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		status := c.Writer.Status()
+		ctx := c.Request.Context()
+		fields := []zap.Field{
+			zap.String("method", c.Request.Method),
+			zap.String("route", route),
+			zap.String("path", c.Request.URL.Path),
+			zap.Int("status", status),
+			zap.Float64("latency_ms", float64(time.Since(start))/float64(time.Millisecond)),
+			zap.Int64("bytes_in", max(c.Request.ContentLength, 0)),
+			zap.Int("bytes", max(c.Writer.Size(), 0)),
+			zap.String("client_ip", c.ClientIP()),
+			zap.String("tenant", tenant.FromContext(ctx)),
+			zap.String("user_agent", c.Request.UserAgent()),
+		}
+		if len(c.Errors) > 0 {
+			fields = append(fields, zap.String("error", c.Errors.Last().Error()))
+		}
+
+		switch {
+		case status >= http.StatusInternalServerError:
+			logger.ErrorCtx(ctx, "request", fields...)
+		case status >= http.StatusBadRequest:
+			logger.WarnCtx(ctx, "request", fields...)
+		default:
+			logger.InfoCtx(ctx, "request", fields...)
+		}
+	}
+}
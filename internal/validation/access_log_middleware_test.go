@@ -0,0 +1,74 @@
+package validation
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+
+	"github.com/sanek1/metrics-collector/internal/requestid"
+	l "github.com/sanek1/metrics-collector/pkg/logging"
+)
+
+func TestAccessLog(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	core, recorded := observer.New(zap.DebugLevel)
+	logger := l.NewFromZap(zap.New(core))
+
+	router := gin.New()
+	router.Use(RequestID(logger), AccessLog(logger), Recovery(logger))
+	router.POST("/update/:name", func(c *gin.Context) {
+		c.String(http.StatusOK, "ok")
+	})
+	router.GET("/missing", func(c *gin.Context) {
+		c.Status(http.StatusNotFound)
+	})
+	router.GET("/panic", func(*gin.Context) {
+		panic("boom")
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/update/alloc", strings.NewReader("12345"))
+	req.Header.Set(requestid.Header, "req-1")
+	req.Header.Set(requestid.AgentHeader, "agent-1")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	entries := recorded.TakeAll()
+	require.Len(t, entries, 1)
+	entry := entries[0]
+	assert.Equal(t, zapcore.InfoLevel, entry.Level)
+	fields := entry.ContextMap()
+	assert.Equal(t, "req-1", fields["request_id"])
+	assert.Equal(t, "agent-1", fields["agent_id"])
+	assert.Equal(t, http.MethodPost, fields["method"])
+	assert.Equal(t, "/update/:name", fields["route"])
+	assert.Equal(t, "/update/alloc", fields["path"])
+	assert.EqualValues(t, http.StatusOK, fields["status"])
+	assert.EqualValues(t, 5, fields["bytes_in"])
+	assert.EqualValues(t, 2, fields["bytes"])
+	assert.Equal(t, "192.0.2.1", fields["client_ip"])
+	assert.Contains(t, fields, "latency_ms")
+
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/missing", nil))
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/nowhere", nil))
+	entries = recorded.TakeAll()
+	require.Len(t, entries, 2)
+	assert.Equal(t, zapcore.WarnLevel, entries[0].Level)
+	assert.Equal(t, "unmatched", entries[1].ContextMap()["route"])
+
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/panic", nil))
+	assert.Equal(t, http.StatusInternalServerError, resp.Code)
+	assert.Contains(t, resp.Body.String(), "internal_error")
+	entries = recorded.TakeAll()
+	require.Len(t, entries, 2)
+	assert.Equal(t, "Recovered from panic", entries[0].Message)
+	assert.Equal(t, zapcore.ErrorLevel, entries[1].Level)
+	assert.Equal(t, entries[0].ContextMap()["request_id"], entries[1].ContextMap()["request_id"])
+}
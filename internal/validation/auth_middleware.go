@@ -0,0 +1,115 @@
+package validation
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/sanek1/metrics-collector/internal/apierror"
+	sf "github.com/sanek1/metrics-collector/internal/flags/server"
+	"github.com/sanek1/metrics-collector/internal/tenant"
+	l "github.com/sanek1/metrics-collector/pkg/logging"
+)
+
+// Права доступа токенов API
+const (
+	// ScopeRead разрешает чтение метрик
+	ScopeRead = "read"
+	// ScopeWrite разрешает обновление метрик
+	ScopeWrite = "write"
+	// ScopeAdmin разрешает управление сервером и включает остальные права
+	ScopeAdmin = "admin"
+)
+
+// Auth проверяет bearer-токены запросов и их права.
+type Auth struct {
+	tokens map[string]sf.APIToken
+	l      *l.ZapLogger
+}
+
+// NewAuth создает проверку токенов по списку из конфигурации.
+// Если список пуст, проверка отключена и все запросы пропускаются.
+func NewAuth(tokens []sf.APIToken, logger *l.ZapLogger) *Auth {
+	a := &Auth{
+		tokens: make(map[string]sf.APIToken, len(tokens)),
+		l:      logger,
+	}
+	for _, t := range tokens {
+		if t.Token != "" {
+			a.tokens[t.Token] = t
+		}
+	}
+	return a
+}
+
+// Enabled сообщает, включена ли проверка токенов.
+func (a *Auth) Enabled() bool {
+	return len(a.tokens) != 0
+}
+
+// TenantTokens возвращает соответствие токенов арендаторам
+// для токенов, привязанных к арендатору.
+func (a *Auth) TenantTokens() map[string]string {
+	res := make(map[string]string)
+	for value, t := range a.tokens {
+		if t.Tenant != "" {
+			res[value] = t.Tenant
+		}
+	}
+	return res
+}
+
+// Require возвращает middleware, пропускающий только запросы с токеном,
+// у которого есть право scope. Отсутствующий или неизвестный токен
+// отклоняется с кодом 401, недостаточные права - с кодом 403.
+func (a *Auth) Require(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !a.Enabled() {
+			c.Next()
+			return
+		}
+
+		value := bearerToken(c.GetHeader("Authorization"))
+		token, ok := a.tokens[value]
+		if !ok {
+			a.reject(c, http.StatusUnauthorized, value, scope, "missing or unknown token")
+			return
+		}
+		if !hasScope(token.Scopes, scope) {
+			a.reject(c, http.StatusForbidden, value, scope, "insufficient scope")
+			return
+		}
+		if token.Tenant != "" && token.Tenant != tenant.FromContext(c.Request.Context()) {
+			a.reject(c, http.StatusForbidden, value, scope, "token is not allowed for tenant")
+			return
+		}
+		c.Next()
+	}
+}
+
+func (a *Auth) reject(c *gin.Context, status int, token, scope, reason string) {
+	a.l.WarnCtx(c.Request.Context(), "request rejected",
+		zap.String("token", token),
+		zap.String("scope", scope),
+		zap.String("reason", reason),
+		zap.String("method", c.Request.Method),
+		zap.String("path", c.Request.URL.Path),
+		zap.String("client_ip", c.ClientIP()))
+
+	code := apierror.CodeForbidden
+	if status == http.StatusUnauthorized {
+		code = apierror.CodeUnauthorized
+		c.Header("WWW-Authenticate", `Bearer realm="metrics"`)
+	}
+	apierror.Abort(c, status, code, reason)
+}
+
+func hasScope(scopes []string, scope string) bool {
+	for _, s := range scopes {
+		if s == scope || s == ScopeAdmin {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,108 @@
+package validation
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+
+	sf "github.com/sanek1/metrics-collector/internal/flags/server"
+	"github.com/sanek1/metrics-collector/internal/tenant"
+	l "github.com/sanek1/metrics-collector/pkg/logging"
+)
+
+func TestAuth_Require(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	logger, _ := l.NewZapLogger(zap.InfoLevel)
+
+	auth := NewAuth([]sf.APIToken{
+		{Token: "reader-token", Scopes: []string{ScopeRead}},
+		{Token: "writer-token", Scopes: []string{ScopeWrite}},
+		{Token: "admin-token", Scopes: []string{ScopeAdmin}},
+		{Token: "team-token", Scopes: []string{ScopeRead}, Tenant: "team-a"},
+	}, logger)
+
+	router := gin.New()
+	router.Use(TenantMiddleware(auth.TenantTokens()))
+	router.GET("/read", auth.Require(ScopeRead), func(c *gin.Context) {
+		c.String(http.StatusOK, tenant.FromContext(c.Request.Context()))
+	})
+	router.POST("/write", auth.Require(ScopeWrite), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	tests := []struct {
+		name           string
+		method         string
+		path           string
+		headers        map[string]string
+		expectedStatus int
+	}{
+		{name: "no token", method: http.MethodGet, path: "/read", expectedStatus: http.StatusUnauthorized},
+		{name: "unknown token", method: http.MethodGet, path: "/read",
+			headers: map[string]string{"Authorization": "Bearer unknown"}, expectedStatus: http.StatusUnauthorized},
+		{name: "reader reads", method: http.MethodGet, path: "/read",
+			headers: map[string]string{"Authorization": "Bearer reader-token"}, expectedStatus: http.StatusOK},
+		{name: "reader cannot write", method: http.MethodPost, path: "/write",
+			headers: map[string]string{"Authorization": "Bearer reader-token"}, expectedStatus: http.StatusForbidden},
+		{name: "writer cannot read", method: http.MethodGet, path: "/read",
+			headers: map[string]string{"Authorization": "Bearer writer-token"}, expectedStatus: http.StatusForbidden},
+		{name: "writer writes", method: http.MethodPost, path: "/write",
+			headers: map[string]string{"Authorization": "Bearer writer-token"}, expectedStatus: http.StatusOK},
+		{name: "admin reads", method: http.MethodGet, path: "/read",
+			headers: map[string]string{"Authorization": "Bearer admin-token"}, expectedStatus: http.StatusOK},
+		{name: "admin writes", method: http.MethodPost, path: "/write",
+			headers: map[string]string{"Authorization": "bearer admin-token"}, expectedStatus: http.StatusOK},
+		{name: "tenant token in own tenant", method: http.MethodGet, path: "/read",
+			headers: map[string]string{"Authorization": "Bearer team-token"}, expectedStatus: http.StatusOK},
+		{name: "tenant token in other tenant", method: http.MethodGet, path: "/read",
+			headers: map[string]string{"Authorization": "Bearer team-token", tenant.Header: "team-b"}, expectedStatus: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			assert.Equal(t, tt.expectedStatus, w.Code)
+		})
+	}
+
+	t.Run("tenant resolved from token", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/read", nil)
+		req.Header.Set("Authorization", "Bearer team-token")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, "team-a", w.Body.String())
+	})
+
+	t.Run("unauthorized sets challenge header", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/read", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Contains(t, w.Header().Get("WWW-Authenticate"), "Bearer")
+	})
+}
+
+func TestAuth_Disabled(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	logger, _ := l.NewZapLogger(zap.InfoLevel)
+	auth := NewAuth(nil, logger)
+	assert.False(t, auth.Enabled())
+
+	router := gin.New()
+	router.GET("/read", auth.Require(ScopeRead), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/read", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
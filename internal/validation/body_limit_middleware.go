@@ -0,0 +1,38 @@
+package validation
+
+import (
+	"fmt"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/sanek1/metrics-collector/internal/limits"
+)
+
+// BodyLimitMiddleware ограничивает размер тела запроса maxSize байтами.
+// Запросы с заведомо большим Content-Length отклоняются сразу,
+// остальные - при чтении тела. maxSize <= 0 снимает ограничение.
+func BodyLimitMiddleware(maxSize int64) gin.HandlerFunc {
+	limit := &atomic.Int64{}
+	limit.Store(maxSize)
+	return BodyLimit(limit)
+}
+
+// BodyLimit ограничивает размер тела запроса значением limit, которое
+// можно изменить во время работы, например при перечитывании конфигурации.
+func BodyLimit(limit *atomic.Int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		maxSize := limit.Load()
+		if maxSize <= 0 || c.Request.Body == nil || c.Request.Body == http.NoBody {
+			c.Next()
+			return
+		}
+		if c.Request.ContentLength > maxSize {
+			limits.Reject(c, fmt.Errorf("%w: limit %d bytes", limits.ErrBodyTooLarge, maxSize))
+			return
+		}
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxSize)
+		c.Next()
+	}
+}
@@ -1,10 +1,35 @@
 package validation
 
 import (
-	"github.com/gin-contrib/gzip"
+	"net/http"
+
 	"github.com/gin-gonic/gin"
+
+	"github.com/sanek1/metrics-collector/internal/compression"
 )
 
-func GzipMiddleware() gin.HandlerFunc {
-	return gzip.Gzip(gzip.DefaultCompression)
+// CompressionMiddleware сжимает ответы кодировкой, выбранной по заголовку
+// Accept-Encoding запроса (zstd, snappy или gzip), и сообщает клиентам
+// поддерживаемые кодировки тел запросов в заголовке Accept-Encoding ответа.
+func CompressionMiddleware() gin.HandlerFunc {
+	acceptEncoding := compression.AcceptEncoding()
+	return func(c *gin.Context) {
+		c.Header("Accept-Encoding", acceptEncoding)
+		c.Writer.Header().Add("Vary", "Accept-Encoding")
+
+		codec, ok := compression.Get(compression.Negotiate(c.GetHeader("Accept-Encoding")))
+		if !ok || c.Request.Method == http.MethodHead {
+			c.Next()
+			return
+		}
+
+		cw := newCompressWriter(c.Writer, codec)
+		c.Writer = cw
+		defer func() {
+			c.Writer = cw.ResponseWriter
+			_ = cw.Close()
+		}()
+
+		c.Next()
+	}
 }
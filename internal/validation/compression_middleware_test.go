@@ -10,11 +10,13 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	"github.com/sanek1/metrics-collector/internal/compression"
 )
 
-func TestGzipMiddleware(t *testing.T) {
+func TestCompressionMiddleware_Gzip(t *testing.T) {
 	router := gin.New()
-	router.Use(GzipMiddleware())
+	router.Use(CompressionMiddleware())
 
 	router.GET("/test", func(c *gin.Context) {
 		c.String(http.StatusOK, "test response")
@@ -53,9 +55,9 @@ func TestGzipMiddleware(t *testing.T) {
 	})
 }
 
-func TestGzipMiddleware_ContentType(t *testing.T) {
+func TestCompressionMiddleware_ContentType(t *testing.T) {
 	router := gin.New()
-	router.Use(GzipMiddleware())
+	router.Use(CompressionMiddleware())
 
 	router.GET("/json", func(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{"message": "test"})
@@ -70,3 +72,54 @@ func TestGzipMiddleware_ContentType(t *testing.T) {
 	assert.Equal(t, "application/json; charset=utf-8", resp.Header().Get("Content-Type"))
 	assert.Equal(t, "gzip", resp.Header().Get("Content-Encoding"))
 }
+
+func TestCompressionMiddleware_Negotiation(t *testing.T) {
+	router := gin.New()
+	router.Use(CompressionMiddleware())
+	router.GET("/test", func(c *gin.Context) {
+		c.String(http.StatusOK, "test response")
+	})
+	router.GET("/empty", func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+	})
+
+	tests := []struct {
+		name           string
+		acceptEncoding string
+		expected       string
+	}{
+		{name: "zstd preferred", acceptEncoding: "gzip, zstd, snappy", expected: "zstd"},
+		{name: "snappy", acceptEncoding: "snappy", expected: "snappy"},
+		{name: "q values", acceptEncoding: "zstd;q=0.5, gzip;q=0.9", expected: "gzip"},
+		{name: "unsupported", acceptEncoding: "br", expected: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/test", nil)
+			req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			resp := httptest.NewRecorder()
+			router.ServeHTTP(resp, req)
+
+			assert.Equal(t, http.StatusOK, resp.Code)
+			assert.Equal(t, tt.expected, resp.Header().Get("Content-Encoding"))
+			assert.Equal(t, "zstd, snappy, gzip", resp.Header().Get("Accept-Encoding"))
+
+			r, err := compression.NewReader(tt.expected, resp.Body)
+			require.NoError(t, err)
+			body, err := io.ReadAll(r)
+			require.NoError(t, err)
+			assert.Equal(t, "test response", string(body))
+		})
+	}
+
+	t.Run("empty body is not compressed", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/empty", nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+
+		assert.Equal(t, http.StatusNoContent, resp.Code)
+		assert.Empty(t, resp.Header().Get("Content-Encoding"))
+		assert.Zero(t, resp.Body.Len())
+	})
+}
@@ -0,0 +1,21 @@
+package validation
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// NoDeadlines снимает ограничения времени чтения запроса и записи ответа,
+// заданные в http.Server (ReadTimeout и WriteTimeout), для маршрутов с потоковым
+// телом неограниченного размера: иначе долгий импорт прерывается на середине.
+// Если соединение не поддерживает изменение сроков, ограничения остаются.
+func NoDeadlines() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		rc := http.NewResponseController(c.Writer)
+		_ = rc.SetReadDeadline(time.Time{})
+		_ = rc.SetWriteDeadline(time.Time{})
+		c.Next()
+	}
+}
@@ -1,18 +1,52 @@
 package validation
 
 import (
-	"compress/gzip"
+	"io"
 	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/sanek1/metrics-collector/internal/compression"
 )
 
+// compressWriter сжимает тело ответа выбранным кодеком.
+// Поток сжатия создается при первой записи, поэтому ответы без тела не сжимаются.
 type compressWriter struct {
-	w  http.ResponseWriter
-	zw *gzip.Writer
+	gin.ResponseWriter
+	codec compression.Codec
+	zw    io.WriteCloser
 }
 
-func NewCompressWriter(w http.ResponseWriter) *compressWriter {
+func newCompressWriter(w gin.ResponseWriter, codec compression.Codec) *compressWriter {
 	return &compressWriter{
-		w:  w,
-		zw: gzip.NewWriter(w),
+		ResponseWriter: w,
+		codec:          codec,
+	}
+}
+
+func (cw *compressWriter) Write(data []byte) (int, error) {
+	if cw.zw == nil {
+		cw.Header().Set("Content-Encoding", cw.codec.Name())
+		cw.Header().Del("Content-Length")
+		cw.zw = cw.codec.NewWriter(cw.ResponseWriter)
+	}
+	return cw.zw.Write(data)
+}
+
+func (cw *compressWriter) WriteString(s string) (int, error) {
+	return cw.Write([]byte(s))
+}
+
+// Close завершает поток сжатия, если тело ответа было записано.
+func (cw *compressWriter) Close() error {
+	if cw.zw == nil {
+		return nil
 	}
+	return cw.zw.Close()
+}
+
+// Unwrap возвращает исходный ResponseWriter для http.ResponseController,
+// например чтобы изменить сроки чтения и записи соединения.
+func (cw *compressWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
 }
@@ -7,12 +7,24 @@ import (
 	"encoding/hex"
 	"io"
 	"net/http"
+	"os"
+	"sync"
 
 	"github.com/gin-gonic/gin"
+
+	"github.com/sanek1/metrics-collector/internal/apierror"
+	"github.com/sanek1/metrics-collector/internal/limits"
+	"github.com/sanek1/metrics-collector/internal/selfmetrics"
 )
 
+// HashHeader - заголовок с подписью тела запроса или ответа
+const HashHeader = "HashSHA256"
+
 type Secret struct {
+	// mu защищает SecretKey, который меняется при перечитывании конфигурации
+	mu        sync.RWMutex
 	SecretKey string `json:"key"`
+	metrics   *selfmetrics.Collector
 }
 
 func NewHash(key string) *Secret {
@@ -21,34 +33,112 @@ func NewHash(key string) *Secret {
 	}
 }
 
+// SetCollector задает сборщик, в котором учитываются запросы с неверной подписью.
+func (s *Secret) SetCollector(c *selfmetrics.Collector) {
+	s.metrics = c
+}
+
+// SetKey заменяет ключ подписи. Пустой ключ отключает проверку и подпись.
+func (s *Secret) SetKey(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.SecretKey = key
+}
+
+func (s *Secret) key() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.SecretKey
+}
+
+// HashMiddleware проверяет подпись тела запроса, если клиент передал заголовок HashSHA256,
+// и подписывает ответ тем же ключом. Без ключа запрос передается дальше без проверки.
 func (s *Secret) HashMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
+		key := s.key()
+		if key == "" {
+			c.Next()
+			return
+		}
 		body, err := c.GetRawData()
+		if limits.IsTooLarge(err) {
+			limits.Reject(c, err)
+			return
+		}
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{
-				"error": "Unable to read request body",
-			})
-			c.Abort()
+			apierror.Abort(c, http.StatusBadRequest, apierror.CodeBadRequest, "Unable to read request body", err.Error())
+			return
+		}
+		if provided := c.GetHeader(HashHeader); provided != "" && !verifyHash(key, body, provided) {
+			s.metrics.Reject(selfmetrics.ReasonHash)
+			apierror.Abort(c, http.StatusBadRequest, apierror.CodeInvalidHash, "Request hash mismatch")
 			return
 		}
 		c.Request.Body = io.NopCloser(bytes.NewBuffer(body))
-		dataToHash := string(body) + s.SecretKey
+		c.Header(HashHeader, sum(key, body))
+		c.Next()
+	}
+}
+
+// HashStreamMiddleware проверяет подпись так же, как HashMiddleware, на маршрутах
+// с телом неограниченного размера. Тело не буферизуется в памяти, а записывается
+// во временный файл: обработчик начинает читать его только после проверки подписи,
+// поэтому запрос с неверной подписью не применяется даже частично.
+func (s *Secret) HashStreamMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := s.key()
+		if key == "" {
+			c.Next()
+			return
+		}
+		f, err := os.CreateTemp("", "metrics-body-*")
+		if err != nil {
+			apierror.Abort(c, http.StatusInternalServerError, apierror.CodeInternal, "Unable to store request body", err.Error())
+			return
+		}
+		defer func() {
+			_ = f.Close()
+			_ = os.Remove(f.Name())
+		}()
+
 		hash := sha256.New()
-		hash.Write([]byte(dataToHash))
-		hashSum := hash.Sum(nil)
-		hashHex := hex.EncodeToString(hashSum)
-		c.Header("HashSHA256", hashHex)
+		if _, err := io.Copy(io.MultiWriter(f, hash), c.Request.Body); err != nil {
+			apierror.Abort(c, http.StatusBadRequest, apierror.CodeBadRequest, "Unable to read request body", err.Error())
+			return
+		}
+		// подпись вычисляется так же, как в sum: от тела, дополненного ключом
+		hash.Write([]byte(key))
+		signature := hex.EncodeToString(hash.Sum(nil))
+		if provided := c.GetHeader(HashHeader); provided != "" && provided != signature {
+			s.metrics.Reject(selfmetrics.ReasonHash)
+			apierror.Abort(c, http.StatusBadRequest, apierror.CodeInvalidHash, "Request hash mismatch")
+			return
+		}
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			apierror.Abort(c, http.StatusInternalServerError, apierror.CodeInternal, "Unable to read request body", err.Error())
+			return
+		}
+		c.Request.Body = f
+		c.Header(HashHeader, signature)
 		c.Next()
 	}
 }
 
 func (s *Secret) VerifyHash(body []byte, providedHash string) bool {
-	dataToHash := string(body) + s.SecretKey
+	return verifyHash(s.key(), body, providedHash)
+}
+
+func verifyHash(key string, body []byte, providedHash string) bool {
+	return sum(key, body) == providedHash
+}
+
+// sum возвращает подпись тела: SHA-256 от тела, дополненного ключом.
+func sum(key string, body []byte) string {
+	dataToHash := string(body) + key
 
 	hash := sha256.New()
 	hash.Write([]byte(dataToHash))
 	hashSum := hash.Sum(nil)
 
-	hashHex := hex.EncodeToString(hashSum)
-	return hashHex == providedHash
+	return hex.EncodeToString(hashSum)
 }
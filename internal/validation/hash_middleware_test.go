@@ -77,6 +77,30 @@ func Test_HashMiddleware(t *testing.T) {
 		assert.NotEmpty(t, w.Header().Get("HashSHA256"))
 	})
 
+	t.Run("accepts matching request hash", func(t *testing.T) {
+		body := []byte(`{"data":"test"}`)
+		hash := sha256.Sum256([]byte(string(body) + "test-key"))
+
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/test", bytes.NewReader(body))
+		req.Header.Set(HashHeader, hex.EncodeToString(hash[:]))
+
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+
+	t.Run("rejects mismatching request hash", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/test", bytes.NewReader([]byte(`{"data":"test"}`)))
+		req.Header.Set(HashHeader, "invalid-hash")
+
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.JSONEq(t, `{"code":"invalid_hash","message":"Request hash mismatch"}`, w.Body.String())
+	})
+
 	t.Run("handles read error", func(t *testing.T) {
 		w := httptest.NewRecorder()
 		req := httptest.NewRequest("POST", "/test", &errorReader{})
@@ -85,7 +109,70 @@ func Test_HashMiddleware(t *testing.T) {
 		router.ServeHTTP(w, req)
 
 		assert.Equal(t, http.StatusBadRequest, w.Code)
-		assert.JSONEq(t, `{"error":"Unable to read request body"}`, w.Body.String())
+		assert.JSONEq(t, `{"code":"bad_request","message":"Unable to read request body","details":"unexpected EOF"}`, w.Body.String())
+	})
+}
+
+func Test_HashStreamMiddleware(t *testing.T) {
+	var received []byte
+	newRouter := func(key string) *gin.Engine {
+		router := gin.New()
+		router.POST("/import", NewHash(key).HashStreamMiddleware(), func(c *gin.Context) {
+			received, _ = io.ReadAll(c.Request.Body)
+			c.Status(http.StatusOK)
+		})
+		return router
+	}
+	body := bytes.Repeat([]byte(`{"data":"test"}`+"\n"), 1000)
+	hash := sha256.Sum256([]byte(string(body) + "test-key"))
+	signature := hex.EncodeToString(hash[:])
+
+	t.Run("passes body to handler and signs response", func(t *testing.T) {
+		received = nil
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/import", bytes.NewReader(body))
+		req.Header.Set(HashHeader, signature)
+
+		newRouter("test-key").ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, signature, w.Header().Get(HashHeader))
+		assert.Equal(t, body, received)
+	})
+
+	t.Run("rejects mismatching request hash before handler", func(t *testing.T) {
+		received = nil
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/import", bytes.NewReader(body))
+		req.Header.Set(HashHeader, "invalid-hash")
+
+		newRouter("test-key").ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.JSONEq(t, `{"code":"invalid_hash","message":"Request hash mismatch"}`, w.Body.String())
+		assert.Nil(t, received)
+	})
+
+	t.Run("handles read error", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/import", &errorReader{})
+
+		newRouter("test-key").ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.JSONEq(t, `{"code":"bad_request","message":"Unable to read request body","details":"unexpected EOF"}`, w.Body.String())
+	})
+
+	t.Run("no key", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/import", bytes.NewReader(body))
+		req.Header.Set(HashHeader, "invalid-hash")
+
+		newRouter("").ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Empty(t, w.Header().Get(HashHeader))
+		assert.Equal(t, body, received)
 	})
 }
 
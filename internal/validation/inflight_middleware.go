@@ -0,0 +1,16 @@
+package validation
+
+import (
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+)
+
+// InFlight учитывает в counter количество запросов, обрабатываемых в данный момент.
+func InFlight(counter *atomic.Int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		counter.Add(1)
+		defer counter.Add(-1)
+		c.Next()
+	}
+}
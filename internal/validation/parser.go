@@ -1,27 +1,62 @@
 package validation
 
 import (
+	"errors"
+	"net/http"
+
 	"github.com/gin-gonic/gin"
+	"github.com/sanek1/metrics-collector/internal/apierror"
+	"github.com/sanek1/metrics-collector/internal/compression"
 	"github.com/sanek1/metrics-collector/internal/handlers"
+	"github.com/sanek1/metrics-collector/internal/limits"
+	"github.com/sanek1/metrics-collector/internal/selfmetrics"
 )
 
 type Parser struct {
 	services *handlers.Services
+	metrics  *selfmetrics.Collector
 }
 
 func NewParser(s *handlers.Services) *Parser {
 	return &Parser{services: s}
 }
 
+// SetCollector задает сборщик, в котором учитываются отклоненные запросы.
+func (p *Parser) SetCollector(c *selfmetrics.Collector) {
+	p.metrics = c
+}
+
 func (p *Parser) HandleMetrics() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		metrics, err := p.services.ParseMetricsServices(c)
+		if limits.IsTooLarge(err) {
+			limits.Reject(c, err)
+			return
+		}
+		if err != nil {
+			p.metrics.Reject(rejectReason(err))
+		}
+		if errors.Is(err, compression.ErrUnsupported) {
+			apierror.Abort(c, http.StatusUnsupportedMediaType, apierror.CodeUnsupportedMediaType, "unsupported content encoding", err.Error())
+			return
+		}
 		if err != nil {
-			c.JSON(400, gin.H{"error": err.Error()})
-			c.Abort()
+			apierror.Abort(c, http.StatusBadRequest, apierror.CodeInvalidMetric, "unable to parse metrics", err.Error())
 			return
 		}
 		c.Set("metrics", metrics)
 		c.Next()
 	}
 }
+
+// rejectReason возвращает причину отклонения запроса для собственных метрик сервера.
+func rejectReason(err error) string {
+	switch {
+	case errors.Is(err, handlers.ErrDecrypt):
+		return selfmetrics.ReasonDecrypt
+	case errors.Is(err, handlers.ErrDecompress):
+		return selfmetrics.ReasonDecompress
+	default:
+		return selfmetrics.ReasonParse
+	}
+}
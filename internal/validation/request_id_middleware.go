@@ -0,0 +1,31 @@
+package validation
+
+import (
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/sanek1/metrics-collector/internal/requestid"
+	l "github.com/sanek1/metrics-collector/pkg/logging"
+)
+
+// RequestID назначает запросу идентификатор и добавляет его в поля журнала контекста.
+// Идентификатор берется из заголовка X-Request-ID, если клиент передал корректное
+// значение, иначе генерируется новый. Он возвращается клиенту в том же заголовке.
+// Корректный идентификатор агента из X-Agent-ID также добавляется в поля журнала.
+func RequestID(logger *l.ZapLogger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(requestid.Header)
+		if requestid.Validate(id) != nil {
+			id = requestid.New()
+		}
+		c.Header(requestid.Header, id)
+
+		fields := []zap.Field{zap.String("request_id", id)}
+		if agent := c.GetHeader(requestid.AgentHeader); requestid.Validate(agent) == nil {
+			fields = append(fields, zap.String("agent_id", agent))
+		}
+		ctx := requestid.WithID(c.Request.Context(), id)
+		c.Request = c.Request.WithContext(logger.WithContextFields(ctx, fields...))
+		c.Next()
+	}
+}
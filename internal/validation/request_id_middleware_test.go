@@ -0,0 +1,81 @@
+package validation
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/sanek1/metrics-collector/internal/requestid"
+	l "github.com/sanek1/metrics-collector/pkg/logging"
+)
+
+func TestRequestID(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	logger := l.NewFromZap(zap.NewNop())
+
+	var (
+		ctxID  string
+		fields l.ZapFields
+	)
+	router := gin.New()
+	router.Use(RequestID(logger))
+	router.GET("/id", func(c *gin.Context) {
+		ctxID = requestid.FromContext(c.Request.Context())
+		fields, _ = c.Request.Context().Value(l.FieldKey("zapFields")).(l.ZapFields)
+		c.Status(http.StatusOK)
+	})
+
+	tests := []struct {
+		name      string
+		headers   map[string]string
+		keepID    bool
+		wantAgent string
+	}{
+		{
+			name: "generated id",
+		},
+		{
+			name:      "propagated id and agent",
+			headers:   map[string]string{requestid.Header: "req-42", requestid.AgentHeader: "host-1"},
+			keepID:    true,
+			wantAgent: "host-1",
+		},
+		{
+			name:    "invalid id and agent are replaced and dropped",
+			headers: map[string]string{requestid.Header: "bad id\n", requestid.AgentHeader: "bad agent"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/id", nil)
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			resp := httptest.NewRecorder()
+			router.ServeHTTP(resp, req)
+
+			id := resp.Header().Get(requestid.Header)
+			require.NoError(t, requestid.Validate(id))
+			if tt.keepID {
+				assert.Equal(t, tt.headers[requestid.Header], id)
+			} else {
+				assert.Len(t, id, 32)
+			}
+			assert.Equal(t, id, ctxID)
+			require.Contains(t, fields, "request_id")
+			assert.Equal(t, id, fields["request_id"].String)
+			if tt.wantAgent != "" {
+				require.Contains(t, fields, "agent_id")
+				assert.Equal(t, tt.wantAgent, fields["agent_id"].String)
+			} else {
+				assert.NotContains(t, fields, "agent_id")
+			}
+		})
+	}
+}
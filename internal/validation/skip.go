@@ -0,0 +1,19 @@
+package validation
+
+import "github.com/gin-gonic/gin"
+
+// SkipRoutes применяет middleware ко всем маршрутам, кроме перечисленных.
+// Маршруты задаются шаблонами, как при регистрации (c.FullPath()).
+func SkipRoutes(middleware gin.HandlerFunc, routes ...string) gin.HandlerFunc {
+	skip := make(map[string]struct{}, len(routes))
+	for _, route := range routes {
+		skip[route] = struct{}{}
+	}
+	return func(c *gin.Context) {
+		if _, ok := skip[c.FullPath()]; ok {
+			c.Next()
+			return
+		}
+		middleware(c)
+	}
+}
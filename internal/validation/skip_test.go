@@ -0,0 +1,29 @@
+package validation
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSkipRoutes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(SkipRoutes(func(c *gin.Context) {
+		c.AbortWithStatus(http.StatusTeapot)
+	}, "/skip/:id"))
+	r.GET("/skip/:id", func(c *gin.Context) { c.Status(http.StatusOK) })
+	r.GET("/other", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	for path, want := range map[string]int{
+		"/skip/1": http.StatusOK,
+		"/other":  http.StatusTeapot,
+	} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		assert.Equal(t, want, w.Code, path)
+	}
+}
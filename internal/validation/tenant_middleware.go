@@ -0,0 +1,49 @@
+package validation
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/sanek1/metrics-collector/internal/apierror"
+	"github.com/sanek1/metrics-collector/internal/tenant"
+)
+
+// TenantMiddleware определяет арендатора запроса и сохраняет его в контексте.
+// Если bearer-токен соответствует арендатору, используется этот арендатор,
+// а заголовок X-Scope-OrgID с другим арендатором отклоняется с кодом 403.
+// Без такого токена арендатор берется из заголовка X-Scope-OrgID.
+// Иначе используется арендатор по умолчанию.
+func TenantMiddleware(tokens map[string]string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(tenant.Header)
+		if bound := tokens[bearerToken(c.GetHeader("Authorization"))]; bound != "" {
+			if id != "" && id != bound {
+				apierror.Abort(c, http.StatusForbidden, apierror.CodeForbidden,
+					"tenant does not match token", "token is bound to another tenant")
+				return
+			}
+			id = bound
+		}
+		if id == "" {
+			id = tenant.Default
+		}
+
+		if err := tenant.Validate(id); err != nil {
+			apierror.Abort(c, http.StatusBadRequest, apierror.CodeBadRequest, "invalid tenant", err.Error())
+			return
+		}
+
+		c.Request = c.Request.WithContext(tenant.WithTenant(c.Request.Context(), id))
+		c.Next()
+	}
+}
+
+func bearerToken(header string) string {
+	const prefix = "Bearer "
+	if len(header) <= len(prefix) || !strings.EqualFold(header[:len(prefix)], prefix) {
+		return ""
+	}
+	return strings.TrimSpace(header[len(prefix):])
+}
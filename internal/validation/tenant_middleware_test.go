@@ -0,0 +1,90 @@
+package validation
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/sanek1/metrics-collector/internal/tenant"
+)
+
+func TestTenantMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(TenantMiddleware(map[string]string{"secret-token": "team-b"}))
+	router.GET("/tenant", func(c *gin.Context) {
+		c.String(http.StatusOK, tenant.FromContext(c.Request.Context()))
+	})
+
+	tests := []struct {
+		name           string
+		headers        map[string]string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:           "default tenant",
+			expectedStatus: http.StatusOK,
+			expectedBody:   tenant.Default,
+		},
+		{
+			name:           "tenant from header",
+			headers:        map[string]string{tenant.Header: "team-a"},
+			expectedStatus: http.StatusOK,
+			expectedBody:   "team-a",
+		},
+		{
+			name:           "tenant from token",
+			headers:        map[string]string{"Authorization": "Bearer secret-token"},
+			expectedStatus: http.StatusOK,
+			expectedBody:   "team-b",
+		},
+		{
+			name:           "header matches token",
+			headers:        map[string]string{"Authorization": "Bearer secret-token", tenant.Header: "team-b"},
+			expectedStatus: http.StatusOK,
+			expectedBody:   "team-b",
+		},
+		{
+			name:           "header overrides token tenant",
+			headers:        map[string]string{"Authorization": "Bearer secret-token", tenant.Header: "team-a"},
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "unknown token with header",
+			headers:        map[string]string{"Authorization": "Bearer other", tenant.Header: "team-a"},
+			expectedStatus: http.StatusOK,
+			expectedBody:   "team-a",
+		},
+		{
+			name:           "unknown token",
+			headers:        map[string]string{"Authorization": "Bearer other"},
+			expectedStatus: http.StatusOK,
+			expectedBody:   tenant.Default,
+		},
+		{
+			name:           "invalid tenant",
+			headers:        map[string]string{tenant.Header: "team/a"},
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/tenant", nil)
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.expectedBody != "" {
+				assert.Equal(t, tt.expectedBody, w.Body.String())
+			}
+		})
+	}
+}
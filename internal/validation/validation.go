@@ -1,11 +1,13 @@
 package validation
 
 import (
+	"io"
 	"net/http"
 
 	"go.uber.org/zap"
 
 	"github.com/gin-gonic/gin"
+	"github.com/sanek1/metrics-collector/internal/apierror"
 	"github.com/sanek1/metrics-collector/internal/handlers"
 	l "github.com/sanek1/metrics-collector/pkg/logging"
 )
@@ -29,9 +31,18 @@ func (mc *MiddlewareController) Recover(next http.Handler) gin.HandlerFunc {
 		defer func() {
 			if rec := recover(); rec != nil {
 				mc.l.PanicCtx(c.Request.Context(), "recovered from panic", zap.Any("panic", rec))
-				http.Error(c.Writer, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				apierror.Write(c.Writer, http.StatusInternalServerError, apierror.CodeInternal, http.StatusText(http.StatusInternalServerError))
 			}
 		}()
 		next.ServeHTTP(c.Writer, c.Request)
 	}
 }
+
+// Recovery перехватывает панику обработчика, записывает ее в журнал
+// с полями контекста запроса и отвечает 500 с единым телом ошибки.
+func Recovery(logger *l.ZapLogger) gin.HandlerFunc {
+	return gin.CustomRecoveryWithWriter(io.Discard, func(c *gin.Context, rec any) {
+		logger.ErrorCtx(c.Request.Context(), "Recovered from panic", zap.Any("panic", rec), zap.Stack("stack"))
+		apierror.Abort(c, http.StatusInternalServerError, apierror.CodeInternal, http.StatusText(http.StatusInternalServerError))
+	})
+}
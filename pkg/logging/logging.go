@@ -32,6 +32,8 @@ func (zf ZapFields) Append(fields ...zap.Field) ZapFields {
 type ZapLogger struct {
 	logger *zap.Logger
 	level  zap.AtomicLevel
+	// unsampled - журнал без сэмплирования с общим уровнем, см. Unsampled
+	unsampled *ZapLogger
 }
 
 // NewZapLogger returns a new ZapLogger configured with the provided options.
@@ -44,12 +46,39 @@ func NewZapLogger(level zapcore.Level) (*ZapLogger, error) {
 		return nil, err
 	}
 
+	settings.config.Sampling = nil
+	u, err := settings.config.Build(settings.opts...)
+	if err != nil {
+		return nil, err
+	}
+
 	return &ZapLogger{
-		logger: l,
-		level:  atomic,
+		logger:    l,
+		level:     atomic,
+		unsampled: &ZapLogger{logger: u, level: atomic},
 	}, nil
 }
 
+// NewFromZap оборачивает готовый *zap.Logger, например журнал
+// из go.uber.org/zap/zaptest/observer в тестах.
+func NewFromZap(logger *zap.Logger) *ZapLogger {
+	return &ZapLogger{
+		logger: logger,
+		level:  zap.NewAtomicLevel(),
+	}
+}
+
+// Unsampled возвращает журнал с тем же уровнем, но без сэмплирования.
+// Он нужен для записей с одинаковым сообщением, каждая из которых важна,
+// например журнала доступа: сэмплирование отбросило бы их часть под нагрузкой.
+// Если журнал создан через NewFromZap, возвращается он сам.
+func (z *ZapLogger) Unsampled() *ZapLogger {
+	if z.unsampled != nil {
+		return z.unsampled
+	}
+	return z
+}
+
 func (z *ZapLogger) WithContextFields(ctx context.Context, fields ...zap.Field) context.Context {
 	ctxFields, _ := ctx.Value(zapFieldsKey).(ZapFields)
 	if ctxFields == nil {
@@ -65,6 +94,10 @@ func (z *ZapLogger) maskField(f zap.Field) zap.Field {
 		return zap.String(f.Key, "******")
 	}
 
+	if f.Key == "token" {
+		return zap.String(f.Key, maskToken(f.String))
+	}
+
 	if f.Key == "email" {
 		email := f.String
 		parts := strings.Split(email, "@")
@@ -75,22 +108,26 @@ func (z *ZapLogger) maskField(f zap.Field) zap.Field {
 	return f
 }
 
+// maskToken оставляет видимыми только первые символы токена.
+func maskToken(token string) string {
+	const visible = 4
+	if len(token) <= visible*2 {
+		return "******"
+	}
+	return token[:visible] + "******"
+}
+
 func (z *ZapLogger) Sync() {
 	_ = z.logger.Sync()
 }
 
 func (z *ZapLogger) withCtxFields(ctx context.Context, fields ...zap.Field) []zap.Field {
-	ctxFields, ok := ctx.Value(zapFieldsKey).(ZapFields)
-	if ok {
-		ctxFields.Append(fields...)
-	} else {
-		ctxFields = make(ZapFields)
-		ctxFields.Append(fields...)
-	}
+	ctxFields, _ := ctx.Value(zapFieldsKey).(ZapFields)
+	merged := ctxFields.Append(fields...)
 
-	maskedFields := make([]zap.Field, 0, len(fields))
+	maskedFields := make([]zap.Field, 0, len(merged))
 
-	for _, f := range ctxFields {
+	for _, f := range merged {
 		maskedFields = append(maskedFields, z.maskField(f))
 	}
 
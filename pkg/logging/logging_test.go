@@ -139,3 +139,41 @@ func TestSetLevel(t *testing.T) {
 	assert.Equal(t, zap.ErrorLevel, entries[0].Level)
 	assert.Equal(t, "error message", entries[0].Message)
 }
+
+func TestMaskedFields(t *testing.T) {
+	core, recorded := observer.New(zap.InfoLevel)
+	logger := &ZapLogger{
+		logger: zap.New(core),
+		level:  zap.NewAtomicLevelAt(zap.InfoLevel),
+	}
+
+	ctx := logger.WithContextFields(context.Background(), zap.String("app", "test"))
+	logger.WarnCtx(ctx, "request rejected",
+		zap.String("token", "0123456789abcdef"),
+		zap.String("short", "value"),
+		zap.String("password", "secret"))
+
+	entries := recorded.TakeAll()
+	require.Len(t, entries, 1)
+	fields := entries[0].ContextMap()
+	assert.Equal(t, "test", fields["app"])
+	assert.Equal(t, "value", fields["short"])
+	assert.Equal(t, "0123******", fields["token"])
+	assert.Equal(t, "******", fields["password"])
+}
+
+func TestUnsampled(t *testing.T) {
+	logger, err := NewZapLogger(zap.InfoLevel)
+	require.NoError(t, err)
+
+	u := logger.Unsampled()
+	require.NotNil(t, u)
+	assert.NotSame(t, logger, u)
+	assert.Same(t, u, u.Unsampled())
+
+	logger.SetLevel(zap.ErrorLevel)
+	assert.Equal(t, zap.ErrorLevel, u.level.Level(), "unsampled logger should share the level")
+
+	wrapped := NewFromZap(zap.NewNop())
+	assert.Same(t, wrapped, wrapped.Unsampled())
+}